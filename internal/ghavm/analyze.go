@@ -0,0 +1,106 @@
+package ghavm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// Analysis is the result of analyzing a single workflow's content with
+// [Engine.AnalyzeContent].
+type Analysis struct {
+	// Workflow holds the workflow's steps, with their current versions and
+	// upgrade candidates resolved where possible.
+	Workflow Workflow
+	// Plan describes the change the mode would make to each resolved step
+	// that would change.
+	Plan Plan
+	// Content is the workflow content with every change applied.
+	Content []byte
+}
+
+// AnalyzeContent resolves the action steps in the given workflow content and
+// proposes rewrites for them according to the given mode, without reading or
+// writing any files. The path only identifies the workflow in the results,
+// so it need not exist (e.g. an unsaved file in an editor).
+//
+// The engine's own workflows are left untouched, so a single engine may
+// analyze many pieces of content.
+func (e *Engine) AnalyzeContent(ctx context.Context, path string, content []byte, mode PinMode) (Analysis, error) {
+	w, err := scanContent(path, bytes.NewReader(content), scanOpts{})
+	if err != nil {
+		return Analysis{}, err
+	}
+
+	// each analysis gets its own phase logger, so that concurrent analyses
+	// do not trip over each other's phases
+	sub := *e
+	sub.root = Root{Workflows: map[string]Workflow{path: w}}
+	sub.phaseLog = e.phaseLog.fork()
+	if err := sub.resolveSteps(ctx, mode); err != nil {
+		return Analysis{}, fmt.Errorf("failed to resolve commit refs: %w", err)
+	}
+	w = sub.root.Workflows[path]
+
+	strategy := rewriteStrategyForMode(mode)
+	rewritten, _, _, err := rewriteContent(ctx, w, content, strategy, nil, sub.shortHashLength)
+	if err != nil {
+		return Analysis{}, err
+	}
+	return Analysis{
+		Workflow: w,
+		Plan:     buildPlan(sub.root, strategy, sub.shortHashLength),
+		Content:  rewritten,
+	}, nil
+}
+
+// analysisJSON is the JSON representation of an [Analysis].
+type analysisJSON struct {
+	Workflow string          `json:"workflow"`
+	Steps    []analyzedStep  `json:"steps"`
+	Changes  []PlannedChange `json:"changes"`
+	Content  string          `json:"content"`
+}
+
+// analyzedStep is the JSON representation of a single resolved step in an
+// [Analysis].
+type analyzedStep struct {
+	Line                    int    `json:"line"`
+	Action                  string `json:"action"`
+	Ref                     string `json:"ref"`
+	CurrentVersion          string `json:"current_version"`
+	CurrentCommit           string `json:"current_commit"`
+	LatestVersion           string `json:"latest_version"`
+	LatestCommit            string `json:"latest_commit"`
+	LatestCompatibleVersion string `json:"latest_compatible_version"`
+	LatestCompatibleCommit  string `json:"latest_compatible_commit"`
+}
+
+// writeAnalysisJSON writes the analysis to dst as JSON.
+func writeAnalysisJSON(dst io.Writer, a Analysis) error {
+	out := analysisJSON{
+		Workflow: a.Workflow.FilePath,
+		Steps:    make([]analyzedStep, 0, len(a.Workflow.Steps)),
+		Changes:  a.Plan.Changes,
+		Content:  string(a.Content),
+	}
+	if out.Changes == nil {
+		out.Changes = []PlannedChange{}
+	}
+	for _, step := range a.Workflow.Steps {
+		candidates := step.Action.UpgradeCandidates
+		out.Steps = append(out.Steps, analyzedStep{
+			Line:                    step.LineNumber,
+			Action:                  step.Action.Name,
+			Ref:                     step.Action.Ref,
+			CurrentVersion:          step.Action.Release.Version,
+			CurrentCommit:           step.Action.Release.CommitHash,
+			LatestVersion:           candidates.Latest.Version,
+			LatestCommit:            candidates.Latest.CommitHash,
+			LatestCompatibleVersion: candidates.LatestCompatible.Version,
+			LatestCompatibleCommit:  candidates.LatestCompatible.CommitHash,
+		})
+	}
+	return writeJSON(dst, out)
+}
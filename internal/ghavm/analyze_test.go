@@ -0,0 +1,108 @@
+package ghavm
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestAnalyzeContent(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	client := newTestClient(t, map[string]httpResponse{
+		// version tags
+		"2590b2f6ce": okResponse(`{
+			"data": {
+				"repository": {
+					"refs": {
+						"nodes": [
+							{"name": "v1.1.0", "target": {"oid": "` + commitB + `"}},
+							{"name": "v1.0.0", "target": {"oid": "` + commitA + `"}}
+						],
+						"pageInfo": {"hasNextPage": false, "endCursor": ""}
+					}
+				}
+			}
+		}`),
+		// releases
+		"6104c8d776": okResponse(`{
+			"data": {
+				"repository": {
+					"releases": {
+						"pageInfo": {"hasNextPage": false, "endCursor": ""},
+						"nodes": [
+							{"tag": {"target": {"oid": "` + commitB + `"}}, "tagName": "v1.1.0"},
+							{"tag": {"target": {"oid": "` + commitA + `"}}, "tagName": "v1.0.0"}
+						]
+					}
+				}
+			}
+		}`),
+	}, nil)
+
+	const path = "virtual/.github/workflows/ci.yaml"
+	content := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@" + commitA + " # v1.0.0",
+		"  - run: echo hi",
+		"",
+	}, "\n")
+
+	engine := newEngine(Root{}, client, io.Discard, engineOpts{TrustHashes: true})
+	analysis, err := engine.AnalyzeContent(testCtx(), path, []byte(content), ModeCompat)
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(analysis.Workflow.Steps), 1, "incorrect number of steps")
+	step := analysis.Workflow.Steps[0]
+	assert.Equal(t, step.Action.Release, Release{Version: "v1.0.0", CommitHash: commitA}, "incorrect current release")
+	assert.Equal(t, step.Action.UpgradeCandidates.LatestCompatible, Release{Version: "v1.1.0", CommitHash: commitB}, "incorrect compat candidate")
+
+	assert.DeepEqual(t, analysis.Plan, Plan{Changes: []PlannedChange{{
+		Workflow:        path,
+		Line:            2,
+		Action:          "owner/repo",
+		CurrentRef:      commitA,
+		CurrentVersion:  "v1.0.0",
+		CurrentCommit:   commitA,
+		ProposedVersion: "v1.1.0",
+		ProposedCommit:  commitB,
+		Change:          ChangeMinor,
+	}}}, "incorrect plan")
+	assert.Equal(t, string(analysis.Content), strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@" + commitB + " # v1.1.0",
+		"  - run: echo hi",
+		"",
+	}, "\n"), "incorrect rewritten content")
+
+	// nothing is written to disk, and the engine's own workflows are
+	// untouched
+	_, err = os.Stat(path)
+	assert.Equal(t, os.IsNotExist(err), true, "virtual path should not be created")
+	assert.Equal(t, engine.root.WorkflowCount(), 0, "engine root should be unchanged")
+
+	// each analysis logs its own phases, so one engine may run many at once
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := engine.AnalyzeContent(testCtx(), path, []byte(content), ModeCompat)
+			assert.NilError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	var buf strings.Builder
+	assert.NilError(t, writeAnalysisJSON(&buf, analysis))
+	assert.Contains(t, buf.String(), `"latest_compatible_version": "v1.1.0"`, "analysis JSON")
+	assert.Contains(t, buf.String(), `"proposed_commit": "`+commitB+`"`, "analysis JSON")
+}
@@ -2,37 +2,310 @@ package ghavm
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/mccutchen/ghavm/internal/slogctx"
 )
 
+// Volatility classifies how likely a cached value is to change, which
+// determines how long it may safely be cached (see [Volatility.TTL]).
+type Volatility int
+
+// Volatilities, from most to least likely to change.
+const (
+	// Volatile values may change at any time, e.g. the commit a branch
+	// points to. As the zero value, it is assumed for unclassified values.
+	Volatile Volatility = iota
+	// Mutable values change occasionally, e.g. a repo's tags and releases.
+	Mutable
+	// Immutable values never change, e.g. the details of a specific commit.
+	Immutable
+)
+
+// TTLs for cached values of each volatility.
+const (
+	volatileTTL = 5 * time.Minute
+	mutableTTL  = time.Hour
+)
+
+// TTL returns how long a value of this volatility may be cached, or false if
+// it may be cached forever.
+func (v Volatility) TTL() (time.Duration, bool) {
+	switch v {
+	case Immutable:
+		return 0, false
+	case Mutable:
+		return mutableTTL, true
+	default:
+		return volatileTTL, true
+	}
+}
+
+func (v Volatility) String() string {
+	switch v {
+	case Immutable:
+		return "immutable"
+	case Mutable:
+		return "mutable"
+	default:
+		return "volatile"
+	}
+}
+
 type entry[V any] struct {
-	val V
-	err error
+	ready      chan struct{}
+	val        V
+	err        error
+	volatility Volatility
+	// evicted is set once the entry is removed from the cache, so that a
+	// value computed after its removal is still passed to onEvict
+	evicted bool
+	// expires is when the computed value must be computed again, according
+	// to its volatility, or zero if it never expires
+	expires time.Time
+}
+
+// expired returns true if the entry's value has been computed and has
+// expired as of now.
+func (e *entry[V]) expired(now time.Time) bool {
+	select {
+	case <-e.ready:
+		return !e.expires.IsZero() && now.After(e.expires)
+	default:
+		return false
+	}
 }
 
 // Cache is a dumb map-based concurrency-safe in-memory cache, useful for
 // short-lived processes.
+//
+// Concurrent calls for the same key are deduplicated, so that only one of
+// them calls its thunk while the others wait for its result, but calls for
+// different keys do not block each other.
+//
+// Each cached value carries a [Volatility], which is the cache's default
+// volatility unless classified individually via [Cache.DoClassified]. Values
+// expire once their volatility's TTL has passed, after which the next call
+// computes them again.
 type Cache[K comparable, V any] struct {
-	mu    sync.Mutex
-	cache map[K]entry[V]
+	mu         sync.Mutex
+	cache      map[K]*entry[V]
+	volatility Volatility
+	// onEvict, if set, is called once with each successfully computed value
+	// removed from the cache, e.g. to stop background work it owns
+	onEvict func(V)
+	// now, if set, returns the current time, e.g. for tests
+	now func() time.Time
 }
 
-// Do caches the result of calling thunk.
+// newCache creates a [Cache] whose values have the given volatility by
+// default. The zero value of [Cache] is also ready to use, treating its values
+// as [Volatile].
+func newCache[K comparable, V any](volatility Volatility) *Cache[K, V] {
+	return &Cache[K, V]{volatility: volatility}
+}
+
+// Do caches the result of calling thunk, with the cache's default volatility.
 func (c *Cache[K, V]) Do(ctx context.Context, key K, thunk func() (V, error)) (V, error) {
+	return c.DoClassified(ctx, key, func() (V, Volatility, error) {
+		val, err := thunk()
+		return val, c.volatility, err
+	})
+}
+
+// DoClassified caches the result of calling thunk, which also classifies the
+// volatility of the value it returns, e.g. because a ref may turn out to be
+// either an immutable commit hash or a volatile branch.
+//
+// An expired value is evicted and computed again.
+func (c *Cache[K, V]) DoClassified(ctx context.Context, key K, thunk func() (V, Volatility, error)) (V, error) {
+	var (
+		expiredVal V
+		expired    bool
+	)
 	c.mu.Lock()
-	defer c.mu.Unlock()
 	if c.cache == nil {
-		c.cache = make(map[K]entry[V])
+		c.cache = make(map[K]*entry[V])
+	}
+	e, found := c.cache[key]
+	if found && e.expired(c.clock()) {
+		slogctx.Debug(ctx, "cache: expired", slog.Any("key", key))
+		expiredVal, expired = c.evictLocked(key, e)
+		found = false
+	}
+	if !found {
+		e = &entry[V]{ready: make(chan struct{})}
+		c.cache[key] = e
+	}
+	c.mu.Unlock()
+	if expired && c.onEvict != nil {
+		c.onEvict(expiredVal)
 	}
-	if entry, found := c.cache[key]; found {
+
+	if found {
 		slogctx.Debug(ctx, "cache: hit", slog.Any("key", key))
-		return entry.val, entry.err
+		select {
+		case <-e.ready:
+			return e.val, e.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
 	}
 	slogctx.Debug(ctx, "cache: miss", slog.Any("key", key))
-	val, err := thunk()
-	c.cache[key] = entry[V]{val, err}
-	return val, err
+	completed := false
+	defer func() {
+		// waiters must never block forever, even if thunk panics, and the
+		// next call must try again
+		if !completed {
+			e.err = fmt.Errorf("cache: computing value for %v panicked", key)
+		}
+		c.finish(key, e, completed)
+	}()
+	e.val, e.volatility, e.err = thunk()
+	if ttl, ok := e.volatility.TTL(); ok {
+		e.expires = c.clock().Add(ttl)
+	}
+	completed = true
+	slogctx.Debug(ctx, "cache: stored", slog.Any("key", key), slog.String("volatility", e.volatility.String()))
+	return e.val, e.err
+}
+
+// clock returns the current time, according to c.now if set.
+func (c *Cache[K, V]) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// finish marks the entry for key as ready, removing it from the cache if its
+// thunk did not complete and passing its value to c.onEvict if it was
+// evicted while being computed.
+func (c *Cache[K, V]) finish(key K, e *entry[V], completed bool) {
+	c.mu.Lock()
+	close(e.ready)
+	if !completed && c.cache[key] == e {
+		delete(c.cache, key)
+		e.evicted = true
+	}
+	evicted := e.evicted && completed && e.err == nil
+	c.mu.Unlock()
+	if evicted && c.onEvict != nil {
+		c.onEvict(e.val)
+	}
+}
+
+// evictLocked removes the entry for key, returning its value for c.onEvict
+// if it has already been successfully computed. Values still being computed
+// are passed to c.onEvict by [Cache.finish] instead. c.mu must be held.
+func (c *Cache[K, V]) evictLocked(key K, e *entry[V]) (V, bool) {
+	delete(c.cache, key)
+	e.evicted = true
+	select {
+	case <-e.ready:
+		return e.val, e.err == nil
+	default:
+		var zero V
+		return zero, false
+	}
+}
+
+// evictAll removes every entry that keep does not want kept, passing their
+// computed values to c.onEvict.
+func (c *Cache[K, V]) evictAll(keep func(*entry[V]) bool) {
+	var evicted []V
+	c.mu.Lock()
+	for key, e := range c.cache {
+		if keep(e) {
+			continue
+		}
+		if val, ok := c.evictLocked(key, e); ok {
+			evicted = append(evicted, val)
+		}
+	}
+	c.mu.Unlock()
+	if c.onEvict != nil {
+		for _, val := range evicted {
+			c.onEvict(val)
+		}
+	}
+}
+
+// Peek returns the cached value for key if it has already been successfully
+// computed, without waiting for any call in progress.
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	e, found := c.cache[key]
+	c.mu.Unlock()
+	if found {
+		select {
+		case <-e.ready:
+			if e.err == nil {
+				return e.val, true
+			}
+		default:
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Volatility returns the volatility of the cached value for key if it has
+// already been successfully computed.
+func (c *Cache[K, V]) Volatility(key K) (Volatility, bool) {
+	c.mu.Lock()
+	e, found := c.cache[key]
+	c.mu.Unlock()
+	if found {
+		select {
+		case <-e.ready:
+			if e.err == nil {
+				return e.volatility, true
+			}
+		default:
+		}
+	}
+	return Volatile, false
+}
+
+// Forget removes any cached value for key, so that the next call to Do
+// computes it again.
+func (c *Cache[K, V]) Forget(key K) {
+	c.mu.Lock()
+	e, found := c.cache[key]
+	var (
+		val     V
+		evicted bool
+	)
+	if found {
+		val, evicted = c.evictLocked(key, e)
+	}
+	c.mu.Unlock()
+	if evicted && c.onEvict != nil {
+		c.onEvict(val)
+	}
+}
+
+// Clear removes every cached value, so that subsequent calls to Do compute
+// them again.
+func (c *Cache[K, V]) Clear() {
+	c.evictAll(func(*entry[V]) bool { return false })
+}
+
+// ClearMutable removes every cached value that is not [Immutable], along with
+// any failed or in-progress calls, so that subsequent calls to Do compute
+// them again.
+func (c *Cache[K, V]) ClearMutable() {
+	c.evictAll(func(e *entry[V]) bool {
+		select {
+		case <-e.ready:
+			return e.err == nil && e.volatility == Immutable
+		default:
+			return false
+		}
+	})
 }
@@ -0,0 +1,219 @@
+package ghavm
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("concurrent calls for the same key are deduplicated", func(t *testing.T) {
+		t.Parallel()
+		var (
+			cache   Cache[string, int]
+			calls   atomic.Int64
+			release = make(chan struct{})
+			wg      sync.WaitGroup
+		)
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				val, err := cache.Do(testCtx(), "key", func() (int, error) {
+					calls.Add(1)
+					<-release
+					return 42, nil
+				})
+				assert.NilError(t, err)
+				assert.Equal(t, val, 42, "incorrect value")
+			}()
+		}
+		close(release)
+		wg.Wait()
+		assert.Equal(t, calls.Load(), int64(1), "thunk should be called once")
+	})
+
+	t.Run("different keys do not block each other", func(t *testing.T) {
+		t.Parallel()
+		var cache Cache[string, int]
+		blocked := make(chan struct{})
+		t.Cleanup(func() { close(blocked) })
+		go func() {
+			_, _ = cache.Do(testCtx(), "slow", func() (int, error) {
+				<-blocked
+				return 0, nil
+			})
+		}()
+		val, err := cache.Do(testCtx(), "fast", func() (int, error) { return 1, nil })
+		assert.NilError(t, err)
+		assert.Equal(t, val, 1, "incorrect value")
+	})
+
+	t.Run("peek and forget", func(t *testing.T) {
+		t.Parallel()
+		var cache Cache[string, int]
+		_, ok := cache.Peek("key")
+		assert.Equal(t, ok, false, "expected no value before Do")
+
+		_, _ = cache.Do(testCtx(), "key", func() (int, error) { return 1, nil })
+		val, ok := cache.Peek("key")
+		assert.Equal(t, ok, true, "expected cached value")
+		assert.Equal(t, val, 1, "incorrect value")
+
+		_, _ = cache.Do(testCtx(), "err", func() (int, error) { return 0, errors.New("boom") })
+		_, ok = cache.Peek("err")
+		assert.Equal(t, ok, false, "errors should not be peeked")
+
+		cache.Forget("key")
+		_, ok = cache.Peek("key")
+		assert.Equal(t, ok, false, "expected no value after Forget")
+		val, _ = cache.Do(testCtx(), "key", func() (int, error) { return 2, nil })
+		assert.Equal(t, val, 2, "expected value to be recomputed")
+	})
+	t.Run("volatility", func(t *testing.T) {
+		t.Parallel()
+		cache := newCache[string, int](Mutable)
+		_, _ = cache.Do(testCtx(), "default", func() (int, error) { return 1, nil })
+		_, _ = cache.DoClassified(testCtx(), "commit", func() (int, Volatility, error) { return 2, Immutable, nil })
+		_, _ = cache.DoClassified(testCtx(), "branch", func() (int, Volatility, error) { return 3, Volatile, nil })
+		_, _ = cache.DoClassified(testCtx(), "err", func() (int, Volatility, error) { return 0, Immutable, errors.New("boom") })
+
+		for key, want := range map[string]Volatility{"default": Mutable, "commit": Immutable, "branch": Volatile} {
+			got, ok := cache.Volatility(key)
+			assert.Equal(t, ok, true, "expected cached value for %s", key)
+			assert.Equal(t, got, want, "incorrect volatility for %s", key)
+		}
+		_, ok := cache.Volatility("err")
+		assert.Equal(t, ok, false, "errors should not be classified")
+
+		// only immutable values survive clearing mutable values
+		cache.ClearMutable()
+		for key, want := range map[string]bool{"default": false, "commit": true, "branch": false, "err": false} {
+			_, ok := cache.Peek(key)
+			assert.Equal(t, ok, want, "incorrect cached state for %s", key)
+		}
+	})
+
+	t.Run("panicking thunk does not block waiters", func(t *testing.T) {
+		t.Parallel()
+		var (
+			cache   Cache[string, int]
+			started = make(chan struct{})
+			release = make(chan struct{})
+		)
+		go func() {
+			defer func() { _ = recover() }()
+			_, _ = cache.Do(testCtx(), "key", func() (int, error) {
+				close(started)
+				<-release
+				panic("boom")
+			})
+		}()
+		<-started
+		time.AfterFunc(10*time.Millisecond, func() { close(release) })
+		_, err := cache.Do(testCtx(), "key", func() (int, error) { return 1, nil })
+		assert.Error(t, err, errors.New("cache: computing value for key panicked"))
+		val, err := cache.Do(testCtx(), "key", func() (int, error) { return 2, nil })
+		assert.NilError(t, err)
+		assert.Equal(t, val, 2, "expected value to be recomputed after panic")
+	})
+
+	t.Run("evicted values are passed to onEvict", func(t *testing.T) {
+		t.Parallel()
+		var (
+			mu      sync.Mutex
+			evicted []int
+		)
+		cache := newCache[string, int](Mutable)
+		cache.onEvict = func(val int) {
+			mu.Lock()
+			evicted = append(evicted, val)
+			mu.Unlock()
+		}
+		_, _ = cache.Do(testCtx(), "forgotten", func() (int, error) { return 1, nil })
+		_, _ = cache.DoClassified(testCtx(), "immutable", func() (int, Volatility, error) { return 2, Immutable, nil })
+		_, _ = cache.Do(testCtx(), "mutable", func() (int, error) { return 3, nil })
+		_, _ = cache.Do(testCtx(), "err", func() (int, error) { return 4, errors.New("boom") })
+
+		cache.Forget("forgotten")
+		cache.Forget("missing")
+		cache.ClearMutable()
+		assert.DeepEqual(t, evicted, []int{1, 3}, "incorrect evicted values")
+
+		// a value still being computed is passed on once it is ready
+		release := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = cache.Do(testCtx(), "slow", func() (int, error) {
+				<-release
+				return 5, nil
+			})
+		}()
+		for {
+			cache.mu.Lock()
+			_, found := cache.cache["slow"]
+			cache.mu.Unlock()
+			if found {
+				break
+			}
+			runtime.Gosched()
+		}
+		cache.Clear()
+		close(release)
+		<-done
+		assert.DeepEqual(t, evicted, []int{1, 3, 2, 5}, "incorrect evicted values")
+	})
+
+	t.Run("values expire according to their volatility", func(t *testing.T) {
+		t.Parallel()
+		var (
+			now     = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			evicted []int
+		)
+		cache := newCache[string, int](Mutable)
+		cache.now = func() time.Time { return now }
+		cache.onEvict = func(val int) { evicted = append(evicted, val) }
+		calls := map[string]int{}
+		get := func(key string, volatility Volatility) int {
+			val, err := cache.DoClassified(testCtx(), key, func() (int, Volatility, error) {
+				calls[key]++
+				return calls[key], volatility, nil
+			})
+			assert.NilError(t, err)
+			return val
+		}
+		get("volatile", Volatile)
+		get("mutable", Mutable)
+		get("immutable", Immutable)
+
+		now = now.Add(volatileTTL + time.Second)
+		assert.Equal(t, get("volatile", Volatile), 2, "volatile value should be recomputed")
+		assert.Equal(t, get("mutable", Mutable), 1, "mutable value should still be cached")
+
+		now = now.Add(mutableTTL)
+		assert.Equal(t, get("mutable", Mutable), 2, "mutable value should be recomputed")
+		assert.Equal(t, get("immutable", Immutable), 1, "immutable value should never expire")
+		assert.DeepEqual(t, evicted, []int{1, 1}, "expired values should be evicted")
+	})
+}
+
+func TestVolatilityTTL(t *testing.T) {
+	t.Parallel()
+
+	ttl, expires := Volatile.TTL()
+	assert.Equal(t, ttl, volatileTTL, "incorrect volatile ttl")
+	assert.Equal(t, expires, true, "volatile values should expire")
+	ttl, expires = Mutable.TTL()
+	assert.Equal(t, ttl, mutableTTL, "incorrect mutable ttl")
+	assert.Equal(t, expires, true, "mutable values should expire")
+	_, expires = Immutable.TTL()
+	assert.Equal(t, expires, false, "immutable values should never expire")
+}
@@ -0,0 +1,93 @@
+package ghavm
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runGit runs git with the given args in dir, returning its stdout.
+func runGit(dir string, args ...string) (string, error) {
+	// #nosec G204 -- args are built by ghavm, and refs are validated by git
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// validateGitRef returns an error unless ref names a commit in the git repo
+// containing dir.
+func validateGitRef(dir, ref string) error {
+	if !inGitRepo(dir) {
+		return fmt.Errorf("%s is not in a git repo", dir)
+	}
+	if _, err := runGit(dir, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}"); err != nil {
+		return fmt.Errorf("unknown git ref %q", ref)
+	}
+	return nil
+}
+
+// contentAtRef returns the content of the file at path as of the given git
+// ref, or false if the file did not exist at that ref.
+func contentAtRef(path, ref string) (string, bool, error) {
+	dir, name := filepath.Dir(path), "./"+filepath.Base(path)
+	if _, err := runGit(dir, "cat-file", "-e", ref+":"+name); err != nil {
+		return "", false, nil
+	}
+	content, err := runGit(dir, "show", ref+":"+name)
+	if err != nil {
+		return "", false, err
+	}
+	return content, true, nil
+}
+
+// onlyChangedSince limits the workflow's steps to those whose uses: values
+// were added or changed since the given git ref. A workflow that did not
+// exist at the ref is entirely new, so all of its steps are kept.
+func onlyChangedSince(workflow Workflow, ref string, opts scanOpts) (Workflow, error) {
+	content, ok, err := contentAtRef(workflow.FilePath, ref)
+	if err != nil {
+		return Workflow{}, fmt.Errorf("scanner: failed to read %s at %s: %w", workflow.FilePath, ref, err)
+	}
+	if !ok {
+		return workflow, nil
+	}
+	opts.ChangedSince = ""
+	base, err := scanContent(workflow.FilePath, strings.NewReader(content), opts)
+	if err != nil {
+		return Workflow{}, err
+	}
+	workflow.Steps = changedSteps(base.Steps, workflow.Steps)
+	return workflow, nil
+}
+
+// changedSteps returns the steps whose action and ref are not found among the
+// base steps. Steps are matched by value rather than by line number, so that
+// unrelated edits which move steps around do not mark them as changed, and
+// each base step matches at most one step, so that a copy of an existing step
+// is still considered new.
+func changedSteps(base, steps []Step) []Step {
+	unchanged := make(map[string]int, len(base))
+	for _, step := range base {
+		unchanged[dependencyKey(step.Action.Name, step.Action.Ref)]++
+	}
+	var changed []Step
+	for _, step := range steps {
+		key := dependencyKey(step.Action.Name, step.Action.Ref)
+		if unchanged[key] > 0 {
+			unchanged[key]--
+			continue
+		}
+		changed = append(changed, step)
+	}
+	return changed
+}
@@ -0,0 +1,73 @@
+package ghavm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestOnlyChangedSince(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %s\n%s", args[0], err, out)
+		}
+	}
+	write := func(name, content string) string {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		assert.NilError(t, os.WriteFile(p, []byte(content), 0o600))
+		return p
+	}
+
+	git("init", "--quiet", "--initial-branch=main")
+	existing := write("existing.yaml", `steps:
+  - uses: actions/checkout@v4
+  - uses: actions/setup-go@v5
+  - uses: actions/cache@v4
+`)
+	git("add", ".")
+	git("commit", "--quiet", "--message", "initial")
+
+	// one step upgraded, one step moved, and one step copied
+	write("existing.yaml", `steps:
+  - uses: actions/setup-go@v5
+  - run: make test
+  - uses: actions/checkout@v4
+  - uses: actions/cache@v5
+  - uses: actions/checkout@v4
+`)
+	added := write("added.yaml", `steps:
+  - uses: actions/checkout@v4
+`)
+
+	root, err := ScanWorkflows([]string{existing, added}, scanOpts{ChangedSince: "HEAD"})
+	assert.NilError(t, err)
+
+	var got []string
+	for _, step := range root.Workflows[existing].Steps {
+		got = append(got, step.Action.Name+"@"+step.Action.Ref)
+	}
+	assert.DeepEqual(t, got, []string{"actions/cache@v5", "actions/checkout@v4"}, "changed steps in existing workflow")
+	assert.Equal(t, root.Workflows[existing].Steps[1].LineNumber, 5, "copied step line number")
+	assert.Equal(t, len(root.Workflows[added].Steps), 1, "steps in added workflow")
+
+	assert.NilError(t, validateGitRef(dir, "HEAD"))
+	err = validateGitRef(dir, "no-such-ref")
+	assert.Equal(t, err.Error(), `unknown git ref "no-such-ref"`, "error for unknown ref")
+}
@@ -0,0 +1,110 @@
+package ghavm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// changelogLevels are the change levels summarized in a changelog, in the
+// order their sections appear.
+var changelogLevels = []ChangeLevel{ChangeMajor, ChangeMinor, ChangePatch, ChangeUnknown}
+
+// changelogEntry is a single action bumped from one release to another,
+// along with every workflow location where the bump was made.
+type changelogEntry struct {
+	change    PlannedChange
+	locations []string
+}
+
+// compareURL returns the URL of the GitHub page comparing the current and
+// proposed releases of the change, by version if both are known and by
+// commit otherwise.
+func compareURL(c PlannedChange) string {
+	base, head := c.CurrentVersion, c.ProposedVersion
+	if base == "" || head == "" {
+		base, head = c.CurrentCommit, c.ProposedCommit
+	}
+	return "https://github.com/" + Action{Name: c.Action}.Repo() + "/compare/" + base + "..." + head
+}
+
+// writeChangelog writes a markdown changelog of the given changes to dst,
+// suitable for use as a pull request description, with a section for each
+// level of change. Identical changes made in several places are listed once,
+// with all of their locations, which are shown via workflowName. Changes
+// that leave a step on the same commit are omitted.
+func writeChangelog(dst io.Writer, changes []PlannedChange, workflowName func(string) string) {
+	var (
+		entries = make(map[ChangeLevel][]*changelogEntry, len(changelogLevels))
+		seen    = make(map[string]*changelogEntry, len(changes))
+	)
+	for _, c := range changes {
+		if c.Change == ChangeNone {
+			continue
+		}
+		location := fmt.Sprintf("%s:%d", workflowName(c.Workflow), c.Line)
+		key := canonicalName(c.Action) + "@" + c.CurrentCommit + "..." + c.ProposedCommit
+		if entry, ok := seen[key]; ok {
+			entry.locations = append(entry.locations, location)
+			continue
+		}
+		entry := &changelogEntry{change: c, locations: []string{location}}
+		seen[key] = entry
+		entries[c.Change] = append(entries[c.Change], entry)
+	}
+
+	fprintln(dst, "## Action upgrades")
+	if len(seen) == 0 {
+		fprintln(dst)
+		fprintln(dst, "No actions were upgraded.")
+		return
+	}
+	for _, level := range changelogLevels {
+		if len(entries[level]) == 0 {
+			continue
+		}
+		fprintln(dst)
+		fprintf(dst, "### %s%s\n", strings.ToUpper(string(level[:1])), level[1:])
+		fprintln(dst)
+		for _, entry := range entries[level] {
+			c := entry.change
+			current := Release{Version: c.CurrentVersion, CommitHash: c.CurrentCommit}
+			proposed := Release{Version: c.ProposedVersion, CommitHash: c.ProposedCommit}
+			links := []string{fmt.Sprintf("[compare](%s)", compareURL(c))}
+			if isValidVersion(c.ProposedVersion) {
+				links = append(links, fmt.Sprintf("[release notes](https://github.com/%s/releases/tag/%s)", Action{Name: c.Action}.Repo(), c.ProposedVersion))
+			}
+			fprintf(dst, "- `%s` %s → %s (%s)\n", c.Action, changelogVersion(current), changelogVersion(proposed), strings.Join(links, ", "))
+			for _, location := range entry.locations {
+				fprintf(dst, "  - `%s`\n", location)
+			}
+		}
+	}
+}
+
+// changelogVersion describes a release in a changelog by its version, or by
+// its short commit hash if it has no version.
+func changelogVersion(r Release) string {
+	if r.Version != "" {
+		return r.Version
+	}
+	if len(r.CommitHash) > minShortHashLength {
+		return "`" + r.CommitHash[:minShortHashLength] + "`"
+	}
+	return "`" + r.CommitHash + "`"
+}
+
+// writeChangelogFile writes a markdown changelog of the given changes to the
+// engine's changelog file, if any.
+func (e *Engine) writeChangelogFile(changes []PlannedChange) error {
+	if e.changelogFile == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	writeChangelog(&buf, changes, e.workflowName)
+	if err := writeFile(e.changelogFile, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write changelog: %w", err)
+	}
+	return nil
+}
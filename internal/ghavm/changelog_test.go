@@ -0,0 +1,82 @@
+package ghavm
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestWriteChangelog(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+		commitC = "cccccccccccccccccccccccccccccccccccccccc"
+		commitD = "dddddddddddddddddddddddddddddddddddddddd"
+	)
+	testCases := map[string]struct {
+		changes []PlannedChange
+		want    string
+	}{
+		"no changes": {
+			changes: nil,
+			want: `## Action upgrades
+
+No actions were upgraded.
+`,
+		},
+		"grouped by change level": {
+			changes: []PlannedChange{
+				{Workflow: "ci.yaml", Line: 3, Action: "actions/setup-go", CurrentVersion: "v5.4.0", CurrentCommit: commitA, ProposedVersion: "v5.4.1", ProposedCommit: commitB, Change: ChangePatch},
+				{Workflow: "ci.yaml", Line: 5, Action: "actions/checkout", CurrentVersion: "v3.5.0", CurrentCommit: commitA, ProposedVersion: "v4.2.2", ProposedCommit: commitB, Change: ChangeMajor},
+				{Workflow: "release.yaml", Line: 9, Action: "Actions/Checkout", CurrentVersion: "v3.5.0", CurrentCommit: commitA, ProposedVersion: "v4.2.2", ProposedCommit: commitB, Change: ChangeMajor},
+				{Workflow: "ci.yaml", Line: 7, Action: "owner/repo/sub", CurrentCommit: commitC, ProposedCommit: commitD, Change: ChangeUnknown},
+				{Workflow: "ci.yaml", Line: 11, Action: "owner/pinned", CurrentVersion: "v1.0.0", CurrentCommit: commitA, ProposedVersion: "v1.0.0", ProposedCommit: commitA, Change: ChangeNone},
+			},
+			want: "## Action upgrades\n" +
+				"\n" +
+				"### Major\n" +
+				"\n" +
+				"- `actions/checkout` v3.5.0 → v4.2.2 ([compare](https://github.com/actions/checkout/compare/v3.5.0...v4.2.2), [release notes](https://github.com/actions/checkout/releases/tag/v4.2.2))\n" +
+				"  - `ci.yaml:5`\n" +
+				"  - `release.yaml:9`\n" +
+				"\n" +
+				"### Patch\n" +
+				"\n" +
+				"- `actions/setup-go` v5.4.0 → v5.4.1 ([compare](https://github.com/actions/setup-go/compare/v5.4.0...v5.4.1), [release notes](https://github.com/actions/setup-go/releases/tag/v5.4.1))\n" +
+				"  - `ci.yaml:3`\n" +
+				"\n" +
+				"### Unknown\n" +
+				"\n" +
+				"- `owner/repo/sub` `ccccccc` → `ddddddd` ([compare](https://github.com/owner/repo/compare/" + commitC + "..." + commitD + "))\n" +
+				"  - `ci.yaml:7`\n",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var buf strings.Builder
+			writeChangelog(&buf, tc.changes, filepath.Base)
+			if buf.String() != tc.want {
+				t.Fatalf("incorrect changelog:\n\n%s", diffStrings(t, tc.want, buf.String()))
+			}
+		})
+	}
+}
+
+func TestWriteChangelogFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "upgrades.md")
+	engine := newEngine(Root{}, nil, io.Discard, engineOpts{ChangelogFile: path})
+	assert.NilError(t, engine.writeChangelogFile(nil))
+
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	assert.Contains(t, string(got), "No actions were upgraded.", "changelog")
+}
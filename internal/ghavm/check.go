@@ -0,0 +1,468 @@
+package ghavm
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/mccutchen/ghavm/internal/slogctx"
+)
+
+// checkOpts configures which checks [Engine.Check] runs.
+type checkOpts struct {
+	// DeprecatedRuntimes flags actions whose action.yml targets a Node
+	// runtime deprecated by GitHub.
+	DeprecatedRuntimes bool
+	// FloatingMajors flags actions referenced by a floating major version
+	// tag (e.g. v4) when a newer major version exists or when the tag lags
+	// behind the newest release in its major version.
+	FloatingMajors bool
+	// AllowedOwners, if given, flags actions published by any other owner.
+	AllowedOwners []string
+	// StaleComments flags actions whose version comments do not match the
+	// commits they are pinned to, e.g. because the action on the line was
+	// changed by hand without updating its comment.
+	StaleComments bool
+	// ConsistentPinning flags actions left floating on a tag or branch in
+	// some steps while pinned to a commit hash in others, which usually
+	// indicates an incomplete pinning effort.
+	ConsistentPinning bool
+	// Unpinned flags actions that are not pinned to a full commit hash,
+	// except for refs sanctioned to float by the config.
+	Unpinned bool
+}
+
+// empty returns true if no checks are enabled.
+func (o checkOpts) empty() bool {
+	return !o.DeprecatedRuntimes && !o.FloatingMajors && len(o.AllowedOwners) == 0 && !o.StaleComments && !o.ConsistentPinning && !o.Unpinned
+}
+
+// FindingPriority ranks findings by how urgently they need attention.
+type FindingPriority int
+
+// Finding priorities, from most to least urgent.
+const (
+	PriorityHigh FindingPriority = iota
+	PriorityMedium
+	PriorityLow
+)
+
+func (p FindingPriority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityMedium:
+		return "medium"
+	case PriorityLow:
+		return "low"
+	default:
+		return fmt.Sprintf("FindingPriority(%d)", int(p))
+	}
+}
+
+// Finding records a problem identified by a check for a specific step.
+type Finding struct {
+	Check    string
+	Priority FindingPriority
+	Workflow string
+	Step     Step
+	Msg      string
+}
+
+// deprecatedRuntimes maps each Node runtime GitHub has deprecated for actions
+// to a short explanation.
+var deprecatedRuntimes = map[string]string{
+	"node12": "node12 was removed from GitHub-hosted runners in 2023",
+	"node16": "node16 was removed from GitHub-hosted runners in 2024",
+	"node20": "node20 is deprecated and will be removed from GitHub-hosted runners",
+}
+
+var errNoChecks = errors.New("at least one check must be enabled")
+
+// Check resolves each step's current version and runs the checks enabled in
+// opts against it, writing any findings to dst in the engine's output format.
+func (e *Engine) Check(ctx context.Context, dst io.Writer, opts checkOpts) ([]Finding, error) {
+	if opts.empty() {
+		return nil, errNoChecks
+	}
+	// checking owners or pins doesn't require resolving versions, and
+	// upgrade candidates are only needed to check floating major versions
+	if opts.DeprecatedRuntimes || opts.FloatingMajors || opts.StaleComments {
+		mode := ModeCurrent
+		if opts.FloatingMajors {
+			mode = ModeLatest
+		}
+		if err := e.resolveSteps(ctx, mode); err != nil {
+			return nil, fmt.Errorf("failed to resolve commit refs: %w", err)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		findings []Finding
+	)
+	addFinding := func(f Finding) {
+		mu.Lock()
+		defer mu.Unlock()
+		findings = append(findings, f)
+	}
+
+	if opts.DeprecatedRuntimes {
+		e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseRuntimes, e.root.StepCount()))
+		err := e.forEachStep(ctx, func(ctx context.Context, workflow Workflow, step *Step) error {
+			msg, err := e.checkDeprecatedRuntime(ctx, workflow, step)
+			if err != nil {
+				return err
+			}
+			if msg != "" {
+				addFinding(Finding{
+					Check:    "deprecated-runtime",
+					Priority: PriorityHigh,
+					Workflow: workflow.FilePath,
+					Step:     *step,
+					Msg:      msg,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check action runtimes: %w", err)
+		}
+		e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+		e.phaseLog.ShowDiagnostics()
+	}
+
+	if opts.StaleComments {
+		e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseComments, e.root.StepCount()))
+		err := e.forEachStep(ctx, func(ctx context.Context, workflow Workflow, step *Step) error {
+			f, found, err := e.checkStaleComment(ctx, workflow, step)
+			if err != nil {
+				return err
+			}
+			if found {
+				f.Workflow = workflow.FilePath
+				addFinding(f)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check version comments: %w", err)
+		}
+		e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+		e.phaseLog.ShowDiagnostics()
+	}
+
+	if opts.FloatingMajors {
+		for _, workflow := range e.root.Workflows {
+			for _, step := range workflow.Steps {
+				for _, f := range checkFloatingMajor(step) {
+					f.Workflow = workflow.FilePath
+					addFinding(f)
+				}
+			}
+		}
+	}
+
+	if len(opts.AllowedOwners) > 0 {
+		for _, workflow := range e.root.Workflows {
+			for _, step := range workflow.Steps {
+				if f, found := checkAllowedOwner(step, opts.AllowedOwners); found {
+					f.Workflow = workflow.FilePath
+					addFinding(f)
+				}
+			}
+		}
+	}
+
+	if opts.ConsistentPinning {
+		for _, f := range e.checkConsistentPinning() {
+			addFinding(f)
+		}
+	}
+
+	if opts.Unpinned {
+		for _, workflow := range e.root.Workflows {
+			for _, step := range workflow.Steps {
+				if f, found := e.checkUnpinned(step); found {
+					f.Workflow = workflow.FilePath
+					addFinding(f)
+				}
+			}
+		}
+	}
+
+	sortFindings(findings)
+	if e.output == outputJUnit {
+		return findings, writeJUnit(dst, "ghavm check", e.root, findings)
+	}
+	e.renderFindings(dst, findings)
+	return findings, nil
+}
+
+// checkAllowedOwner reports a step whose action is published by an owner
+// that is not in the allowlist. Owners are compared case-insensitively, as
+// they are on GitHub.
+func checkAllowedOwner(step Step, allowed []string) (Finding, bool) {
+	owner := step.Action.Owner()
+	for _, a := range allowed {
+		if strings.EqualFold(owner, a) {
+			return Finding{}, false
+		}
+	}
+	return Finding{
+		Check:    "allowed-owners",
+		Priority: PriorityHigh,
+		Step:     step,
+		Msg:      fmt.Sprintf("owner %s is not an allowed owner", owner),
+	}, true
+}
+
+// checkUnpinned reports a step whose action is not pinned to a full commit
+// hash, unless its ref is sanctioned to float by the config.
+func (e *Engine) checkUnpinned(step Step) (Finding, bool) {
+	if isFullCommitHash(step.Action.Ref) || e.config.sanctions(step.Action) {
+		return Finding{}, false
+	}
+	return Finding{
+		Check:    "unpinned",
+		Priority: PriorityMedium,
+		Step:     step,
+		Msg:      fmt.Sprintf("floats on %s instead of being pinned to a commit hash", step.Action.Ref),
+	}, true
+}
+
+// maxPinnedLocations limits how many of the steps pinning an action are
+// listed in each consistent-pinning finding.
+const maxPinnedLocations = 3
+
+// checkConsistentPinning groups steps across every workflow by action repo,
+// and reports each step left floating on a tag or branch when other steps
+// pin the same repo to a commit hash, listing where it is pinned. Steps whose
+// refs are sanctioned to float by the config are not reported.
+func (e *Engine) checkConsistentPinning() []Finding {
+	type location struct {
+		workflow string
+		step     Step
+	}
+	var (
+		pinned   = make(map[string][]location)
+		floating = make(map[string][]location)
+	)
+	for _, key := range slices.Sorted(maps.Keys(e.root.Workflows)) {
+		w := e.root.Workflows[key]
+		for _, step := range w.Steps {
+			repo := canonicalName(step.Action.Repo())
+			if isFullCommitHash(step.Action.Ref) {
+				pinned[repo] = append(pinned[repo], location{w.FilePath, step})
+			} else if !e.config.sanctions(step.Action) {
+				floating[repo] = append(floating[repo], location{w.FilePath, step})
+			}
+		}
+	}
+
+	var findings []Finding
+	for _, repo := range slices.Sorted(maps.Keys(floating)) {
+		locs := pinned[repo]
+		if len(locs) == 0 {
+			continue
+		}
+		var where []string
+		for _, loc := range locs[:min(len(locs), maxPinnedLocations)] {
+			where = append(where, fmt.Sprintf("%s:%d", e.workflowName(loc.workflow), loc.step.LineNumber+1))
+		}
+		if n := len(locs) - maxPinnedLocations; n > 0 {
+			where = append(where, fmt.Sprintf("and %d more", n))
+		}
+		for _, loc := range floating[repo] {
+			findings = append(findings, Finding{
+				Check:    "consistent-pinning",
+				Priority: PriorityMedium,
+				Workflow: loc.workflow,
+				Step:     loc.step,
+				Msg:      fmt.Sprintf("floats on %s, but %s is pinned to a commit hash at %s", loc.step.Action.Ref, loc.step.Action.Repo(), strings.Join(where, ", ")),
+			})
+		}
+	}
+	return findings
+}
+
+// isFloatingMajor returns true if the given ref is a floating major version
+// tag like v4.
+func isFloatingMajor(ref string) bool {
+	return semver.IsValid(ref) && semver.Major(ref) == ref
+}
+
+// checkFloatingMajor reports whether a step referencing a floating major
+// version tag should migrate to a newer major version and whether the tag
+// itself is stale relative to the newest release in its major version.
+//
+// The step must have been resolved with upgrade candidates.
+func checkFloatingMajor(step Step) []Finding {
+	var (
+		ref        = step.Action.Ref
+		current    = step.Action.Release
+		candidates = step.Action.UpgradeCandidates
+		findings   []Finding
+	)
+	if !isFloatingMajor(ref) || !current.Exists() {
+		return nil
+	}
+	if latest := candidates.Latest; compareVersions(majorVersion(latest.Version), ref) > 0 {
+		findings = append(findings, Finding{
+			Check:    "floating-major",
+			Priority: PriorityMedium,
+			Step:     step,
+			Msg:      fmt.Sprintf("newer major version %s is available (latest release %s)", majorVersion(latest.Version), latest.Version),
+		})
+	}
+	if compat := candidates.LatestCompatible; compat.Exists() && compat.CommitHash != current.CommitHash && compareVersions(current.Version, compat.Version) < 0 {
+		findings = append(findings, Finding{
+			Check:    "floating-major",
+			Priority: PriorityLow,
+			Step:     step,
+			Msg:      fmt.Sprintf("floating tag %s points to %s, but the newest %s release is %s", ref, cmp.Or(current.Version, current.CommitHash), ref, compat.Version),
+		})
+	}
+	return findings
+}
+
+// checkStaleComment reports a step whose version comment does not match the
+// commit its ref resolves to. A comment naming a tag that does not exist in
+// the action's repo at all most likely belongs to a different action (e.g.
+// after the repo in `uses:` was changed by hand), so it is reported with a
+// higher priority than one that merely lags behind its ref.
+//
+// The step must have been resolved.
+func (e *Engine) checkStaleComment(ctx context.Context, workflow Workflow, step *Step) (Finding, bool, error) {
+	comment, current := step.Comment, step.Action.Release
+	if !isValidVersion(comment) || !current.Exists() || slices.Contains(step.Action.VersionTags, comment) {
+		return Finding{}, false, nil
+	}
+	e.phaseLog.Info(workflow, step, "resolving commit hash for version comment %s", comment)
+	commit, err := e.gh.GetCommitHashForRef(ctx, step.Action.Repo(), comment)
+	if err != nil {
+		if !isRefNotFound(err) {
+			return Finding{}, false, fmt.Errorf("failed to resolve version comment %s: %w", comment, err)
+		}
+		slogctx.Debug(ctx, "check: version comment not found", "action", step.Action.Name, "comment", comment, "error", err)
+		return Finding{
+			Check:    "stale-comment",
+			Priority: PriorityHigh,
+			Step:     *step,
+			Msg:      fmt.Sprintf("version comment %s is not a tag in %s, it may belong to a different action", comment, step.Action.Repo()),
+		}, true, nil
+	}
+	if commit == current.CommitHash {
+		return Finding{}, false, nil
+	}
+	return Finding{
+		Check:    "stale-comment",
+		Priority: PriorityLow,
+		Step:     *step,
+		Msg:      fmt.Sprintf("version comment %s points to %s, not %s", comment, commit, cmp.Or(current.Version, current.CommitHash)),
+	}, true, nil
+}
+
+// isRefNotFound returns true if the error from resolving a ref means that
+// the ref does not exist, as opposed to e.g. a network or server error.
+func isRefNotFound(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+	return strings.Contains(err.Error(), "failed to resolve reference")
+}
+
+// checkDeprecatedRuntime returns a non-empty message if the step's action
+// targets a deprecated Node runtime.
+func (e *Engine) checkDeprecatedRuntime(ctx context.Context, workflow Workflow, step *Step) (string, error) {
+	// reusable workflows don't have runtimes, and we can't check actions
+	// whose current version could not be resolved
+	if step.Action.IsReusableWorkflow() || !step.Action.Release.Exists() {
+		return "", nil
+	}
+	e.phaseLog.Info(workflow, step, "fetching action metadata for commit %s", step.Action.Release.CommitHash)
+	content, err := e.gh.GetActionMetadataFile(ctx, step.Action, step.Action.Release.CommitHash)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch action metadata: %w", err)
+	}
+	runtime := parseActionRuntime(content)
+	if reason, deprecated := deprecatedRuntimes[runtime]; deprecated {
+		return fmt.Sprintf("uses deprecated runtime %s (%s)", runtime, reason), nil
+	}
+	return "", nil
+}
+
+// parseActionRuntime extracts the `runs.using` value from the contents of an
+// action.yml metadata file, returning an empty string if not found.
+func parseActionRuntime(content string) string {
+	inRuns := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		// a non-indented line starts a new top-level key
+		if line[0] != ' ' && line[0] != '\t' {
+			inRuns = strings.HasPrefix(trimmed, "runs:")
+			continue
+		}
+		if !inRuns {
+			continue
+		}
+		if value, found := strings.CutPrefix(trimmed, "using:"); found {
+			value, _, _ = strings.Cut(value, "#")
+			return strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	return ""
+}
+
+// sortFindings sorts findings by priority, then by workflow path, and then by
+// line number.
+func sortFindings(findings []Finding) {
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return cmp.Or(
+			cmp.Compare(a.Priority, b.Priority),
+			cmp.Compare(a.Workflow, b.Workflow),
+			cmp.Compare(a.Step.LineNumber, b.Step.LineNumber),
+		)
+	})
+}
+
+// renderFindings writes a human-readable report of the given findings,
+// grouped by priority and then by workflow, to dst.
+func (e *Engine) renderFindings(dst io.Writer, findings []Finding) {
+	if len(findings) == 0 {
+		fprintln(dst, e.style.Green("✓ no problems found"))
+		return
+	}
+	var (
+		lastPriority = FindingPriority(-1)
+		lastWorkflow = ""
+	)
+	for i, f := range findings {
+		if f.Priority != lastPriority {
+			if i > 0 {
+				fprintln(dst)
+			}
+			fprintln(dst, e.style.Boldf("%s priority", f.Priority))
+			lastPriority = f.Priority
+			lastWorkflow = ""
+		}
+		if f.Workflow != lastWorkflow {
+			fprintln(dst, "  workflow", e.style.Bold(e.workflowName(f.Workflow)))
+			lastWorkflow = f.Workflow
+		}
+		fprintf(dst, "    line %d: %s → %s\n", f.Step.LineNumber+1, e.style.Boldf("%s@%s", f.Step.Action.Name, f.Step.Action.Ref), e.style.Yellow(f.Msg))
+	}
+}
@@ -0,0 +1,357 @@
+package ghavm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestParseActionRuntime(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		content string
+		want    string
+	}{
+		"javascript action": {
+			content: `name: checkout
+description: checkout a repo
+runs:
+  using: node20
+  main: dist/index.js
+`,
+			want: "node20",
+		},
+		"quoted with trailing comment": {
+			content: `runs:
+  using: 'node16' # TODO: upgrade
+  main: index.js
+`,
+			want: "node16",
+		},
+		"comments and blank lines within runs": {
+			content: `runs:
+  # the runtime
+
+  using: "node12"
+`,
+			want: "node12",
+		},
+		"composite action": {
+			content: `runs:
+  using: composite
+  steps:
+    - uses: actions/checkout@v4
+`,
+			want: "composite",
+		},
+		"using outside of runs is ignored": {
+			content: `inputs:
+  using:
+    description: not a runtime
+runs:
+  using: docker
+`,
+			want: "docker",
+		},
+		"missing runs": {
+			content: "name: broken\n",
+			want:    "",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, parseActionRuntime(tc.content), tc.want, "incorrect runtime")
+		})
+	}
+}
+
+func TestSortFindings(t *testing.T) {
+	t.Parallel()
+	findings := []Finding{
+		{Workflow: "b.yaml", Step: Step{LineNumber: 1}},
+		{Workflow: "a.yaml", Step: Step{LineNumber: 10}},
+		{Workflow: "c.yaml", Step: Step{LineNumber: 4}, Priority: PriorityLow},
+		{Workflow: "a.yaml", Step: Step{LineNumber: 2}},
+		{Workflow: "a.yaml", Step: Step{LineNumber: 3}, Priority: PriorityMedium},
+	}
+	sortFindings(findings)
+	got := make([]string, 0, len(findings))
+	for _, f := range findings {
+		got = append(got, fmt.Sprintf("%s:%d", f.Workflow, f.Step.LineNumber))
+	}
+	assert.DeepEqual(t, got, []string{"a.yaml:2", "a.yaml:10", "b.yaml:1", "a.yaml:3", "c.yaml:4"}, "incorrect order")
+}
+
+func TestCheckFloatingMajor(t *testing.T) {
+	t.Parallel()
+
+	var (
+		v3   = Release{Version: "v3.5.0", CommitHash: "commit-v3.5.0"}
+		v4_1 = Release{Version: "v4.1.0", CommitHash: "commit-v4.1.0"}
+		v4_2 = Release{Version: "v4.2.3", CommitHash: "commit-v4.2.3"}
+		v5   = Release{Version: "v5.0.1", CommitHash: "commit-v5.0.1"}
+	)
+
+	testCases := map[string]struct {
+		action Action
+		want   []string
+	}{
+		"up to date": {
+			action: Action{Ref: "v4", Release: v4_2, UpgradeCandidates: UpgradeCandidates{Latest: v4_2, LatestCompatible: v4_2}},
+			want:   nil,
+		},
+		"newer major available": {
+			action: Action{Ref: "v4", Release: v4_2, UpgradeCandidates: UpgradeCandidates{Latest: v5, LatestCompatible: v4_2}},
+			want:   []string{"medium: newer major version v5 is available (latest release v5.0.1)"},
+		},
+		"stale floating tag": {
+			action: Action{Ref: "v4", Release: v4_1, UpgradeCandidates: UpgradeCandidates{Latest: v4_2, LatestCompatible: v4_2}},
+			want:   []string{"low: floating tag v4 points to v4.1.0, but the newest v4 release is v4.2.3"},
+		},
+		"newer major and stale floating tag": {
+			action: Action{Ref: "v3", Release: Release{CommitHash: "untagged"}, UpgradeCandidates: UpgradeCandidates{Latest: v5, LatestCompatible: v3}},
+			want: []string{
+				"medium: newer major version v5 is available (latest release v5.0.1)",
+				"low: floating tag v3 points to untagged, but the newest v3 release is v3.5.0",
+			},
+		},
+		"specific version is not floating": {
+			action: Action{Ref: "v4.1.0", Release: v4_1, UpgradeCandidates: UpgradeCandidates{Latest: v5, LatestCompatible: v4_2}},
+			want:   nil,
+		},
+		"unresolved": {
+			action: Action{Ref: "v4"},
+			want:   nil,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var got []string
+			for _, f := range checkFloatingMajor(Step{Action: tc.action}) {
+				got = append(got, fmt.Sprintf("%s: %s", f.Priority, f.Msg))
+			}
+			assert.DeepEqual(t, got, tc.want, "incorrect findings")
+		})
+	}
+}
+
+func TestRenderFindings(t *testing.T) {
+	t.Parallel()
+	findings := []Finding{
+		{Priority: PriorityHigh, Workflow: "a.yaml", Step: Step{LineNumber: 1, Action: Action{Name: "owner/one", Ref: "v1"}}, Msg: "first"},
+		{Priority: PriorityHigh, Workflow: "b.yaml", Step: Step{LineNumber: 2, Action: Action{Name: "owner/two", Ref: "v2"}}, Msg: "second"},
+		{Priority: PriorityLow, Workflow: "a.yaml", Step: Step{LineNumber: 3, Action: Action{Name: "owner/three", Ref: "v3"}}, Msg: "third"},
+	}
+	want := `high priority
+  workflow a.yaml
+    line 2: owner/one@v1 → first
+  workflow b.yaml
+    line 3: owner/two@v2 → second
+
+low priority
+  workflow a.yaml
+    line 4: owner/three@v3 → third
+`
+	out := &strings.Builder{}
+	engine := newEngine(Root{}, nil, io.Discard, engineOpts{})
+	engine.renderFindings(out, findings)
+	assert.Equal(t, out.String(), want, "incorrect output")
+}
+
+func TestCheckAllowedOwners(t *testing.T) {
+	t.Parallel()
+
+	root := Root{Workflows: map[string]Workflow{
+		"ci.yaml": {
+			FilePath: "ci.yaml",
+			Steps: []Step{
+				{LineNumber: 3, Action: Action{Name: "actions/checkout", Ref: "v4"}},
+				{LineNumber: 5, Action: Action{Name: "MyOrg/deploy/.github/workflows/deploy.yaml", Ref: "main"}},
+				{LineNumber: 7, Action: Action{Name: "someone/sketchy-action", Ref: "v1"}},
+			},
+		},
+	}}
+	want := `high priority
+  workflow ci.yaml
+    line 8: someone/sketchy-action@v1 → owner someone is not an allowed owner
+`
+
+	// no versions need to be resolved, so no GitHub client is needed
+	out := &strings.Builder{}
+	engine := newEngine(root, nil, io.Discard, engineOpts{})
+	findings, err := engine.Check(testCtx(), out, checkOpts{AllowedOwners: []string{"actions", "myorg"}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(findings), 1, "incorrect number of findings")
+	assert.Equal(t, findings[0].Check, "allowed-owners", "incorrect check")
+	assert.Equal(t, out.String(), want, "incorrect output")
+}
+
+func TestCheckConsistentPinning(t *testing.T) {
+	t.Parallel()
+
+	const commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	root := Root{Workflows: map[string]Workflow{
+		"ci.yaml": {
+			FilePath: "ci.yaml",
+			Steps: []Step{
+				{LineNumber: 3, Action: Action{Name: "actions/checkout", Ref: commitA}},
+				{LineNumber: 5, Action: Action{Name: "actions/setup-go", Ref: "v5"}},
+				{LineNumber: 7, Action: Action{Name: "owner/repo/subdir", Ref: commitA}},
+			},
+		},
+		"release.yaml": {
+			FilePath: "release.yaml",
+			Steps: []Step{
+				{LineNumber: 2, Action: Action{Name: "Actions/Checkout", Ref: "v4"}},
+				{LineNumber: 4, Action: Action{Name: "actions/setup-go", Ref: "main"}},
+				{LineNumber: 6, Action: Action{Name: "owner/repo", Ref: "v1"}},
+			},
+		},
+	}}
+	want := `medium priority
+  workflow release.yaml
+    line 3: Actions/Checkout@v4 → floats on v4, but Actions/Checkout is pinned to a commit hash at ci.yaml:4
+    line 7: owner/repo@v1 → floats on v1, but owner/repo is pinned to a commit hash at ci.yaml:8
+`
+
+	// no versions need to be resolved, so no GitHub client is needed
+	out := &strings.Builder{}
+	engine := newEngine(root, nil, io.Discard, engineOpts{})
+	findings, err := engine.Check(testCtx(), out, checkOpts{ConsistentPinning: true})
+	assert.NilError(t, err)
+	assert.Equal(t, len(findings), 2, "incorrect number of findings")
+	assert.Equal(t, findings[0].Check, "consistent-pinning", "incorrect check")
+	assert.Equal(t, out.String(), want, "incorrect output")
+}
+
+func TestCheckUnpinned(t *testing.T) {
+	t.Parallel()
+
+	const commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	root := Root{Workflows: map[string]Workflow{
+		"ci.yaml": {
+			FilePath: "ci.yaml",
+			Steps: []Step{
+				{LineNumber: 3, Action: Action{Name: "actions/checkout", Ref: commitA}},
+				{LineNumber: 5, Action: Action{Name: "actions/setup-go", Ref: "v5"}},
+				{LineNumber: 7, Action: Action{Name: "MyOrg/canary", Ref: "main"}},
+				{LineNumber: 9, Action: Action{Name: "myorg/canary", Ref: "v1"}},
+			},
+		},
+	}}
+	cfg := config{SanctionedRefs: map[string]bool{sanctionedRefKey("myorg/canary", "main"): true}}
+	want := `medium priority
+  workflow ci.yaml
+    line 6: actions/setup-go@v5 → floats on v5 instead of being pinned to a commit hash
+    line 10: myorg/canary@v1 → floats on v1 instead of being pinned to a commit hash
+`
+
+	// no versions need to be resolved, so no GitHub client is needed
+	out := &strings.Builder{}
+	engine := newEngine(root, nil, io.Discard, engineOpts{Config: cfg})
+	findings, err := engine.Check(testCtx(), out, checkOpts{Unpinned: true, ConsistentPinning: true})
+	assert.NilError(t, err)
+	assert.Equal(t, len(findings), 2, "incorrect number of findings")
+	assert.Equal(t, out.String(), want, "incorrect output")
+}
+
+func TestCheckStaleComments(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	notFound := errResponse(http.StatusNotFound, `{"message": "Not Found"}`)
+	client := newTestClient(t, map[string]httpResponse{
+		// version tags
+		"2590b2f6ce": okResponse(`{
+			"data": {
+				"repository": {
+					"refs": {
+						"nodes": [
+							{"name": "v1.1.0", "target": {"oid": "` + commitB + `"}},
+							{"name": "v1.0.0", "target": {"oid": "` + commitA + `"}}
+						],
+						"pageInfo": {"hasNextPage": false, "endCursor": ""}
+					}
+				}
+			}
+		}`),
+	}, map[string]httpResponse{
+		"GET /repos/owner/repo/git/ref/heads/v4.2.0": notFound,
+		"GET /repos/owner/repo/git/ref/tags/v4.2.0":  notFound,
+	})
+
+	root := Root{Workflows: map[string]Workflow{
+		"ci.yaml": {
+			FilePath: "ci.yaml",
+			Steps: []Step{
+				// comment matches
+				{LineNumber: 1, Action: Action{Name: "owner/repo", Ref: commitA}, Comment: "v1.0.0"},
+				// comment lags behind the pinned commit
+				{LineNumber: 2, Action: Action{Name: "owner/repo", Ref: commitB}, Comment: "v1.0.0"},
+				// comment left over from a different action
+				{LineNumber: 3, Action: Action{Name: "owner/repo", Ref: commitA}, Comment: "v4.2.0"},
+				// not a version comment
+				{LineNumber: 4, Action: Action{Name: "owner/repo", Ref: commitA}, Comment: "pinned for reasons"},
+			},
+		},
+	}}
+	want := `high priority
+  workflow ci.yaml
+    line 4: owner/repo@` + commitA + ` → version comment v4.2.0 is not a tag in owner/repo, it may belong to a different action
+
+low priority
+  workflow ci.yaml
+    line 3: owner/repo@` + commitB + ` → version comment v1.0.0 points to ` + commitA + `, not v1.1.0
+`
+
+	out := &strings.Builder{}
+	engine := newEngine(root, client, io.Discard, engineOpts{TrustHashes: true})
+	findings, err := engine.Check(testCtx(), out, checkOpts{StaleComments: true})
+	assert.NilError(t, err)
+	assert.Equal(t, len(findings), 2, "incorrect number of findings")
+	assert.Equal(t, findings[0].Check, "stale-comment", "incorrect check")
+	assert.Equal(t, out.String(), want, "incorrect output")
+}
+
+func TestIsRefNotFound(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		err  error
+		want bool
+	}{
+		"not found status": {
+			err:  fmt.Errorf("wrapped: %w", &httpStatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}),
+			want: true,
+		},
+		"unresolved reference": {
+			err:  errors.New("failed to resolve reference v4.2.0"),
+			want: true,
+		},
+		"server error": {
+			err:  &httpStatusError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"},
+			want: false,
+		},
+		"other error": {
+			err:  errors.New("connection reset by peer"),
+			want: false,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, isRefNotFound(tc.err), tc.want, "incorrect result")
+		})
+	}
+}
@@ -2,16 +2,28 @@
 package ghavm
 
 import (
+	"bytes"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/fatih/color"
 	"github.com/mccutchen/ghavm/internal/slogctx"
+	"github.com/mccutchen/ghavm/internal/style"
 	"github.com/spf13/cobra"
 )
 
@@ -23,6 +35,7 @@ func RunApp(app *cobra.Command, args []string) error {
 
 // NewApp creates the CLI for ghavm.
 func NewApp(stdin io.Reader, stdout io.Writer, stderr io.Writer, getenv func(string) string, versionInfo string) *cobra.Command {
+	userAgent := defaultUserAgent(versionInfo)
 	rootCmd := &cobra.Command{
 		Use:   "ghavm",
 		Short: "ghavm manages version pinning and upgrades for GitHub Actions workflows.",
@@ -52,8 +65,87 @@ func NewApp(stdin io.Reader, stdout io.Writer, stderr io.Writer, getenv func(str
 
   # list version and available upgrades for all 'actions/setup-go'
   # actions in the current repo
-  ghavm list --select actions/setup-go`,
+  ghavm list --select actions/setup-go
+
+  # include every version tag, the release URL, and signature status of
+  # each action's current version
+  ghavm list --verbose
+
+  # indicate whether each action's owner is an organization with a verified
+  # domain
+  ghavm list --show-verified
+
+  # also consider version tags that were never published as GitHub
+  # releases
+  ghavm list --action-version-source both
+
+  # mark actions used in matrix jobs, to help judge the impact of
+  # changing them
+  ghavm list --annotate-matrix
+
+  # also list actions in templated workflow sources (e.g. ci.yaml.j2)
+  ghavm list --include-templated "*.yaml.j2"
+
+  # keep the list up to date, refreshing it every 10 minutes
+  ghavm list --watch --watch-interval 10m
+
+  # list only upgrades that became available since the last run (e.g. in
+  # a daily bot), reusing versions resolved in the last 12 hours
+  ghavm list --since-last-run --state-ttl 12h
+
+  # same, but resolve every action again (e.g. right after a release),
+  # still recording the results for later runs
+  ghavm list --since-last-run --force-refresh
+
+  # also list the actions used by composite actions, two levels deep
+  ghavm list --transitive --transitive-depth 2
+
+  # save the resolved versions of every action as a baseline, then later
+  # report what changed since then
+  ghavm list --output json > baseline.json
+  ghavm list --compare-to baseline.json
+
+  # write a drift report to share with people who don't use ghavm
+  ghavm list --output html > drift.html`,
 		RunE: listCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			if interval, _ := cmd.Flags().GetDuration("watch-interval"); interval < minWatchInterval {
+				return fmt.Errorf("--watch-interval must be at least %s", minWatchInterval)
+			}
+			if ttl, _ := cmd.Flags().GetDuration("state-ttl"); ttl < 0 {
+				return fmt.Errorf("--state-ttl must not be negative")
+			}
+			if cmd.Flags().Changed("force-refresh") && !cmd.Flags().Changed("since-last-run") {
+				return fmt.Errorf("--force-refresh requires --since-last-run")
+			}
+			if depth, _ := cmd.Flags().GetInt("transitive-depth"); depth < 1 {
+				return fmt.Errorf("--transitive-depth must be at least 1")
+			}
+			output, _ := cmd.Flags().GetString("output")
+			switch {
+			case output != outputText && output != outputJSON && output != outputHTML:
+				return fmt.Errorf("--output/-o must be one of %q, %q, or %q", outputText, outputJSON, outputHTML)
+			case output == outputHTML && cmd.Flags().Changed("compare-to"):
+				return fmt.Errorf("--output/-o %s cannot be used with --compare-to", outputHTML)
+			}
+			return nil
+		},
+	}
+	listCmd.Flags().Bool("show-verified", false, "Indicate whether each action's owner is an organization that has verified a domain with GitHub, which is not the same as the Marketplace's verified creator badge (costs an extra API request per owner)")
+	listCmd.Flags().Bool("annotate-matrix", false, "Mark actions used in jobs with a matrix strategy, which may run many times")
+	listCmd.Flags().Bool("transitive", false, "Also list the actions used by composite actions, recursively, by fetching their action.yml files (costs an extra API request per action and ref)")
+	listCmd.Flags().Int("transitive-depth", defaultTransitiveDepth, "With --transitive, the maximum number of levels of dependencies to list, which also bounds how far cycles are followed")
+	listCmd.Flags().Bool("watch", false, "Keep listing versions, refreshing the list on an interval until interrupted")
+	listCmd.Flags().Duration("watch-interval", 5*time.Minute, "Time to wait between refreshes with --watch")
+	listCmd.Flags().String("since-last-run", "", "List only upgrades that became available since the last run, as recorded in this state file (default "+defaultStateFile+" if given without a value)")
+	listCmd.Flags().Lookup("since-last-run").NoOptDefVal = defaultStateFile
+	listCmd.Flags().Duration("state-ttl", 24*time.Hour, "With --since-last-run, reuse versions recorded in the state file within this long instead of resolving them again, unless the action's ref has changed")
+	listCmd.Flags().Bool("force-refresh", false, "With --since-last-run, resolve every action again instead of reusing versions recorded in the state file, still recording the fresh versions for later runs")
+	listCmd.Flags().StringP("output", "o", outputText, "Output format, one of text, json, or html (the resolved versions and latest releases of every action, or the changes since the baseline with --compare-to; html writes a self-contained, sortable report of how far each action has drifted behind its latest release)")
+	listCmd.Flags().String("compare-to", "", "Report the changes since a baseline previously written by list --output json, i.e. actions added or removed, versions changed, and new upgrades available")
+	for _, flag := range []string{"output", "compare-to"} {
+		listCmd.MarkFlagsMutuallyExclusive(flag, "since-last-run")
+		listCmd.MarkFlagsMutuallyExclusive(flag, "watch")
 	}
 
 	pinCmd := &cobra.Command{
@@ -69,9 +161,54 @@ func NewApp(stdin io.Reader, stdout io.Writer, stderr io.Writer, getenv func(str
   ghavm pin --target actions/setup-go
 
   # pin the versions of all actions in a specific file
-  ghavm pin .github/workflows/my-workflow.yaml`,
+  ghavm pin .github/workflows/my-workflow.yaml
+
+  # pin only actions not yet pinned, leaving already-pinned actions
+  # (and their version comments) untouched
+  ghavm pin --only-floating
+
+  # run a formatter over any rewritten workflow files
+  ghavm pin --post-write-command yamlfmt
+
+  # show only diagnostics and a final tally, e.g. in CI logs
+  ghavm pin --summary-only
+
+  # pin to 12-character short hashes, which are easier to read but less
+  # secure than full hashes, and which the GitHub Actions runner rejects in
+  # uses: (e.g. for workflows consumed by other tools)
+  ghavm pin --ref-style short
+
+  # fix stale version comments on already-pinned actions, without
+  # changing any commit hashes
+  ghavm pin --comment-only
+
+  # record "# v4" rather than "# v4.1.2" for actions used via @v4
+  ghavm pin --match-ref-precision
+
+  # pin actions tracking a branch (e.g. @main) to their latest releases,
+  # recording the branch in their version comments
+  ghavm pin --branches-to-latest
+
+  # remove version comments from actions already pinned to commit hashes
+  ghavm pin --prune-comments
+
+  # standardize the formatting of already-pinned actions offline, keeping
+  # their hashes and version comments
+  ghavm pin --rewrite-only
+
+  # record a known-good state, then later re-pin exactly those actions
+  # to their recorded hashes
+  ghavm pin --dry-run --output json > ghavm.lock.json
+  ghavm pin --from-lockfile ghavm.lock.json`,
 		RunE: pinOrUpgradeCmd,
 	}
+	pinCmd.Flags().Bool("comment-only", false, "Only update version comments on actions already pinned to commit hashes")
+	pinCmd.Flags().Bool("prune-comments", false, "Remove version comments from actions already pinned to commit hashes")
+	pinCmd.Flags().Bool("trust-hashes", false, "Don't confirm refs that are already full commit hashes via the API, keeping existing version comments if tags can't be fetched")
+	pinCmd.Flags().String("from-lockfile", "", "Only re-pin the actions recorded in a JSON plan from --dry-run --output json, to their recorded hashes, without resolving versions via the API")
+	pinCmd.Flags().Bool("branches-to-latest", false, "Pin actions tracking a branch (e.g. @main) to their latest releases instead of the branches' current commits, recording the branch in the version comment (e.g. # v4 (was:main))")
+	pinCmd.Flags().Bool("rewrite-only", false, "Only re-write actions already pinned to commit hashes with version comments in the canonical format, keeping their hashes and comments, without any API requests (e.g. to standardize formatting offline)")
+	pinCmd.MarkFlagsMutuallyExclusive("comment-only", "prune-comments", "from-lockfile", "rewrite-only")
 
 	upgradeCmd := &cobra.Command{
 		Use:   "upgrade [flags] [path...]",
@@ -102,29 +239,250 @@ Available modes:
 
   # upgrade 'actions/setup-go' actions in the current repo to the
   # latest release, regardless of major version
-  ghavm upgrade --target actions/setup-go --mode=latest`,
+  ghavm upgrade --target actions/setup-go --mode=latest
+
+  # preview upgrades as a JSON plan, without modifying any files
+  ghavm upgrade --dry-run --output json
+
+  # choose which upgrades to apply by answering a prompt
+  ghavm upgrade --interactive
+
+  # upgrade and write a changelog to use as a pull request description
+  ghavm upgrade --changelog-out upgrades.md
+
+  # review and adjust the planned upgrades in $EDITOR before applying
+  ghavm upgrade --edit
+
+  # skip releases whose commits are less than 3 days old
+  ghavm upgrade --min-commit-age 3d
+
+  # reproduce the versions that were newest at the start of 2023, which
+  # may require downgrading actions
+  ghavm upgrade --mode=latest --as-of 2023-01-01 --allow-downgrade`,
 		RunE: pinOrUpgradeCmd,
 		PreRunE: func(cmd *cobra.Command, _ []string) error {
 			mode := cmd.Flag("mode").Value.String()
 			if mode != "compat" && mode != "latest" {
 				return fmt.Errorf("--mode/-m must be one of \"compat\" or \"latest\"")
 			}
+			if asOf := cmd.Flag("as-of").Value.String(); asOf != "" {
+				if _, err := parseAsOf(asOf); err != nil {
+					return err
+				}
+			}
+			// --editor defaults to the VISUAL or EDITOR env vars, like git
+			if f := cmd.Flag("editor"); !f.Changed {
+				_ = f.Value.Set(cmp.Or(getenv("VISUAL"), getenv("EDITOR"), defaultEditor))
+			}
 			return nil
 		},
 	}
 	upgradeCmd.Flags().StringP("mode", "m", "compat", "Upgrade mode")
+	upgradeCmd.Flags().BoolP("interactive", "i", false, "Choose which actions to upgrade, and to which versions, by entering commands at a prompt before applying (requires a terminal)")
+	upgradeCmd.Flags().Bool("edit", false, "Open the planned upgrades as a JSON plan in an editor, to adjust target versions or remove entries before applying")
+	upgradeCmd.Flags().String("editor", "", "Editor command used by --edit (default: VISUAL or EDITOR env values, falling back to "+defaultEditor+")")
+	upgradeCmd.MarkFlagsMutuallyExclusive("edit", "interactive")
+	upgradeCmd.Flags().String("changelog-out", "", "Markdown file to which a changelog of the upgrades is written, grouped by major, minor, and patch changes with compare and release notes links (e.g. to paste into a pull request description)")
+	upgradeCmd.Flags().String("as-of", "", "Only consider releases published on or before this date (YYYY-MM-DD) or time (RFC 3339)")
+
+	// define common arguments for all commands that resolve current versions
+	for _, cmd := range []*cobra.Command{listCmd, pinCmd, upgradeCmd} {
+		cmd.Flags().Bool("pin-comment-verify-on-read", false, "Warn about actions pinned to commit hashes whose version comments do not match the versions of those commits, which may indicate tampering")
+		cmd.Flags().Bool("versions-from-releases", false, "Look up the versions of commits without any version tags in their repos' releases, recovering versions whose tags are missed (e.g. tags without a \"v\" prefix)")
+		cmd.Flags().String("version-map", "", "JSON file mapping owner/repo@commit to versions, used instead of looking up the version tags of those commits via the API (e.g. to populate version comments deterministically in CI)")
+		cmd.Flags().Bool("offline", false, "With --version-map, never look up the versions of commits missing from the map via the API, leaving them without versions")
+		cmd.PreRunE = wrapPreRunE(cmd, func(cmd *cobra.Command, _ []string) error {
+			if offline, _ := cmd.Flags().GetBool("offline"); offline {
+				if path, _ := cmd.Flags().GetString("version-map"); path == "" {
+					return fmt.Errorf("--offline requires --version-map")
+				}
+			}
+			return nil
+		})
+	}
+
+	// define common arguments for all commands that choose upgrade candidates
+	for _, cmd := range []*cobra.Command{listCmd, upgradeCmd} {
+		cmd.Flags().Bool("require-verified", false, "Only consider releases whose tag or commit has a verified signature")
+		cmd.Flags().String("action-version-source", versionSourceReleases, "Where upgrade candidates come from, one of releases (versions published as GitHub releases), tags (every version tag, ignoring releases), or both (the union of the two)")
+		cmd.Flags().Int("consistency-retry", 0, "Retry fetching releases up to this many times if an action's current release is missing from them, e.g. right after it was published (e.g. --consistency-retry=3)")
+		cmd.Flags().StringSlice("include-prereleases-matching", nil, "Only consider prereleases (e.g. v2.0.0-rc.1) for actions matching these patterns, with optional wildcards (e.g. --include-prereleases-matching \"myorg/*\")")
+		cmd.Flags().StringSlice("deny-version", nil, "Never upgrade to these known-bad versions, given as owner/repo@version (e.g. --deny-version actions/foo@v4.2.0)")
+		cmd.Flags().String("min-commit-age", "", "Only consider releases whose commits are at least this old, in days (e.g. 3d) or as a duration (e.g. 36h), to give the community time to catch malicious releases")
+		cmd.Flags().Bool("parallel", false, "Start fetching each action's releases for upgrade candidates while its current version is still being resolved, reducing latency for large repos at the cost of some unused requests")
+		cmd.PreRunE = wrapPreRunE(cmd, func(cmd *cobra.Command, _ []string) error {
+			patterns, _ := cmd.Flags().GetStringSlice("include-prereleases-matching")
+			for _, pattern := range patterns {
+				if err := validatePattern(pattern); err != nil {
+					return fmt.Errorf("invalid --include-prereleases-matching pattern: %w", err)
+				}
+			}
+			if source, _ := cmd.Flags().GetString("action-version-source"); source != versionSourceReleases && source != versionSourceTags && source != versionSourceBoth {
+				return fmt.Errorf("--action-version-source must be one of %q, %q, or %q", versionSourceReleases, versionSourceTags, versionSourceBoth)
+			}
+			denied, _ := cmd.Flags().GetStringSlice("deny-version")
+			if _, err := parseDeniedVersions(denied); err != nil {
+				return err
+			}
+			if age, _ := cmd.Flags().GetString("min-commit-age"); age != "" {
+				if _, err := parseMinCommitAge(age); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	checkCmd := &cobra.Command{
+		Use:   "check [flags] [path...]",
+		Short: "Check actions for problems, exiting non-zero if any are found",
+		Example: `  # check for actions targeting deprecated Node runtimes
+  ghavm check --deprecated-runtimes
+
+  # find actions on floating major tags that need attention
+  ghavm check --floating-majors
+
+  # flag actions not published by GitHub or your own org
+  ghavm check --allowed-owners actions,myorg
+
+  # find version comments that don't match their pinned commits
+  ghavm check --stale-comments
+
+  # find actions not yet pinned to commit hashes
+  ghavm check --unpinned
+
+  # find actions pinned in some workflows but left floating in others
+  ghavm check --consistent-pinning
+
+  # report problems without failing an advisory pipeline
+  ghavm check --deprecated-runtimes --exit-zero
+
+  # in a PR's CI job, only check actions added or changed by the PR
+  ghavm check --unpinned --only-changed-since origin/main
+
+  # report problems as JUnit XML for a CI system's test report
+  ghavm check --deprecated-runtimes --output junit > ghavm-check.xml`,
+		RunE: checkCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			if output, _ := cmd.Flags().GetString("output"); output != outputText && output != outputJUnit {
+				return fmt.Errorf("--output/-o must be one of %q or %q", outputText, outputJUnit)
+			}
+			return nil
+		},
+	}
+	checkCmd.Flags().Bool("deprecated-runtimes", false, "Flag actions that target a deprecated Node runtime")
+	checkCmd.Flags().Bool("floating-majors", false, "Flag actions on floating major tags (e.g. v4) with a newer major version available or a stale tag")
+	checkCmd.Flags().StringSlice("allowed-owners", nil, "Flag actions published by any owner not in this list (e.g. --allowed-owners actions,myorg)")
+	checkCmd.Flags().Bool("stale-comments", false, "Flag actions whose version comments do not match the commits they are pinned to, e.g. comments left over from a different action")
+	checkCmd.Flags().Bool("unpinned", false, "Flag actions not pinned to a full commit hash, except for refs sanctioned to float by the config file")
+	checkCmd.Flags().Bool("consistent-pinning", false, "Flag actions left floating on a tag or branch in some steps but pinned to a commit hash in others, e.g. after an incomplete pinning effort")
+	checkCmd.Flags().StringP("output", "o", outputText, "Output format, one of text or junit (every action as a test case that fails if it has any problems)")
+	checkCmd.Flags().Bool("exit-zero", false, "Exit zero even if problems are found, e.g. to collect the report in an advisory pipeline (errors still exit non-zero)")
+
+	policyCmd := &cobra.Command{
+		Use:   "policy [flags] [path...]",
+		Short: "Evaluate actions against a policy file, exiting non-zero on any violations",
+		Example: `  # evaluate the policy in ` + policyFileName + ` at the repo root
+  ghavm policy
+
+  # evaluate a shared policy and upload the results to code scanning
+  ghavm policy --config org-policy.yaml --output sarif > ghavm.sarif`,
+		RunE: policyCmd,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			if output, _ := cmd.Flags().GetString("output"); output != outputText && output != outputJSON && output != outputSARIF && output != outputJUnit {
+				return fmt.Errorf("--output/-o must be one of %q, %q, %q, or %q", outputText, outputJSON, outputSARIF, outputJUnit)
+			}
+			return nil
+		},
+	}
+	policyCmd.Flags().String("config", "", "Policy file to evaluate (default: "+policyFileName+" at the repo root)")
+	policyCmd.Flags().StringP("output", "o", outputText, "Output format, one of text, json, sarif, or junit")
+	policyCmd.Flags().Bool("exit-zero", false, "Exit zero even if violations are found, e.g. to collect the report in an advisory pipeline (errors still exit non-zero)")
+
+	// define common arguments for all commands that read the config file
+	for _, cmd := range []*cobra.Command{listCmd, pinCmd, upgradeCmd, checkCmd} {
+		cmd.Flags().String("config", "", "Config file with per-action version constraints and refs sanctioned to float (default: "+configFileName+" at the repo root, if present)")
+	}
+
+	// define common arguments for all commands that rewrite workflow files
+	for _, cmd := range []*cobra.Command{pinCmd, upgradeCmd} {
+		cmd.Flags().Bool("only-workflows-with-changes", false, "Only report workflows that were actually modified")
+		cmd.Flags().Bool("summary-only", false, "Suppress progress output, showing only diagnostics and a final one-line tally of the actions changed, unchanged, and skipped (e.g. for tidy CI logs)")
+		cmd.Flags().Bool("allow-downgrade", false, "Allow pinning actions to versions older than their current versions")
+		cmd.Flags().Bool("dry-run", false, "Report the changes that would be made without modifying any files")
+		cmd.Flags().StringP("output", "o", outputText, "Output format, one of text, json (the planned changes with --dry-run, otherwise the changes made), or diffstat (a one-line summary of changes)")
+		cmd.Flags().String("post-write-command", "", "Command to run once after rewriting workflows, with the changed file paths appended (e.g. \"yamlfmt\")")
+		cmd.Flags().Bool("ignore-post-write-errors", false, "Report a failing --post-write-command as a warning instead of an error")
+		cmd.Flags().String("report-file", "", "JSON file in which to record the planned changes for this repo, merged with any other repos' results already in the file")
+		cmd.Flags().String("report-key", "", "Key identifying this repo in --report-file (default: the absolute path of the repo root)")
+		cmd.Flags().String("group-by", "", "Tag each change in JSON output and reports with a suggested key for batching related upgrades, either \"owner\" or \"change\" (e.g. patch, minor, major)")
+		cmd.Flags().Bool("annotate-unresolvable", false, "Add a warning comment above steps whose action repos no longer exist, without changing the steps")
+		cmd.Flags().Bool("codeowners", false, "Tag each change in JSON output and reports with the owners of its workflow file, according to the repo's CODEOWNERS file")
+		cmd.Flags().Bool("only-if-token-scoped", false, "Check that every action repo is accessible with the current token before resolving any actions, and refuse to proceed if any are not")
+		cmd.Flags().Bool("allow-template-rewrite", false, "Rewrite templated workflows found via --include-templated like any other workflow, which is only safe if their uses: lines are not templated")
+		cmd.Flags().Bool("all-or-nothing", false, "Only replace workflow files once every changed file has been written, leaving every file untouched if any cannot be")
+		cmd.Flags().String("ref-style", refStyleFull, "Style of the commit hashes written to workflows, either \"full\" or \"short\" (warning: the GitHub Actions runner rejects short hashes in uses:, so workflows pinned to them will fail to run on GitHub; short hashes are also easier to collide with)")
+		cmd.Flags().Int("short-hash-length", defaultShortHashLength, "Length of the commit hashes written with --ref-style short")
+		cmd.Flags().Bool("tree-hashes", false, "Record the git tree hash of each proposed commit in JSON output and reports, identifying the exact content pinned")
+		cmd.Flags().Bool("match-ref-precision", false, "Record versions in comments with the precision of the refs actions requested, e.g. v4 rather than v4.1.2 for an action used via @v4 (or already pinned with a v4 comment), when both tag the same commit")
+		cmd.PreRunE = wrapPreRunE(cmd, func(cmd *cobra.Command, _ []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			switch {
+			case output != outputText && output != outputJSON && output != outputDiffstat:
+				return fmt.Errorf("--output/-o must be one of %q, %q, or %q", outputText, outputJSON, outputDiffstat)
+			case output == outputDiffstat && dryRun:
+				return fmt.Errorf("--output/-o %s cannot be used with --dry-run", outputDiffstat)
+			}
+			if cmd.Flag("report-key").Changed && !cmd.Flag("report-file").Changed {
+				return fmt.Errorf("--report-key requires --report-file")
+			}
+			if groupBy, _ := cmd.Flags().GetString("group-by"); groupBy != "" && groupBy != groupByOwner && groupBy != groupByChange {
+				return fmt.Errorf("--group-by must be one of %q or %q", groupByOwner, groupByChange)
+			}
+			if refStyle, _ := cmd.Flags().GetString("ref-style"); refStyle != refStyleFull && refStyle != refStyleShort {
+				return fmt.Errorf("--ref-style must be one of %q or %q", refStyleFull, refStyleShort)
+			}
+			if n, _ := cmd.Flags().GetInt("short-hash-length"); n < minShortHashLength || n >= 40 {
+				return fmt.Errorf("--short-hash-length must be between %d and 39", minShortHashLength)
+			}
+			return nil
+		})
+	}
 
 	// define common arguments for all commands that resolve action versions
 	// (which is every command today, but might not be in the future, so we
 	// don't want to define these on the root command)
-	for _, cmd := range []*cobra.Command{listCmd, pinCmd, upgradeCmd} {
-		cmd.Flags().StringP("github-token", "g", "", "GitHub access token (default: GITHUB_TOKEN env value)")
+	for _, cmd := range []*cobra.Command{listCmd, pinCmd, upgradeCmd, checkCmd, policyCmd} {
 		cmd.Flags().StringSliceP("select", "s", nil, "Select specific actions, with optional wildcards (e.g. --select \"actions/*\" --select codecov/codecov-action)")
-		cmd.Flags().StringSliceP("exclude", "e", nil, "Exclude specific actions, with optional wildcards (e.g. --exclude \"actions/*\" --exclude codecov/codecov-action)")
-		cmd.Flags().IntP("workers", "w", runtime.NumCPU(), "Limit parallelism when accessing the GitHub API")
+		excludeRules := &excludeRulesValue{rules: &[]string{}}
+		cmd.Flags().VarP(excludeRules, "exclude", "e", "Exclude specific actions, with optional wildcards (e.g. --exclude \"actions/*\" --exclude codecov/codecov-action)")
+		cmd.Flags().Var(excludeRules.negated(), "include", "Re-include actions excluded by an earlier --exclude, with optional wildcards (e.g. --exclude \"actions/*\" --include actions/checkout)")
+		cmd.Flags().Bool("only-pinned", false, "Only work on actions already pinned to a full commit hash (e.g. to refresh their version comments)")
+		cmd.Flags().Bool("only-floating", false, "Only work on actions not yet pinned to a full commit hash, i.e. those using tags or branches (e.g. to pin them)")
+		cmd.MarkFlagsMutuallyExclusive("only-pinned", "only-floating")
+		cmd.Flags().String("only-changed-since", "", "Only work on actions whose uses: lines were added or changed since this git ref, leaving the rest as-is (e.g. --only-changed-since origin/main to only resolve a PR's changes in CI)")
+		cmd.Flags().StringSlice("select-owner", nil, "Select all actions published by these owners (e.g. --select-owner actions is the same as --select \"actions/*\")")
+		cmd.Flags().Var(excludeRules.owners(), "exclude-owner", "Exclude all actions published by these owners (e.g. --exclude-owner actions is the same as --exclude \"actions/*\")")
+		cmd.Flags().IntP("workers", "w", min(runtime.NumCPU(), maxSafeWorkers), "Limit parallelism when accessing the GitHub API")
+		cmd.Flags().Int("concurrent-workflows", 0, "Limit how many workflows may have steps in flight at once, independent of --workers (default: no limit)")
 		cmd.Flags().Bool("strict", false, "Strict mode, abort on any error")
+		cmd.Flags().Bool("fail-fast", true, "In strict mode, abort on the first error (use --fail-fast=false to process every step and report all errors before failing)")
 		cmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging")
+		cmd.Flags().Var(&hostTokensValue{}, "host-token", "Authenticate requests to a host with the token in an env var instead of the default token, in host=ENV_VAR format (e.g. --host-token ghes.example.com=GHES_TOKEN, may be repeated)")
+		cmd.Flags().String("git-mirror", "", "Directory of local clones of action repos, as <owner>/<repo> or <owner>/<repo>.git, from which to resolve those actions instead of the GitHub API, treating complete version tags as unpublished releases (a token is only required for actions missing from the mirror)")
+		cmd.Flags().Bool("retry-on-5xx", false, "Retry GitHub API requests that fail with 5xx server errors, e.g. during transient outages, with exponential backoff and jitter")
+		cmd.Flags().Int("max-retries", 3, "With --retry-on-5xx, the maximum number of times to retry each failed request")
+		cmd.Flags().String("scope", "", "Only work on workflow files within this directory, finding workflows in any .github/workflows directories under it if no paths are given (e.g. --scope services/payments in a monorepo)")
+		cmd.Flags().Bool("suggest-typos", false, "When an action's repo is not found, search GitHub for a similarly named repo to suggest as a fix for a typo (costs extra search API requests)")
+		cmd.Flags().Bool("fix-missing-owner", false, "Treat legacy action references missing an owner (e.g. checkout@v4) as first-party actions/* actions instead of skipping them, adding the owner when pinning or upgrading")
+		cmd.Flags().StringSlice("include-templated", nil, "Also scan templated workflow sources whose file names match these patterns (e.g. --include-templated \"*.yaml.j2\"), which are never rewritten unless --allow-template-rewrite is given")
+		cmd.Flags().String("lang", "", "Language for version listings and progress output, either en or es (default: detected from LC_ALL, LC_MESSAGES, or LANG env values, falling back to en)")
 		cmd.Flags().String("color", "auto", "Output colored escape sequences based on when, which may be set to either always, auto, or never")
+		cmd.Flags().Bool("relative-paths", false, "Show workflow paths relative to the repo root in all output, so that output is the same wherever the repo is checked out (implied by --deterministic)")
+		cmd.Flags().Bool("deterministic", false, "Make output reproducible from run to run (e.g. for golden tests or committed reports) by resolving one action at a time, showing relative paths, disabling colors unless --color is given, and omitting timestamps from verbose logs")
+		cmd.MarkFlagsMutuallyExclusive("deterministic", "workers")
+		cmd.MarkFlagsMutuallyExclusive("deterministic", "concurrent-workflows")
 
 		// set up env var handling
 		cmd.PreRunE = wrapPreRunE(cmd, func(cmd *cobra.Command, _ []string) error {
@@ -133,11 +491,41 @@ Available modes:
 			if f := cmd.Flag("github-token"); !f.Changed {
 				if token := getenv("GITHUB_TOKEN"); token != "" {
 					_ = f.Value.Set(token)
-				} else {
+				} else if tokenCmd := cmd.Flag("github-token-command").Value.String(); tokenCmd != "" {
+					token, err := commandTokenProvider(tokenCmd)(context.Background())
+					if err != nil {
+						return err
+					}
+					_ = f.Value.Set(token)
+				} else if mirror := cmd.Flag("git-mirror").Value.String(); mirror == "" && !makesNoAPIRequests(cmd) {
 					return fmt.Errorf("either --github-token/-g flag or GITHUB_TOKEN env var are required")
 				}
 			}
 
+			// --deterministic bundles every setting that makes output vary
+			// from run to run, so it must be applied before their defaults
+			if deterministic, _ := cmd.Flags().GetBool("deterministic"); deterministic {
+				if relative, _ := cmd.Flags().GetBool("relative-paths"); cmd.Flag("relative-paths").Changed && !relative {
+					return fmt.Errorf("--deterministic cannot be used with --relative-paths=false")
+				}
+				_ = cmd.Flags().Set("workers", "1")
+				_ = cmd.Flags().Set("relative-paths", "true")
+				if !cmd.Flag("color").Changed {
+					_ = cmd.Flags().Set("color", "never")
+				}
+			}
+
+			// --lang is validated if given, otherwise detected from the locale,
+			// falling back to English for unsupported locales
+			if f := cmd.Flag("lang"); f.Changed {
+				if err := validateLang(f.Value.String()); err != nil {
+					return fmt.Errorf("invalid --lang: %w", err)
+				}
+			} else {
+				locale := cmp.Or(getenv("LC_ALL"), getenv("LC_MESSAGES"), getenv("LANG"))
+				_ = f.Value.Set(cmp.Or(langFromLocale(locale), defaultLang))
+			}
+
 			// --verbose flag is optional, but we also support setting via env vars
 			if f := cmd.Flag("verbose"); !f.Changed {
 				if verbose := getenv("VERBOSE"); verbose != "" && verbose != "0" && verbose != "false" {
@@ -157,8 +545,87 @@ Available modes:
 				return fmt.Errorf("--color must be one of: %s", strings.Join(validColors, ", "))
 			}
 
+			// --fail-fast=false only changes how strict mode fails
+			if failFast, _ := cmd.Flags().GetBool("fail-fast"); !failFast {
+				if strict, _ := cmd.Flags().GetBool("strict"); !strict {
+					return fmt.Errorf("--fail-fast=false requires --strict")
+				}
+			}
+
+			// --workers has no hard upper limit (e.g. GHES may allow higher
+			// rate limits), but we warn about likely rate limiting
+			if workers, _ := cmd.Flags().GetInt("workers"); workers > maxSafeWorkers {
+				fprintf(cmd.ErrOrStderr(), "warning: --workers above %d will likely hit GitHub API rate limits\n", maxSafeWorkers)
+			}
+
+			if n, _ := cmd.Flags().GetInt("concurrent-workflows"); n < 0 {
+				return fmt.Errorf("--concurrent-workflows must not be negative")
+			}
+
+			// validate network configuration
+			if proxy, _ := cmd.Flags().GetString("proxy"); proxy != "" {
+				if _, err := parseProxyURL(proxy); err != nil {
+					return fmt.Errorf("invalid --proxy: %w", err)
+				}
+			}
+			if headers, _ := cmd.Flags().GetStringArray("header"); len(headers) > 0 {
+				if _, err := parseHeaders(headers); err != nil {
+					return fmt.Errorf("invalid --header/-H: %w", err)
+				}
+			}
+
+			// resolve each --host-token from its env var, so that a missing
+			// token is reported before any requests are made
+			if v, ok := cmd.Flags().Lookup("host-token").Value.(*hostTokensValue); ok {
+				if err := v.resolve(getenv); err != nil {
+					return fmt.Errorf("invalid --host-token: %w", err)
+				}
+			}
+
+			// validate --git-mirror, whose releases are never verified
+			if mirror, _ := cmd.Flags().GetString("git-mirror"); mirror != "" {
+				if err := validateGitMirror(mirror); err != nil {
+					return fmt.Errorf("invalid --git-mirror: %w", err)
+				}
+				if verified, _ := cmd.Flags().GetBool("require-verified"); verified {
+					return fmt.Errorf("--require-verified cannot be used with --git-mirror, since signatures cannot be verified locally")
+				}
+			}
+
+			if maxRetries, _ := cmd.Flags().GetInt("max-retries"); maxRetries < 0 {
+				return fmt.Errorf("invalid --max-retries: must not be negative, got %d", maxRetries)
+			}
+
+			if scope, _ := cmd.Flags().GetString("scope"); scope != "" {
+				if info, err := os.Stat(scope); err != nil {
+					return fmt.Errorf("invalid --scope: %w", err)
+				} else if !info.IsDir() {
+					return fmt.Errorf("invalid --scope: %s is not a directory", scope)
+				}
+			}
+
+			if ref, _ := cmd.Flags().GetString("only-changed-since"); ref != "" {
+				if err := validateGitRef(".", ref); err != nil {
+					return fmt.Errorf("invalid --only-changed-since: %w", err)
+				}
+			}
+
+			// validate --include-templated patterns
+			templated, _ := cmd.Flags().GetStringSlice("include-templated")
+			for _, pattern := range templated {
+				if err := validateTemplatePattern(pattern); err != nil {
+					return fmt.Errorf("invalid --include-templated pattern: %w", err)
+				}
+			}
+
 			// validate --select patterns
-			if selects, _ := cmd.Flags().GetStringSlice("select"); len(selects) > 0 {
+			owners, _ := cmd.Flags().GetStringSlice("select-owner")
+			for _, owner := range owners {
+				if err := validateOwner(owner); err != nil {
+					return fmt.Errorf("invalid --select-owner: %w", err)
+				}
+			}
+			if selects := getSelects(cmd); len(selects) > 0 {
 				for _, selectPattern := range selects {
 					if err := validatePattern(selectPattern); err != nil {
 						return fmt.Errorf("invalid --select pattern: %w", err)
@@ -166,12 +633,15 @@ Available modes:
 				}
 			}
 
-			// validate --exclude patterns
-			if excludes, _ := cmd.Flags().GetStringSlice("exclude"); len(excludes) > 0 {
-				for _, exclude := range excludes {
-					if err := validatePattern(exclude); err != nil {
-						return fmt.Errorf("invalid --exclude pattern: %w", err)
-					}
+			// validate --exclude and --include patterns
+			for _, rule := range getExcludeRules(cmd) {
+				flagName := "--exclude"
+				pattern, negated := strings.CutPrefix(rule, "!")
+				if negated {
+					flagName = "--include"
+				}
+				if err := validatePattern(pattern); err != nil {
+					return fmt.Errorf("invalid %s pattern: %w", flagName, err)
 				}
 			}
 
@@ -179,7 +649,84 @@ Available modes:
 		})
 	}
 
-	rootCmd.AddCommand(listCmd, pinCmd, upgradeCmd)
+	doctorCmd := &cobra.Command{
+		Use:   "doctor [flags] [path...]",
+		Short: "Diagnose common setup problems",
+		Example: `  # check the token, network, rate limits, and workflows for the
+  # current repo
+  ghavm doctor`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return doctorCmd(cmd, args, getenv)
+		},
+	}
+	doctorCmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging")
+
+	permissionsCmd := &cobra.Command{
+		Use:   "permissions [command...]",
+		Short: "Show the token permissions required to run ghavm",
+		Example: `  # show the permissions needed for a least-privilege token that can
+  # run every command
+  ghavm permissions
+
+  # show the permissions needed to run upgrade
+  ghavm permissions upgrade`,
+		Args: cobra.ArbitraryArgs,
+		RunE: permissionsCmd,
+	}
+
+	dependabotCmd := &cobra.Command{
+		Use:   "dependabot [flags] [path...]",
+		Short: "Compare the actions ghavm manages with a Dependabot config",
+		Example: `  # report gaps between the workflows in the current repo and its
+  # .github/dependabot.yml, e.g. before migrating from Dependabot
+  ghavm dependabot
+
+  # report gaps as JSON
+  ghavm dependabot -o json`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if output, _ := cmd.Flags().GetString("output"); output != outputText && output != outputJSON {
+				return fmt.Errorf("--output/-o must be one of %q or %q", outputText, outputJSON)
+			}
+			return nil
+		},
+		RunE: dependabotCmd,
+	}
+	dependabotCmd.Flags().String("dependabot-config", "", "Path to the Dependabot config (default: .github/dependabot.yml at the root of the repo)")
+	dependabotCmd.Flags().StringP("output", "o", outputText, "Output format, one of text or json")
+
+	analyzeCmd := &cobra.Command{
+		Use:   "analyze --path <path> [flags]",
+		Short: "Analyze workflow content read from stdin, without touching any files",
+		Example: `  # report the resolved steps and proposed upgrades for an unsaved
+  # workflow in an editor, as JSON
+  ghavm analyze --path .github/workflows/ci.yaml --mode latest < buffer.yaml`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, _ []string) error {
+			if mode, _ := cmd.Flags().GetString("mode"); mode != "current" && mode != "compat" && mode != "latest" {
+				return fmt.Errorf("--mode/-m must be one of \"current\", \"compat\", or \"latest\"")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return analyzeCmd(cmd, args, getenv)
+		},
+	}
+	analyzeCmd.Flags().String("path", "", "Logical path of the workflow, which identifies it in the results but need not exist")
+	_ = analyzeCmd.MarkFlagRequired("path")
+	analyzeCmd.Flags().StringP("mode", "m", "compat", "Mode for proposed rewrites, one of current (pin current versions), compat, or latest")
+	analyzeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging")
+
+	// define auth and network arguments for every command that talks to the
+	// GitHub API
+	for _, cmd := range []*cobra.Command{listCmd, pinCmd, upgradeCmd, checkCmd, policyCmd, doctorCmd, analyzeCmd} {
+		cmd.Flags().StringP("github-token", "g", "", "GitHub access token (default: GITHUB_TOKEN env value)")
+		cmd.Flags().String("github-token-command", "", "Command that prints a GitHub access token, re-run to refresh an expired token during long runs (e.g. \"gh auth token\")")
+		cmd.Flags().String("proxy", "", "Proxy URL for GitHub API requests (default: HTTPS_PROXY/HTTP_PROXY env values)")
+		cmd.Flags().StringArrayP("header", "H", nil, "Extra header to send with every GitHub API request, in \"Name: value\" format (may be repeated)")
+		cmd.Flags().String("user-agent", userAgent, "User-Agent header to send with every GitHub API request")
+	}
+
+	rootCmd.AddCommand(listCmd, pinCmd, upgradeCmd, checkCmd, policyCmd, doctorCmd, permissionsCmd, dependabotCmd, analyzeCmd)
 
 	// wire up I/O
 	rootCmd.SetIn(stdin)
@@ -195,74 +742,394 @@ Available modes:
 
 func listCmd(cmd *cobra.Command, args []string) error {
 	var (
-		flags       = cmd.Flags()
-		token, _    = flags.GetString("github-token")
-		selects, _  = flags.GetStringSlice("select")
-		excludes, _ = flags.GetStringSlice("exclude")
-		workers, _  = flags.GetInt("workers")
-		strict, _   = flags.GetBool("strict")
-		verbose, _  = flags.GetBool("verbose")
-		colorArg, _ = flags.GetString("color")
+		flags             = cmd.Flags()
+		workers, _        = flags.GetInt("workers")
+		wfLimit, _        = flags.GetInt("concurrent-workflows")
+		strict, _         = flags.GetBool("strict")
+		failFast, _       = flags.GetBool("fail-fast")
+		verbose, _        = flags.GetBool("verbose")
+		colorArg, _       = flags.GetString("color")
+		lang, _           = flags.GetString("lang")
+		relPaths, _       = flags.GetBool("relative-paths")
+		deterministic, _  = flags.GetBool("deterministic")
+		suggest, _        = flags.GetBool("suggest-typos")
+		verified, _       = flags.GetBool("require-verified")
+		versionSource, _  = flags.GetString("action-version-source")
+		retries, _        = flags.GetInt("consistency-retry")
+		prerels, _        = flags.GetStringSlice("include-prereleases-matching")
+		denied, _         = flags.GetStringSlice("deny-version")
+		cfgPath, _        = flags.GetString("config")
+		relVers, _        = flags.GetBool("versions-from-releases")
+		versionMapPath, _ = flags.GetString("version-map")
+		offline, _        = flags.GetBool("offline")
+		verifyComm, _     = flags.GetBool("pin-comment-verify-on-read")
+		minAgeStr, _      = flags.GetString("min-commit-age")
+		parallel, _       = flags.GetBool("parallel")
+		annotateMatrix, _ = flags.GetBool("annotate-matrix")
+		transitive, _     = flags.GetBool("transitive")
+		transDepth, _     = flags.GetInt("transitive-depth")
+		showVerified, _   = flags.GetBool("show-verified")
+		watching, _       = flags.GetBool("watch")
+		watchInterval, _  = flags.GetDuration("watch-interval")
+		statePath, _      = flags.GetString("since-last-run")
+		stateTTL, _       = flags.GetDuration("state-ttl")
+		refresh, _        = flags.GetBool("force-refresh")
+		output, _         = flags.GetString("output")
+		baselinePath, _   = flags.GetString("compare-to")
+		fancy             = enableFancyOutput(colorArg, verbose)
 	)
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+	var versions versionMap
+	if versionMapPath != "" {
+		if versions, err = readVersionMap(versionMapPath); err != nil {
+			return err
+		}
+	}
+	deniedVersions, err := parseDeniedVersions(denied)
+	if err != nil {
+		return err
+	}
+	var minAge time.Duration
+	if minAgeStr != "" {
+		minAge, err = parseMinCommitAge(minAgeStr)
+		if err != nil {
+			return err
+		}
+	}
+	var baseline Inventory
+	if baselinePath != "" {
+		if baseline, err = readInventory(baselinePath); err != nil {
+			return err
+		}
+	}
+	ctx := newAppContext(context.Background(), cmd.ErrOrStderr(), chooseLogLevel(verbose), deterministic)
+	ghClient, err := newCommandClient(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	list := func(ctx context.Context, dst io.Writer) error {
+		root, err := scanCommandWorkflows(cmd, args)
+		if err != nil {
+			if errors.Is(err, errNoWorkflows) {
+				return nil
+			}
+			return err
+		}
+
+		var committedBefore time.Time
+		if minAge > 0 {
+			committedBefore = time.Now().Add(-minAge)
+		}
+		var (
+			state *runState
+			now   = time.Now()
+		)
+		if statePath != "" {
+			// forcing a refresh treats all recorded versions as stale, so
+			// every action is resolved again, while the recorded upgrades
+			// are still used to find the new ones
+			ttl := stateTTL
+			if refresh {
+				ttl = 0
+			}
+			if state, err = readState(statePath, now, ttl); err != nil {
+				return err
+			}
+		}
+		engine := newEngine(root, ghClient, cmd.ErrOrStderr(), engineOpts{
+			Strict:             strict,
+			NoFailFast:         !failFast,
+			Workers:            workers,
+			WorkflowLimit:      wfLimit,
+			Fancy:              fancy,
+			Lang:               lang,
+			RelativePaths:      relPaths,
+			SuggestTypos:       suggest,
+			RequireVerified:    verified,
+			VersionSource:      versionSource,
+			ConsistencyRetries: retries,
+			PrereleasePatterns: prerels,
+			DeniedVersions:     deniedVersions,
+			Config:             cfg,
+			Verbose:            verbose,
+			AnnotateMatrix:     annotateMatrix,
+			TransitiveDepth:    transitiveDepth(transitive, transDepth),
+			ShowVerified:       showVerified,
+			ReleaseVersions:    relVers,
+			VersionMap:         versions,
+			PrefetchReleases:   parallel,
+			Offline:            offline,
+			VerifyComments:     verifyComm,
+			CommittedBefore:    committedBefore,
+			State:              state,
+		})
+		if output != outputText || baselinePath != "" {
+			inv, err := engine.Inventory(ctx)
+			if err != nil {
+				return err
+			}
+			switch {
+			case output == outputHTML:
+				return writeHTMLReport(dst, inv)
+			case baselinePath == "":
+				return writeJSON(dst, inv)
+			case output == outputJSON:
+				return writeJSON(dst, compareInventories(baseline, inv))
+			default:
+				engine.renderInventoryDelta(dst, compareInventories(baseline, inv))
+				return nil
+			}
+		}
+		if state == nil {
+			return engine.List(ctx, dst)
+		}
+		if err := engine.ListSinceLastRun(ctx, dst, state, now); err != nil {
+			return err
+		}
+		return writeState(statePath, state)
+	}
+	if !watching {
+		return list(ctx, cmd.OutOrStdout())
+	}
+
+	// workflows are found and scanned again on every run, so that added
+	// and removed workflows are picked up
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	return watch(ctx, cmd.OutOrStdout(), ghClient, watchOpts{
+		Interval: watchInterval,
+		Clear:    fancy,
+	}, list)
+}
+
+// makesNoAPIRequests returns true if the given command is pin with
+// --rewrite-only, --prune-comments, or --from-lockfile, which need no GitHub
+// token because they make no API requests.
+func makesNoAPIRequests(cmd *cobra.Command) bool {
+	rewriteOnly, _ := cmd.Flags().GetBool("rewrite-only")
+	prune, _ := cmd.Flags().GetBool("prune-comments")
+	lockfile, _ := cmd.Flags().GetString("from-lockfile")
+	return rewriteOnly || prune || lockfile != ""
+}
+
+// errNoWorkflows is returned by scanCommandWorkflows when there are no
+// workflows to work on, which is not a failure.
+var errNoWorkflows = errors.New("no workflows found")
+
+// prepareCommand builds the GitHub client and scans the workflows for every
+// command that resolves action versions, as configured by their common flags.
+func prepareCommand(ctx context.Context, cmd *cobra.Command, args []string) (*GitHubClient, Root, error) {
+	ghClient, err := newCommandClient(ctx, cmd)
+	if err != nil {
+		return nil, Root{}, err
+	}
+	root, err := scanCommandWorkflows(cmd, args)
+	if err != nil {
+		return nil, Root{}, err
+	}
+	return ghClient, root, nil
+}
+
+// newCommandClient returns a GitHub client configured by the common flags,
+// after ensuring its auth token is valid if one is needed.
+func newCommandClient(ctx context.Context, cmd *cobra.Command) (*GitHubClient, error) {
 	var (
-		ctx      = newAppContext(context.Background(), cmd.ErrOrStderr(), chooseLogLevel(verbose))
-		ghClient = NewGitHubClient(token, nil)
+		flags         = cmd.Flags()
+		token, _      = flags.GetString("github-token")
+		tokenCmd, _   = flags.GetString("github-token-command")
+		proxy, _      = flags.GetString("proxy")
+		headers, _    = flags.GetStringArray("header")
+		userAgent, _  = flags.GetString("user-agent")
+		gitMirror, _  = flags.GetString("git-mirror")
+		retry5xx, _   = flags.GetBool("retry-on-5xx")
+		maxRetries, _ = flags.GetInt("max-retries")
 	)
+	httpClient, err := newHTTPClient(proxy, userAgent, headers)
+	if err != nil {
+		return nil, err
+	}
+	ghClient := NewGitHubClient(token, httpClient)
+	if tokenCmd != "" {
+		ghClient.SetTokenProvider(commandTokenProvider(tokenCmd))
+	}
+	if gitMirror != "" {
+		ghClient.SetGitMirror(gitMirror)
+	}
+	if retry5xx {
+		ghClient.SetRetryOn5xx(maxRetries)
+	}
+	for host, hostToken := range getHostTokens(cmd) {
+		ghClient.SetHostToken(host, hostToken)
+	}
 
-	// ensure our auth token is valid
-	if _, err := ghClient.ValidateAuth(ctx); err != nil {
-		return fmt.Errorf("GitHub authentication failed: %s", err)
+	// ensure our auth token is valid, if we need one
+	if (token != "" || gitMirror == "") && !makesNoAPIRequests(cmd) {
+		if _, err := ghClient.ValidateAuth(ctx); err != nil {
+			return nil, fmt.Errorf("GitHub authentication failed: %s", err)
+		}
 	}
+	return ghClient, nil
+}
 
-	// find workflow files to work on
-	files, err := FindWorkflows(args)
+// scanCommandWorkflows finds and scans the workflows given by args and the
+// common flags, warning about any problems found along the way, or about
+// there being no workflows at all, in which case it returns errNoWorkflows.
+func scanCommandWorkflows(cmd *cobra.Command, args []string) (Root, error) {
+	var (
+		flags           = cmd.Flags()
+		scope, _        = flags.GetString("scope")
+		templated, _    = flags.GetStringSlice("include-templated")
+		fixOwner, _     = flags.GetBool("fix-missing-owner")
+		changedSince, _ = flags.GetString("only-changed-since")
+		relPaths, _     = flags.GetBool("relative-paths")
+	)
+	files, err := findWorkflows(args, scope, templated)
 	if err != nil {
-		return fmt.Errorf("error finding workflow files: %s", err)
+		return Root{}, fmt.Errorf("error finding workflow files: %s", err)
 	}
 	if len(files) == 0 {
 		fprintln(cmd.ErrOrStderr(), "warning: no workflows found")
-		return nil
+		return Root{}, errNoWorkflows
 	}
-
-	// scan workflow files for action steps to upgrade
 	root, err := ScanWorkflows(files, scanOpts{
-		Selects:  selects,
-		Excludes: excludes,
+		Selects:          getSelects(cmd),
+		Excludes:         getExcludeRules(cmd),
+		TemplatePatterns: templated,
+		RefKinds:         getRefKinds(cmd),
+		FixMissingOwner:  fixOwner,
+		ChangedSince:     changedSince,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to scan workflow files: %w", err)
+		return Root{}, fmt.Errorf("failed to scan workflow files: %w", err)
 	}
+	warnScanProblems(cmd.ErrOrStderr(), root, relPaths)
+	return root, nil
+}
 
-	engine := newEngine(root, ghClient, cmd.ErrOrStderr(), engineOpts{
-		Strict:  strict,
-		Workers: workers,
-		Fancy:   enableFancyOutput(colorArg, verbose),
-	})
-	if err := engine.List(ctx, cmd.OutOrStdout()); err != nil {
-		return err
+// transitiveDepth returns the number of levels of transitive dependencies
+// to find for list --transitive and --transitive-depth, or 0 to find none.
+func transitiveDepth(transitive bool, depth int) int {
+	if !transitive {
+		return 0
 	}
-	return nil
+	return depth
+}
+
+// Commit hash styles for --ref-style.
+const (
+	refStyleFull  = "full"
+	refStyleShort = "short"
+
+	// defaultShortHashLength is long enough to avoid accidental collisions
+	// even in large repos, though not deliberate ones.
+	defaultShortHashLength = 12
+	// minShortHashLength matches git's minimum abbreviated hash length.
+	minShortHashLength = 7
+)
+
+// shortHashLength returns the length to truncate written commit hashes to for
+// the given --ref-style, or 0 to write full hashes.
+func shortHashLength(refStyle string, n int) int {
+	if refStyle != refStyleShort {
+		return 0
+	}
+	return n
 }
 
 func pinOrUpgradeCmd(cmd *cobra.Command, args []string) error {
 	var (
-		flags       = cmd.Flags()
-		token, _    = flags.GetString("github-token")
-		selects, _  = flags.GetStringSlice("select")
-		excludes, _ = flags.GetStringSlice("exclude")
-		workers, _  = flags.GetInt("workers")
-		strict, _   = flags.GetBool("strict")
-		verbose, _  = flags.GetBool("verbose")
-		colorArg, _ = flags.GetString("color")
+		flags             = cmd.Flags()
+		workers, _        = flags.GetInt("workers")
+		wfLimit, _        = flags.GetInt("concurrent-workflows")
+		strict, _         = flags.GetBool("strict")
+		failFast, _       = flags.GetBool("fail-fast")
+		verbose, _        = flags.GetBool("verbose")
+		colorArg, _       = flags.GetString("color")
+		lang, _           = flags.GetString("lang")
+		relPaths, _       = flags.GetBool("relative-paths")
+		deterministic, _  = flags.GetBool("deterministic")
+		suggest, _        = flags.GetBool("suggest-typos")
+		commentOnly, _    = flags.GetBool("comment-only")       // pin only
+		prune, _          = flags.GetBool("prune-comments")     // pin only
+		rewriteOnly, _    = flags.GetBool("rewrite-only")       // pin only
+		trustHashes, _    = flags.GetBool("trust-hashes")       // pin only
+		lockfile, _       = flags.GetString("from-lockfile")    // pin only
+		toLatest, _       = flags.GetBool("branches-to-latest") // pin only
+		onlyChanged, _    = flags.GetBool("only-workflows-with-changes")
+		summaryOnly, _    = flags.GetBool("summary-only")
+		downgrade, _      = flags.GetBool("allow-downgrade")
+		dryRun, _         = flags.GetBool("dry-run")
+		output, _         = flags.GetString("output")
+		postWrite, _      = flags.GetString("post-write-command")
+		ignorePost, _     = flags.GetBool("ignore-post-write-errors")
+		reportFile, _     = flags.GetString("report-file")
+		reportKey, _      = flags.GetString("report-key")
+		treeHashes, _     = flags.GetBool("tree-hashes")
+		matchPrec, _      = flags.GetBool("match-ref-precision")
+		refStyle, _       = flags.GetString("ref-style")
+		shortLen, _       = flags.GetInt("short-hash-length")
+		allOrNothing, _   = flags.GetBool("all-or-nothing")
+		annotate, _       = flags.GetBool("annotate-unresolvable")
+		tokenScoped, _    = flags.GetBool("only-if-token-scoped")
+		groupBy, _        = flags.GetString("group-by")
+		codeowners, _     = flags.GetBool("codeowners")
+		tmplRewrite, _    = flags.GetBool("allow-template-rewrite")
+		relVers, _        = flags.GetBool("versions-from-releases")
+		versionMapPath, _ = flags.GetString("version-map")
+		offline, _        = flags.GetBool("offline")
+		verifyComm, _     = flags.GetBool("pin-comment-verify-on-read")
+		verified, _       = flags.GetBool("require-verified")                    // upgrade only
+		versionSource, _  = flags.GetString("action-version-source")             // upgrade only
+		retries, _        = flags.GetInt("consistency-retry")                    // upgrade only
+		prerels, _        = flags.GetStringSlice("include-prereleases-matching") // upgrade only
+		denied, _         = flags.GetStringSlice("deny-version")                 // upgrade only
+		minAge, _         = flags.GetString("min-commit-age")                    // upgrade only
+		parallel, _       = flags.GetBool("parallel")                            // upgrade only
+		interactive, _    = flags.GetBool("interactive")                         // upgrade only
+		edit, _           = flags.GetBool("edit")                                // upgrade only
+		editor, _         = flags.GetString("editor")                            // upgrade only
+		changelog, _      = flags.GetString("changelog-out")                     // upgrade only
 	)
+	// the prompt reads commands from stdin, and the chosen upgrades or plan
+	// are written to stdout, so both must be a terminal
+	if interactive && (!isTerminal(cmd.InOrStdin()) || !isTerminal(cmd.OutOrStdout())) {
+		fprintln(cmd.ErrOrStderr(), "warning: --interactive requires a terminal, continuing non-interactively")
+		interactive = false
+	}
 	var (
-		ctx      = newAppContext(context.Background(), cmd.ErrOrStderr(), chooseLogLevel(verbose))
-		ghClient = NewGitHubClient(token, nil)
+		versions versionMap
+		err      error
 	)
+	if versionMapPath != "" {
+		if versions, err = readVersionMap(versionMapPath); err != nil {
+			return err
+		}
+	}
 
-	var mode PinMode
+	cfgPath, _ := flags.GetString("config")
+	cfg, err := loadConfig(cfgPath)
+	if err != nil {
+		return err
+	}
+	var (
+		mode            PinMode
+		asOf            time.Time
+		committedBefore time.Time
+		lock            Plan
+		deniedVersions  map[string][]string
+	)
 	if cmd.Name() == "pin" {
 		mode = ModeCurrent
+		if lockfile != "" {
+			lock, err = readLockfile(lockfile)
+			if err != nil {
+				return err
+			}
+		}
 	} else {
 		modeStr, _ := flags.GetString("mode")
 		switch modeStr {
@@ -273,49 +1140,410 @@ func pinOrUpgradeCmd(cmd *cobra.Command, args []string) error {
 		default:
 			panic("invalid upgrade mode: " + modeStr)
 		}
+		if asOfStr, _ := flags.GetString("as-of"); asOfStr != "" {
+			asOf, err = parseAsOf(asOfStr)
+			if err != nil {
+				return err
+			}
+		}
+		deniedVersions, err = parseDeniedVersions(denied)
+		if err != nil {
+			return err
+		}
+		if minAge != "" {
+			age, err := parseMinCommitAge(minAge)
+			if err != nil {
+				return err
+			}
+			committedBefore = time.Now().Add(-age)
+		}
 	}
 
-	// ensure our auth token is valid
-	if _, err := ghClient.ValidateAuth(ctx); err != nil {
-		return fmt.Errorf("GitHub authentication failed: %s", err)
+	postWriteCmd, err := splitCommandLine(postWrite)
+	if err != nil {
+		return fmt.Errorf("invalid --post-write-command: %w", err)
 	}
 
-	// find workflow files to work on
-	files, err := FindWorkflows(args)
+	ctx := newAppContext(context.Background(), cmd.ErrOrStderr(), chooseLogLevel(verbose), deterministic)
+	ghClient, root, err := prepareCommand(ctx, cmd, args)
 	if err != nil {
-		return fmt.Errorf("error finding workflow files: %s", err)
+		if errors.Is(err, errNoWorkflows) {
+			return nil
+		}
+		return err
 	}
-	if len(files) == 0 {
-		fprintln(cmd.ErrOrStderr(), "warning: no workflows found")
-		return nil
+
+	// templated workflows are read-only unless their user vouches that
+	// rewriting them line by line is safe
+	if !tmplRewrite {
+		var skipped []string
+		root, skipped = root.withoutTemplated()
+		for _, path := range skipped {
+			fprintf(cmd.ErrOrStderr(), "warning: skipping templated workflow %s (use --allow-template-rewrite to rewrite it)\n", workflowPath(path, relPaths))
+		}
 	}
 
-	// scan workflow files for action steps to upgrade
-	root, err := ScanWorkflows(files, scanOpts{
-		Selects:  selects,
-		Excludes: excludes,
+	// pin or upgrade actions
+	engine := newEngine(root, ghClient, cmd.ErrOrStderr(), engineOpts{
+		Strict:                strict,
+		NoFailFast:            !failFast,
+		Workers:               workers,
+		WorkflowLimit:         wfLimit,
+		Fancy:                 enableFancyOutput(colorArg, verbose),
+		Lang:                  lang,
+		RelativePaths:         relPaths,
+		SuggestTypos:          suggest,
+		OnlyChanged:           onlyChanged,
+		SummaryOnly:           summaryOnly,
+		AllowDowngrade:        downgrade,
+		DryRun:                dryRun,
+		TrustHashes:           trustHashes,
+		BranchesToLatest:      toLatest,
+		MatchRefPrecision:     matchPrec,
+		ReleaseVersions:       relVers,
+		VersionMap:            versions,
+		PrefetchReleases:      parallel,
+		Offline:               offline,
+		VerifyComments:        verifyComm,
+		TreeHashes:            treeHashes,
+		ShortHashLength:       shortHashLength(refStyle, shortLen),
+		AllOrNothing:          allOrNothing,
+		AnnotateUnresolvable:  annotate,
+		RequireRepoAccess:     tokenScoped,
+		AsOf:                  asOf,
+		CommittedBefore:       committedBefore,
+		RequireVerified:       verified,
+		VersionSource:         versionSource,
+		ConsistencyRetries:    retries,
+		PrereleasePatterns:    prerels,
+		DeniedVersions:        deniedVersions,
+		Config:                cfg,
+		PostWriteCommand:      postWriteCmd,
+		IgnorePostWriteErrors: ignorePost,
+		ReportFile:            reportFile,
+		ReportRepo:            cmp.Or(reportKey, defaultReportKey(args)),
+		ChangelogFile:         changelog,
+		GroupBy:               groupBy,
+		CodeOwners:            codeowners,
+		Output:                output,
 	})
+	switch {
+	case commentOnly:
+		return engine.ReconcileComments(ctx, cmd.OutOrStdout())
+	case prune:
+		return engine.PruneComments(ctx, cmd.OutOrStdout())
+	case rewriteOnly:
+		return engine.RewriteOnly(ctx, cmd.OutOrStdout())
+	case lockfile != "":
+		return engine.PinFromLockfile(ctx, cmd.OutOrStdout(), lock)
+	case interactive:
+		return engine.Interactive(ctx, cmd.InOrStdin(), cmd.OutOrStdout(), mode)
+	case edit:
+		return engine.EditPlan(ctx, cmd.OutOrStdout(), mode, commandPlanEditor(editor, cmd.InOrStdin(), cmd.ErrOrStderr()))
+	}
+	if err := engine.Pin(ctx, cmd.OutOrStdout(), mode); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkCmd(cmd *cobra.Command, args []string) error {
+	var (
+		flags                 = cmd.Flags()
+		workers, _            = flags.GetInt("workers")
+		wfLimit, _            = flags.GetInt("concurrent-workflows")
+		strict, _             = flags.GetBool("strict")
+		failFast, _           = flags.GetBool("fail-fast")
+		verbose, _            = flags.GetBool("verbose")
+		colorArg, _           = flags.GetString("color")
+		lang, _               = flags.GetString("lang")
+		relPaths, _           = flags.GetBool("relative-paths")
+		deterministic, _      = flags.GetBool("deterministic")
+		suggest, _            = flags.GetBool("suggest-typos")
+		deprecatedRuntimes, _ = flags.GetBool("deprecated-runtimes")
+		floatingMajors, _     = flags.GetBool("floating-majors")
+		allowedOwners, _      = flags.GetStringSlice("allowed-owners")
+		staleComments, _      = flags.GetBool("stale-comments")
+		consistentPins, _     = flags.GetBool("consistent-pinning")
+		unpinned, _           = flags.GetBool("unpinned")
+		cfgPath, _            = flags.GetString("config")
+		exitZero, _           = flags.GetBool("exit-zero")
+		output, _             = flags.GetString("output")
+	)
+	opts := checkOpts{
+		DeprecatedRuntimes: deprecatedRuntimes,
+		FloatingMajors:     floatingMajors,
+		AllowedOwners:      allowedOwners,
+		StaleComments:      staleComments,
+		ConsistentPinning:  consistentPins,
+		Unpinned:           unpinned,
+	}
+	if opts.empty() {
+		return errNoChecks
+	}
+	if slices.Contains(allowedOwners, "") {
+		return fmt.Errorf("--allowed-owners must not contain empty owner names")
+	}
+	cfg, err := loadConfig(cfgPath)
 	if err != nil {
-		return fmt.Errorf("failed to scan workflow files: %w", err)
+		return err
+	}
+
+	ctx := newAppContext(context.Background(), cmd.ErrOrStderr(), chooseLogLevel(verbose), deterministic)
+	ghClient, root, err := prepareCommand(ctx, cmd, args)
+	if err != nil {
+		if errors.Is(err, errNoWorkflows) {
+			return nil
+		}
+		return err
 	}
 
-	// pin or upgrade actions
 	engine := newEngine(root, ghClient, cmd.ErrOrStderr(), engineOpts{
-		Strict:  strict,
-		Workers: workers,
-		Fancy:   enableFancyOutput(colorArg, verbose),
+		Strict:        strict,
+		NoFailFast:    !failFast,
+		Workers:       workers,
+		WorkflowLimit: wfLimit,
+		Fancy:         enableFancyOutput(colorArg, verbose),
+		Lang:          lang,
+		RelativePaths: relPaths,
+		SuggestTypos:  suggest,
+		Output:        output,
+		Config:        cfg,
 	})
-	if err := engine.Pin(ctx, mode); err != nil {
+	findings, err := engine.Check(ctx, cmd.OutOrStdout(), opts)
+	if err != nil {
+		return err
+	}
+	return findingsError(cmd.ErrOrStderr(), len(findings), "problem(s)", exitZero)
+}
+
+func policyCmd(cmd *cobra.Command, args []string) error {
+	var (
+		flags            = cmd.Flags()
+		workers, _       = flags.GetInt("workers")
+		wfLimit, _       = flags.GetInt("concurrent-workflows")
+		strict, _        = flags.GetBool("strict")
+		failFast, _      = flags.GetBool("fail-fast")
+		verbose, _       = flags.GetBool("verbose")
+		colorArg, _      = flags.GetString("color")
+		lang, _          = flags.GetString("lang")
+		relPaths, _      = flags.GetBool("relative-paths")
+		deterministic, _ = flags.GetBool("deterministic")
+		suggest, _       = flags.GetBool("suggest-typos")
+		configPath, _    = flags.GetString("config")
+		output, _        = flags.GetString("output")
+		exitZero, _      = flags.GetBool("exit-zero")
+	)
+	p, err := loadPolicy(configPath)
+	if err != nil {
+		return err
+	}
+	ctx := newAppContext(context.Background(), cmd.ErrOrStderr(), chooseLogLevel(verbose), deterministic)
+	ghClient, root, err := prepareCommand(ctx, cmd, args)
+	if err != nil {
+		if errors.Is(err, errNoWorkflows) {
+			return nil
+		}
 		return err
 	}
+
+	engine := newEngine(root, ghClient, cmd.ErrOrStderr(), engineOpts{
+		Strict:        strict,
+		NoFailFast:    !failFast,
+		Workers:       workers,
+		WorkflowLimit: wfLimit,
+		Fancy:         enableFancyOutput(colorArg, verbose),
+		Lang:          lang,
+		RelativePaths: relPaths,
+		SuggestTypos:  suggest,
+	})
+	findings, err := engine.EvaluatePolicy(ctx, p)
+	if err != nil {
+		return err
+	}
+	switch output {
+	case outputJSON:
+		err = writePolicyJSON(cmd.OutOrStdout(), findings, relPaths)
+	case outputSARIF:
+		err = writePolicySARIF(cmd.OutOrStdout(), findings)
+	case outputJUnit:
+		err = writeJUnit(cmd.OutOrStdout(), "ghavm policy", root, findings)
+	default:
+		engine.renderFindings(cmd.OutOrStdout(), findings)
+	}
+	if err != nil {
+		return err
+	}
+	return findingsError(cmd.ErrOrStderr(), len(findings), "policy violation(s)", exitZero)
+}
+
+func permissionsCmd(cmd *cobra.Command, args []string) error {
+	commands := args
+	if len(commands) == 0 {
+		commands = apiCommands
+	}
+	perms, err := requiredPermissions(commands)
+	if err != nil {
+		return err
+	}
+	renderPermissions(cmd.OutOrStdout(), commands, perms)
+	return nil
+}
+
+func dependabotCmd(cmd *cobra.Command, args []string) error {
+	var (
+		flags         = cmd.Flags()
+		configPath, _ = flags.GetString("dependabot-config")
+		output, _     = flags.GetString("output")
+	)
+	if configPath == "" {
+		var err error
+		if configPath, err = findDependabotConfig(); err != nil {
+			return err
+		}
+	}
+	updates, err := loadDependabotConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	// Dependabot may check workflows anywhere in the repo, so by default
+	// every .github/workflows directory under the repo root is compared
+	repoRoot := filepath.Dir(filepath.Dir(configPath))
+	var files []string
+	if len(args) == 0 {
+		files, err = findWorkflowsUnder(repoRoot, nil)
+	} else {
+		files, err = FindWorkflows(args)
+	}
+	if err != nil {
+		return fmt.Errorf("error finding workflow files: %s", err)
+	}
+	root, err := ScanWorkflows(files, scanOpts{})
+	if err != nil {
+		return fmt.Errorf("failed to scan workflow files: %w", err)
+	}
+	warnScanProblems(cmd.ErrOrStderr(), root, false)
+
+	gaps := findDependabotGaps(root, repoRoot, configPath, updates)
+	if output == outputJSON {
+		return writeJSON(cmd.OutOrStdout(), gaps)
+	}
+	renderDependabotGaps(cmd.OutOrStdout(), gaps)
+	return nil
+}
+
+func analyzeCmd(cmd *cobra.Command, _ []string, getenv func(string) string) error {
+	var (
+		flags        = cmd.Flags()
+		path, _      = flags.GetString("path")
+		modeStr, _   = flags.GetString("mode")
+		token, _     = flags.GetString("github-token")
+		tokenCmd, _  = flags.GetString("github-token-command")
+		proxy, _     = flags.GetString("proxy")
+		headers, _   = flags.GetStringArray("header")
+		userAgent, _ = flags.GetString("user-agent")
+		verbose, _   = flags.GetBool("verbose")
+		ctx          = newAppContext(context.Background(), cmd.ErrOrStderr(), chooseLogLevel(verbose), false)
+	)
+	httpClient, err := newHTTPClient(proxy, userAgent, headers)
+	if err != nil {
+		return err
+	}
+	token = cmp.Or(token, getenv("GITHUB_TOKEN"))
+	if token == "" && tokenCmd != "" {
+		if token, err = commandTokenProvider(tokenCmd)(ctx); err != nil {
+			return err
+		}
+	}
+	if token == "" {
+		return fmt.Errorf("either --github-token/-g flag or GITHUB_TOKEN env var are required")
+	}
+	ghClient := NewGitHubClient(token, httpClient)
+	if tokenCmd != "" {
+		ghClient.SetTokenProvider(commandTokenProvider(tokenCmd))
+	}
+
+	content, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return fmt.Errorf("failed to read workflow content: %w", err)
+	}
+	var mode PinMode
+	switch modeStr {
+	case "current":
+		mode = ModeCurrent
+	case "latest":
+		mode = ModeLatest
+	default:
+		mode = ModeCompat
+	}
+	engine := newEngine(Root{}, ghClient, cmd.ErrOrStderr(), engineOpts{SummaryOnly: true})
+	analysis, err := engine.AnalyzeContent(ctx, path, content, mode)
+	if err != nil {
+		return err
+	}
+	return writeAnalysisJSON(cmd.OutOrStdout(), analysis)
+}
+
+func doctorCmd(cmd *cobra.Command, args []string, getenv func(string) string) error {
+	var (
+		flags        = cmd.Flags()
+		token, _     = flags.GetString("github-token")
+		tokenCmd, _  = flags.GetString("github-token-command")
+		proxy, _     = flags.GetString("proxy")
+		headers, _   = flags.GetStringArray("header")
+		userAgent, _ = flags.GetString("user-agent")
+		verbose, _   = flags.GetBool("verbose")
+		ctx          = newAppContext(context.Background(), cmd.ErrOrStderr(), chooseLogLevel(verbose), false)
+		out          = cmd.OutOrStdout()
+	)
+	httpClient, err := newHTTPClient(proxy, userAgent, headers)
+	if err != nil {
+		return err
+	}
+
+	// find a token the same way the other commands do, but report a missing
+	// token as a failed check rather than an error
+	opts := doctorOpts{Token: token, TokenSource: "--github-token", Paths: args}
+	if opts.Token == "" {
+		opts.Token, opts.TokenSource = getenv("GITHUB_TOKEN"), "GITHUB_TOKEN env var"
+	}
+	if opts.Token == "" && tokenCmd != "" {
+		opts.TokenSource = "--github-token-command"
+		if opts.Token, err = commandTokenProvider(tokenCmd)(ctx); err != nil {
+			fprintln(out, err)
+		}
+	}
+
+	ghClient := NewGitHubClient(opts.Token, httpClient)
+	checks := runDoctor(ctx, ghClient, opts)
+	renderDoctor(out, style.New(enableFancyOutput("auto", verbose)), checks)
+
+	failed := 0
+	for _, check := range checks {
+		if !check.OK && !check.Skipped {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("found %d problem(s)", failed)
+	}
 	return nil
 }
 
-func newAppContext(ctx context.Context, out io.Writer, level slog.Level) context.Context {
-	logger := slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{
-		Level: level,
-	}))
-	return slogctx.New(ctx, logger)
+// newAppContext returns a context carrying a logger that writes to out at
+// the given level, omitting timestamps from each record if deterministic.
+func newAppContext(ctx context.Context, out io.Writer, level slog.Level, deterministic bool) context.Context {
+	opts := &slog.HandlerOptions{Level: level}
+	if deterministic {
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+	return slogctx.New(ctx, slog.New(slog.NewTextHandler(out, opts)))
 }
 
 // chooseLogLevel returns an appropriate log level based on the given verbose
@@ -344,6 +1572,380 @@ func enableFancyOutput(colorArg string, verboseArg bool) bool {
 	}
 }
 
+// maxSafeWorkers is the number of workers above which we expect to run into
+// GitHub's secondary rate limits on concurrent requests.
+const maxSafeWorkers = 20
+
+// parseAsOf parses an --as-of value, which may be either a date or an
+// RFC 3339 timestamp. A date refers to the very end of that day in UTC, so
+// that releases published at any point on that day are included.
+func parseAsOf(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t.Add(24*time.Hour - time.Nanosecond), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--as-of must be a date (YYYY-MM-DD) or an RFC 3339 timestamp, got %q", s)
+	}
+	return t, nil
+}
+
+// parseMinCommitAge parses a --min-commit-age value (see [parseAge]).
+func parseMinCommitAge(s string) (time.Duration, error) {
+	age, err := parseAge(s)
+	if err != nil {
+		return 0, fmt.Errorf("--min-commit-age %w", err)
+	}
+	return age, nil
+}
+
+// parseAge parses an age, which may be either a whole number of days (e.g.
+// 3d) or a Go duration (e.g. 36h).
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("must be a number of days (e.g. 3d) or a duration (e.g. 36h), got %q", s)
+}
+
+// parseDeniedVersions parses --deny-version values of the form
+// owner/repo@version into a map of canonical repo names to their denied
+// versions (see [parseDeniedVersion]).
+func parseDeniedVersions(values []string) (map[string][]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	denied := make(map[string][]string, len(values))
+	for _, v := range values {
+		repo, version, err := parseDeniedVersion(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --deny-version: %w", err)
+		}
+		denied[repo] = append(denied[repo], version)
+	}
+	return denied, nil
+}
+
+// parseDeniedVersion parses a denied version of the form owner/repo@version
+// into a canonical repo name and version. A path within the repo (e.g.
+// github/codeql-action/init@v3.1.0) is accepted, but the version is denied
+// for every action in the repo, since they share releases.
+func parseDeniedVersion(s string) (repo string, version string, err error) {
+	name, version, ok := strings.Cut(s, "@")
+	repo = Action{Name: name}.Repo()
+	if !ok || version == "" || !strings.Contains(repo, "/") {
+		return "", "", fmt.Errorf("must be in owner/repo@version format, got %q", s)
+	}
+	return canonicalName(repo), cmp.Or(canonicalVersion(version), version), nil
+}
+
+// excludeRulesValue is a flag value shared by the --exclude, --include, and
+// --exclude-owner flags, which records their patterns in the order they were
+// given so that later rules can override earlier ones. Re-included patterns
+// are recorded with a "!" prefix, which may also be given directly to
+// --exclude.
+type excludeRulesValue struct {
+	rules  *[]string
+	negate bool
+	owner  bool
+}
+
+// negated returns a value that appends re-include rules to the same list.
+func (v *excludeRulesValue) negated() *excludeRulesValue {
+	return &excludeRulesValue{rules: v.rules, negate: true}
+}
+
+// owners returns a value that appends rules excluding every action published
+// by the given owners to the same list.
+func (v *excludeRulesValue) owners() *excludeRulesValue {
+	return &excludeRulesValue{rules: v.rules, owner: true}
+}
+
+func (v *excludeRulesValue) Set(s string) error {
+	for _, pattern := range strings.Split(s, ",") {
+		if v.owner {
+			if err := validateOwner(pattern); err != nil {
+				return err
+			}
+			pattern += "/*"
+		}
+		if v.negate {
+			pattern = "!" + pattern
+		}
+		*v.rules = append(*v.rules, pattern)
+	}
+	return nil
+}
+
+func (v *excludeRulesValue) String() string {
+	return strings.Join(*v.rules, ",")
+}
+
+func (v *excludeRulesValue) Type() string {
+	return "strings"
+}
+
+// hostTokensValue is a repeatable flag value mapping hosts to the env vars
+// holding their tokens, which are resolved by resolve.
+type hostTokensValue struct {
+	values []string
+	tokens map[string]string
+}
+
+func (v *hostTokensValue) Set(s string) error {
+	v.values = append(v.values, s)
+	return nil
+}
+
+func (v *hostTokensValue) String() string {
+	return strings.Join(v.values, ",")
+}
+
+func (v *hostTokensValue) Type() string {
+	return "host=env"
+}
+
+// resolve parses each host=ENV_VAR value and looks up its token, which
+// must not be empty.
+func (v *hostTokensValue) resolve(getenv func(string) string) error {
+	tokens := make(map[string]string, len(v.values))
+	for _, value := range v.values {
+		host, envVar, _ := strings.Cut(value, "=")
+		host = strings.ToLower(host)
+		if host == "" || envVar == "" || strings.ContainsAny(host, ":/") {
+			return fmt.Errorf("must be in host=ENV_VAR format, got %q", value)
+		}
+		if _, ok := tokens[host]; ok {
+			return fmt.Errorf("duplicate host %q", host)
+		}
+		token := getenv(envVar)
+		if token == "" {
+			return fmt.Errorf("env var %s for host %q is empty or unset", envVar, host)
+		}
+		tokens[host] = token
+	}
+	v.tokens = tokens
+	return nil
+}
+
+// getHostTokens returns the tokens given to the command by --host-token,
+// keyed by host.
+func getHostTokens(cmd *cobra.Command) map[string]string {
+	if f := cmd.Flags().Lookup("host-token"); f != nil {
+		if v, ok := f.Value.(*hostTokensValue); ok {
+			return v.tokens
+		}
+	}
+	return nil
+}
+
+// getSelects returns the --select patterns given to the command, along with
+// a wildcard pattern for each --select-owner.
+func getSelects(cmd *cobra.Command) []string {
+	selects, _ := cmd.Flags().GetStringSlice("select")
+	owners, _ := cmd.Flags().GetStringSlice("select-owner")
+	for _, owner := range owners {
+		selects = append(selects, owner+"/*")
+	}
+	return selects
+}
+
+// getRefKinds returns the kinds of refs to limit the command to, given
+// --only-pinned or --only-floating, or nil to include every kind.
+func getRefKinds(cmd *cobra.Command) []RefKind {
+	if pinned, _ := cmd.Flags().GetBool("only-pinned"); pinned {
+		return []RefKind{RefKindCommit}
+	}
+	if floating, _ := cmd.Flags().GetBool("only-floating"); floating {
+		return []RefKind{RefKindVersion, RefKindOther}
+	}
+	return nil
+}
+
+// validateOwner ensures that an --exclude-owner or --select-owner value is a
+// bare owner name.
+func validateOwner(owner string) error {
+	if owner == "" || strings.ContainsAny(owner, "/*") {
+		return fmt.Errorf("must be an owner name without slashes or wildcards (e.g. \"actions\"), got %q", owner)
+	}
+	return nil
+}
+
+// getExcludeRules returns the ordered --exclude and --include rules given to
+// the command.
+func getExcludeRules(cmd *cobra.Command) []string {
+	if v, ok := cmd.Flags().Lookup("exclude").Value.(*excludeRulesValue); ok && len(*v.rules) > 0 {
+		return *v.rules
+	}
+	return nil
+}
+
+// defaultReportKey identifies the repo being processed in a --report-file by
+// the absolute path of the repo containing the first path argument, or the
+// current directory if none were given.
+func defaultReportKey(args []string) string {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+	}
+	root := findRepoRoot(dir)
+	if abs, err := filepath.Abs(root); err == nil {
+		return abs
+	}
+	return root
+}
+
+// findingsError returns an error reporting the given number of findings
+// (e.g. check problems), or nil if there are none. With --exit-zero, the error
+// is only written to stderr as a warning, so that the command exits zero.
+func findingsError(stderr io.Writer, count int, noun string, exitZero bool) error {
+	if count == 0 {
+		return nil
+	}
+	err := fmt.Errorf("found %d %s", count, noun)
+	if exitZero {
+		fprintf(stderr, "warning: %s, exiting zero because of --exit-zero\n", err)
+		return nil
+	}
+	return err
+}
+
+// warnScanProblems writes a warning for each problem found while scanning the
+// workflows in root, in workflow order, optionally showing workflow paths
+// relative to their repo roots (see [workflowPath]).
+func warnScanProblems(dst io.Writer, root Root, relative bool) {
+	for _, path := range slices.Sorted(maps.Keys(root.Workflows)) {
+		for _, warning := range root.Workflows[path].Warnings {
+			fprintf(dst, "warning: %s: %s\n", workflowPath(path, relative), warning)
+		}
+	}
+}
+
+// findWorkflows finds workflow files in the given paths, as [FindWorkflows]
+// does, limited to those within scope, if given. If a scope but no paths are
+// given, the workflows in every .github/workflows directory under the scope
+// are found instead of those at the root of the repo.
+func findWorkflows(paths []string, scope string, templatePatterns []string) ([]string, error) {
+	if scope == "" {
+		return FindWorkflows(paths, templatePatterns...)
+	}
+	if len(paths) == 0 {
+		return findWorkflowsUnder(scope, templatePatterns)
+	}
+	files, err := FindWorkflows(paths, templatePatterns...)
+	if err != nil {
+		return nil, err
+	}
+	return scopeWorkflows(files, scope)
+}
+
+// defaultEditor is the editor used by --edit when neither VISUAL nor EDITOR
+// is set.
+const defaultEditor = "vi"
+
+// commandPlanEditor returns a [PlanEditor] that runs the given --editor
+// command on the plan file, connected to the user's terminal.
+func commandPlanEditor(command string, stdin io.Reader, out io.Writer) PlanEditor {
+	args, parseErr := splitCommandLine(command)
+	return func(ctx context.Context, path string) error {
+		if parseErr != nil {
+			return fmt.Errorf("invalid --editor: %w", parseErr)
+		}
+		if len(args) == 0 {
+			return errors.New("--editor must not be empty")
+		}
+		// #nosec G204 -- the command is explicitly configured by the user
+		editor := exec.CommandContext(ctx, args[0], append(args[1:], path)...)
+		editor.Stdin, editor.Stdout, editor.Stderr = stdin, out, out
+		return editor.Run()
+	}
+}
+
+// splitCommandLine splits a user-supplied command line into its arguments
+// the way a POSIX shell would, honoring single quotes, double quotes, and
+// backslash escapes, so that e.g. --editor 'code --wait' and arguments
+// containing spaces work as expected. No other shell expansion is done.
+func splitCommandLine(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	switch {
+	case escaped:
+		return nil, errors.New("unfinished backslash escape")
+	case quote != 0:
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// commandTokenProvider returns a [TokenProvider] that runs the given
+// --github-token-command and uses its trimmed stdout as the token.
+func commandTokenProvider(command string) TokenProvider {
+	args, parseErr := splitCommandLine(command)
+	return func(ctx context.Context) (string, error) {
+		if parseErr != nil {
+			return "", fmt.Errorf("invalid --github-token-command: %w", parseErr)
+		}
+		if len(args) == 0 {
+			return "", errors.New("--github-token-command must not be empty")
+		}
+		// #nosec G204 -- the command is explicitly configured by the user
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && len(bytes.TrimSpace(exitErr.Stderr)) > 0 {
+				err = fmt.Errorf("%w\n%s", err, bytes.TrimSpace(exitErr.Stderr))
+			}
+			return "", fmt.Errorf("--github-token-command failed: %w", err)
+		}
+		token := strings.TrimSpace(string(out))
+		if token == "" {
+			return "", errors.New("--github-token-command printed an empty token")
+		}
+		return token, nil
+	}
+}
+
 // wrapPreRunE acts as a "middleware" for cobra Command.PreRunE functions.
 func wrapPreRunE(cmd *cobra.Command, newPreRunE preRunE) preRunE {
 	if cmd.PreRunE == nil {
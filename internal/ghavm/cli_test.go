@@ -1,9 +1,13 @@
 package ghavm
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"strings"
 	"testing"
 
+	"github.com/mccutchen/ghavm/internal/slogctx"
 	"github.com/mccutchen/ghavm/internal/testing/assert"
 )
 
@@ -43,11 +47,46 @@ func TestCLI(t *testing.T) {
 			wantErr:    true,
 			wantStderr: "Error: unknown command \"invalid\" for \"ghavm\"\nRun 'ghavm --help' for usage.",
 		},
+		"analyze without a path": {
+			args:       []string{"analyze", "-g", "token"},
+			wantErr:    true,
+			wantStderr: "Error: required flag(s) \"path\" not set",
+		},
+		"analyze with an invalid mode": {
+			args:       []string{"analyze", "-g", "token", "--path", "ci.yaml", "--mode", "nope"},
+			wantErr:    true,
+			wantStderr: "Error: --mode/-m must be one of \"current\", \"compat\", or \"latest\"",
+		},
 		"missing github token": {
 			args:       []string{"list"},
 			wantErr:    true,
 			wantStderr: "Error: either --github-token/-g flag or GITHUB_TOKEN env var are required",
 		},
+		"pin prune-comments needs no github token": {
+			args:       []string{"pin", "--prune-comments", "testdata/missing-dir"},
+			wantErr:    true,
+			wantStderr: "Error: error finding workflow files: stat testdata/missing-dir: no such file or directory",
+		},
+		"pin from-lockfile needs no github token": {
+			args:       []string{"pin", "--from-lockfile", "testdata/missing-lock.json"},
+			wantErr:    true,
+			wantStderr: "Error: failed to read lockfile: open testdata/missing-lock.json: no such file or directory",
+		},
+		"failing github token command": {
+			args:       []string{"list", "--github-token-command", "false"},
+			wantErr:    true,
+			wantStderr: "Error: --github-token-command failed: exit status 1",
+		},
+		"unterminated github token command quote": {
+			args:       []string{"list", "--github-token-command", "echo 'token"},
+			wantErr:    true,
+			wantStderr: "Error: invalid --github-token-command: unterminated ' quote",
+		},
+		"empty github token command output": {
+			args:       []string{"list", "--github-token-command", "true"},
+			wantErr:    true,
+			wantStderr: "Error: --github-token-command printed an empty token",
+		},
 		"invalid color flag": {
 			args:       []string{"list", "--github-token", "fake", "--color", "invalid"},
 			wantErr:    true,
@@ -64,6 +103,52 @@ func TestCLI(t *testing.T) {
 			wantErr:    true,
 			wantStderr: `Error: --mode/-m must be one of "compat" or "latest"`,
 		},
+		"fail-fast disabled without strict": {
+			args:       []string{"list", "--github-token", "fake", "--fail-fast=false"},
+			wantErr:    true,
+			wantStderr: "Error: --fail-fast=false requires --strict",
+		},
+		"negative concurrent workflows": {
+			args:       []string{"list", "--github-token", "fake", "--concurrent-workflows", "-1"},
+			wantErr:    true,
+			wantStderr: "Error: --concurrent-workflows must not be negative",
+		},
+		"invalid proxy": {
+			args:       []string{"list", "--github-token", "fake", "--proxy", "proxy.example:3128"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --proxy: invalid proxy URL "proxy.example:3128": scheme must be one of http, https, or socks5`,
+		},
+		"invalid header": {
+			args:       []string{"list", "--github-token", "fake", "-H", "X-Waf-Token"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --header/-H: invalid header "X-Waf-Token": must be in "Name: value" format`,
+		},
+		"invalid host token": {
+			args:       []string{"list", "--github-token", "fake", "--host-token", "ghes.example.com"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --host-token: must be in host=ENV_VAR format, got "ghes.example.com"`,
+		},
+		"host token with unset env var": {
+			args:       []string{"list", "--github-token", "fake", "--host-token", "ghes.example.com=GHES_TOKEN"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --host-token: env var GHES_TOKEN for host "ghes.example.com" is empty or unset`,
+		},
+		"duplicate host token": {
+			args:       []string{"list", "--github-token", "fake", "--host-token", "ghes.example.com=GHES_TOKEN", "--host-token", "GHES.example.com=OTHER_TOKEN"},
+			env:        map[string]string{"GHES_TOKEN": "a", "OTHER_TOKEN": "b"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --host-token: duplicate host "ghes.example.com"`,
+		},
+		"invalid as-of date": {
+			args:       []string{"upgrade", "--github-token", "fake", "--as-of", "01/01/2023"},
+			wantErr:    true,
+			wantStderr: `Error: --as-of must be a date (YYYY-MM-DD) or an RFC 3339 timestamp, got "01/01/2023"`,
+		},
+		"too many workers warns": {
+			args:       []string{"pin", "--github-token", "fake", "--workers", "50", "--select", "*/invalid"},
+			wantErr:    true,
+			wantStderr: "warning: --workers above 20 will likely hit GitHub API rate limits\nError: invalid --select pattern: wildcards are only supported at the end of patterns, got: \"*/invalid\"",
+		},
 		"invalid select pattern": {
 			args:       []string{"pin", "--github-token", "fake", "--select", "*/invalid"},
 			wantErr:    true,
@@ -79,6 +164,241 @@ func TestCLI(t *testing.T) {
 			wantErr:    true,
 			wantStderr: `Error: invalid --exclude pattern: multiple wildcards not supported, got: "actions/*/*/*"`,
 		},
+		"invalid include pattern": {
+			args:       []string{"pin", "--github-token", "fake", "--exclude", "actions/*", "--include", "*/checkout"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --include pattern: wildcards are only supported at the end of patterns, got: "*/checkout"`,
+		},
+		"invalid negated exclude pattern": {
+			args:       []string{"pin", "--github-token", "fake", "--exclude", "!actions/*/*"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --include pattern: multiple wildcards not supported, got: "actions/*/*"`,
+		},
+		"exclude-owner with slash": {
+			args:       []string{"pin", "--github-token", "fake", "--exclude-owner", "actions/checkout"},
+			wantErr:    true,
+			wantStderr: `Error: invalid argument "actions/checkout" for "--exclude-owner" flag: must be an owner name without slashes or wildcards (e.g. "actions"), got "actions/checkout"`,
+		},
+		"select-owner with wildcard": {
+			args:       []string{"list", "--github-token", "fake", "--select-owner", "actions*"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --select-owner: must be an owner name without slashes or wildcards (e.g. "actions"), got "actions*"`,
+		},
+		"invalid include-prereleases-matching pattern": {
+			args:       []string{"upgrade", "--github-token", "fake", "--include-prereleases-matching", "*/action"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --include-prereleases-matching pattern: wildcards are only supported at the end of patterns, got: "*/action"`,
+		},
+		"consistency-retry without a value": {
+			args:       []string{"list", "--github-token", "fake", "--consistency-retry"},
+			wantErr:    true,
+			wantStderr: "Error: flag needs an argument: --consistency-retry",
+		},
+		"invalid deny-version": {
+			args:       []string{"upgrade", "--github-token", "fake", "--deny-version", "actions/checkout"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --deny-version: must be in owner/repo@version format, got "actions/checkout"`,
+		},
+		"invalid min-commit-age": {
+			args:       []string{"upgrade", "--github-token", "fake", "--min-commit-age", "3 days"},
+			wantErr:    true,
+			wantStderr: `Error: --min-commit-age must be a number of days (e.g. 3d) or a duration (e.g. 36h), got "3 days"`,
+		},
+		"deny-version without repo": {
+			args:       []string{"list", "--github-token", "fake", "--deny-version", "checkout@v4.2.0"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --deny-version: must be in owner/repo@version format, got "checkout@v4.2.0"`,
+		},
+		"missing config file": {
+			args:       []string{"list", "--github-token", "fake", "--config", "testdata/missing.ghavm.yaml"},
+			wantErr:    true,
+			wantStderr: "Error: failed to read config file: open testdata/missing.ghavm.yaml: no such file or directory",
+		},
+		"invalid output format": {
+			args:       []string{"upgrade", "--github-token", "fake", "--output", "yaml"},
+			wantErr:    true,
+			wantStderr: `Error: --output/-o must be one of "text", "json", or "diffstat"`,
+		},
+		"diffstat output with dry run": {
+			args:       []string{"pin", "--github-token", "fake", "--output", "diffstat", "--dry-run"},
+			wantErr:    true,
+			wantStderr: "Error: --output/-o diffstat cannot be used with --dry-run",
+		},
+		"missing lockfile": {
+			args:       []string{"pin", "--github-token", "fake", "--from-lockfile", "testdata/missing.lock.json"},
+			wantErr:    true,
+			wantStderr: "Error: failed to read lockfile: open testdata/missing.lock.json: no such file or directory",
+		},
+		"lockfile with comment-only": {
+			args:       []string{"pin", "--github-token", "fake", "--from-lockfile", "ghavm.lock.json", "--comment-only"},
+			wantErr:    true,
+			wantStderr: "Error: if any flags in the group [comment-only prune-comments from-lockfile rewrite-only] are set none of the others can be; [comment-only from-lockfile] were all set",
+		},
+		"pin rewrite-only with prune-comments": {
+			args:       []string{"pin", "--rewrite-only", "--prune-comments"},
+			wantErr:    true,
+			wantStderr: "Error: if any flags in the group [comment-only prune-comments from-lockfile rewrite-only] are set none of the others can be; [prune-comments rewrite-only] were all set",
+		},
+		"invalid group-by": {
+			args:       []string{"upgrade", "--github-token", "fake", "--group-by", "repo"},
+			wantErr:    true,
+			wantStderr: `Error: --group-by must be one of "owner" or "change"`,
+		},
+		"report key requires report file": {
+			args:       []string{"pin", "--github-token", "fake", "--report-key", "owner/repo"},
+			wantErr:    true,
+			wantStderr: "Error: --report-key requires --report-file",
+		},
+		"check with empty allowed owner": {
+			args:       []string{"check", "--github-token", "fake", "--allowed-owners", "actions,"},
+			wantErr:    true,
+			wantStderr: "Error: --allowed-owners must not contain empty owner names",
+		},
+		"check without any checks enabled": {
+			args:       []string{"check", "--github-token", "fake"},
+			wantErr:    true,
+			wantStderr: "Error: at least one check must be enabled",
+		},
+		"invalid include-templated pattern": {
+			args:       []string{"list", "--github-token", "fake", "--include-templated", "templates/*.j2"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --include-templated pattern: must be a file name pattern without slashes (e.g. "*.yaml.j2"), got "templates/*.j2"`,
+		},
+		"missing git mirror": {
+			args:       []string{"list", "--git-mirror", "testdata/missing-mirror"},
+			wantErr:    true,
+			wantStderr: "Error: invalid --git-mirror: stat testdata/missing-mirror: no such file or directory",
+		},
+		"git mirror with require-verified": {
+			args:       []string{"upgrade", "--git-mirror", "testdata", "--require-verified"},
+			wantErr:    true,
+			wantStderr: "Error: --require-verified cannot be used with --git-mirror, since signatures cannot be verified locally",
+		},
+		"missing scope": {
+			args:       []string{"list", "--github-token", "fake", "--scope", "testdata/missing-scope"},
+			wantErr:    true,
+			wantStderr: "Error: invalid --scope: stat testdata/missing-scope: no such file or directory",
+		},
+		"invalid action version source": {
+			args:       []string{"upgrade", "--github-token", "fake", "--action-version-source", "branches"},
+			wantErr:    true,
+			wantStderr: `Error: --action-version-source must be one of "releases", "tags", or "both"`,
+		},
+		"unknown only-changed-since ref": {
+			args:       []string{"list", "--github-token", "fake", "--only-changed-since", "no-such-ref"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --only-changed-since: unknown git ref "no-such-ref"`,
+		},
+		"negative max retries": {
+			args:       []string{"list", "--github-token", "fake", "--retry-on-5xx", "--max-retries", "-1"},
+			wantErr:    true,
+			wantStderr: "Error: invalid --max-retries: must not be negative, got -1",
+		},
+		"permissions for unknown command": {
+			args:       []string{"permissions", "frobnicate"},
+			wantErr:    true,
+			wantStderr: `Error: unknown command "frobnicate", must be one of list, pin, upgrade, check, policy, analyze, doctor`,
+		},
+		"only pinned and only floating": {
+			args:       []string{"list", "--github-token", "fake", "--only-pinned", "--only-floating"},
+			wantErr:    true,
+			wantStderr: "Error: if any flags in the group [only-pinned only-floating] are set none of the others can be; [only-floating only-pinned] were all set",
+		},
+		"unsupported lang": {
+			args:       []string{"list", "--github-token", "fake", "--lang", "fr"},
+			wantErr:    true,
+			wantStderr: `Error: invalid --lang: unsupported language "fr", must be one of en, es`,
+		},
+		"force refresh without state file": {
+			args:       []string{"list", "--github-token", "fake", "--force-refresh"},
+			wantErr:    true,
+			wantStderr: "Error: --force-refresh requires --since-last-run",
+		},
+		"invalid ref style": {
+			args:       []string{"pin", "--github-token", "fake", "--ref-style", "medium"},
+			wantErr:    true,
+			wantStderr: `Error: --ref-style must be one of "full" or "short"`,
+		},
+		"short hash length too short": {
+			args:       []string{"pin", "--github-token", "fake", "--ref-style", "short", "--short-hash-length", "4"},
+			wantErr:    true,
+			wantStderr: "Error: --short-hash-length must be between 7 and 39",
+		},
+		"dependabot with invalid output": {
+			args:       []string{"dependabot", "--output", "sarif"},
+			wantErr:    true,
+			wantStderr: `Error: --output/-o must be one of "text" or "json"`,
+		},
+		"dependabot with missing config": {
+			args:       []string{"dependabot", "--dependabot-config", "testdata/missing-dependabot.yml"},
+			wantErr:    true,
+			wantStderr: "Error: Dependabot config testdata/missing-dependabot.yml not found",
+		},
+		"list with invalid output": {
+			args:       []string{"list", "--github-token", "fake", "--output", "sarif"},
+			wantErr:    true,
+			wantStderr: `Error: --output/-o must be one of "text", "json", or "html"`,
+		},
+		"list with invalid transitive depth": {
+			args:       []string{"list", "--github-token", "fake", "--transitive", "--transitive-depth", "0"},
+			wantErr:    true,
+			wantStderr: "Error: --transitive-depth must be at least 1",
+		},
+		"list html output with compare-to": {
+			args:       []string{"list", "--github-token", "fake", "--output", "html", "--compare-to", "baseline.json"},
+			wantErr:    true,
+			wantStderr: "Error: --output/-o html cannot be used with --compare-to",
+		},
+		"list compare-to with watch": {
+			args:       []string{"list", "--github-token", "fake", "--compare-to", "baseline.json", "--watch"},
+			wantErr:    true,
+			wantStderr: "Error: if any flags in the group [compare-to watch] are set none of the others can be; [compare-to watch] were all set",
+		},
+		"list with missing baseline": {
+			args:       []string{"list", "--github-token", "fake", "--compare-to", "testdata/missing-baseline.json"},
+			wantErr:    true,
+			wantStderr: "Error: failed to read baseline: open testdata/missing-baseline.json: no such file or directory",
+		},
+		"upgrade edit with interactive": {
+			args:       []string{"upgrade", "--github-token", "fake", "--edit", "--interactive"},
+			wantErr:    true,
+			wantStderr: "Error: if any flags in the group [edit interactive] are set none of the others can be; [edit interactive] were all set",
+		},
+		"check with invalid output": {
+			args:       []string{"check", "--github-token", "fake", "--deprecated-runtimes", "--output", "json"},
+			wantErr:    true,
+			wantStderr: `Error: --output/-o must be one of "text" or "junit"`,
+		},
+		"deterministic with workers": {
+			args:       []string{"list", "--github-token", "fake", "--deterministic", "--workers", "4"},
+			wantErr:    true,
+			wantStderr: "Error: if any flags in the group [deterministic workers] are set none of the others can be; [deterministic workers] were all set",
+		},
+		"deterministic without relative paths": {
+			args:       []string{"list", "--github-token", "fake", "--deterministic", "--relative-paths=false"},
+			wantErr:    true,
+			wantStderr: "Error: --deterministic cannot be used with --relative-paths=false",
+		},
+		"offline without version map": {
+			args:       []string{"pin", "--github-token", "fake", "--offline"},
+			wantErr:    true,
+			wantStderr: "Error: --offline requires --version-map",
+		},
+		"missing version map": {
+			args:       []string{"list", "--github-token", "fake", "--version-map", "testdata/missing-versions.json"},
+			wantErr:    true,
+			wantStderr: "Error: failed to read version map: open testdata/missing-versions.json: no such file or directory",
+		},
+		"policy with invalid output": {
+			args:       []string{"policy", "--github-token", "fake", "--output", "diffstat"},
+			wantErr:    true,
+			wantStderr: `Error: --output/-o must be one of "text", "json", "sarif", or "junit"`,
+		},
+		"policy with missing policy file": {
+			args:       []string{"policy", "--github-token", "fake", "--config", "testdata/missing-policy.yaml"},
+			wantErr:    true,
+			wantStderr: "Error: failed to read policy file: open testdata/missing-policy.yaml: no such file or directory",
+		},
 	}
 
 	for name, tc := range testCases {
@@ -104,3 +424,143 @@ func TestCLI(t *testing.T) {
 		})
 	}
 }
+
+func TestFindingsError(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		count      int
+		exitZero   bool
+		wantErr    error
+		wantStderr string
+	}{
+		"no findings": {
+			count: 0,
+		},
+		"findings": {
+			count:   2,
+			wantErr: errors.New("found 2 problem(s)"),
+		},
+		"findings with exit zero": {
+			count:      2,
+			exitZero:   true,
+			wantStderr: "warning: found 2 problem(s), exiting zero because of --exit-zero\n",
+		},
+		"no findings with exit zero": {
+			count:    0,
+			exitZero: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var stderr strings.Builder
+			err := findingsError(&stderr, tc.count, "problem(s)", tc.exitZero)
+			if tc.wantErr != nil {
+				assert.Error(t, err, tc.wantErr)
+			} else {
+				assert.NilError(t, err)
+			}
+			assert.Equal(t, stderr.String(), tc.wantStderr, "incorrect stderr")
+		})
+	}
+}
+
+func TestExcludeRulesOrder(t *testing.T) {
+	t.Parallel()
+
+	app, _, _ := newTestApp(func(string) string { return "" })
+	pinCmd, _, err := app.Find([]string{"pin"})
+	assert.NilError(t, err)
+	assert.NilError(t, pinCmd.ParseFlags([]string{
+		"--exclude", "actions/*",
+		"--include", "actions/checkout,actions/setup-go",
+		"-e", "actions/setup-go",
+		"--exclude-owner", "myorg,other",
+		"--include", "myorg/deploy",
+	}))
+	assert.DeepEqual(t, getExcludeRules(pinCmd), []string{
+		"actions/*",
+		"!actions/checkout",
+		"!actions/setup-go",
+		"actions/setup-go",
+		"myorg/*",
+		"other/*",
+		"!myorg/deploy",
+	}, "incorrect exclude rules")
+}
+
+func TestGetSelects(t *testing.T) {
+	t.Parallel()
+
+	app, _, _ := newTestApp(func(string) string { return "" })
+	listCmd, _, err := app.Find([]string{"list"})
+	assert.NilError(t, err)
+	assert.NilError(t, listCmd.ParseFlags([]string{
+		"--select-owner", "myorg",
+		"--select", "actions/checkout",
+	}))
+	assert.DeepEqual(t, getSelects(listCmd), []string{
+		"actions/checkout",
+		"myorg/*",
+	}, "incorrect selects")
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		command string
+		want    []string
+		wantErr error
+	}{
+		"empty": {
+			command: "  ",
+			want:    nil,
+		},
+		"plain words": {
+			command: "yamlfmt  -conf .yamlfmt",
+			want:    []string{"yamlfmt", "-conf", ".yamlfmt"},
+		},
+		"quoted args": {
+			command: `code --wait "--user-data-dir=/tmp/my dir" 'a "b"' ''`,
+			want:    []string{"code", "--wait", "--user-data-dir=/tmp/my dir", `a "b"`, ""},
+		},
+		"escapes": {
+			command: `prettier --write my\ file "say \"hi\""`,
+			want:    []string{"prettier", "--write", "my file", `say "hi"`},
+		},
+		"unterminated quote": {
+			command: `sh -c "echo`,
+			wantErr: errors.New(`unterminated " quote`),
+		},
+		"trailing backslash": {
+			command: `yamlfmt \`,
+			wantErr: errors.New("unfinished backslash escape"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := splitCommandLine(tc.command)
+			if tc.wantErr != nil {
+				assert.Error(t, err, tc.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tc.want, "incorrect args")
+		})
+	}
+}
+
+func TestNewAppContextDeterministic(t *testing.T) {
+	t.Parallel()
+
+	for _, deterministic := range []bool{false, true} {
+		var buf strings.Builder
+		ctx := newAppContext(context.Background(), &buf, slog.LevelDebug, deterministic)
+		slogctx.Debug(ctx, "resolved", "action", "actions/checkout")
+		assert.Contains(t, buf.String(), "level=DEBUG msg=resolved action=actions/checkout", "incorrect log record")
+		assert.Equal(t, strings.Contains(buf.String(), "time="), !deterministic, "incorrect timestamp presence")
+	}
+}
@@ -0,0 +1,210 @@
+package ghavm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// codeownersLocations are the paths, relative to the root of a repo, where
+// GitHub looks for a CODEOWNERS file, in the order it looks for them. Only the
+// first one found is used.
+var codeownersLocations = []string{
+	filepath.Join(".github", "CODEOWNERS"),
+	"CODEOWNERS",
+	filepath.Join("docs", "CODEOWNERS"),
+}
+
+// codeowners is a parsed CODEOWNERS file.
+type codeowners struct {
+	rules []codeownersRule
+}
+
+// codeownersRule is a single line of a CODEOWNERS file, assigning the paths
+// matching a pattern to a set of owners. A rule with no owners leaves the
+// matching paths unowned.
+type codeownersRule struct {
+	pattern string
+	re      *regexp.Regexp
+	owners  []string
+}
+
+// parseCodeowners parses a CODEOWNERS file read from r.
+//
+// Following GitHub's behavior, lines with invalid patterns (e.g. those using
+// gitignore's "!" negation or "[ ]" character ranges, which CODEOWNERS does
+// not support) are skipped rather than treated as errors.
+func parseCodeowners(r io.Reader) (codeowners, error) {
+	var co codeowners
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		// a pattern starting with a literal # must escape it
+		pattern := strings.Replace(fields[0], `\#`, "#", 1)
+		var owners []string
+		for _, f := range fields[1:] {
+			if strings.HasPrefix(f, "#") {
+				break // trailing comment
+			}
+			owners = append(owners, f)
+		}
+		re, err := compileCodeownersPattern(pattern)
+		if err != nil {
+			continue
+		}
+		co.rules = append(co.rules, codeownersRule{
+			pattern: pattern,
+			re:      re,
+			owners:  owners,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return codeowners{}, fmt.Errorf("failed to read CODEOWNERS: %w", err)
+	}
+	return co, nil
+}
+
+// owners returns the owners of the given slash-separated path, relative to
+// the root of the repo. The last matching rule wins, so a path matched only
+// by rules without owners (or not matched at all) has no owners.
+func (co codeowners) owners(path string) []string {
+	for i := len(co.rules) - 1; i >= 0; i-- {
+		if co.rules[i].re.MatchString(path) {
+			return co.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// compileCodeownersPattern translates a CODEOWNERS pattern, which follows
+// most of the same rules as a .gitignore pattern, into a regexp matching
+// slash-separated file paths relative to the root of the repo:
+//
+//   - A pattern with a slash at its start or in its middle is anchored to
+//     the root of the repo. Otherwise, it matches at any depth.
+//   - A pattern matching a directory also matches everything inside it. A
+//     trailing slash matches only directories.
+//   - Unlike .gitignore, a pattern ending in "/*" matches only the files
+//     directly inside a directory, not those in its subdirectories.
+//   - "*" matches anything except a slash, "?" matches any single character
+//     except a slash, and "**" matches across directories when it forms a
+//     whole leading, trailing, or middle path segment.
+func compileCodeownersPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" || strings.HasPrefix(pattern, "!") || strings.ContainsAny(pattern, "[]") {
+		return nil, fmt.Errorf("unsupported CODEOWNERS pattern: %q", pattern)
+	}
+
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return nil, fmt.Errorf("unsupported CODEOWNERS pattern: %q", "/")
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		if seg == "**" {
+			switch {
+			case last:
+				// "foo/**" matches everything inside foo, and a bare "**"
+				// matches everything
+				if i > 0 {
+					b.WriteString("/")
+				}
+				b.WriteString(".*")
+			case i == 0:
+				b.WriteString("(?:.*/)?")
+			default:
+				b.WriteString("/(?:.*/)?")
+			}
+			continue
+		}
+		if i > 0 && segments[i-1] != "**" {
+			b.WriteString("/")
+		}
+		for _, r := range seg {
+			switch r {
+			case '*':
+				b.WriteString("[^/]*")
+			case '?':
+				b.WriteString("[^/]")
+			default:
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+	}
+	switch {
+	case segments[len(segments)-1] == "**":
+		// already matches everything inside
+	case dirOnly:
+		b.WriteString("/.*")
+	case strings.HasSuffix(pattern, "/*"):
+		// direct children only
+	default:
+		b.WriteString("(?:/.*)?")
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// loadCodeowners loads the CODEOWNERS file for the repo rooted at dir. A repo
+// without a CODEOWNERS file has no owners, which is not an error.
+func loadCodeowners(dir string) (codeowners, error) {
+	for _, loc := range codeownersLocations {
+		f, err := os.Open(filepath.Join(dir, loc))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return codeowners{}, fmt.Errorf("failed to open CODEOWNERS: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		return parseCodeowners(f)
+	}
+	return codeowners{}, nil
+}
+
+// ownedPlan returns a copy of plan with each change's Owners set according
+// to the CODEOWNERS file of the repo containing its workflow.
+func ownedPlan(plan Plan) (Plan, error) {
+	var (
+		owned = Plan{Changes: make([]PlannedChange, len(plan.Changes))}
+		repos = make(map[string]codeowners) // repo root -> CODEOWNERS
+	)
+	for i, c := range plan.Changes {
+		root := findRepoRoot(filepath.Dir(c.Workflow))
+		co, ok := repos[root]
+		if !ok {
+			var err error
+			co, err = loadCodeowners(root)
+			if err != nil {
+				return Plan{}, err
+			}
+			repos[root] = co
+		}
+		rel, err := filepath.Rel(root, c.Workflow)
+		if err != nil {
+			return Plan{}, fmt.Errorf("failed to find path of %s in its repo: %w", c.Workflow, err)
+		}
+		c.Owners = co.owners(filepath.ToSlash(rel))
+		owned.Changes[i] = c
+	}
+	return owned, nil
+}
@@ -0,0 +1,182 @@
+package ghavm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+// Test cases are adapted from the examples in GitHub's CODEOWNERS docs:
+// https://docs.github.com/en/repositories/managing-your-repositorys-settings-and-features/customizing-your-repository/about-code-owners
+func TestCodeowners(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		codeowners string
+		want       map[string][]string // path -> owners
+	}{
+		"global owners": {
+			codeowners: "*       @global-owner1 @global-owner2",
+			want: map[string][]string{
+				"README.md":                 {"@global-owner1", "@global-owner2"},
+				".github/workflows/ci.yaml": {"@global-owner1", "@global-owner2"},
+			},
+		},
+		"last match wins": {
+			codeowners: strings.Join([]string{
+				"*       @global-owner1",
+				"*.js    @js-owner #This is an inline comment.",
+				"*.go docs@example.com",
+			}, "\n"),
+			want: map[string][]string{
+				"README.md":       {"@global-owner1"},
+				"src/app/main.js": {"@js-owner"},
+				"cmd/main.go":     {"docs@example.com"},
+			},
+		},
+		"anchored directory": {
+			codeowners: "/build/logs/ @doctocat",
+			want: map[string][]string{
+				"build/logs/out.log":        {"@doctocat"},
+				"build/logs/nested/out.log": {"@doctocat"},
+				"src/build/logs/out.log":    nil,
+				"build/logs":                nil,
+			},
+		},
+		"direct children only": {
+			codeowners: "docs/*  docs@example.com",
+			want: map[string][]string{
+				"docs/getting-started.md":           {"docs@example.com"},
+				"docs/build-app/troubleshooting.md": nil,
+				"other/docs/getting-started.md":     nil,
+				"docs-archive/getting-started.md":   nil,
+			},
+		},
+		"unanchored directory": {
+			codeowners: "apps/ @octocat",
+			want: map[string][]string{
+				"apps/main.go":             {"@octocat"},
+				"services/apps/web/app.js": {"@octocat"},
+				"apps":                     nil,
+				"myapps/main.go":           nil,
+			},
+		},
+		"double star prefix": {
+			codeowners: "**/logs @octocat",
+			want: map[string][]string{
+				"logs/out.log":               {"@octocat"},
+				"build/logs/out.log":         {"@octocat"},
+				"deeply/nested/logs/out.log": {"@octocat"},
+				"build/logs":                 {"@octocat"},
+				"build/catalogs/out.log":     nil,
+			},
+		},
+		"double star middle and suffix": {
+			codeowners: strings.Join([]string{
+				"/src/**/test @tester",
+				"/vendor/** @vendorer",
+			}, "\n"),
+			want: map[string][]string{
+				"src/test/a_test.go":       {"@tester"},
+				"src/pkg/sub/test/a.go":    {"@tester"},
+				"lib/src/test/a.go":        nil,
+				"vendor/github.com/x/y.go": {"@vendorer"},
+				"vendor":                   nil,
+			},
+		},
+		"rule without owners unsets owners": {
+			codeowners: strings.Join([]string{
+				"/apps/ @octocat",
+				"/apps/github",
+			}, "\n"),
+			want: map[string][]string{
+				"apps/web/index.js":    {"@octocat"},
+				"apps/github/index.js": nil,
+			},
+		},
+		"single character wildcard": {
+			codeowners: "/.github/workflows/ci?.yaml @ci-owner",
+			want: map[string][]string{
+				".github/workflows/ci1.yaml": {"@ci-owner"},
+				".github/workflows/ci.yaml":  nil,
+			},
+		},
+		"escaped hash": {
+			codeowners: `\#notes.md @noter`,
+			want: map[string][]string{
+				"#notes.md":      {"@noter"},
+				"docs/#notes.md": {"@noter"},
+			},
+		},
+		"paths are case sensitive": {
+			codeowners: "/Docs/ @doctocat",
+			want: map[string][]string{
+				"Docs/readme.md": {"@doctocat"},
+				"docs/readme.md": nil,
+			},
+		},
+		"invalid lines are skipped": {
+			codeowners: strings.Join([]string{
+				"# a comment",
+				"",
+				"* @everyone",
+				"!*.md @nobody",
+				"*.[ch] @c-owner",
+			}, "\n"),
+			want: map[string][]string{
+				"README.md": {"@everyone"},
+				"main.c":    {"@everyone"},
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			co, err := parseCodeowners(strings.NewReader(tc.codeowners))
+			assert.NilError(t, err)
+			for path, want := range tc.want {
+				assert.DeepEqual(t, co.owners(path), want, "incorrect owners for "+path)
+			}
+		})
+	}
+}
+
+func TestOwnedPlan(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0o700))
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, "docs"), 0o700))
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, ".github", "workflows"), 0o700))
+	// GitHub only reads the first CODEOWNERS file it finds, so the one in
+	// docs/ is ignored
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "CODEOWNERS"), []byte(strings.Join([]string{
+		"* @org/everyone",
+		"/.github/workflows/release.yaml @org/release",
+	}, "\n")), 0o600))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "docs", "CODEOWNERS"), []byte("* @org/docs"), 0o600))
+
+	plan := Plan{Changes: []PlannedChange{
+		{Workflow: filepath.Join(dir, ".github", "workflows", "ci.yaml"), Action: "actions/checkout"},
+		{Workflow: filepath.Join(dir, ".github", "workflows", "release.yaml"), Action: "actions/checkout"},
+	}}
+	owned, err := ownedPlan(plan)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, owned.Changes[0].Owners, []string{"@org/everyone"}, "incorrect owners")
+	assert.DeepEqual(t, owned.Changes[1].Owners, []string{"@org/release"}, "incorrect owners")
+	assert.Equal(t, len(plan.Changes[0].Owners), 0, "original plan should not be modified")
+
+	t.Run("no CODEOWNERS file", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		assert.NilError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0o700))
+		owned, err := ownedPlan(Plan{Changes: []PlannedChange{
+			{Workflow: filepath.Join(dir, ".github", "workflows", "ci.yaml")},
+		}})
+		assert.NilError(t, err)
+		assert.Equal(t, len(owned.Changes[0].Owners), 0, "expected no owners")
+	})
+}
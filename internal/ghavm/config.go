@@ -0,0 +1,233 @@
+package ghavm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// configFileName is the name of the optional config file ghavm looks for at
+// the root of the repo.
+const configFileName = ".ghavm.yaml"
+
+// config holds optional per-repo settings loaded from a config file.
+//
+// Only a small subset of YAML is supported, in keeping with how we parse
+// workflow and action metadata files:
+//
+//	constraints:
+//	  actions/checkout: ">=4.1.0 <5"
+//	  myorg/*: "<2"
+//	sanctioned-refs:
+//	  - myorg/canary-action@main
+type config struct {
+	// Constraints limits upgrade candidates for matching actions. The first
+	// entry whose pattern matches an action applies.
+	Constraints []actionConstraint
+	// SanctionedRefs holds the action@ref combinations that are explicitly
+	// allowed to float (e.g. internal canaries tracking @main), which are
+	// never pinned or flagged as unpinned, keyed by [sanctionedRefKey].
+	SanctionedRefs map[string]bool
+}
+
+// sanctionedRefKey identifies an action@ref combination in
+// [config.SanctionedRefs], matching action names case-insensitively.
+func sanctionedRefKey(name, ref string) string {
+	return canonicalName(name) + "@" + ref
+}
+
+// sanctions returns true if the given action's ref is sanctioned to float.
+func (c config) sanctions(a Action) bool {
+	return c.SanctionedRefs[sanctionedRefKey(a.Name, a.Ref)]
+}
+
+// actionConstraint applies a version constraint to actions matching a
+// pattern.
+type actionConstraint struct {
+	Pattern    string
+	Constraint versionConstraint
+}
+
+// constraintFor returns the version constraint for the given action, if any.
+func (c config) constraintFor(a Action) versionConstraint {
+	for _, ac := range c.Constraints {
+		if matchesPattern(a.Name, ac.Pattern) {
+			return ac.Constraint
+		}
+	}
+	return nil
+}
+
+// loadConfig loads the config file at the given path. If path is empty, the
+// default config file at the root of the current repo is loaded if it exists,
+// and an empty config is returned if it does not.
+func loadConfig(path string) (config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = filepath.Join(findRepoRoot("."), configFileName)
+	}
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return config{}, nil
+		}
+		return config{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+	cfg, err := parseConfig(string(content))
+	if err != nil {
+		return config{}, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// parseConfig parses the contents of a config file.
+func parseConfig(content string) (config, error) {
+	nodes, err := parseSimpleYAML(content)
+	if err != nil {
+		return config{}, err
+	}
+	var cfg config
+	for _, node := range nodes {
+		switch {
+		case !node.IsKey():
+			return config{}, fmt.Errorf("line %d: expected \"key: value\", got %q", node.Line, node.Text)
+		case node.Key != "constraints" && node.Key != "sanctioned-refs":
+			return config{}, fmt.Errorf("line %d: unknown key %q", node.Line, node.Key)
+		case node.Value != "" && node.Key == "constraints":
+			return config{}, fmt.Errorf("line %d: %s must be a mapping of actions to version constraints", node.Line, node.Key)
+		case node.Value != "":
+			return config{}, fmt.Errorf("line %d: %s must be a list of action@ref entries", node.Line, node.Key)
+		}
+
+		if node.Key == "constraints" {
+			constraints, err := parseConstraints(node.Children)
+			if err != nil {
+				return config{}, err
+			}
+			cfg.Constraints = append(cfg.Constraints, constraints...)
+			continue
+		}
+		for _, item := range node.Children {
+			if !item.List {
+				return config{}, fmt.Errorf("line %d: expected a list of action@ref entries, got %q", item.Line, item.Text)
+			}
+			name, ref, ok := strings.Cut(item.Value, "@")
+			if !ok || ref == "" || !strings.Contains(name, "/") {
+				return config{}, fmt.Errorf("line %d: sanctioned ref must be in owner/repo@ref format, got %q", item.Line, item.Value)
+			}
+			if cfg.SanctionedRefs == nil {
+				cfg.SanctionedRefs = make(map[string]bool)
+			}
+			cfg.SanctionedRefs[sanctionedRefKey(name, ref)] = true
+		}
+	}
+	return cfg, nil
+}
+
+// parseConstraints parses the entries of a constraints mapping, shared by
+// config and policy files, which map action patterns to version constraints.
+func parseConstraints(entries []*yamlNode) ([]actionConstraint, error) {
+	constraints := make([]actionConstraint, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsKey() || entry.List {
+			return nil, fmt.Errorf("line %d: expected \"key: value\", got %q", entry.Line, entry.Text)
+		}
+		if err := validatePattern(entry.Key); err != nil {
+			return nil, fmt.Errorf("line %d: invalid action pattern: %w", entry.Line, err)
+		}
+		constraint, err := parseVersionConstraint(entry.Value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid constraint for %s: %w", entry.Line, entry.Key, err)
+		}
+		constraints = append(constraints, actionConstraint{
+			Pattern:    entry.Key,
+			Constraint: constraint,
+		})
+	}
+	return constraints, nil
+}
+
+// versionConstraint is a set of semver comparisons (e.g. ">=4.1.0 <5"), all
+// of which a version must satisfy.
+type versionConstraint []versionComparison
+
+// versionComparison compares a version against a fixed semver version.
+type versionComparison struct {
+	Op      string
+	Version string
+}
+
+// versionOps are the supported comparison operators, ordered so that longer
+// operators are matched before their prefixes.
+var versionOps = []string{">=", "<=", ">", "<", "="}
+
+// parseVersionConstraint parses a space-separated list of comparisons, where
+// each comparison is an operator (>=, >, <=, <, or =) followed by a semver
+// version with an optional "v" prefix. A version without an operator must
+// match exactly.
+func parseVersionConstraint(s string) (versionConstraint, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, errors.New("empty constraint")
+	}
+	constraint := make(versionConstraint, 0, len(fields))
+	for _, field := range fields {
+		op := "="
+		for _, candidate := range versionOps {
+			if rest, found := strings.CutPrefix(field, candidate); found {
+				op, field = candidate, rest
+				break
+			}
+		}
+		version := field
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+		if !semver.IsValid(version) {
+			return nil, fmt.Errorf("invalid version %q", field)
+		}
+		constraint = append(constraint, versionComparison{Op: op, Version: version})
+	}
+	return constraint, nil
+}
+
+// allows determines whether the given version satisfies every comparison in
+// the constraint. Non-semver versions never satisfy a constraint.
+func (c versionConstraint) allows(version string) bool {
+	if !isValidVersion(version) {
+		return false
+	}
+	for _, comparison := range c {
+		result := compareVersions(version, comparison.Version)
+		var ok bool
+		switch comparison.Op {
+		case ">=":
+			ok = result >= 0
+		case ">":
+			ok = result > 0
+		case "<=":
+			ok = result <= 0
+		case "<":
+			ok = result < 0
+		default:
+			ok = result == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c versionConstraint) String() string {
+	parts := make([]string, len(c))
+	for i, comparison := range c {
+		parts[i] = comparison.Op + comparison.Version
+	}
+	return strings.Join(parts, " ")
+}
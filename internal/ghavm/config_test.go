@@ -0,0 +1,224 @@
+package ghavm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		content string
+		want    config
+		wantErr error
+	}{
+		"empty": {
+			content: "",
+			want:    config{},
+		},
+		"constraints": {
+			content: `# pin checkout to v4
+constraints:
+  actions/checkout: ">=4.1.0 <5"  # no v5 yet
+  "myorg/*": '<2'
+`,
+			want: config{
+				Constraints: []actionConstraint{
+					{
+						Pattern: "actions/checkout",
+						Constraint: versionConstraint{
+							{Op: ">=", Version: "v4.1.0"},
+							{Op: "<", Version: "v5"},
+						},
+					},
+					{
+						Pattern:    "myorg/*",
+						Constraint: versionConstraint{{Op: "<", Version: "v2"}},
+					},
+				},
+			},
+		},
+		"sanctioned refs": {
+			content: `sanctioned-refs:
+  - myorg/Canary@main  # tracks main on purpose
+  - "myorg/other/subdir@release"
+- myorg/unindented@dev
+constraints:
+  actions/checkout: v4
+`,
+			want: config{
+				Constraints: []actionConstraint{
+					{Pattern: "actions/checkout", Constraint: versionConstraint{{Op: "=", Version: "v4"}}},
+				},
+				SanctionedRefs: map[string]bool{
+					"myorg/canary@main":          true,
+					"myorg/other/subdir@release": true,
+					"myorg/unindented@dev":       true,
+				},
+			},
+		},
+		"sanctioned refs must be a list": {
+			content: "sanctioned-refs: myorg/canary@main\n",
+			wantErr: errors.New("line 1: sanctioned-refs must be a list of action@ref entries"),
+		},
+		"sanctioned ref must be a list item": {
+			content: "sanctioned-refs:\n  myorg/canary: main\n",
+			wantErr: errors.New(`line 2: expected a list of action@ref entries, got "myorg/canary: main"`),
+		},
+		"sanctioned ref without ref": {
+			content: "sanctioned-refs:\n  - myorg/canary\n",
+			wantErr: errors.New(`line 2: sanctioned ref must be in owner/repo@ref format, got "myorg/canary"`),
+		},
+		"unknown key": {
+			content: "upgrades:\n  actions/checkout: v4\n",
+			wantErr: errors.New(`line 1: unknown key "upgrades"`),
+		},
+		"constraints must be a mapping": {
+			content: "constraints: v4\n",
+			wantErr: errors.New("line 1: constraints must be a mapping of actions to version constraints"),
+		},
+		"indented line outside section": {
+			content: "  actions/checkout: v4\n",
+			wantErr: errors.New("line 1: unexpected indentation"),
+		},
+		"invalid pattern": {
+			content: "constraints:\n  \"*/checkout\": v4\n",
+			wantErr: errors.New(`line 2: invalid action pattern: wildcards are only supported at the end of patterns, got: "*/checkout"`),
+		},
+		"invalid constraint": {
+			content: "constraints:\n  actions/checkout: \">=four\"\n",
+			wantErr: errors.New(`line 2: invalid constraint for actions/checkout: invalid version "four"`),
+		},
+		"missing value": {
+			content: "constraints:\n  actions/checkout\n",
+			wantErr: errors.New(`line 2: expected "key: value", got "actions/checkout"`),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseConfig(tc.content)
+			if tc.wantErr != nil {
+				assert.Error(t, err, tc.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tc.want, "incorrect config")
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	t.Run("explicit path", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), configFileName)
+		assert.NilError(t, os.WriteFile(path, []byte("constraints:\n  actions/checkout: \"<5\"\n"), 0o600))
+		cfg, err := loadConfig(path)
+		assert.NilError(t, err)
+		assert.Equal(t, cfg.constraintFor(Action{Name: "actions/checkout"}).String(), "<v5", "incorrect constraint")
+	})
+
+	t.Run("missing explicit path is an error", func(t *testing.T) {
+		t.Parallel()
+		_, err := loadConfig(filepath.Join(t.TempDir(), configFileName))
+		if err == nil {
+			t.Fatal("expected error but got nil")
+		}
+		assert.Contains(t, err.Error(), "failed to read config file", "error message")
+	})
+
+	t.Run("missing default config is not an error", func(t *testing.T) {
+		t.Parallel()
+		cfg, err := loadConfig("")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, cfg, config{}, "expected empty config")
+	})
+}
+
+func TestConstraintFor(t *testing.T) {
+	t.Parallel()
+
+	cfg := config{
+		Constraints: []actionConstraint{
+			{Pattern: "actions/checkout", Constraint: versionConstraint{{Op: "<", Version: "v5"}}},
+			{Pattern: "actions/*", Constraint: versionConstraint{{Op: "<", Version: "v3"}}},
+		},
+	}
+	testCases := map[string]string{
+		"actions/checkout":     "<v5",
+		"actions/setup-go":     "<v3",
+		"codecov/codecov-test": "",
+	}
+	for name, want := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, cfg.constraintFor(Action{Name: name}).String(), want, "incorrect constraint")
+		})
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		constraint string
+		allowed    []string
+		disallowed []string
+	}{
+		"range": {
+			constraint: ">=4.1.0 <5",
+			allowed:    []string{"v4.1.0", "v4.9.9"},
+			disallowed: []string{"v4.0.9", "v5.0.0", "v3"},
+		},
+		"exclusive lower bound": {
+			constraint: ">v1.2.3",
+			allowed:    []string{"v1.2.4", "v2.0.0"},
+			disallowed: []string{"v1.2.3", "v1.0.0"},
+		},
+		"inclusive upper bound": {
+			constraint: "<=2.1",
+			allowed:    []string{"v2.1.0", "v1.0.0"},
+			disallowed: []string{"v2.1.1"},
+		},
+		"exact version": {
+			constraint: "v3.2.1",
+			allowed:    []string{"v3.2.1"},
+			disallowed: []string{"v3.2.0", "v3.2.2"},
+		},
+		"explicit equality": {
+			constraint: "=3.2.1",
+			allowed:    []string{"v3.2.1"},
+			disallowed: []string{"v3.2.2"},
+		},
+		"non-semver versions are never allowed": {
+			constraint: ">=1",
+			disallowed: []string{"main", ""},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			constraint, err := parseVersionConstraint(tc.constraint)
+			assert.NilError(t, err)
+			for _, v := range tc.allowed {
+				assert.Equal(t, constraint.allows(v), true, "expected %s to allow %s", tc.constraint, v)
+			}
+			for _, v := range tc.disallowed {
+				assert.Equal(t, constraint.allows(v), false, "expected %s to disallow %s", tc.constraint, v)
+			}
+		})
+	}
+
+	t.Run("empty constraint is an error", func(t *testing.T) {
+		t.Parallel()
+		_, err := parseVersionConstraint("  ")
+		assert.Error(t, err, errors.New("empty constraint"))
+	})
+}
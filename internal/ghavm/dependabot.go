@@ -0,0 +1,296 @@
+package ghavm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// dependabotConfigPaths are the locations of a repo's Dependabot config,
+// relative to the root of the repo.
+var dependabotConfigPaths = []string{
+	filepath.Join(".github", "dependabot.yml"),
+	filepath.Join(".github", "dependabot.yaml"),
+}
+
+// dependabotUpdate is a `github-actions` entry in a Dependabot config's
+// `updates` list.
+type dependabotUpdate struct {
+	// Directories are the directories Dependabot checks, relative to the
+	// root of the repo (e.g. "/"), which may contain glob patterns
+	Directories []string
+	// Ignored are the dependency-name patterns of the ignore rules that
+	// ignore every version of matching actions. Rules limited to some
+	// versions or update types are not included, since Dependabot still
+	// updates those actions.
+	Ignored []string
+}
+
+// findDependabotConfig returns the path of the Dependabot config at the root
+// of the current repo, or an error if there is none.
+func findDependabotConfig() (string, error) {
+	root := findRepoRoot(".")
+	for _, p := range dependabotConfigPaths {
+		candidate := filepath.Join(root, p)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no Dependabot config found at %s", filepath.Join(root, dependabotConfigPaths[0]))
+}
+
+// loadDependabotConfig loads the github-actions updates from the Dependabot
+// config at path.
+func loadDependabotConfig(path string) ([]dependabotUpdate, error) {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("Dependabot config %s not found", path)
+		}
+		return nil, fmt.Errorf("failed to read Dependabot config: %w", err)
+	}
+	updates, err := parseDependabotConfig(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Dependabot config %s: %w", path, err)
+	}
+	return updates, nil
+}
+
+// parseDependabotConfig parses the github-actions entries from the contents
+// of a Dependabot config. Entries for other ecosystems are ignored.
+//
+// The config is parsed with [parseSimpleYAML], like our own config files, so
+// only that subset of YAML is supported. Unknown keys are skipped, since the
+// config belongs to Dependabot:
+//
+//	updates:
+//	  - package-ecosystem: github-actions
+//	    directories: ["/", "/.github/actions/*"]
+//	    ignore:
+//	      - dependency-name: "actions/*"
+func parseDependabotConfig(content string) ([]dependabotUpdate, error) {
+	nodes, err := parseSimpleYAML(content)
+	if err != nil {
+		return nil, err
+	}
+	var updates []dependabotUpdate
+	for _, section := range nodes {
+		if section.Key != "updates" {
+			continue
+		}
+		for _, item := range section.Children {
+			if !item.List || len(item.Children) == 0 || !item.Children[0].IsKey() {
+				return nil, fmt.Errorf("line %d: expected a list of updates, got %q", item.Line, item.Text)
+			}
+			if ecosystem, update := parseDependabotUpdate(item.Children); ecosystem == "github-actions" {
+				updates = append(updates, update)
+			}
+		}
+	}
+	return updates, nil
+}
+
+// parseDependabotUpdate parses the entries of a single item in a Dependabot
+// config's updates list, returning its ecosystem along with the update.
+func parseDependabotUpdate(entries []*yamlNode) (string, dependabotUpdate) {
+	var (
+		ecosystem string
+		update    dependabotUpdate
+	)
+	for _, entry := range entries {
+		switch entry.Key {
+		case "package-ecosystem":
+			ecosystem = entry.Value
+		case "directory":
+			update.Directories = append(update.Directories, entry.Value)
+		case "directories":
+			update.Directories = append(update.Directories, parseFlowList(entry.Value)...)
+			for _, item := range entry.Children {
+				if item.List {
+					update.Directories = append(update.Directories, item.Value)
+				}
+			}
+		case "ignore":
+			for _, rule := range entry.Children {
+				if name, ok := ignoresEveryVersion(rule.Children); ok {
+					update.Ignored = append(update.Ignored, name)
+				}
+			}
+		}
+	}
+	return ecosystem, update
+}
+
+// ignoresEveryVersion returns the dependency-name of an ignore rule, given
+// its entries, if the rule is not limited to some versions or update types.
+func ignoresEveryVersion(entries []*yamlNode) (string, bool) {
+	name := ""
+	for _, entry := range entries {
+		switch entry.Key {
+		case "dependency-name":
+			name = entry.Value
+		case "versions", "update-types":
+			return "", false
+		}
+	}
+	return name, name != ""
+}
+
+// parseFlowList parses a YAML flow sequence (e.g. `["/", "/sub"]`), or a
+// single scalar value, into a list of values.
+func parseFlowList(value string) []string {
+	inner, ok := strings.CutPrefix(value, "[")
+	if !ok {
+		if value == "" {
+			return nil
+		}
+		return []string{unquoteYAML(value)}
+	}
+	inner = strings.TrimSuffix(inner, "]")
+	var values []string
+	for _, v := range strings.Split(inner, ",") {
+		if v = unquoteYAML(strings.TrimSpace(v)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// dependabotGaps compares the actions ghavm manages with Dependabot's
+// github-actions config.
+type dependabotGaps struct {
+	Config string `json:"config"`
+	// Uncovered are the steps ghavm manages that Dependabot does not update.
+	Uncovered []dependabotGap `json:"uncovered"`
+	// Unmanaged are the directories Dependabot checks in which ghavm found
+	// no workflows, e.g. those holding composite actions' metadata files,
+	// which ghavm does not manage.
+	Unmanaged []string `json:"unmanaged"`
+}
+
+// dependabotGap is a step that Dependabot does not update.
+type dependabotGap struct {
+	Workflow string `json:"workflow"`
+	Line     int    `json:"line"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason"`
+}
+
+// findDependabotGaps compares the workflows in root, whose repo root is
+// repoRoot, against the given Dependabot updates.
+//
+// A workflow in <dir>/.github/workflows is covered by an update whose
+// directories include /<dir> (or /<dir>/.github/workflows), and each of its
+// steps is covered unless an ignore rule of every such update ignores it.
+func findDependabotGaps(root Root, repoRoot string, configPath string, updates []dependabotUpdate) dependabotGaps {
+	gaps := dependabotGaps{
+		Config:    configPath,
+		Uncovered: []dependabotGap{},
+		Unmanaged: []string{},
+	}
+	managedDirs := make(map[string]bool)
+	for _, key := range slices.Sorted(maps.Keys(root.Workflows)) {
+		w := root.Workflows[key]
+		dir := dependabotDir(repoRoot, w.FilePath)
+		managedDirs[dir] = true
+
+		var covering []dependabotUpdate
+		for _, u := range updates {
+			if slices.ContainsFunc(u.Directories, func(pattern string) bool {
+				return matchesDependabotDir(pattern, dir) || matchesDependabotDir(pattern, path.Join(dir, ".github", "workflows"))
+			}) {
+				covering = append(covering, u)
+			}
+		}
+		for _, step := range w.Steps {
+			gap := dependabotGap{Workflow: w.FilePath, Line: step.LineNumber + 1, Action: step.Action.Name}
+			if len(covering) == 0 {
+				gap.Reason = fmt.Sprintf("no github-actions update for directory %s", dir)
+				gaps.Uncovered = append(gaps.Uncovered, gap)
+				continue
+			}
+			var pattern string
+			ignored := !slices.ContainsFunc(covering, func(u dependabotUpdate) bool {
+				idx := slices.IndexFunc(u.Ignored, func(p string) bool { return matchesDependencyName(step.Action.Repo(), p) })
+				if idx >= 0 {
+					pattern = u.Ignored[idx]
+				}
+				return idx < 0
+			})
+			if ignored {
+				gap.Reason = fmt.Sprintf("ignored by dependency-name %q", pattern)
+				gaps.Uncovered = append(gaps.Uncovered, gap)
+			}
+		}
+	}
+	for _, u := range updates {
+		for _, pattern := range u.Directories {
+			managed := slices.ContainsFunc(slices.Collect(maps.Keys(managedDirs)), func(dir string) bool {
+				return matchesDependabotDir(pattern, dir) || matchesDependabotDir(pattern, path.Join(dir, ".github", "workflows"))
+			})
+			if !managed && !slices.Contains(gaps.Unmanaged, pattern) {
+				gaps.Unmanaged = append(gaps.Unmanaged, pattern)
+			}
+		}
+	}
+	return gaps
+}
+
+// dependabotDir returns the Dependabot directory (e.g. "/" or "/sub") whose
+// .github/workflows directory holds the given workflow file.
+func dependabotDir(repoRoot string, workflowPath string) string {
+	dir := filepath.Dir(filepath.Dir(filepath.Dir(workflowPath)))
+	rel, err := filepath.Rel(repoRoot, dir)
+	if err != nil || rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+// matchesDependabotDir returns true if the given Dependabot directory
+// pattern, which may contain * and ** globs, matches dir.
+func matchesDependabotDir(pattern string, dir string) bool {
+	pattern = "/" + strings.Trim(pattern, "/")
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return dir == prefix || prefix == "" || strings.HasPrefix(dir, prefix+"/")
+	}
+	matched, _ := path.Match(pattern, dir)
+	return matched
+}
+
+// matchesDependencyName returns true if the given Dependabot dependency-name
+// pattern, in which * matches any characters, matches the action repo.
+func matchesDependencyName(repo string, pattern string) bool {
+	expr := "(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	matched, _ := regexp.MatchString(expr, repo)
+	return matched
+}
+
+// renderDependabotGaps writes a human-readable report of the gaps to dst.
+func renderDependabotGaps(dst io.Writer, gaps dependabotGaps) {
+	fprintf(dst, "compared with Dependabot config %s:\n", gaps.Config)
+	if len(gaps.Uncovered) == 0 {
+		fprintln(dst, "  ✓ every action managed by ghavm is also updated by Dependabot")
+	} else {
+		fprintf(dst, "  %d action(s) managed by ghavm but not updated by Dependabot:\n", len(gaps.Uncovered))
+		for _, g := range gaps.Uncovered {
+			fprintf(dst, "    %s:%d %s (%s)\n", g.Workflow, g.Line, g.Action, g.Reason)
+		}
+	}
+	if len(gaps.Unmanaged) == 0 {
+		fprintln(dst, "  ✓ every directory checked by Dependabot is also managed by ghavm")
+	} else {
+		fprintf(dst, "  %d directory(s) checked by Dependabot but not managed by ghavm:\n", len(gaps.Unmanaged))
+		for _, dir := range gaps.Unmanaged {
+			fprintf(dst, "    %s (no workflows found, e.g. composite actions, which ghavm does not manage)\n", dir)
+		}
+	}
+}
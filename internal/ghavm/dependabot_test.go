@@ -0,0 +1,162 @@
+package ghavm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestParseDependabotConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		content string
+		want    []dependabotUpdate
+		wantErr string
+	}{
+		"single directory": {
+			content: strings.Join([]string{
+				"version: 2",
+				"updates:",
+				"  - package-ecosystem: \"github-actions\"",
+				"    directory: \"/\" # the root",
+				"    schedule:",
+				"      interval: weekly",
+			}, "\n"),
+			want: []dependabotUpdate{{Directories: []string{"/"}}},
+		},
+		"directories and ignore rules": {
+			content: strings.Join([]string{
+				"version: 2",
+				"updates:",
+				"- package-ecosystem: github-actions",
+				"  directories:",
+				"    - /",
+				"    - '/sub/*'",
+				"  ignore:",
+				"    - dependency-name: actions/*",
+				"    - dependency-name: owner/partial",
+				"      versions: [\">= 2\"]",
+				"    - dependency-name: \"owner/ignored\"",
+				"- package-ecosystem: github-actions",
+				"  directories: [\"/a\", \"/b\"]",
+			}, "\n"),
+			want: []dependabotUpdate{
+				{Directories: []string{"/", "/sub/*"}, Ignored: []string{"actions/*", "owner/ignored"}},
+				{Directories: []string{"/a", "/b"}},
+			},
+		},
+		"other ecosystems are skipped": {
+			content: strings.Join([]string{
+				"updates:",
+				"  - package-ecosystem: gomod",
+				"    directory: /",
+				"registries:",
+				"  npm:",
+				"    type: npm-registry",
+			}, "\n"),
+			want: nil,
+		},
+		"invalid updates": {
+			content: strings.Join([]string{
+				"updates:",
+				"  package-ecosystem: github-actions",
+			}, "\n"),
+			wantErr: `line 2: expected a list of updates, got "package-ecosystem: github-actions"`,
+		},
+		"invalid indentation": {
+			content: strings.Join([]string{
+				"updates:",
+				"  - package-ecosystem: github-actions",
+				"      directory: /",
+			}, "\n"),
+			wantErr: "line 3: unexpected indentation",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseDependabotConfig(tc.content)
+			if tc.wantErr != "" {
+				assert.Equal(t, err.Error(), tc.wantErr, "incorrect error")
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tc.want, "incorrect updates")
+		})
+	}
+}
+
+func TestMatchesDependabotDir(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		pattern string
+		dir     string
+		want    bool
+	}{
+		"root":                {"/", "/", true},
+		"root without slash":  {"", "/", true},
+		"exact":               {"/sub", "/sub", true},
+		"trailing slash":      {"/sub/", "/sub", true},
+		"different":           {"/sub", "/other", false},
+		"glob":                {"/apps/*", "/apps/web", true},
+		"glob is one level":   {"/apps/*", "/apps/web/nested", false},
+		"double star":         {"/apps/**", "/apps/web/nested", true},
+		"double star at root": {"/**", "/apps/web", true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, matchesDependabotDir(tc.pattern, tc.dir), tc.want, "incorrect match")
+		})
+	}
+}
+
+func TestFindDependabotGaps(t *testing.T) {
+	t.Parallel()
+
+	repoRoot := filepath.Join("repo")
+	workflow := func(dir string, actions ...string) Workflow {
+		w := Workflow{FilePath: filepath.Join(repoRoot, dir, ".github", "workflows", "ci.yaml")}
+		for i, name := range actions {
+			w.Steps = append(w.Steps, Step{LineNumber: i, Action: Action{Name: name, Ref: "v1"}})
+		}
+		return w
+	}
+	root := Root{Workflows: map[string]Workflow{
+		"a": workflow("", "actions/checkout", "owner/repo/subdir", "owner/ignored"),
+		"b": workflow("sub", "owner/repo"),
+	}}
+	updates := []dependabotUpdate{
+		{Directories: []string{"/", "/actions/*"}, Ignored: []string{"Owner/Ignored"}},
+	}
+
+	gaps := findDependabotGaps(root, repoRoot, "dependabot.yml", updates)
+	assert.DeepEqual(t, gaps.Uncovered, []dependabotGap{
+		{Workflow: filepath.Join("repo", ".github", "workflows", "ci.yaml"), Line: 3, Action: "owner/ignored", Reason: `ignored by dependency-name "Owner/Ignored"`},
+		{Workflow: filepath.Join("repo", "sub", ".github", "workflows", "ci.yaml"), Line: 1, Action: "owner/repo", Reason: "no github-actions update for directory /sub"},
+	}, "incorrect uncovered actions")
+	assert.DeepEqual(t, gaps.Unmanaged, []string{"/actions/*"}, "incorrect unmanaged directories")
+
+	var out strings.Builder
+	renderDependabotGaps(&out, gaps)
+	assert.Contains(t, out.String(), "2 action(s) managed by ghavm but not updated by Dependabot", "incorrect output")
+	assert.Contains(t, out.String(), "1 directory(s) checked by Dependabot but not managed by ghavm", "incorrect output")
+}
+
+func TestLoadDependabotConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	_, err := loadDependabotConfig(filepath.Join(dir, "missing.yml"))
+	assert.Contains(t, err.Error(), "not found", "incorrect error")
+
+	p := filepath.Join(dir, "dependabot.yml")
+	assert.NilError(t, os.WriteFile(p, []byte("updates:\n  oops\n"), 0o600))
+	_, err = loadDependabotConfig(p)
+	assert.Contains(t, err.Error(), "invalid Dependabot config", "incorrect error")
+}
@@ -0,0 +1,179 @@
+package ghavm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mccutchen/ghavm/internal/style"
+)
+
+// doctorOpts configures the checks run by [runDoctor].
+type doctorOpts struct {
+	// Token is the GitHub access token, if any was found.
+	Token string
+	// TokenSource describes where the token came from (e.g. "GITHUB_TOKEN
+	// env var").
+	TokenSource string
+	// Paths are the paths in which to look for workflows.
+	Paths []string
+}
+
+// doctorCheck is the result of a single diagnostic check.
+type doctorCheck struct {
+	Name    string
+	OK      bool
+	Skipped bool
+	Detail  string
+	// Fix suggests how to resolve a failed check.
+	Fix string
+}
+
+// minRateLimitHeadroom is the fraction of an API rate limit below which the
+// remaining requests are considered too few for a typical run.
+const minRateLimitHeadroom = 0.1
+
+// runDoctor diagnoses common setup problems, returning the result of each
+// check in order. Checks that depend on an earlier failed check are skipped.
+func runDoctor(ctx context.Context, gh *GitHubClient, opts doctorOpts) []doctorCheck {
+	var checks []doctorCheck
+	add := func(check doctorCheck) {
+		checks = append(checks, check)
+	}
+	skip := func(name string, reason string) {
+		add(doctorCheck{Name: name, Skipped: true, Detail: reason})
+	}
+
+	// token presence
+	tokenCheck := doctorCheck{Name: "GitHub token", OK: true, Detail: "found via " + opts.TokenSource}
+	if opts.Token == "" {
+		tokenCheck = doctorCheck{
+			Name:   "GitHub token",
+			Detail: "no token found",
+			Fix:    "pass --github-token/-g, set GITHUB_TOKEN (e.g. GITHUB_TOKEN=$(gh auth token)), or use --github-token-command",
+		}
+	}
+	add(tokenCheck)
+
+	// network reachability, which also tells us our rate limits if the
+	// token is valid
+	limits, limitsErr := gh.GetRateLimits(ctx)
+	var urlErr *url.Error
+	reachable := !errors.As(limitsErr, &urlErr)
+	if reachable {
+		add(doctorCheck{Name: "API reachable", OK: true, Detail: "api.github.com"})
+	} else {
+		add(doctorCheck{
+			Name:   "API reachable",
+			Detail: limitsErr.Error(),
+			Fix:    "check your network connection and proxy settings (--proxy or HTTPS_PROXY)",
+		})
+	}
+
+	// token validity and scopes
+	var tokenValid bool
+	switch {
+	case !tokenCheck.OK:
+		skip("token valid", "no token")
+		skip("token scopes", "no token")
+	case !reachable:
+		skip("token valid", "API unreachable")
+		skip("token scopes", "API unreachable")
+	default:
+		info, err := gh.GetAuthInfo(ctx)
+		if err != nil {
+			add(doctorCheck{
+				Name:   "token valid",
+				Detail: err.Error(),
+				Fix:    "generate a new token, as this one may be expired, revoked, or mistyped",
+			})
+			skip("token scopes", "invalid token")
+			break
+		}
+		tokenValid = true
+		add(doctorCheck{Name: "token valid", OK: true, Detail: "authenticated as " + info.Login})
+		add(doctorCheck{Name: "token scopes", OK: true, Detail: describeScopes(info.Scopes)})
+	}
+
+	// rate limit headroom
+	switch {
+	case !tokenValid:
+		skip("rate limit", "no valid token")
+	case limitsErr != nil:
+		add(doctorCheck{Name: "rate limit", Detail: limitsErr.Error()})
+	default:
+		check := doctorCheck{
+			Name:   "rate limit",
+			OK:     true,
+			Detail: fmt.Sprintf("%s REST, %s GraphQL requests remaining", formatRateLimit(limits.REST), formatRateLimit(limits.GraphQL)),
+		}
+		for _, limit := range []RateLimit{limits.REST, limits.GraphQL} {
+			if float64(limit.Remaining) < float64(limit.Limit)*minRateLimitHeadroom {
+				check.OK = false
+				check.Fix = fmt.Sprintf("wait until %s for the limit to reset, or use a different token", limit.Reset.Local().Format(time.Kitchen))
+			}
+		}
+		add(check)
+	}
+
+	// workflow discovery
+	files, err := FindWorkflows(opts.Paths)
+	switch {
+	case err != nil:
+		add(doctorCheck{
+			Name:   "workflows",
+			Detail: err.Error(),
+			Fix:    "pass the path to a repo, workflow directory, or workflow file",
+		})
+	case len(files) == 0:
+		add(doctorCheck{
+			Name:   "workflows",
+			Detail: "no workflows found",
+			Fix:    "run ghavm from within a repo with a .github/workflows directory, or pass the path to your workflows",
+		})
+	default:
+		add(doctorCheck{Name: "workflows", OK: true, Detail: fmt.Sprintf("found %d workflow(s)", len(files))})
+	}
+
+	return checks
+}
+
+// describeScopes summarizes a token's OAuth scopes.
+func describeScopes(scopes []string) string {
+	switch {
+	case scopes == nil:
+		return "not reported (fine-grained or app token)"
+	case len(scopes) == 0:
+		return "(none); actions in private repos require the repo scope"
+	case !slices.Contains(scopes, "repo"):
+		return strings.Join(scopes, ", ") + "; actions in private repos require the repo scope"
+	default:
+		return strings.Join(scopes, ", ")
+	}
+}
+
+func formatRateLimit(limit RateLimit) string {
+	return fmt.Sprintf("%d/%d", limit.Remaining, limit.Limit)
+}
+
+// renderDoctor writes a checklist of the given check results to dst.
+func renderDoctor(dst io.Writer, s *style.Style, checks []doctorCheck) {
+	for _, check := range checks {
+		switch {
+		case check.Skipped:
+			fprintf(dst, "%s %s: skipped (%s)\n", s.Yellow("-"), check.Name, check.Detail)
+		case check.OK:
+			fprintf(dst, "%s %s: %s\n", s.Green("✓"), check.Name, check.Detail)
+		default:
+			fprintf(dst, "%s %s: %s\n", s.Red("✗"), check.Name, check.Detail)
+			if check.Fix != "" {
+				fprintf(dst, "    fix: %s\n", check.Fix)
+			}
+		}
+	}
+}
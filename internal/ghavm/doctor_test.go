@@ -0,0 +1,172 @@
+package ghavm
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/style"
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestRunDoctor(t *testing.T) {
+	t.Parallel()
+
+	const (
+		rateLimitOK = `{"resources": {
+			"core": {"limit": 5000, "remaining": 4990, "reset": 1700000000},
+			"graphql": {"limit": 5000, "remaining": 5000, "reset": 1700000000}
+		}}`
+		rateLimitLow = `{"resources": {
+			"core": {"limit": 5000, "remaining": 10, "reset": 1700000000},
+			"graphql": {"limit": 5000, "remaining": 5000, "reset": 1700000000}
+		}}`
+		userOK = `{"login": "test-user"}`
+	)
+
+	type result struct {
+		name    string
+		ok      bool
+		skipped bool
+		detail  string
+	}
+
+	workflow := writeTestWorkflow(t, "steps:\n  - uses: actions/checkout@v4\n")
+
+	testCases := map[string]struct {
+		opts          doctorOpts
+		restEndpoints map[string]httpResponse
+		want          []result
+	}{
+		"all checks pass": {
+			opts: doctorOpts{Token: "token", TokenSource: "GITHUB_TOKEN env var", Paths: []string{workflow}},
+			restEndpoints: map[string]httpResponse{
+				"GET /rate_limit": okResponse(rateLimitOK),
+				"GET /user": {
+					status: http.StatusOK,
+					body:   userOK,
+					header: http.Header{"X-Oauth-Scopes": {"repo, read:org"}},
+				},
+			},
+			want: []result{
+				{name: "GitHub token", ok: true, detail: "found via GITHUB_TOKEN env var"},
+				{name: "API reachable", ok: true, detail: "api.github.com"},
+				{name: "token valid", ok: true, detail: "authenticated as test-user"},
+				{name: "token scopes", ok: true, detail: "repo, read:org"},
+				{name: "rate limit", ok: true, detail: "4990/5000 REST, 5000/5000 GraphQL requests remaining"},
+				{name: "workflows", ok: true, detail: "found 1 workflow(s)"},
+			},
+		},
+		"missing token": {
+			opts: doctorOpts{Paths: []string{workflow}},
+			restEndpoints: map[string]httpResponse{
+				"GET /rate_limit": okResponse(rateLimitOK),
+			},
+			want: []result{
+				{name: "GitHub token", detail: "no token found"},
+				{name: "API reachable", ok: true, detail: "api.github.com"},
+				{name: "token valid", skipped: true, detail: "no token"},
+				{name: "token scopes", skipped: true, detail: "no token"},
+				{name: "rate limit", skipped: true, detail: "no valid token"},
+				{name: "workflows", ok: true, detail: "found 1 workflow(s)"},
+			},
+		},
+		"invalid token": {
+			opts: doctorOpts{Token: "token", TokenSource: "--github-token", Paths: []string{workflow}},
+			restEndpoints: map[string]httpResponse{
+				"GET /rate_limit": errResponse(http.StatusUnauthorized, ""),
+				"GET /user":       errResponse(http.StatusUnauthorized, ""),
+			},
+			want: []result{
+				{name: "GitHub token", ok: true, detail: "found via --github-token"},
+				{name: "API reachable", ok: true, detail: "api.github.com"},
+				{name: "token valid", detail: "invalid auth token"},
+				{name: "token scopes", skipped: true, detail: "invalid token"},
+				{name: "rate limit", skipped: true, detail: "no valid token"},
+				{name: "workflows", ok: true, detail: "found 1 workflow(s)"},
+			},
+		},
+		"low rate limit and missing repo scope": {
+			opts: doctorOpts{Token: "token", TokenSource: "--github-token", Paths: []string{workflow}},
+			restEndpoints: map[string]httpResponse{
+				"GET /rate_limit": okResponse(rateLimitLow),
+				"GET /user": {
+					status: http.StatusOK,
+					body:   userOK,
+					header: http.Header{"X-Oauth-Scopes": {"read:org"}},
+				},
+			},
+			want: []result{
+				{name: "GitHub token", ok: true, detail: "found via --github-token"},
+				{name: "API reachable", ok: true, detail: "api.github.com"},
+				{name: "token valid", ok: true, detail: "authenticated as test-user"},
+				{name: "token scopes", ok: true, detail: "read:org; actions in private repos require the repo scope"},
+				{name: "rate limit", detail: "10/5000 REST, 5000/5000 GraphQL requests remaining"},
+				{name: "workflows", ok: true, detail: "found 1 workflow(s)"},
+			},
+		},
+		"no workflows": {
+			opts: doctorOpts{Token: "token", TokenSource: "--github-token", Paths: []string{t.TempDir()}},
+			restEndpoints: map[string]httpResponse{
+				"GET /rate_limit": okResponse(rateLimitOK),
+				"GET /user":       okResponse(userOK),
+			},
+			want: []result{
+				{name: "GitHub token", ok: true, detail: "found via --github-token"},
+				{name: "API reachable", ok: true, detail: "api.github.com"},
+				{name: "token valid", ok: true, detail: "authenticated as test-user"},
+				{name: "token scopes", ok: true, detail: "not reported (fine-grained or app token)"},
+				{name: "rate limit", ok: true, detail: "4990/5000 REST, 5000/5000 GraphQL requests remaining"},
+				{name: "workflows", detail: "no workflows found"},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := newTestClient(t, nil, tc.restEndpoints)
+			checks := runDoctor(testCtx(), client, tc.opts)
+			got := make([]result, 0, len(checks))
+			for _, check := range checks {
+				got = append(got, result{name: check.Name, ok: check.OK, skipped: check.Skipped, detail: check.Detail})
+				if !check.OK && !check.Skipped {
+					assert.Equal(t, check.Fix != "", true, "failed check %q should suggest a fix", check.Name)
+				}
+			}
+			assert.DeepEqual(t, got, tc.want, "incorrect checks")
+		})
+	}
+
+	t.Run("unreachable API", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		client := NewGitHubClient("token", &http.Client{Transport: &fakeTransport{url: srv.URL}})
+		checks := runDoctor(testCtx(), client, doctorOpts{Token: "token", TokenSource: "--github-token", Paths: []string{workflow}})
+		assert.Equal(t, len(checks), 6, "incorrect number of checks")
+		assert.Equal(t, checks[1].OK, false, "API should be unreachable")
+		assert.Contains(t, checks[1].Detail, "connection refused", "incorrect detail")
+		assert.Equal(t, checks[2].Skipped, true, "token validity should be skipped")
+		assert.Equal(t, checks[2].Detail, "API unreachable", "incorrect skip reason")
+	})
+}
+
+func TestRenderDoctor(t *testing.T) {
+	t.Parallel()
+
+	checks := []doctorCheck{
+		{Name: "GitHub token", OK: true, Detail: "found via --github-token"},
+		{Name: "token valid", Detail: "invalid auth token", Fix: "generate a new token"},
+		{Name: "token scopes", Skipped: true, Detail: "invalid token"},
+	}
+	buf := &bytes.Buffer{}
+	renderDoctor(buf, style.New(false), checks)
+	want := "" +
+		"✓ GitHub token: found via --github-token\n" +
+		"✗ token valid: invalid auth token\n" +
+		"    fix: generate a new token\n" +
+		"- token scopes: skipped (invalid token)\n"
+	assert.Equal(t, buf.String(), want, "incorrect output")
+}
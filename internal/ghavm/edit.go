@@ -0,0 +1,122 @@
+package ghavm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// PlanEditor lets the user edit the JSON plan in the file at path, e.g. by
+// opening it in their $EDITOR, returning once the edits are saved.
+type PlanEditor func(ctx context.Context, path string) error
+
+// EditPlan resolves upgrade candidates for each step, writes the plan the
+// given mode would apply to a temporary file for the user to edit, and then
+// applies the edited plan.
+//
+// Removing an entry from the plan leaves its step untouched. Changing an
+// entry's proposed_version without changing its proposed_commit resolves the
+// commit for the new version. Nothing is changed if editing fails.
+//
+// In dry run mode, the edited plan is written to dst instead.
+func (e *Engine) EditPlan(ctx context.Context, dst io.Writer, mode PinMode, edit PlanEditor) error {
+	if err := e.resolveSteps(ctx, mode); err != nil {
+		return fmt.Errorf("failed to resolve commit refs: %w", err)
+	}
+	if !e.allowDowngrade {
+		if err := e.checkDowngrades(mode); err != nil {
+			return err
+		}
+	}
+	plan := buildPlan(e.root, e.pinStrategy(mode), e.shortHashLength)
+	if len(plan.Changes) == 0 {
+		fprintln(e.phaseLog.out, e.style.Green("✓ all actions are up to date"))
+		return nil
+	}
+
+	edited, err := editPlanFile(ctx, plan, edit)
+	if err != nil {
+		return err
+	}
+	if len(edited.Changes) == 0 {
+		fprintln(e.phaseLog.out, "no changes made")
+		return nil
+	}
+	strategy, err := e.editedPlanStrategy(ctx, plan, edited)
+	if err != nil {
+		return err
+	}
+	return e.applyChosen(ctx, dst, strategy, len(edited.Changes))
+}
+
+// editPlanFile writes the plan to a temporary file, runs the editor on it,
+// and returns the edited plan.
+func editPlanFile(ctx context.Context, plan Plan, edit PlanEditor) (Plan, error) {
+	f, err := os.CreateTemp("", "ghavm-plan-*.json")
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to create plan file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	err = writeJSON(f, plan)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to write plan file: %w", err)
+	}
+
+	if err := edit(ctx, f.Name()); err != nil {
+		return Plan{}, fmt.Errorf("failed to edit plan, no changes made: %w", err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to read edited plan: %w", err)
+	}
+	var edited Plan
+	if err := json.Unmarshal(data, &edited); err != nil {
+		return Plan{}, fmt.Errorf("failed to parse edited plan, no changes made: %w", err)
+	}
+	return edited, nil
+}
+
+// editedPlanStrategy returns a [RewriteStrategy] that chooses the release
+// recorded in the edited plan for each step, or an error if the edited plan
+// does not match the original plan's steps or records an invalid release.
+func (e *Engine) editedPlanStrategy(ctx context.Context, original Plan, edited Plan) (RewriteStrategy, error) {
+	type planKey struct {
+		workflow string
+		line     int
+	}
+	planned := make(map[planKey]PlannedChange, len(original.Changes))
+	for _, c := range original.Changes {
+		planned[planKey{filepath.Clean(c.Workflow), c.Line}] = c
+	}
+
+	chosen := make(map[planKey]Release, len(edited.Changes))
+	for _, c := range edited.Changes {
+		key := planKey{filepath.Clean(c.Workflow), c.Line}
+		orig, ok := planned[key]
+		if !ok || canonicalName(orig.Action) != canonicalName(c.Action) {
+			return nil, fmt.Errorf("edited plan entry for %s at %s:%d does not match any planned change", c.Action, c.Workflow, c.Line)
+		}
+		release := Release{Version: c.ProposedVersion, CommitHash: c.ProposedCommit}
+		if c.ProposedVersion != orig.ProposedVersion && c.ProposedCommit == orig.ProposedCommit {
+			commit, err := e.gh.GetCommitHashForRef(ctx, Action{Name: c.Action}.Repo(), c.ProposedVersion)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve edited version %s of %s: %w", c.ProposedVersion, c.Action, err)
+			}
+			release.CommitHash = commit
+		}
+		if !isFullCommitHash(release.CommitHash) {
+			return nil, fmt.Errorf("edited plan entry for %s at %s:%d must have a full proposed_commit hash", c.Action, c.Workflow, c.Line)
+		}
+		chosen[key] = release
+	}
+
+	return func(w Workflow, step Step) Release {
+		return chosen[planKey{filepath.Clean(w.FilePath), step.LineNumber + 1}]
+	}, nil
+}
@@ -0,0 +1,147 @@
+package ghavm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestEditPlan(t *testing.T) {
+	t.Parallel()
+
+	var (
+		checkoutV4  = Release{Version: "v4.0.0", CommitHash: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+		checkoutV41 = Release{Version: "v4.1.0", CommitHash: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+		checkoutV42 = Release{Version: "v4.2.0", CommitHash: "cccccccccccccccccccccccccccccccccccccccc"}
+		setupGoV5   = Release{Version: "v5.0.0", CommitHash: "dddddddddddddddddddddddddddddddddddddddd"}
+		setupGoV51  = Release{Version: "v5.1.0", CommitHash: "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee"}
+	)
+	newRoot := func() Root {
+		return Root{Workflows: map[string]Workflow{
+			"ci.yaml": {
+				FilePath: "ci.yaml",
+				Steps: []Step{
+					{LineNumber: 1, Action: Action{Name: "actions/checkout", Ref: "v4", Release: checkoutV4, UpgradeCandidates: UpgradeCandidates{
+						Latest:           checkoutV41,
+						LatestCompatible: checkoutV41,
+					}}},
+					{LineNumber: 2, Action: Action{Name: "actions/setup-go", Ref: "v5", Release: setupGoV5, UpgradeCandidates: UpgradeCandidates{
+						Latest:           setupGoV51,
+						LatestCompatible: setupGoV51,
+					}}},
+				},
+			},
+		}}
+	}
+	// editPlan returns a PlanEditor that applies the given edit to the
+	// changes in the plan file
+	editPlan := func(t *testing.T, edit func([]PlannedChange) []PlannedChange) PlanEditor {
+		return func(_ context.Context, path string) error {
+			data, err := os.ReadFile(path)
+			assert.NilError(t, err)
+			var plan Plan
+			assert.NilError(t, json.Unmarshal(data, &plan))
+			plan.Changes = edit(plan.Changes)
+			var buf bytes.Buffer
+			assert.NilError(t, writeJSON(&buf, plan))
+			return os.WriteFile(path, buf.Bytes(), 0o600)
+		}
+	}
+
+	testCases := map[string]struct {
+		edit    func([]PlannedChange) []PlannedChange
+		rest    map[string]httpResponse
+		want    []string
+		wantErr string
+	}{
+		"unedited": {
+			edit: func(c []PlannedChange) []PlannedChange { return c },
+			want: []string{"actions/checkout@" + checkoutV41.CommitHash, "actions/setup-go@" + setupGoV51.CommitHash},
+		},
+		"removed entry": {
+			edit: func(c []PlannedChange) []PlannedChange { return c[1:] },
+			want: []string{"actions/setup-go@" + setupGoV51.CommitHash},
+		},
+		"edited version is resolved": {
+			edit: func(c []PlannedChange) []PlannedChange {
+				c[0].ProposedVersion = "v4.2.0"
+				return c[:1]
+			},
+			rest: map[string]httpResponse{
+				"GET /repos/actions/checkout/git/ref/heads/v4.2.0": errResponse(404, `{"message": "Not Found"}`),
+				"GET /repos/actions/checkout/git/ref/tags/v4.2.0":  okResponse(`{"object": {"type": "commit", "sha": "` + checkoutV42.CommitHash + `"}}`),
+			},
+			want: []string{"actions/checkout@" + checkoutV42.CommitHash},
+		},
+		"edited version and commit": {
+			edit: func(c []PlannedChange) []PlannedChange {
+				c[0].ProposedVersion, c[0].ProposedCommit = checkoutV42.Version, checkoutV42.CommitHash
+				return c[:1]
+			},
+			want: []string{"actions/checkout@" + checkoutV42.CommitHash},
+		},
+		"everything removed": {
+			edit: func([]PlannedChange) []PlannedChange { return nil },
+		},
+		"unknown entry": {
+			edit: func(c []PlannedChange) []PlannedChange {
+				c[0].Line = 7
+				return c
+			},
+			wantErr: "edited plan entry for actions/checkout at ci.yaml:7 does not match any planned change",
+		},
+		"short commit": {
+			edit: func(c []PlannedChange) []PlannedChange {
+				c[0].ProposedCommit = "abc123"
+				return c
+			},
+			wantErr: "edited plan entry for actions/checkout at ci.yaml:2 must have a full proposed_commit hash",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var out bytes.Buffer
+			engine := newEngine(newRoot(), newTestClient(t, nil, tc.rest), &bytes.Buffer{}, engineOpts{DryRun: true, Output: outputJSON})
+			plan := buildPlan(engine.root, engine.pinStrategy(ModeCompat), 0)
+			edited, err := editPlanFile(testCtx(), plan, editPlan(t, tc.edit))
+			assert.NilError(t, err)
+			strategy, err := engine.editedPlanStrategy(testCtx(), plan, edited)
+			if tc.wantErr != "" {
+				assert.Equal(t, err.Error(), tc.wantErr, "incorrect error")
+				return
+			}
+			assert.NilError(t, err)
+			assert.NilError(t, engine.applyChosen(testCtx(), &out, strategy, len(edited.Changes)))
+
+			var applied Plan
+			assert.NilError(t, json.Unmarshal(out.Bytes(), &applied))
+			var got []string
+			for _, c := range applied.Changes {
+				got = append(got, c.Action+"@"+c.ProposedCommit)
+			}
+			assert.DeepEqual(t, got, tc.want, "incorrect applied changes")
+		})
+	}
+
+	t.Run("editor failure", func(t *testing.T) {
+		t.Parallel()
+		plan := buildPlan(newRoot(), rewriteStrategyForMode(ModeCompat), 0)
+		_, err := editPlanFile(testCtx(), plan, func(context.Context, string) error { return errors.New("exit status 1") })
+		assert.Error(t, err, errors.New("failed to edit plan, no changes made: exit status 1"))
+	})
+
+	t.Run("invalid edits", func(t *testing.T) {
+		t.Parallel()
+		plan := buildPlan(newRoot(), rewriteStrategyForMode(ModeCompat), 0)
+		_, err := editPlanFile(testCtx(), plan, func(_ context.Context, path string) error {
+			return os.WriteFile(path, []byte("{"), 0o600)
+		})
+		assert.Contains(t, err.Error(), "failed to parse edited plan, no changes made", "incorrect error")
+	})
+}
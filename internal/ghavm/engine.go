@@ -3,6 +3,7 @@ package ghavm
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
@@ -10,12 +11,14 @@ import (
 	"log/slog"
 	"maps"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unicode/utf8"
 
 	"golang.org/x/sync/errgroup"
@@ -53,174 +56,1185 @@ func (m PinMode) String() string {
 type engineOpts struct {
 	// Workers defines the number of worker threads used to resolve actions.
 	Workers int
+	// WorkflowLimit, if positive, limits how many workflows may have
+	// steps in flight at once, independent of Workers.
+	WorkflowLimit int
 	// Strict enables strict mode, where any action resolution failure aborts
 	// the entire process.
 	Strict bool
+	// NoFailFast changes strict mode to process every step before failing,
+	// reporting all failures together instead of aborting on the first one.
+	NoFailFast bool
 	// Fancy enables "fancy" terminal output via ANSI escape sequences.
 	Fancy bool
+	// State, if set, holds the state recorded by a previous run, so that
+	// actions with fresh recorded state are not resolved again.
+	State *runState
+	// Lang is the language of user-facing output (see [catalogs]), which
+	// defaults to English.
+	Lang string
+	// OnlyChanged limits the summary of rewritten workflows to those that
+	// were actually modified.
+	OnlyChanged bool
+	// SummaryOnly suppresses per-phase and per-step progress output, showing
+	// only diagnostics and a one-line tally of the rewritten actions.
+	SummaryOnly bool
+	// AllowDowngrade allows pinning an action to an older version than its
+	// current version.
+	AllowDowngrade bool
+	// DryRun reports the changes that would be made instead of rewriting
+	// any workflow files.
+	DryRun bool
+	// AnnotateUnresolvable inserts a warning comment above each step that
+	// could not be resolved because its action's repo was not found, so that
+	// dead actions are noticed during review. The steps themselves are left
+	// unchanged.
+	AnnotateUnresolvable bool
+	// AllOrNothing stages every rewritten workflow file before replacing any
+	// of them, so that a failure to write one file leaves every file
+	// untouched, rather than only some of them changed.
+	AllOrNothing bool
+	// ShortHashLength, if non-zero, truncates the commit hashes written to
+	// workflows to this many characters, which is less secure than pinning
+	// full hashes, and which the GitHub Actions runner rejects in `uses:`
+	// (see [refStyleShort]). Plans, reports, and changelogs still record
+	// full hashes.
+	ShortHashLength int
+	// SuggestTypos searches for repos with names similar to any action repo
+	// that is not found, suggesting the closest one as a likely fix for a
+	// typo in the diagnostic.
+	SuggestTypos bool
+	// RequireRepoAccess checks that every distinct action repo is accessible
+	// before resolving any steps, refusing to proceed if any are not, so that
+	// a token lacking access to some private repos cannot cause a partial
+	// rewrite.
+	RequireRepoAccess bool
+	// TreeHashes fetches the git tree hash of each release that may be
+	// proposed for a step, which is recorded in JSON output.
+	TreeHashes bool
+	// ReleaseVersions falls back to looking up the versions of a commit in
+	// its repo's releases when no version tags are found pointing to it.
+	ReleaseVersions bool
+	// PrefetchReleases starts fetching each action repo's releases for
+	// upgrade candidates before resolving the action's ref, so that the two
+	// overlap, at the cost of fetching releases that go unused if the
+	// action's version cannot be resolved.
+	PrefetchReleases bool
+	// VersionMap, if given, records the versions of known commits, which
+	// are used instead of looking up their version tags via the API.
+	VersionMap versionMap
+	// Offline never looks up the versions of commits missing from
+	// VersionMap via the API, leaving them without versions.
+	Offline bool
+	// VerifyComments warns about steps pinned to commit hashes whose version
+	// comments do not match any version tag of the resolved commit, which
+	// may indicate a tampered pin.
+	VerifyComments bool
+	// TrustHashes skips confirming refs that are already full commit hashes
+	// via the API, and tolerates failures to look up their version tags.
+	TrustHashes bool
+	// BranchesToLatest pins actions tracking a branch (e.g. main) to their
+	// latest releases instead of the branches' current commits, recording
+	// the branch in the version comment (e.g. "v4 (was:main)").
+	BranchesToLatest bool
+	// MatchRefPrecision records the version of each action pinned to its
+	// current commit with the precision of the ref it requested, e.g. "v4"
+	// rather than "v4.1.2" for an action used via @v4, as long as that
+	// version also tags the commit.
+	MatchRefPrecision bool
+	// AsOf, if non-zero, limits upgrade candidates to releases published on
+	// or before the given time.
+	AsOf time.Time
+	// CommittedBefore, if non-zero, limits upgrade candidates to releases
+	// whose commits were made on or before the given time.
+	CommittedBefore time.Time
+	// RequireVerified limits upgrade candidates to releases whose tag or
+	// commit has a valid signature.
+	RequireVerified bool
+	// VersionSource is where upgrade candidates come from, either
+	// "releases" (the default if empty), "tags", or "both" (see
+	// [candidateOpts.VersionSource]).
+	VersionSource string
+	// PrereleasePatterns, if given, limits prerelease upgrade candidates to
+	// actions matching one of these patterns. Otherwise, prereleases are
+	// considered for every action.
+	PrereleasePatterns []string
+	// DeniedVersions maps canonical repo names (see [canonicalName]) to
+	// versions that are never chosen as upgrade candidates for any action
+	// in that repo.
+	DeniedVersions map[string][]string
+	// Config holds per-repo settings, including per-action version
+	// constraints on upgrade candidates.
+	Config config
+	// ConsistencyRetries is the number of times to retry fetching upgrade
+	// candidates for an action whose current release is missing from them.
+	ConsistencyRetries int
+	// PostWriteCommand, if given, is run once after any workflow files are
+	// rewritten, with the paths of the changed files appended to its args.
+	PostWriteCommand []string
+	// IgnorePostWriteErrors reports a failing PostWriteCommand as a warning
+	// instead of an error.
+	IgnorePostWriteErrors bool
+	// Verbose includes each action's version tags, release URL,
+	// verification status, and tree hash, along with the number of releases
+	// it is behind the latest, when listing versions.
+	Verbose bool
+	// ShowVerified checks whether each action's owner is an organization
+	// with a verified domain (see [GitHubClient.IsVerifiedCreator]) and
+	// indicates it when listing versions.
+	ShowVerified bool
+	// TransitiveDepth, if non-zero, finds the actions used by composite
+	// actions, recursively up to this many levels deep, to be listed along
+	// with each step.
+	TransitiveDepth int
+	// AnnotateMatrix marks steps in jobs with a matrix strategy, which may run
+	// many times, when listing versions.
+	AnnotateMatrix bool
+	// ReportFile, if given, is a JSON report file in which the planned
+	// changes are recorded under ReportRepo, alongside those of other repos.
+	ReportFile string
+	ReportRepo string
+	// ChangelogFile, if given, is a markdown file to which a changelog of the
+	// upgrades made (or planned, in dry run mode) is written.
+	ChangelogFile string
+	// CodeOwners tags each change in JSON output and reports with the owners
+	// of its workflow file, according to the CODEOWNERS file of its repo.
+	CodeOwners bool
+	// GroupBy, if given, tags each change in JSON output and reports with a
+	// suggested grouping key, either "owner" or "change".
+	GroupBy string
+	// Output is the format of the engine's results, either "text" (the
+	// default), "json", or "diffstat".
+	Output string
+	// RelativePaths shows the paths of workflow files in git repos relative
+	// to their repo roots in all output (see [workflowPath]).
+	RelativePaths bool
 }
 
+// Output formats.
+const (
+	outputText     = "text"
+	outputJSON     = "json"
+	outputDiffstat = "diffstat"
+)
+
 // Engine manages the version upgrade process, from resolving current versions
 // to choosing upgrade candidates to applying upgrades.
 type Engine struct {
-	root     Root
-	gh       *GitHubClient
-	workers  int
-	strict   bool
-	style    *style.Style
-	phaseLog *PhaseLogger
+	root             Root
+	gh               *GitHubClient
+	workers          int
+	workflowLimit    int
+	strict           bool
+	noFailFast       bool
+	onlyChanged      bool
+	allowDowngrade   bool
+	dryRun           bool
+	trustHashes      bool
+	branchesToLatest bool
+	matchPrecision   bool
+	releaseVersions  bool
+	prefetchReleases bool
+	versionMap       versionMap
+	offline          bool
+	verifyComments   bool
+	state            *runState
+	treeHashes       bool
+	annotateMissing  bool
+	suggestTypos     bool
+	shortHashLength  int
+	allOrNothing     bool
+	unresolvable     *unresolvableSteps
+	requireAccess    bool
+	candidateOpts    candidateOpts
+	prereleases      []string
+	deniedVersions   map[string][]string
+	config           config
+	postWriteCmd     []string
+	ignorePostErrs   bool
+	reportFile       string
+	changelogFile    string
+	reportRepo       string
+	groupBy          string
+	codeowners       bool
+	output           string
+	verbose          bool
+	annotateMatrix   bool
+	transitive       int
+	showVerified     bool
+	relativePaths    bool
+	style            *style.Style
+	msgs             catalog
+	phaseLog         *PhaseLogger
 }
 
 // newEngine creates a new [Engine].
 func newEngine(root Root, ghClient *GitHubClient, logOut io.Writer, opts engineOpts) *Engine {
 	style := style.New(opts.Fancy)
+	msgs := catalogFor(opts.Lang)
 	phaseLog := &PhaseLogger{
-		out:   logOut,
-		fancy: opts.Fancy,
-		style: style,
+		out:     logOut,
+		fancy:   opts.Fancy,
+		inPlace: opts.Fancy && isTerminal(logOut),
+		style:   style,
+		msgs:    msgs,
+
+		relativePaths: opts.RelativePaths,
+		summaryOnly:   opts.SummaryOnly,
 	}
 	return &Engine{
-		root:     root,
-		gh:       ghClient,
-		workers:  max(opts.Workers, 1),
-		strict:   opts.Strict,
-		style:    style,
-		phaseLog: phaseLog,
+		root:             root,
+		gh:               ghClient,
+		workers:          max(opts.Workers, 1),
+		workflowLimit:    max(opts.WorkflowLimit, 0),
+		strict:           opts.Strict,
+		noFailFast:       opts.NoFailFast,
+		onlyChanged:      opts.OnlyChanged,
+		allowDowngrade:   opts.AllowDowngrade,
+		dryRun:           opts.DryRun,
+		trustHashes:      opts.TrustHashes,
+		branchesToLatest: opts.BranchesToLatest,
+		matchPrecision:   opts.MatchRefPrecision,
+		releaseVersions:  opts.ReleaseVersions,
+		prefetchReleases: opts.PrefetchReleases,
+		versionMap:       opts.VersionMap,
+		offline:          opts.Offline,
+		verifyComments:   opts.VerifyComments,
+		state:            opts.State,
+		treeHashes:       opts.TreeHashes,
+		annotateMissing:  opts.AnnotateUnresolvable,
+		suggestTypos:     opts.SuggestTypos,
+		shortHashLength:  opts.ShortHashLength,
+		allOrNothing:     opts.AllOrNothing,
+		unresolvable:     &unresolvableSteps{},
+		requireAccess:    opts.RequireRepoAccess,
+		candidateOpts: candidateOpts{
+			AsOf:               opts.AsOf,
+			CommittedBefore:    opts.CommittedBefore,
+			RequireVerified:    opts.RequireVerified,
+			ConsistencyRetries: opts.ConsistencyRetries,
+			VersionSource:      opts.VersionSource,
+		},
+		prereleases:    opts.PrereleasePatterns,
+		deniedVersions: opts.DeniedVersions,
+		config:         opts.Config,
+		postWriteCmd:   opts.PostWriteCommand,
+		ignorePostErrs: opts.IgnorePostWriteErrors,
+		reportFile:     opts.ReportFile,
+		changelogFile:  opts.ChangelogFile,
+		reportRepo:     opts.ReportRepo,
+		groupBy:        opts.GroupBy,
+		codeowners:     opts.CodeOwners,
+		output:         cmp.Or(opts.Output, outputText),
+		verbose:        opts.Verbose,
+		annotateMatrix: opts.AnnotateMatrix,
+		transitive:     opts.TransitiveDepth,
+		showVerified:   opts.ShowVerified,
+		relativePaths:  opts.RelativePaths,
+		style:          style,
+		msgs:           msgs,
+		phaseLog:       phaseLog,
 	}
 }
 
 // List lists each step in each workflow, with the current action version and
 // any available upgrades.
+//
+// Unless fancy output is enabled (where it would interfere with in-place
+// progress updates), each workflow is written to dst as soon as it and every
+// workflow before it have been resolved, so output streams in a
+// deterministic order while resolution is still in progress.
 func (e *Engine) List(ctx context.Context, dst io.Writer) error {
-	if err := e.resolveSteps(ctx, ModeLatest); err != nil {
+	keys := slices.Sorted(maps.Keys(e.root.Workflows))
+	render := func(i int) {
+		w := e.root.Workflows[keys[i]]
+		if len(w.Steps) == 0 {
+			return
+		}
+		e.renderWorkflowVersions(dst, w)
+		if i < len(keys)-1 {
+			fprintln(dst)
+		}
+	}
+
+	if e.phaseLog.fancy {
+		if err := e.resolveSteps(ctx, ModeLatest); err != nil {
+			return fmt.Errorf("failed to resolve commit refs: %w", err)
+		}
+		for i := range keys {
+			render(i)
+		}
+		return nil
+	}
+
+	tracker := newWorkflowTracker(e.root, keys)
+	rendered := make(chan struct{})
+	go func() {
+		defer close(rendered)
+		for i := range keys {
+			if !tracker.wait(i) {
+				return
+			}
+			render(i)
+		}
+	}()
+	err := e.resolveStepsNotify(ctx, ModeLatest, tracker.stepDone)
+	// if resolution was aborted, some workflows will never be done, so the
+	// renderer must be told to stop waiting for them
+	tracker.abort()
+	<-rendered
+	if err != nil {
 		return fmt.Errorf("failed to resolve commit refs: %w", err)
 	}
+	return nil
+}
 
-	keys := slices.Sorted(maps.Keys(e.root.Workflows))
-	for i, key := range keys {
-		w := e.root.Workflows[key]
-		if len(w.Steps) == 0 {
+// workflowPath returns the path of the workflow file at path as shown in
+// the engine's output (see [workflowPath]).
+func (e *Engine) workflowPath(path string) string {
+	return workflowPath(path, e.relativePaths)
+}
+
+// workflowName returns the short name of the workflow file at path as shown
+// in the engine's human-readable output (see [workflowName]).
+func (e *Engine) workflowName(path string) string {
+	return workflowName(path, e.relativePaths)
+}
+
+// renderWorkflowVersions writes the current version and any available
+// upgrades for each step in a resolved workflow to dst.
+func (e *Engine) renderWorkflowVersions(dst io.Writer, w Workflow) {
+	if w.Templated {
+		fprintln(dst, e.msgs.Sprintf(msgWorkflow, e.style.Bold(e.workflowName(w.FilePath))), e.msgs.Sprintf(msgTemplated))
+	} else {
+		fprintln(dst, e.msgs.Sprintf(msgWorkflow, e.style.Bold(e.workflowName(w.FilePath))))
+	}
+	for _, s := range w.Steps {
+		var (
+			current = s.Action.Release
+			latest  = s.Action.UpgradeCandidates.Latest
+			compat  = s.Action.UpgradeCandidates.LatestCompatible
+		)
+		header := "  " + e.msgs.Sprintf(msgActionVersions, e.style.Boldf("%s@%s", s.Action.Name, s.Action.Ref))
+		switch s.Action.Creator {
+		case CreatorVerified:
+			header += " " + e.style.Green(e.msgs.Sprintf(msgVerifiedCreator))
+		case CreatorUnverified:
+			header += " " + e.style.Yellow(e.msgs.Sprintf(msgUnverifiedCreator))
+		}
+		if e.annotateMatrix && s.Matrix {
+			header += " " + e.style.Yellow(e.msgs.Sprintf(msgMatrix))
+		}
+		if e.config.sanctions(s.Action) {
+			header += " " + e.msgs.Sprintf(msgSanctioned)
+		}
+		fprintln(dst, header)
+		if !current.Exists() {
+			fprintln(dst, e.style.Yellow("    "+e.msgs.Sprintf(msgUnresolved)))
 			continue
 		}
-		fprintln(dst, "workflow", e.style.Bold(filepath.Base(w.FilePath)))
-		for _, s := range w.Steps {
-			var (
-				current = s.Action.Release
-				latest  = s.Action.UpgradeCandidates.Latest
-				compat  = s.Action.UpgradeCandidates.LatestCompatible
-			)
-			fprintf(dst, "  action %s versions:", e.style.Boldf("%s@%s", s.Action.Name, s.Action.Ref))
-			fprintln(dst)
-			if !current.Exists() {
-				fprintln(dst, e.style.Yellow("    (could not resolve action versions, unable to pin or upgrade)"))
-				continue
+		fprintln(dst, "    "+e.msgs.label(msgLabelCurrent)+current.String())
+		if e.verbose {
+			e.renderVerboseDetails(dst, s.Action)
+		}
+		if len(s.Dependencies) > 0 {
+			e.renderDependencies(dst, s.Dependencies)
+		}
+		// tags are only missing from upgrade candidates if they come from
+		// releases alone
+		if s.Action.UpgradeCandidates.CurrentUnreleased && cmp.Or(e.candidateOpts.VersionSource, versionSourceReleases) == versionSourceReleases {
+			fprintln(dst, e.style.Yellow("    "+e.msgs.label(msgLabelNote)+e.msgs.Sprintf(msgUnreleasedNote, current.Version)))
+		}
+		if stable := s.Action.UpgradeCandidates.LatestStable; stable.Exists() {
+			note := msgAheadOfStableNote
+			if isPrerelease(current.Version) {
+				note = msgPrereleaseAheadNote
 			}
-			fprintln(dst, "    current: "+current.String())
-			if s.Action.UpgradeCandidates == (UpgradeCandidates{}) {
-				fprintln(dst, "    (no upgrade versions found)")
-				continue
-			} else if latest == current {
-				fprintln(dst, e.style.Green("    ✓ already using latest version"))
-				continue
+			fprintln(dst, e.style.Yellow("    "+e.msgs.label(msgLabelNote)+e.msgs.Sprintf(note, current.Version, stable.Version)))
+		}
+		if !latest.Exists() {
+			fprintln(dst, "    "+e.msgs.Sprintf(msgNoUpgrades))
+			continue
+		} else if latest.CommitHash == current.CommitHash {
+			fprintln(dst, e.style.Green("    "+e.msgs.Sprintf(msgUsingLatest)))
+			continue
+		}
+		if compat.Exists() {
+			msg := e.formatCandidate(compat)
+			if compat.CommitHash == current.CommitHash {
+				msg = e.style.Green(e.msgs.Sprintf(msgUsingLatestCompat))
 			}
-			if compat.Exists() {
-				msg := compat.String()
-				if compat == current {
-					msg = e.style.Green("✓ already using latest compat version")
-				}
-				fprintln(dst, "    compat:  "+msg)
+			fprintln(dst, "    "+e.msgs.label(msgLabelCompat)+msg)
+		}
+		if latest.Exists() {
+			fprintln(dst, "    "+e.msgs.label(msgLabelLatest)+e.formatCandidate(latest))
+		}
+		// the number of releases behind is a verbose detail, like the
+		// current release's tags, so that the default listing only changes
+		// when the chosen versions do
+		if behind := s.Action.UpgradeCandidates.ReleasesBehind; behind > 0 && e.verbose {
+			fprintln(dst, "    "+e.msgs.label(msgLabelBehind)+e.msgs.Sprintf(msgReleasesBehind, behind))
+		}
+	}
+}
+
+// renderDependencies writes the tree of an action's transitive dependencies
+// to dst, with each level indented below the action that uses it.
+func (e *Engine) renderDependencies(dst io.Writer, deps []Dependency) {
+	label := e.msgs.label(msgLabelUses)
+	indent := strings.Repeat(" ", utf8.RuneCountInString(label))
+	var render func(deps []Dependency, level int)
+	render = func(deps []Dependency, level int) {
+		for _, dep := range deps {
+			prefix := indent
+			if label != "" {
+				prefix, label = label, ""
 			}
-			if latest.Exists() {
-				fprintln(dst, "    latest:  "+latest.String())
+			line := "    " + prefix + strings.Repeat("  ", level) + dep.Action + "@" + dep.Ref
+			switch {
+			case dep.Cycle:
+				line += " " + e.style.Yellow(e.msgs.Sprintf(msgDependencyCycle))
+			case dep.Truncated:
+				line += " " + e.msgs.Sprintf(msgDepthLimit)
+			case dep.Error != "":
+				line += " " + e.style.Yellow(e.msgs.Sprintf(msgDependencyError, dep.Error))
 			}
+			fprintln(dst, line)
+			render(dep.Dependencies, level+1)
 		}
-		if i < len(keys)-1 {
-			fprintln(dst)
+	}
+	render(deps, 0)
+}
+
+// renderVerboseDetails writes the full set of version tags, the release URL,
+// the verification status, and the tree hash (if known) of an action's
+// current release to dst.
+func (e *Engine) renderVerboseDetails(dst io.Writer, a Action) {
+	tags := e.msgs.Sprintf(msgNone)
+	if len(a.VersionTags) > 0 {
+		tags = strings.Join(a.VersionTags, ", ")
+	}
+	fprintln(dst, "    "+e.msgs.label(msgLabelTags)+tags)
+	if url := a.ReleaseURL(); url != "" {
+		fprintln(dst, "    "+e.msgs.label(msgLabelRelease)+url)
+	}
+	verified := e.msgs.Sprintf(msgNo)
+	if a.Release.Verified {
+		verified = e.style.Green(e.msgs.Sprintf(msgYes))
+	}
+	fprintln(dst, "    "+e.msgs.label(msgLabelSigned)+verified)
+	if a.Release.TreeHash != "" {
+		fprintln(dst, "    "+e.msgs.label(msgLabelTree)+a.Release.TreeHash)
+	}
+}
+
+// workflowTracker tracks when every step in each workflow has been processed,
+// so that workflows can be handled in order as soon as they are ready.
+type workflowTracker struct {
+	index     map[string]int // workflow path -> index
+	remaining []atomic.Int64
+	done      []chan struct{}
+	aborted   chan struct{}
+	abortOnce sync.Once
+}
+
+// newWorkflowTracker creates a [workflowTracker] for the workflows in root,
+// in the order given by keys.
+func newWorkflowTracker(root Root, keys []string) *workflowTracker {
+	t := &workflowTracker{
+		index:     make(map[string]int, len(keys)),
+		remaining: make([]atomic.Int64, len(keys)),
+		done:      make([]chan struct{}, len(keys)),
+		aborted:   make(chan struct{}),
+	}
+	for i, key := range keys {
+		w := root.Workflows[key]
+		t.index[w.FilePath] = i
+		t.done[i] = make(chan struct{})
+		t.remaining[i].Store(int64(len(w.Steps)))
+		if len(w.Steps) == 0 {
+			close(t.done[i])
 		}
 	}
+	return t
+}
 
-	return nil
+// stepDone records that one step in the given workflow has been processed.
+func (t *workflowTracker) stepDone(w Workflow) {
+	i := t.index[w.FilePath]
+	if t.remaining[i].Add(-1) == 0 {
+		close(t.done[i])
+	}
+}
+
+// wait blocks until every step in the i-th workflow has been processed,
+// returning false if the tracker is aborted first.
+func (t *workflowTracker) wait(i int) bool {
+	select {
+	case <-t.done[i]:
+		return true
+	case <-t.aborted:
+		// prefer reporting a workflow that finished before the abort
+		select {
+		case <-t.done[i]:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// abort unblocks any pending or future calls to wait for workflows that are
+// not yet done.
+func (t *workflowTracker) abort() {
+	t.abortOnce.Do(func() { close(t.aborted) })
+}
+
+// formatCandidate formats an upgrade candidate release for display, marking
+// releases with verified signatures when --require-verified is set.
+func (e *Engine) formatCandidate(r Release) string {
+	if r.Verified && e.candidateOpts.RequireVerified {
+		return r.String() + " " + e.style.Green(e.msgs.Sprintf(msgVerified))
+	}
+	return r.String()
 }
 
 // Pin rewrites each workflow's steps from mutable tags/branches to immutable
 // commit hashes.
-func (e *Engine) Pin(ctx context.Context, mode PinMode) error {
+//
+// In dry run mode, the planned changes are written to dst instead.
+func (e *Engine) Pin(ctx context.Context, dst io.Writer, mode PinMode) error {
 	if err := e.resolveSteps(ctx, mode); err != nil {
 		return fmt.Errorf("failed to resolve commit refs: %w", err)
 	}
-	e.phaseLog.StartPhase("pinning %d action(s) to immutable hashes for their %s versions in %d workflow(s) ...", e.root.StepCount(), mode, e.root.WorkflowCount())
-	if err := e.rewriteWorkflows(ctx, rewriteStrategyForMode(mode)); err != nil {
+	if !e.allowDowngrade {
+		if err := e.checkDowngrades(mode); err != nil {
+			return err
+		}
+	}
+	strategy := e.pinStrategy(mode)
+	if e.dryRun {
+		return e.showPlan(dst, strategy)
+	}
+	e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhasePin, e.root.StepCount(), mode, e.root.WorkflowCount()))
+	result, err := e.rewriteWorkflows(ctx, strategy)
+	if err != nil {
 		return fmt.Errorf("upgrade failed: %w", err)
 	}
-	e.phaseLog.FinishPhase("done!")
-	return nil
+	e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+	verb := "upgraded"
+	if mode == ModeCurrent {
+		verb = "pinned"
+	}
+	if err := e.reportRewrite(dst, result, verb); err != nil {
+		return err
+	}
+	return e.runPostWriteCommand(ctx, result.Changed)
 }
 
-func (e *Engine) rewriteWorkflows(ctx context.Context, strategy RewriteStrategy) error {
-	out := &strings.Builder{}
+// ReconcileComments rewrites the version comments on steps that are already
+// pinned to commit hashes to match the best version tag for each hash,
+// without changing the hashes themselves.
+//
+// In dry run mode, the planned changes are written to dst instead.
+func (e *Engine) ReconcileComments(ctx context.Context, dst io.Writer) error {
+	if err := e.resolveSteps(ctx, ModeCurrent); err != nil {
+		return fmt.Errorf("failed to resolve commit refs: %w", err)
+	}
+	strategy := RewriteStrategy(commentOnlyStrategy)
+	if e.matchPrecision {
+		strategy = refPrecisionStrategy(strategy)
+	}
+	if e.dryRun {
+		return e.showPlan(dst, strategy)
+	}
+	e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseReconcile, e.root.StepCount(), e.root.WorkflowCount()))
+	result, err := e.rewriteWorkflows(ctx, strategy)
+	if err != nil {
+		return fmt.Errorf("reconcile failed: %w", err)
+	}
+	e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+	if err := e.reportRewrite(dst, result, "updated"); err != nil {
+		return err
+	}
+	return e.runPostWriteCommand(ctx, result.Changed)
+}
+
+// PruneComments removes ghavm-managed version comments from steps that are
+// already pinned to full commit hashes, leaving the hashes and any
+// hand-written comments intact. No API requests are made.
+//
+// In dry run mode, the planned changes are written to dst instead.
+func (e *Engine) PruneComments(ctx context.Context, dst io.Writer) error {
+	if e.dryRun {
+		return e.showPlan(dst, pruneCommentsStrategy)
+	}
+	e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhasePrune, e.root.StepCount(), e.root.WorkflowCount()))
+	result, err := e.rewriteWorkflows(ctx, pruneCommentsStrategy)
+	if err != nil {
+		return fmt.Errorf("prune failed: %w", err)
+	}
+	e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+	if err := e.reportRewrite(dst, result, "updated"); err != nil {
+		return err
+	}
+	return e.runPostWriteCommand(ctx, result.Changed)
+}
+
+// RewriteOnly re-writes each step already pinned to a full commit hash in
+// the canonical format used when pinning, keeping its hash and version
+// comment, e.g. to standardize quoting and comment spacing across a repo.
+// Steps whose comments are not version comments are left untouched, so that
+// hand-written comments are not lost. No API requests are made.
+//
+// In dry run mode, the planned changes are written to dst instead.
+func (e *Engine) RewriteOnly(ctx context.Context, dst io.Writer) error {
+	if e.dryRun {
+		return e.showPlan(dst, rewriteOnlyStrategy)
+	}
+	e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseRewrite, e.root.StepCount(), e.root.WorkflowCount()))
+	result, err := e.rewriteWorkflows(ctx, rewriteOnlyStrategy)
+	if err != nil {
+		return fmt.Errorf("rewrite failed: %w", err)
+	}
+	e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+	if err := e.reportRewrite(dst, result, "rewritten"); err != nil {
+		return err
+	}
+	return e.runPostWriteCommand(ctx, result.Changed)
+}
+
+// PinFromLockfile pins each step whose action is recorded for its workflow
+// in the given lockfile to the recorded commit hash and version, leaving
+// every other step untouched. No API requests are made.
+//
+// Lockfile entries for actions no longer used by their workflows are
+// reported as an error before any files are rewritten.
+//
+// In dry run mode, the planned changes are written to dst instead.
+func (e *Engine) PinFromLockfile(ctx context.Context, dst io.Writer, lock Plan) error {
+	strategy, err := e.lockfileStrategy(lock)
+	if err != nil {
+		return err
+	}
+	if e.dryRun {
+		return e.showPlan(dst, strategy)
+	}
+	e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseLockfile, e.root.WorkflowCount()))
+	result, err := e.rewriteWorkflows(ctx, strategy)
+	if err != nil {
+		return fmt.Errorf("pin failed: %w", err)
+	}
+	e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+	if err := e.reportRewrite(dst, result, "pinned"); err != nil {
+		return err
+	}
+	return e.runPostWriteCommand(ctx, result.Changed)
+}
+
+// lockfileStrategy returns a [RewriteStrategy] that chooses the release
+// recorded in the lockfile for each step's workflow and action, or an error
+// if the lockfile is inconsistent or records actions that can no longer be
+// found in e.root.
+//
+// Workflows may be recorded either as given or relative to their repo roots,
+// as with --relative-paths.
+func (e *Engine) lockfileStrategy(lock Plan) (RewriteStrategy, error) {
+	type lockKey struct{ workflow, action string }
+	locked := make(map[lockKey]Release, len(lock.Changes))
+	lookup := func(w Workflow, step Step) (lockKey, bool) {
+		key := lockKey{filepath.Clean(w.FilePath), step.Action.CanonicalName()}
+		if _, ok := locked[key]; ok {
+			return key, true
+		}
+		if rel, ok := repoRelative(w.FilePath); ok {
+			key.workflow = filepath.FromSlash(rel)
+		}
+		_, ok := locked[key]
+		return key, ok
+	}
+	for _, c := range lock.Changes {
+		key := lockKey{filepath.Clean(filepath.FromSlash(c.Workflow)), canonicalName(c.Action)}
+		release := Release{CommitHash: c.ProposedCommit, Version: c.ProposedVersion}
+		if prev, ok := locked[key]; ok && prev != release {
+			return nil, fmt.Errorf("lockfile records conflicting versions of %s in %s: %s and %s", c.Action, c.Workflow, prev, release)
+		}
+		locked[key] = release
+	}
+
+	found := make(map[lockKey]bool, len(locked))
 	for _, w := range e.root.Workflows {
-		out.Reset()
+		for _, step := range w.Steps {
+			if key, ok := lookup(w, step); ok {
+				found[key] = true
+			}
+		}
+	}
+	var missing []string
+	for _, c := range lock.Changes {
+		key := lockKey{filepath.Clean(filepath.FromSlash(c.Workflow)), canonicalName(c.Action)}
+		if !found[key] {
+			missing = append(missing, fmt.Sprintf("  %s %s", c.Workflow, c.Action))
+			found[key] = true // report each entry once
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("lockfile entries not found in workflows:\n%s", strings.Join(missing, "\n"))
+	}
+
+	return func(w Workflow, step Step) Release {
+		key, _ := lookup(w, step)
+		return locked[key]
+	}, nil
+}
 
-		f, err := os.Open(w.FilePath)
+// showPlan writes the changes the given strategy would make to dst, in the
+// engine's output format.
+func (e *Engine) showPlan(dst io.Writer, strategy RewriteStrategy) error {
+	plan := buildPlan(e.root, strategy, e.shortHashLength)
+	if err := e.writeReport(plan.Changes); err != nil {
+		return err
+	}
+	if err := e.writeChangelogFile(plan.Changes); err != nil {
+		return err
+	}
+	if e.output == outputJSON {
+		plan, err := e.annotatePlan(plan)
 		if err != nil {
 			return err
 		}
+		return writeJSON(dst, plan)
+	}
+	e.renderPlan(dst, plan)
+	return nil
+}
 
-		steps := stepsByLine(w.Steps)
-		scanner := bufio.NewScanner(f)
-		scanner.Split(scanLinesWithEndings)
-		for lineNum := 0; scanner.Scan(); lineNum++ {
-			line := scanner.Text()
-			step, found := steps[lineNum]
-			if !found {
-				out.WriteString(line)
-				continue
-			}
+// writeReport records the given changes in the engine's report file, if
+// any. Changes are the planned changes in dry run mode, and the changes
+// actually applied otherwise.
+func (e *Engine) writeReport(changes []PlannedChange) error {
+	if e.reportFile == "" {
+		return nil
+	}
+	if changes == nil {
+		changes = []PlannedChange{}
+	}
+	plan, err := e.annotatePlan(Plan{Changes: changes})
+	if err != nil {
+		return err
+	}
+	if err := mergeReport(e.reportFile, e.reportRepo, plan); err != nil {
+		return fmt.Errorf("failed to update report: %w", err)
+	}
+	return nil
+}
 
-			// figure out which version we're pinning, if any
-			pin := strategy(w, step)
-
-			// if our strategy did not return a valid release, log and continue
-			//
-			// TODO: better diagnostics
-			if !pin.Exists() {
-				slogctx.Debug(
-					ctx, "skipping unresolved action",
-					"action", fmt.Sprintf("%s@%s", step.Action.Name, step.Action.Ref),
-				)
-				out.WriteString(line)
-				continue
-			}
+// reportRewrite reports the result of a rewrite. With JSON output, every
+// modified step is written to dst in the same format as a dry run plan.
+// Otherwise, a summary of the modified workflows is shown.
+func (e *Engine) reportRewrite(dst io.Writer, result rewriteResult, verb string) error {
+	if err := e.writeReport(result.Applied); err != nil {
+		return err
+	}
+	if err := e.writeChangelogFile(result.Applied); err != nil {
+		return err
+	}
+	if e.output == outputJSON {
+		applied := Plan{Changes: result.Applied}
+		if applied.Changes == nil {
+			applied.Changes = []PlannedChange{}
+		}
+		applied, err := e.annotatePlan(applied)
+		if err != nil {
+			return err
+		}
+		return writeJSON(dst, applied)
+	}
+	e.showRewriteSummary(result, verb)
+	return nil
+}
 
-			before, _, found := strings.Cut(line, "uses:")
-			if !found {
-				return fmt.Errorf("expected `uses:` declaration on line %d, got %q", lineNum, line)
-			}
+// annotatePlan returns a copy of plan with each change tagged with its group
+// and owners, as configured, and its workflow path as shown in output, for
+// JSON output and reports.
+func (e *Engine) annotatePlan(plan Plan) (Plan, error) {
+	plan = groupPlan(plan, e.groupBy)
+	if e.codeowners {
+		owned, err := ownedPlan(plan)
+		if err != nil {
+			return Plan{}, fmt.Errorf("failed to look up code owners: %w", err)
+		}
+		plan = owned
+	}
+	if !e.relativePaths {
+		return plan, nil
+	}
+	changes := make([]PlannedChange, len(plan.Changes))
+	for i, c := range plan.Changes {
+		c.Workflow = e.workflowPath(c.Workflow)
+		changes[i] = c
+	}
+	return Plan{Changes: changes}, nil
+}
 
-			// write prefix
-			out.WriteString(before + "uses: ")
-			// append pinned action version
-			fprintf(out, "%s@%s", step.Action.Name, pin.CommitHash)
-			// append version hint in comment
-			if pin.Version != "" {
-				fprintf(out, " # %s", pin.Version)
-			} else if step.Action.Ref != pin.CommitHash {
-				fprintf(out, " # ref:%s", step.Action.Ref)
-			}
-			// append correct line ending based on original line
-			fprintf(out, matchEOL(line))
+// showRewriteSummary reports which workflows were updated by a rewrite and,
+// unless e.onlyChanged is set, which were left unchanged.
+//
+// With diffstat output, only a single line summarizing the number of changed
+// files and actions is shown, using the given verb to describe what happened
+// to the actions (e.g. "pinned").
+func (e *Engine) showRewriteSummary(result rewriteResult, verb string) {
+	out := e.phaseLog.out
+	if e.output == outputDiffstat {
+		fprintf(out, "%d file(s) changed, %d action(s) %s\n", len(result.Changed), result.StepsChanged, verb)
+		return
+	}
+	if e.phaseLog.summaryOnly {
+		e.showRewriteTally(result, verb)
+		return
+	}
+	fprintln(out, e.style.Boldf("updated %d of %d workflow(s)", len(result.Changed), e.root.WorkflowCount()))
+	for _, key := range slices.Sorted(maps.Keys(e.root.Workflows)) {
+		path := e.root.Workflows[key].FilePath
+		if slices.Contains(result.Changed, path) {
+			fprintln(out, "  "+e.style.Green("updated")+"   "+e.workflowPath(path))
+		} else if !e.onlyChanged {
+			fprintln(out, "  unchanged "+e.workflowPath(path))
+		}
+	}
+}
+
+// showRewriteTally writes a single line tallying the steps changed by a
+// rewrite, using the given verb to describe what happened to them, along with
+// the steps left unchanged and those skipped because the rewrite strategy
+// chose no release for them (e.g. because they could not be resolved).
+func (e *Engine) showRewriteTally(result rewriteResult, verb string) {
+	unchanged := max(e.root.StepCount()-result.StepsChanged-result.StepsSkipped, 0)
+	fprintln(e.phaseLog.out, e.style.Boldf("%d action(s) %s, %d unchanged, %d skipped in %d of %d workflow(s)",
+		result.StepsChanged, verb, unchanged, result.StepsSkipped, len(result.Changed), e.root.WorkflowCount()))
+}
+
+// runPostWriteCommand runs the configured post-write command, if any, once
+// over all of the given changed workflow files.
+//
+// If e.ignorePostErrs is set, a failing command is reported as a warning
+// instead of an error.
+func (e *Engine) runPostWriteCommand(ctx context.Context, changed []string) error {
+	if len(e.postWriteCmd) == 0 || len(changed) == 0 {
+		return nil
+	}
+	e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhasePostWrite, e.postWriteCmd[0], len(changed)))
+	args := append(slices.Clone(e.postWriteCmd[1:]), changed...)
+	// #nosec G204 -- the command is explicitly configured by the user
+	cmdOut, err := exec.CommandContext(ctx, e.postWriteCmd[0], args...).CombinedOutput()
+	if err == nil {
+		e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+		return nil
+	}
+	e.phaseLog.FinishPhase(e.msgs.Sprintf(msgFailed))
+	err = fmt.Errorf("post-write command failed: %w", err)
+	if output := strings.TrimSpace(string(cmdOut)); output != "" {
+		err = fmt.Errorf("%w\n%s", err, output)
+	}
+	if e.ignorePostErrs {
+		fprintln(e.phaseLog.out, e.style.Yellow("warning: "+err.Error()))
+		return nil
+	}
+	return err
+}
+
+// rewriteResult records the changes made by rewriteWorkflows.
+type rewriteResult struct {
+	// Changed holds the paths of the workflow files that were modified.
+	Changed []string
+	// StepsChanged is the number of steps whose lines were modified.
+	StepsChanged int
+	// StepsSkipped is the number of steps for which the rewrite strategy
+	// chose no release, in every workflow, modified or not.
+	StepsSkipped int
+	// Applied describes each step whose line was modified.
+	Applied []PlannedChange
+}
+
+// rewriteWorkflows rewrites each step in each workflow according to the given
+// strategy, returning the workflow files and steps that were modified.
+//
+// Files whose contents would not change are not rewritten. Each line's
+// original line ending is preserved, including the lack of a line ending on
+// the final line of a file.
+func (e *Engine) rewriteWorkflows(ctx context.Context, strategy RewriteStrategy) (rewriteResult, error) {
+	if e.allOrNothing {
+		return e.rewriteWorkflowsAllOrNothing(ctx, strategy)
+	}
+	var result rewriteResult
+	for _, key := range slices.Sorted(maps.Keys(e.root.Workflows)) {
+		w := e.root.Workflows[key]
+		original, err := os.ReadFile(w.FilePath)
+		if err != nil {
+			return result, err
 		}
-		if err := scanner.Err(); err != nil {
-			return fmt.Errorf("failed to scan workflow %s: %w", w.FilePath, err)
+		rewritten, applied, skipped, err := rewriteContent(ctx, w, original, strategy, e.unresolvable.lines(w), e.shortHashLength)
+		if err != nil {
+			return result, err
+		}
+		result.StepsSkipped += skipped
+		if bytes.Equal(rewritten, original) {
+			slogctx.Debug(ctx, "skipping unchanged file", "file", w.FilePath)
+			continue
 		}
 		slogctx.Debug(
 			ctx, "writing pinned file",
 			"file", w.FilePath,
 		)
-		if err := writeFile(w.FilePath, []byte(out.String()), 0); err != nil {
-			return fmt.Errorf("failed to atomically replace file: %w", err)
+		if err := writeFile(w.FilePath, rewritten, 0); err != nil {
+			return result, fmt.Errorf("failed to atomically replace file: %w", err)
+		}
+		result.Changed = append(result.Changed, w.FilePath)
+		result.StepsChanged += len(applied)
+		result.Applied = append(result.Applied, applied...)
+	}
+	return result, nil
+}
+
+// rewriteWorkflowsAllOrNothing is like rewriteWorkflows, but stages every
+// rewritten file before replacing any of them, so that a failure leaves
+// every workflow file untouched.
+func (e *Engine) rewriteWorkflowsAllOrNothing(ctx context.Context, strategy RewriteStrategy) (rewriteResult, error) {
+	var (
+		result rewriteResult
+		staged []stagedFile
+	)
+	for _, key := range slices.Sorted(maps.Keys(e.root.Workflows)) {
+		w := e.root.Workflows[key]
+		original, err := os.ReadFile(w.FilePath)
+		if err != nil {
+			discardStaged(staged)
+			return rewriteResult{}, fmt.Errorf("%w (no files were changed)", err)
+		}
+		rewritten, applied, skipped, err := rewriteContent(ctx, w, original, strategy, e.unresolvable.lines(w), e.shortHashLength)
+		if err != nil {
+			discardStaged(staged)
+			return rewriteResult{}, fmt.Errorf("%w (no files were changed)", err)
+		}
+		result.StepsSkipped += skipped
+		if bytes.Equal(rewritten, original) {
+			slogctx.Debug(ctx, "skipping unchanged file", "file", w.FilePath)
+			continue
+		}
+		slogctx.Debug(ctx, "staging pinned file", "file", w.FilePath)
+		s, err := stageFile(w.FilePath, rewritten, original)
+		if err != nil {
+			discardStaged(staged)
+			return rewriteResult{}, fmt.Errorf("failed to stage file, no files were changed: %w", err)
+		}
+		staged = append(staged, s)
+		result.Changed = append(result.Changed, w.FilePath)
+		result.StepsChanged += len(applied)
+		result.Applied = append(result.Applied, applied...)
+	}
+	slogctx.Debug(ctx, "replacing staged files", "count", len(staged))
+	if err := commitStaged(staged); err != nil {
+		return rewriteResult{}, fmt.Errorf("failed to replace files, changes were rolled back: %w", err)
+	}
+	return result, nil
+}
+
+// rewriteContent rewrites each step in a workflow's original content
+// according to the given strategy, returning the rewritten content, the
+// steps whose lines were modified, and the number of steps skipped because
+// the strategy chose no release for them.
+//
+// Steps on the given unresolvable lines are annotated with a warning comment
+// on the preceding line, unless already annotated. Commit hashes are written
+// truncated to hashLength characters, if non-zero, but the returned changes
+// record full hashes.
+func rewriteContent(ctx context.Context, w Workflow, original []byte, strategy RewriteStrategy, unresolvable map[int]bool, hashLength int) ([]byte, []PlannedChange, int, error) {
+	var (
+		out     = &bytes.Buffer{}
+		applied []PlannedChange
+		skipped int
+		line    string
+	)
+	steps := stepsByLine(w.Steps)
+	scanner := bufio.NewScanner(bytes.NewReader(original))
+	scanner.Split(scanLinesWithEndings)
+	for lineNum := 0; scanner.Scan(); lineNum++ {
+		var prevLine string
+		prevLine, line = line, scanner.Text()
+		step, found := steps[lineNum]
+		if !found {
+			out.WriteString(line)
+			continue
+		}
+
+		if unresolvable[lineNum] && strings.TrimSpace(prevLine) != unresolvableAnnotation {
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			out.WriteString(indent + unresolvableAnnotation + cmp.Or(matchEOL(line), matchEOL(prevLine), "\n"))
+		}
+
+		// figure out which version we're pinning, if any
+		pin := strategy(w, step)
+
+		// if our strategy did not return a valid release, log and continue
+		//
+		// TODO: better diagnostics
+		if !pin.Exists() {
+			slogctx.Debug(
+				ctx, "skipping unresolved action",
+				"action", fmt.Sprintf("%s@%s", step.Action.Name, step.Action.Ref),
+			)
+			out.WriteString(line)
+			skipped++
+			continue
+		}
+
+		rewritten, ok := rewriteUsesLine(line, step, pin, hashLength)
+		if !ok {
+			return nil, nil, 0, fmt.Errorf("expected `uses:` declaration on line %d, got %q", lineNum, line)
+		}
+		out.WriteString(rewritten)
+		if rewritten != line {
+			applied = append(applied, newPlannedChange(w, step, pin))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to scan workflow %s: %w", w.FilePath, err)
+	}
+	return out.Bytes(), applied, skipped, nil
+}
+
+// rewriteUsesLine returns the given step's `uses:` line, including any line
+// ending, rewritten to pin the step to the given release (see [writtenHash]),
+// or false if the line is not a `uses:` declaration.
+func rewriteUsesLine(line string, step Step, pin Release, hashLength int) (string, bool) {
+	before, _, found := strings.Cut(line, "uses:")
+	if !found {
+		return "", false
+	}
+
+	// write prefix
+	var out strings.Builder
+	out.WriteString(before + "uses: ")
+	// append pinned action version, preserving any quotes
+	m, ok := parseUsesLine(strings.TrimRight(line, "\r\n"))
+	if !ok {
+		// an action missing its owner, which is added by the rewrite
+		m, _ = parseOwnerlessUsesLine(strings.TrimRight(line, "\r\n"))
+	}
+	commit := writtenHash(pin.CommitHash, hashLength)
+	fprintf(&out, "%s%s@%s%s", m.Quote, step.Action.Name, commit, m.Quote)
+	// append version hint in comment
+	if pin.Version != "" {
+		fprintf(&out, " # %s", pin.Version)
+		if step.OriginalRef != "" {
+			fprintf(&out, " (was:%s)", step.OriginalRef)
 		}
+	} else if step.Action.Ref != commit {
+		fprintf(&out, " # ref:%s", step.Action.Ref)
 	}
+	// append correct line ending based on original line
+	out.WriteString(matchEOL(line))
+	return out.String(), true
+}
+
+// unresolvableAnnotation is the comment inserted above steps whose action
+// repos were not found.
+const unresolvableAnnotation = "# ghavm: WARNING unresolved action, repo may be deleted"
+
+// unresolvableSteps records the steps whose action repos were not found, so
+// that they can be annotated when rewriting. It is safe for concurrent use.
+type unresolvableSteps struct {
+	mu    sync.Mutex
+	steps map[string]map[int]bool // workflow path -> line numbers
+}
+
+func (u *unresolvableSteps) add(w Workflow, s *Step) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.steps == nil {
+		u.steps = make(map[string]map[int]bool)
+	}
+	if u.steps[w.FilePath] == nil {
+		u.steps[w.FilePath] = make(map[int]bool)
+	}
+	u.steps[w.FilePath][s.LineNumber] = true
+}
+
+// lines returns the line numbers of the unresolvable steps in w.
+func (u *unresolvableSteps) lines(w Workflow) map[int]bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.steps[w.FilePath]
+}
+
+// checkMissingRepo warns about the given step if its action's repo is
+// definitively missing, suggesting a similarly named repo if e.suggestTypos
+// is set, and records the step as unresolvable if e.annotateMissing is set.
+func (e *Engine) checkMissingRepo(ctx context.Context, workflow Workflow, step *Step) {
+	repo := step.Action.Repo()
+	exists, err := e.gh.RepoExists(ctx, repo)
+	if err != nil {
+		slogctx.Debug(ctx, "engine: failed to check whether repo exists", "repo", repo, "error", err)
+		return
+	}
+	if exists {
+		return
+	}
+	if suggestion := e.suggestRepo(ctx, repo); suggestion != "" {
+		e.phaseLog.Warn(workflow, step, "repo %s not found; did you mean %s?", repo, suggestion)
+	} else {
+		e.phaseLog.Warn(workflow, step, "repo %s not found, it may have been deleted or renamed", repo)
+	}
+	if e.annotateMissing {
+		e.unresolvable.add(workflow, step)
+	}
+}
+
+// checkRepoAccess checks that the repo of every action in every workflow is
+// accessible, returning an error listing any that are not. Each distinct repo
+// is checked once.
+func (e *Engine) checkRepoAccess(ctx context.Context) error {
+	repos := make(map[string]string) // canonical name -> name as written
+	for _, w := range e.root.Workflows {
+		for _, step := range w.Steps {
+			repo := step.Action.Repo()
+			if _, ok := repos[canonicalName(repo)]; !ok {
+				repos[canonicalName(repo)] = repo
+			}
+		}
+	}
+	e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseRepoAccess, len(repos)))
+
+	var (
+		mu           sync.Mutex
+		inaccessible []string
+	)
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(e.workers)
+	for _, repo := range repos {
+		g.Go(func() error {
+			exists, err := e.gh.RepoExists(ctx, repo)
+			if err != nil {
+				return fmt.Errorf("failed to check access to %s: %w", repo, err)
+			}
+			if !exists {
+				mu.Lock()
+				inaccessible = append(inaccessible, repo)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		e.phaseLog.FinishPhase(e.msgs.Sprintf(msgFailed))
+		return err
+	}
+	if len(inaccessible) > 0 {
+		e.phaseLog.FinishPhase(e.msgs.Sprintf(msgFailed))
+		slices.Sort(inaccessible)
+		return fmt.Errorf("%d action repo(s) not found or not accessible with the current token:\n  %s", len(inaccessible), strings.Join(inaccessible, "\n  "))
+	}
+	e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
 	return nil
 }
 
@@ -234,6 +1248,151 @@ func rewriteStrategyForMode(mode PinMode) RewriteStrategy {
 	}
 }
 
+// pinStrategy returns the [RewriteStrategy] for the given mode, except that
+// steps resolved to pin their branches to the latest release (see
+// [engineOpts.BranchesToLatest]) are pinned to that release instead, and
+// steps whose refs are sanctioned to float by the config are left untouched.
+// Versions are recorded with the precision of the requested refs if
+// [engineOpts.MatchRefPrecision] is set.
+func (e *Engine) pinStrategy(mode PinMode) RewriteStrategy {
+	strategy := rewriteStrategyForMode(mode)
+	var pin RewriteStrategy = func(w Workflow, step Step) Release {
+		if e.config.sanctions(step.Action) {
+			return Release{}
+		}
+		if e.branchesToLatest && step.OriginalRef == step.Action.Ref {
+			return step.Action.UpgradeCandidates.Latest
+		}
+		return strategy(w, step)
+	}
+	if e.matchPrecision {
+		pin = refPrecisionStrategy(pin)
+	}
+	return pin
+}
+
+// refPrecisionStrategy wraps a [RewriteStrategy], recording the version of
+// each step pinned to its current commit with the precision of the version
+// the step requested, e.g. v4 rather than v4.1.2 for a step using @v4, as
+// long as that version is also one of the commit's version tags. The
+// requested version of a step already pinned to a commit hash is its version
+// comment.
+//
+// Steps upgraded to other commits keep the chosen release's version, because
+// only the version tags of each step's current commit are known.
+func refPrecisionStrategy(strategy RewriteStrategy) RewriteStrategy {
+	return func(w Workflow, step Step) Release {
+		pin := strategy(w, step)
+		current := step.Action.Release
+		if pin.CommitHash == "" || !strings.HasPrefix(current.CommitHash, pin.CommitHash) {
+			return pin
+		}
+		requested := step.Action.Ref
+		if strings.HasPrefix(current.CommitHash, requested) {
+			requested = step.Comment
+		}
+		if isValidVersion(requested) && slices.Contains(step.Action.VersionTags, requested) {
+			pin.Version = requested
+		}
+		return pin
+	}
+}
+
+// writtenHash returns the commit hash written to a workflow to pin a release,
+// truncated to hashLength characters if non-zero (see
+// [engineOpts.ShortHashLength]).
+func writtenHash(commit string, hashLength int) string {
+	if hashLength > 0 && len(commit) > hashLength {
+		return commit[:hashLength]
+	}
+	return commit
+}
+
+// commentOnlyStrategy is a [RewriteStrategy] that leaves each step's ref
+// untouched, updating only its version comment. Steps whose refs are not
+// commit hashes are skipped entirely.
+func commentOnlyStrategy(_ Workflow, step Step) Release {
+	current := step.Action.Release
+	if !current.Exists() || !isCommitHashFor(step.Action.Ref, current.CommitHash) {
+		return Release{}
+	}
+	return Release{
+		CommitHash: step.Action.Ref,
+		Version:    current.Version,
+	}
+}
+
+// treeHashReleases returns the releases of the step whose tree hashes are
+// needed: every release that may be proposed with --tree-hashes, or only the
+// current release, which is the only one shown, when listing verbosely.
+func (e *Engine) treeHashReleases(step *Step) []*Release {
+	switch {
+	case e.treeHashes:
+		return []*Release{
+			&step.Action.Release,
+			&step.Action.UpgradeCandidates.Latest,
+			&step.Action.UpgradeCandidates.LatestCompatible,
+		}
+	case e.verbose:
+		return []*Release{&step.Action.Release}
+	default:
+		return nil
+	}
+}
+
+// checkDowngrades returns an error naming every step for which the given mode
+// would choose an older version than the step's current version.
+func (e *Engine) checkDowngrades(mode PinMode) error {
+	var msgs []string
+	for _, key := range slices.Sorted(maps.Keys(e.root.Workflows)) {
+		w := e.root.Workflows[key]
+		for _, step := range w.Steps {
+			current := step.Action.Release
+			if e.config.sanctions(step.Action) {
+				continue
+			}
+			if target := chooseUpgrade(step, mode); isDowngrade(current, target) {
+				msgs = append(msgs, fmt.Sprintf("  %s:%d %s from %s to %s", e.workflowPath(w.FilePath), step.LineNumber+1, step.Action.Name, current.Version, target.Version))
+			}
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("refusing to downgrade %d action(s), pass --allow-downgrade to proceed:\n%s", len(msgs), strings.Join(msgs, "\n"))
+}
+
+// isDowngrade returns true if the target release is older than the current
+// release, according to semver rules.
+func isDowngrade(current, target Release) bool {
+	if !isValidVersion(current.Version) || !isValidVersion(target.Version) {
+		return false
+	}
+	return compareVersions(target.Version, current.Version) < 0
+}
+
+// pruneCommentsStrategy is a [RewriteStrategy] that re-writes steps pinned to
+// full commit hashes without their ghavm-managed version comments. All other
+// steps are skipped.
+func pruneCommentsStrategy(_ Workflow, step Step) Release {
+	if !isFullCommitHash(step.Action.Ref) || !isManagedComment(step.Comment) {
+		return Release{}
+	}
+	return Release{CommitHash: step.Action.Ref}
+}
+
+// rewriteOnlyStrategy is a [RewriteStrategy] that re-writes steps pinned to
+// full commit hashes as they are, taking their versions from their existing
+// version comments. Steps with any other comment (including "ref:" comments,
+// which are only written for unresolved refs) and all other steps are
+// skipped.
+func rewriteOnlyStrategy(_ Workflow, step Step) Release {
+	if !isFullCommitHash(step.Action.Ref) || (step.Comment != "" && !isValidVersion(step.Comment)) {
+		return Release{}
+	}
+	return Release{CommitHash: step.Action.Ref, Version: step.Comment}
+}
+
 // chooseUpgrade chooses the best available upgrade from among the step's
 // current action version and the two upgrade candidates, based on the mode.
 //
@@ -266,20 +1425,91 @@ func chooseUpgrade(step Step, mode PinMode) Release {
 //
 // Each step is mutated in-place as it is resolved.
 func (e *Engine) resolveSteps(ctx context.Context, mode PinMode) error {
-	e.phaseLog.StartPhase("resolving action versions for %d step(s) across %d workflow(s) with %d worker(s) ...", e.root.StepCount(), e.root.WorkflowCount(), e.workers)
+	return e.resolveStepsNotify(ctx, mode, nil)
+}
+
+// resolveStepsNotify is like resolveSteps, but additionally calls onStepDone,
+// if non-nil, as each step finishes resolving, whether or not it succeeded.
+func (e *Engine) resolveStepsNotify(ctx context.Context, mode PinMode, onStepDone func(Workflow)) error {
+	if e.requireAccess {
+		if err := e.checkRepoAccess(ctx); err != nil {
+			return err
+		}
+	}
+
+	e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseResolve, e.root.StepCount(), e.root.WorkflowCount(), e.workers))
 
 	// we can skip the extra work of resolving up to two different upgrade
 	// versions if we're only interested in the current versions of our
 	// actions (e.g. when running `pin` to pin current deps as-is)
 	fetchUpgrades := mode != ModeCurrent
 
+	err := e.forEachStep(ctx, func(ctx context.Context, workflow Workflow, step *Step) error {
+		if onStepDone != nil {
+			defer onStepDone(workflow)
+		}
+		err := e.resolveStep(ctx, workflow, step, fetchUpgrades)
+		if err != nil && (e.annotateMissing || e.suggestTypos) {
+			e.checkMissingRepo(ctx, workflow, step)
+		}
+		if err == nil && e.transitive > 0 {
+			e.resolveDependencies(ctx, workflow, step)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to resolve actions: %w", err)
+	}
+
+	e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+	e.phaseLog.ShowDiagnostics()
+	return nil
+}
+
+// forEachStep calls fn for every step in every workflow, with at most
+// e.workers calls in flight at once and, if e.workflowLimit is set, steps
+// from at most that many workflows in flight at once. Any error returned by fn is logged as a
+// diagnostic for the step and, in strict mode, aborts the remaining calls.
+//
+// If strict mode is combined with noFailFast, every step is processed and the
+// errors for all failed steps are returned together at the end.
+//
+// Steps are passed by pointer, so fn may mutate them in-place.
+func (e *Engine) forEachStep(ctx context.Context, fn func(context.Context, Workflow, *Step) error) error {
+	if e.strict && e.noFailFast {
+		return e.forEachStepCollectingErrors(ctx, fn)
+	}
 	g, ctx := errgroup.WithContext(ctx)
 	var (
 		sem          = semaphore.NewWeighted(int64(e.workers))
+		workflows    = newWorkflowLimiter(e.workflowLimit)
 		workflowKeys = slices.Sorted(maps.Keys(e.root.Workflows))
+		// in strict mode, a failure to schedule a step stops scheduling
+		// further steps, but we still wait for those already in flight
+		acquireErr error
 	)
+schedule:
 	for _, key := range workflowKeys {
 		workflow := e.root.Workflows[key]
+
+		// don't start steps from more than N workflows at once
+		stepDone, err := workflows.acquire(ctx, len(workflow.Steps))
+		if err != nil {
+			// as below, let any other failure be reported instead
+			if errors.Is(err, context.Canceled) {
+				continue
+			}
+			err = fmt.Errorf("failed to acquire workflow semaphore: %w", err)
+			for j := range workflow.Steps {
+				e.phaseLog.Error(workflow, &workflow.Steps[j], err)
+			}
+			if e.strict {
+				acquireErr = err
+				break
+			}
+			continue
+		}
+
 		for j := range workflow.Steps {
 			// take pointer to step via manually indexing into our tree so
 			// modifications will persist beyond this function call
@@ -287,6 +1517,7 @@ func (e *Engine) resolveSteps(ctx context.Context, mode PinMode) error {
 
 			// don't schedule more than N concurrent tasks
 			if err := sem.Acquire(ctx, 1); err != nil {
+				stepDone()
 				// if context was canceled, it means another step failed and
 				// the whole errgroup will be aborted, so we can let the other
 				// failure be reported instead of potentially masking it with
@@ -297,13 +1528,15 @@ func (e *Engine) resolveSteps(ctx context.Context, mode PinMode) error {
 				err = fmt.Errorf("failed to acquire semaphore: %w", err)
 				e.phaseLog.Error(workflow, step, err)
 				if e.strict {
-					return err
+					acquireErr = err
+					break schedule
 				}
 				continue
 			}
 			g.Go(func() error {
+				defer stepDone()
 				defer sem.Release(1)
-				if err := e.resolveStep(ctx, workflow, step, fetchUpgrades); err != nil {
+				if err := fn(ctx, workflow, step); err != nil {
 					e.phaseLog.Error(workflow, step, err)
 					if e.strict {
 						return err
@@ -314,12 +1547,107 @@ func (e *Engine) resolveSteps(ctx context.Context, mode PinMode) error {
 		}
 	}
 	if err := g.Wait(); err != nil {
-		return fmt.Errorf("failed to resolve actions: %w", err)
+		return err
 	}
+	return acquireErr
+}
 
-	e.phaseLog.FinishPhase("done!")
-	e.phaseLog.ShowDiagnostics()
-	return nil
+// forEachStepCollectingErrors is like forEachStep, but never aborts early.
+// Instead, it returns an error describing every failed step, in workflow and
+// line order, once all steps have been processed.
+func (e *Engine) forEachStepCollectingErrors(ctx context.Context, fn func(context.Context, Workflow, *Step) error) error {
+	var (
+		wg           sync.WaitGroup
+		sem          = semaphore.NewWeighted(int64(e.workers))
+		workflows    = newWorkflowLimiter(e.workflowLimit)
+		workflowKeys = slices.Sorted(maps.Keys(e.root.Workflows))
+		errs         = make([]error, e.root.StepCount())
+		idx          = 0
+	)
+	for _, key := range workflowKeys {
+		workflow := e.root.Workflows[key]
+		stepDone, workflowErr := workflows.acquire(ctx, len(workflow.Steps))
+		for j := range workflow.Steps {
+			step := &workflow.Steps[j]
+			i := idx
+			idx++
+			if workflowErr != nil {
+				err := fmt.Errorf("failed to acquire workflow semaphore: %w", workflowErr)
+				e.phaseLog.Error(workflow, step, err)
+				errs[i] = fmt.Errorf("%s:%d: %w", e.workflowPath(workflow.FilePath), step.LineNumber+1, err)
+				continue
+			}
+			if err := sem.Acquire(ctx, 1); err != nil {
+				stepDone()
+				err = fmt.Errorf("failed to acquire semaphore: %w", err)
+				e.phaseLog.Error(workflow, step, err)
+				errs[i] = fmt.Errorf("%s:%d: %w", e.workflowPath(workflow.FilePath), step.LineNumber+1, err)
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer stepDone()
+				defer sem.Release(1)
+				if err := fn(ctx, workflow, step); err != nil {
+					e.phaseLog.Error(workflow, step, err)
+					errs[i] = fmt.Errorf("%s:%d: %w", e.workflowPath(workflow.FilePath), step.LineNumber+1, err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	failed := len(slices.DeleteFunc(slices.Clone(errs), func(err error) bool { return err == nil }))
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d step(s) failed:\n%w", failed, errors.Join(errs...))
+}
+
+// workflowLimiter bounds the number of workflows with steps in flight at
+// once. A zero-value limit means no limit.
+type workflowLimiter struct {
+	sem *semaphore.Weighted
+}
+
+func newWorkflowLimiter(limit int) *workflowLimiter {
+	if limit <= 0 {
+		return &workflowLimiter{}
+	}
+	return &workflowLimiter{sem: semaphore.NewWeighted(int64(limit))}
+}
+
+// acquire blocks until a workflow with the given number of steps may start.
+// The returned stepDone func must be called exactly once per step as it
+// finishes, and the workflow's slot is released after its last step.
+func (l *workflowLimiter) acquire(ctx context.Context, steps int) (stepDone func(), err error) {
+	if l.sem == nil || steps == 0 {
+		return func() {}, nil
+	}
+	if err := l.sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	var remaining atomic.Int64
+	remaining.Store(int64(steps))
+	return func() {
+		if remaining.Add(-1) == 0 {
+			l.sem.Release(1)
+		}
+	}, nil
+}
+
+// versionsForCommit returns the versions of the given commit in the given
+// repo, consulting the engine's version map before looking up the commit's
+// version tags via the API, unless offline.
+func (e *Engine) versionsForCommit(ctx context.Context, repo string, commit string) ([]string, error) {
+	if version, ok := e.versionMap.lookup(repo, commit); ok {
+		return []string{version}, nil
+	}
+	if e.offline {
+		return nil, nil
+	}
+	return e.gh.GetVersionTagsForCommitHash(ctx, repo, commit)
 }
 
 // resolveStep resolves a single step's current version ref to a concrete
@@ -328,19 +1656,71 @@ func (e *Engine) resolveSteps(ctx context.Context, mode PinMode) error {
 //
 // The given step is mutated in-place.
 func (e *Engine) resolveStep(ctx context.Context, workflow Workflow, step *Step, fetchUpgrades bool) error {
+	// 0. actions with fresh state recorded by a previous run don't need to
+	// be resolved again
+	if entry, ok := e.state.lookup(step.Action); ok && fetchUpgrades {
+		e.phaseLog.Info(workflow, step, "using state recorded at %s", entry.ResolvedAt.Format(time.RFC3339))
+		entry.apply(&step.Action)
+		return nil
+	}
+
+	// 0b. (optionally) start fetching the releases from which upgrade
+	// candidates are chosen in step 3, which only depend on the action's
+	// repo, so that fetching them overlaps with resolving its ref
+	if fetchUpgrades && e.prefetchReleases {
+		e.gh.PrefetchReleases(ctx, step.Action.Repo())
+	}
+
 	// 1. resolve the version ref (commit, branch, tag, etc) to a specific
 	// commit hash
-	e.phaseLog.Info(workflow, step, "resolving commit hash for ref %s", step.Action.Ref)
-	commit, err := e.gh.GetCommitHashForRef(ctx, step.Action.Repo(), step.Action.Ref)
-	if err != nil {
-		return fmt.Errorf("failed to resolve commit hash for ref %s: %w", step.Action.Ref, err)
+	//
+	// if we're trusting hashes, a ref that is already a full commit hash is
+	// taken as-is, without confirming it via the API.
+	trusted := e.trustHashes && isFullCommitHash(step.Action.Ref)
+	commit := step.Action.Ref
+	if !trusted {
+		e.phaseLog.Info(workflow, step, "resolving commit hash for ref %s", step.Action.Ref)
+		resolved, err := e.gh.GetCommitHashForRef(ctx, step.Action.Repo(), step.Action.Ref)
+		if err != nil {
+			return fmt.Errorf("failed to resolve commit hash for ref %s: %w", step.Action.Ref, err)
+		}
+		commit = resolved
 	}
 
 	// 2a. attempt to find any semver tags pointing to the resolved commit hash.
 	e.phaseLog.Info(workflow, step, "resolving semver tags for commit hash %s", commit)
-	versions, err := e.gh.GetVersionTagsForCommitHash(ctx, step.Action.Repo(), commit)
+	versions, err := e.versionsForCommit(ctx, step.Action.Repo(), commit)
 	if err != nil {
-		return fmt.Errorf("failed to fetch version tags for resolved commit %s: %w", commit, err)
+		if !trusted {
+			return fmt.Errorf("failed to fetch version tags for resolved commit %s: %w", commit, err)
+		}
+		// for trusted hashes, the version tags are only a nice-to-have, so
+		// we fall back to the step's existing version comment, if any, to
+		// avoid losing it while offline
+		e.phaseLog.Warn(workflow, step, "could not fetch version tags for trusted commit %s, keeping existing version comment: %s", commit, err)
+		versions = nil
+		if isValidVersion(step.Comment) {
+			versions = []string{step.Comment}
+		}
+	} else if len(versions) == 0 && e.releaseVersions && !e.offline {
+		// some tags are missed by the version tag lookup, but may still be
+		// found via the releases that point to them
+		e.phaseLog.Info(workflow, step, "resolving release versions for commit hash %s", commit)
+		versions, err = e.gh.GetReleaseVersionsForCommitHash(ctx, step.Action.Repo(), commit)
+		if err != nil {
+			return fmt.Errorf("failed to fetch release versions for resolved commit %s: %w", commit, err)
+		}
+	}
+
+	// a pinned hash whose version comment names a different version may
+	// have been tampered with, which we can detect for free since we already
+	// know every version tag pointing to the hash
+	if e.verifyComments && isFullCommitHash(step.Action.Ref) && isValidVersion(step.Comment) && !slices.Contains(versions, step.Comment) {
+		resolved := "no version tags"
+		if len(versions) > 0 {
+			resolved = strings.Join(versions, ", ")
+		}
+		e.phaseLog.Warn(workflow, step, "version comment %s does not match pinned commit %s (%s), the pin may have been tampered with", step.Comment, commit, resolved)
 	}
 
 	// 2b. it's conceivable that some commits will point to multiple
@@ -361,6 +1741,7 @@ func (e *Engine) resolveStep(ctx context.Context, workflow Workflow, step *Step,
 		CommitHash: commit,
 		Version:    version,
 	}
+	step.Action.VersionTags = versions
 	slogctx.Debug(
 		ctx, "engine: resolved current version ref to semver tags",
 		"action", step.Action.Name,
@@ -374,17 +1755,90 @@ func (e *Engine) resolveStep(ctx context.Context, workflow Workflow, step *Step,
 	// current release.
 	if fetchUpgrades {
 		e.phaseLog.Info(workflow, step, "finding upgrade candidates for version %s", step.Action.Release.Version)
-		candidates, err := e.gh.GetUpgradeCandidates(ctx, step.Action.Repo(), step.Action.Release)
+		candidates, err := e.gh.GetUpgradeCandidates(ctx, step.Action.Repo(), step.Action.Release, e.candidateOptsFor(step.Action))
 		if err != nil {
 			e.phaseLog.Error(workflow, step, fmt.Errorf("failed to get upgrade candidates for version %s: %w", step.Action.Release.Version, err))
-		} else if candidates == (UpgradeCandidates{}) {
-			e.phaseLog.Warn(workflow, step, fmt.Sprintf("no upgrade candidates found for version %s", step.Action.Release.Version))
+		} else if !candidates.Latest.Exists() {
+			e.phaseLog.Warn(workflow, step, "no upgrade candidates found for version %s", step.Action.Release.Version)
 		}
 		step.Action.UpgradeCandidates = candidates
+		step.Action.Release.Verified = candidates.CurrentVerified
+	}
+
+	// 3b. (optionally) find the latest release of an action tracking a
+	// branch, which it will be pinned to instead of the branch's current
+	// commit, remembering the branch as the action's original ref.
+	//
+	// refs that resolve to version tags or are shortened commit hashes
+	// aren't tracking a branch.
+	if e.branchesToLatest && step.Action.RefKind() == RefKindOther && version == "" && !strings.HasPrefix(commit, step.Action.Ref) {
+		e.phaseLog.Info(workflow, step, "finding latest release for branch %s", step.Action.Ref)
+		// the branch has no version, so any stable release that satisfies
+		// the action's constraints is a candidate
+		opts := e.candidateOptsFor(step.Action)
+		opts.SkipPrereleases = true
+		candidates, err := e.gh.GetUpgradeCandidates(ctx, step.Action.Repo(), Release{Version: step.Action.Ref, CommitHash: commit}, opts)
+		if err != nil {
+			e.phaseLog.Error(workflow, step, fmt.Errorf("failed to find latest release for branch %s: %w", step.Action.Ref, err))
+		} else if !candidates.Latest.Exists() {
+			e.phaseLog.Warn(workflow, step, "no releases found, pinning branch %s to its current commit", step.Action.Ref)
+		} else {
+			step.Action.UpgradeCandidates.Latest = candidates.Latest
+			step.OriginalRef = step.Action.Ref
+		}
+	}
+
+	// 4. (optionally) fetch the tree hash of each release that is shown or
+	// may be proposed, which identifies the content that a pin to its commit
+	// implicitly depends on.
+	trees := make(map[string]string)
+	for _, r := range e.treeHashReleases(step) {
+		if !isFullCommitHash(r.CommitHash) {
+			continue
+		}
+		if tree, ok := trees[r.CommitHash]; ok {
+			r.TreeHash = tree
+			continue
+		}
+		e.phaseLog.Info(workflow, step, "fetching tree hash for commit %s", r.CommitHash)
+		tree, err := e.gh.GetTreeHashForCommit(ctx, step.Action.Repo(), r.CommitHash)
+		if err != nil {
+			return fmt.Errorf("failed to fetch tree hash for commit %s: %w", r.CommitHash, err)
+		}
+		r.TreeHash, trees[r.CommitHash] = tree, tree
+	}
+
+	// 5. (optionally) check whether the action's owner is an organization
+	// with a verified domain, which is informational only, so failures are
+	// not fatal
+	if e.showVerified {
+		owner := step.Action.Owner()
+		e.phaseLog.Info(workflow, step, "checking whether owner %s has a verified domain", owner)
+		verified, err := e.gh.IsVerifiedCreator(ctx, owner)
+		switch {
+		case err != nil:
+			e.phaseLog.Warn(workflow, step, "could not check whether owner %s has a verified domain: %s", owner, err)
+		case verified:
+			step.Action.Creator = CreatorVerified
+		default:
+			step.Action.Creator = CreatorUnverified
+		}
 	}
 	return nil
 }
 
+// candidateOptsFor returns the options used to choose upgrade candidates for
+// the given action, which only considers prereleases for actions matching
+// the engine's prerelease patterns, if any, and applies any version
+// constraint configured for the action and any versions denied for its repo.
+func (e *Engine) candidateOptsFor(a Action) candidateOpts {
+	opts := e.candidateOpts
+	opts.SkipPrereleases = len(e.prereleases) > 0 && !matchesAnyPattern(a.Name, e.prereleases)
+	opts.Constraint = e.config.constraintFor(a)
+	opts.DeniedVersions = e.deniedVersions[canonicalName(a.Repo())]
+	return opts
+}
+
 // stepsByLine groups a slice of [Step]s into a map by line number
 func stepsByLine(steps []Step) map[int]Step {
 	m := make(map[int]Step, len(steps))
@@ -453,12 +1907,39 @@ type PhaseLogger struct {
 	diagnostics map[string][]DiagnosticRecord // workflow path -> records
 
 	style *style.Style
+	msgs  catalog
 	fancy bool
+	// inPlace overwrites each status line with the next, which requires
+	// fancy output and a terminal. Cursor movement escapes would garble
+	// output written anywhere else (e.g. CI logs or captured test output),
+	// so status lines are appended instead, even if fancy output is forced.
+	inPlace bool
+
+	// relativePaths shows workflow paths relative to their repo roots (see
+	// [workflowPath]).
+	relativePaths bool
+	// summaryOnly suppresses phase headers, footers, and status lines, so
+	// that only diagnostics are shown.
+	summaryOnly bool
 
 	phaseStarted  atomic.Bool
 	inPlaceWrites atomic.Int64
 }
 
+// fork returns a new logger writing to the same destination with the same
+// settings, but tracking its own phases and diagnostics.
+func (pl *PhaseLogger) fork() *PhaseLogger {
+	return &PhaseLogger{
+		out:           pl.out,
+		style:         pl.style,
+		msgs:          pl.msgs,
+		fancy:         pl.fancy,
+		inPlace:       pl.inPlace,
+		relativePaths: pl.relativePaths,
+		summaryOnly:   pl.summaryOnly,
+	}
+}
+
 // StartPhase logs a header line marking a new phase.
 func (pl *PhaseLogger) StartPhase(msg string, args ...any) {
 	if pl.phaseStarted.Swap(true) {
@@ -470,7 +1951,9 @@ func (pl *PhaseLogger) StartPhase(msg string, args ...any) {
 	pl.diagnostics = nil
 	pl.mu.Unlock()
 
-	pl.writeln(pl.style.Boldf(msg, args...))
+	if !pl.summaryOnly {
+		pl.writeln(pl.style.Boldf(msg, args...))
+	}
 }
 
 // FinishPhase logs a footer line marking the end of a phase.
@@ -478,10 +1961,13 @@ func (pl *PhaseLogger) FinishPhase(msg string, args ...any) {
 	if !pl.phaseStarted.Swap(false) {
 		panic("PhaseLogger: no phase to finish with msg: " + msg)
 	}
+	if pl.summaryOnly {
+		return
+	}
 	// if we're finishing a section of overwritten lines, we need to a) reset
 	// the write counter to 0 and b) only clear previously overwritten lines
 	// if we actually did any previous overwrites
-	if pl.inPlaceWrites.Swap(0) > 1 {
+	if pl.inPlaceWrites.Swap(0) > 1 && pl.inPlace {
 		pl.write(cursorUpTwo + carriageReturn + clearToEnd)
 	}
 
@@ -511,7 +1997,10 @@ func (pl *PhaseLogger) logPhaseStatus(level Level, workflow Workflow, step *Step
 	if !pl.phaseStarted.Load() {
 		panic("PhaseLogger: phase must be started before updating status: " + msg)
 	}
-	header := fmt.Sprintf("workflow=%s action=%s", pl.style.Boldf(filepath.Base(workflow.FilePath)), pl.style.Boldf(step.Action.Name))
+	if pl.summaryOnly {
+		return
+	}
+	header := fmt.Sprintf("workflow=%s action=%s", pl.style.Boldf(workflowName(workflow.FilePath, pl.relativePaths)), pl.style.Boldf(step.Action.Name))
 	msg = fmt.Sprintf(msg, args...)
 	switch level {
 	case LevelError:
@@ -553,12 +2042,12 @@ func (pl *PhaseLogger) ShowDiagnostics() {
 		return width
 	}
 
-	fprintln(pl.out, pl.style.Boldf("diagnostics"))
+	fprintln(pl.out, pl.style.Bold(pl.msgs.Sprintf(msgDiagnostics)))
 	workflowKeys := slices.Sorted(maps.Keys(pl.diagnostics))
 	for _, workflow := range workflowKeys {
 		recs := pl.diagnostics[workflow]
 		msgPrefixTmpl := fmt.Sprintf("%%5s %%-%ds → ", maxStepWidth(recs))
-		fprintln(pl.out, " ", pl.style.Boldf(workflow))
+		fprintln(pl.out, " ", pl.style.Boldf(workflowPath(workflow, pl.relativePaths)))
 		for _, rec := range recs {
 			msgPrefix := fmt.Sprintf(msgPrefixTmpl, rec.Level, rec.Step.Action.Name)
 			msg := fmt.Sprintf("    %s%s", msgPrefix, rec.Msg)
@@ -594,15 +2083,15 @@ func (pl *PhaseLogger) write(msg string) {
 }
 
 // writeInPlace handles writing status logs, where when "fancy" output is
-// enabled we write the header and message on two lines and then overwrite
-// those two lines on every subsequent in-place write.
+// enabled on a terminal we write the header and message on two lines and then
+// overwrite those two lines on every subsequent in-place write.
 //
-// In non-fancy mode, the header and message are written to a single line
-// without any overwriting/clearing.
+// Otherwise, the header and message are written to a single line without any
+// overwriting/clearing.
 func (pl *PhaseLogger) writeInPlace(header string, msg string) {
 	pl.mu.Lock()
 	defer pl.mu.Unlock()
-	if pl.fancy {
+	if pl.inPlace {
 		// only clear previous two lines after the first in-place write
 		if pl.inPlaceWrites.Add(1) > 1 {
 			fprint(pl.out, cursorUpTwo+carriageReturn+clearToEnd)
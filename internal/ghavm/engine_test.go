@@ -2,14 +2,23 @@ package ghavm
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -58,7 +67,7 @@ func TestIntegrationTests(t *testing.T) {
 			args := []string{
 				"list",
 				filepath.Join("testdata", "workflows"),
-				"--workers=1", // 1 worker to serialize output for consistency across test runs
+				"--deterministic", // serialize output for consistency across test runs
 			}
 			if arg != "" {
 				args = append(args, arg)
@@ -201,6 +210,46 @@ func TestNewEngine(t *testing.T) {
 	}
 }
 
+func TestPhaseLoggerNonTerminal(t *testing.T) {
+	t.Parallel()
+
+	// fancy output is forced, but the log is not a terminal, so status
+	// lines must be appended rather than overwritten via cursor movement
+	out := &strings.Builder{}
+	engine := newEngine(Root{}, nil, out, engineOpts{Fancy: true})
+	workflow := Workflow{FilePath: "ci.yaml"}
+	step := &Step{Action: Action{Name: "actions/checkout"}}
+	engine.phaseLog.StartPhase("resolving")
+	engine.phaseLog.Info(workflow, step, "first")
+	engine.phaseLog.Info(workflow, step, "second")
+	engine.phaseLog.FinishPhase("done!")
+
+	got := out.String()
+	assert.Equal(t, strings.Contains(got, cursorUpTwo), false, "unexpected cursor movement in output:\n"+got)
+	assert.Equal(t, strings.Count(got, "actions/checkout"), 2, "expected one status line per update")
+}
+
+func TestPhaseLoggerSummaryOnly(t *testing.T) {
+	t.Parallel()
+
+	out := &strings.Builder{}
+	engine := newEngine(Root{}, nil, out, engineOpts{SummaryOnly: true})
+	workflow := Workflow{FilePath: "ci.yaml"}
+	step := &Step{Action: Action{Name: "actions/checkout"}}
+	engine.phaseLog.StartPhase("resolving")
+	engine.phaseLog.Info(workflow, step, "first")
+	engine.phaseLog.Warn(workflow, step, "second")
+	engine.phaseLog.FinishPhase("done!")
+	engine.phaseLog.ShowDiagnostics()
+
+	// only the diagnostics are shown
+	got := out.String()
+	assert.Equal(t, strings.Contains(got, "resolving"), false, "unexpected phase header in output:\n"+got)
+	assert.Equal(t, strings.Contains(got, "first"), false, "unexpected status line in output:\n"+got)
+	assert.Equal(t, strings.Contains(got, "done!"), false, "unexpected phase footer in output:\n"+got)
+	assert.Equal(t, strings.Count(got, "second"), 1, "expected diagnostic in output:\n"+got)
+}
+
 func TestTruncateToDisplayWidth(t *testing.T) {
 	t.Parallel()
 
@@ -279,3 +328,1996 @@ func TestTruncateToDisplayWidth(t *testing.T) {
 		})
 	}
 }
+
+// writeTestWorkflow writes the given content to a temporary workflow file and
+// returns its path.
+func writeTestWorkflow(t testing.TB, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "workflow.yaml")
+	assert.NilError(t, os.WriteFile(p, []byte(content), 0o600))
+	return p
+}
+
+func TestReconcileComments(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	input := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@" + commitA + " # v3",
+		"  - uses: owner/repo@bbbbbbb # stale",
+		"  - uses: owner/repo@v1",
+		"  - uses: owner/repo@" + commitA,
+		"  - uses: owner/repo@aaaa # main",
+		"",
+	}, "\n")
+	want := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@" + commitA + " # v4.2.0",
+		"  - uses: owner/repo@bbbbbbb # v1.0.0",
+		"  - uses: owner/repo@v1",
+		"  - uses: owner/repo@" + commitA + " # v4.2.0",
+		"  - uses: owner/repo@aaaa # main",
+		"",
+	}, "\n")
+
+	path := writeTestWorkflow(t, input)
+	root := Root{Workflows: map[string]Workflow{
+		path: {
+			FilePath: path,
+			Steps: []Step{
+				{LineNumber: 1, Action: Action{Name: "owner/repo", Ref: commitA, Release: Release{CommitHash: commitA, Version: "v4.2.0"}}},
+				{LineNumber: 2, Action: Action{Name: "owner/repo", Ref: "bbbbbbb", Release: Release{CommitHash: commitB, Version: "v1.0.0"}}},
+				{LineNumber: 3, Action: Action{Name: "owner/repo", Ref: "v1", Release: Release{CommitHash: commitB, Version: "v1.0.0"}}},
+				{LineNumber: 4, Action: Action{Name: "owner/repo", Ref: commitA, Release: Release{CommitHash: commitA, Version: "v4.2.0"}}},
+				// a branch whose name merely looks like a commit hash
+				{LineNumber: 5, Action: Action{Name: "owner/repo", Ref: "aaaa", Release: Release{CommitHash: commitA, Version: "v4.2.0"}}},
+			},
+		},
+	}}
+	engine := newEngine(root, nil, io.Discard, engineOpts{})
+	result, err := engine.rewriteWorkflows(testCtx(), commentOnlyStrategy)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.Changed, []string{path}, "incorrect changed files")
+
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	if string(got) != want {
+		t.Fatalf("incorrect rewrite:\n\n%s", diffStrings(t, want, string(got)))
+	}
+}
+
+func TestRewriteWorkflowsShortHashes(t *testing.T) {
+	t.Parallel()
+
+	const commit = "abcdef1234abcdef1234abcdef1234abcdef1234"
+	input := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@v1",
+		"  - uses: owner/repo@" + commit + " # v1.0.0",
+		"",
+	}, "\n")
+	want := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@abcdef1234ab # v1.0.0",
+		"  - uses: owner/repo@abcdef1234ab # v1.0.0",
+		"",
+	}, "\n")
+
+	path := writeTestWorkflow(t, input)
+	newRoot := func(refs ...string) Root {
+		var steps []Step
+		for i, ref := range refs {
+			steps = append(steps, Step{LineNumber: i + 1, Action: Action{Name: "owner/repo", Ref: ref, Release: Release{CommitHash: commit, Version: "v1.0.0"}}})
+		}
+		return Root{Workflows: map[string]Workflow{path: {FilePath: path, Steps: steps}}}
+	}
+	engine := newEngine(newRoot("v1", commit), nil, io.Discard, engineOpts{ShortHashLength: 12})
+	result, err := engine.rewriteWorkflows(testCtx(), rewriteStrategyForMode(ModeCurrent))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.Changed, []string{path}, "incorrect changed files")
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	if string(got) != want {
+		t.Fatalf("incorrect rewrite:\n\n%s", diffStrings(t, want, string(got)))
+	}
+	// only the written hashes are truncated
+	assert.Equal(t, len(result.Applied), 2, "incorrect applied changes")
+	assert.Equal(t, result.Applied[0].ProposedCommit, commit, "applied changes should record full hashes")
+
+	// short hashes round trip without further changes, and are not planned
+	// as changes
+	root := newRoot("abcdef1234ab", "abcdef1234ab")
+	w := root.Workflows[path]
+	for i := range w.Steps {
+		w.Steps[i].Line = "  - uses: owner/repo@abcdef1234ab # v1.0.0"
+	}
+	engine = newEngine(root, nil, io.Discard, engineOpts{ShortHashLength: 12})
+	result, err = engine.rewriteWorkflows(testCtx(), rewriteStrategyForMode(ModeCurrent))
+	assert.NilError(t, err)
+	assert.Equal(t, len(result.Changed), 0, "short hashes should not be rewritten again")
+	assert.Equal(t, len(buildPlan(root, rewriteStrategyForMode(ModeCurrent), 12).Changes), 0, "short hashes should not be planned as changes")
+}
+
+func TestRewriteWorkflowsAllOrNothing(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commit = "abcdef1234abcdef1234abcdef1234abcdef1234"
+		input  = "steps:\n  - uses: owner/repo@v1\n"
+	)
+	step := Step{LineNumber: 1, Action: Action{Name: "owner/repo", Ref: "v1", Release: Release{CommitHash: commit, Version: "v1.0.0"}}}
+	// the first workflow can be rewritten, but the second has gone missing
+	// since it was scanned
+	path := writeTestWorkflow(t, input)
+	missing := filepath.Join(t.TempDir(), "workflow.yaml")
+	root := Root{Workflows: map[string]Workflow{
+		"a": {FilePath: path, Steps: []Step{step}},
+		"b": {FilePath: missing, Steps: []Step{step}},
+	}}
+
+	for _, allOrNothing := range []bool{false, true} {
+		assert.NilError(t, os.WriteFile(path, []byte(input), 0o600))
+		engine := newEngine(root, nil, io.Discard, engineOpts{AllOrNothing: allOrNothing})
+		_, err := engine.rewriteWorkflows(testCtx(), rewriteStrategyForMode(ModeCurrent))
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+		got, err := os.ReadFile(path) // #nosec G304
+		assert.NilError(t, err)
+		assert.Equal(t, string(got) == input, allOrNothing, "only all-or-nothing mode should leave the first file untouched")
+		entries, err := os.ReadDir(filepath.Dir(path))
+		assert.NilError(t, err)
+		assert.Equal(t, len(entries), 1, "no temp files should remain")
+	}
+}
+
+func TestRewriteWorkflowsSkipsUnchangedFiles(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	var (
+		pinnedPath   = writeTestWorkflow(t, "steps:\n  - uses: owner/repo@"+commit+" # v1.0.0\n")
+		unpinnedPath = writeTestWorkflow(t, "steps:\n  - uses: owner/repo@v1\n")
+		release      = Release{CommitHash: commit, Version: "v1.0.0"}
+	)
+
+	// backdate the already-pinned file, so we can tell if it gets rewritten
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.NilError(t, os.Chtimes(pinnedPath, past, past))
+
+	root := Root{Workflows: map[string]Workflow{
+		pinnedPath: {
+			FilePath: pinnedPath,
+			Steps:    []Step{{LineNumber: 1, Action: Action{Name: "owner/repo", Ref: commit, Release: release}}},
+		},
+		unpinnedPath: {
+			FilePath: unpinnedPath,
+			Steps:    []Step{{LineNumber: 1, Action: Action{Name: "owner/repo", Ref: "v1", Release: release}}},
+		},
+	}}
+	engine := newEngine(root, nil, io.Discard, engineOpts{})
+	result, err := engine.rewriteWorkflows(testCtx(), rewriteStrategyForMode(ModeCurrent))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result.Changed, []string{unpinnedPath}, "incorrect changed files")
+	assert.Equal(t, result.StepsChanged, 1, "incorrect number of changed steps")
+
+	info, err := os.Stat(pinnedPath)
+	assert.NilError(t, err)
+	assert.Equal(t, info.ModTime().Equal(past), true, "unchanged file should not be rewritten")
+
+	// steps are skipped according to the strategy, even if they were resolved
+	result, err = engine.rewriteWorkflows(testCtx(), commentOnlyStrategy)
+	assert.NilError(t, err)
+	assert.Equal(t, result.StepsChanged, 0, "incorrect number of changed steps")
+	assert.Equal(t, result.StepsSkipped, 1, "incorrect number of skipped steps")
+}
+
+func TestShowRewriteSummary(t *testing.T) {
+	t.Parallel()
+
+	resolved := Step{Action: Action{Release: Release{CommitHash: "aaa111"}}}
+	root := Root{Workflows: map[string]Workflow{
+		"a.yaml": {FilePath: "a.yaml", Steps: []Step{resolved}},
+		"b.yaml": {FilePath: "b.yaml", Steps: []Step{resolved, resolved, resolved, {}}},
+	}}
+	testCases := map[string]struct {
+		opts engineOpts
+		want string
+	}{
+		"all workflows": {
+			opts: engineOpts{},
+			want: "updated 1 of 2 workflow(s)\n  unchanged a.yaml\n  updated   b.yaml\n",
+		},
+		"only workflows with changes": {
+			opts: engineOpts{OnlyChanged: true},
+			want: "updated 1 of 2 workflow(s)\n  updated   b.yaml\n",
+		},
+		"diffstat": {
+			opts: engineOpts{Output: outputDiffstat},
+			want: "1 file(s) changed, 3 action(s) pinned\n",
+		},
+		"summary only": {
+			opts: engineOpts{SummaryOnly: true},
+			want: "3 action(s) pinned, 1 unchanged, 1 skipped in 1 of 2 workflow(s)\n",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			out := &bytes.Buffer{}
+			engine := newEngine(root, nil, out, tc.opts)
+			engine.showRewriteSummary(rewriteResult{Changed: []string{"b.yaml"}, StepsChanged: 3, StepsSkipped: 1}, "pinned")
+			assert.Equal(t, out.String(), tc.want, "incorrect summary")
+		})
+	}
+}
+
+func TestIsDowngrade(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		current  string
+		target   string
+		expected bool
+	}{
+		{"v2.0.0", "v1.0.0", true},
+		{"v1.2.0", "v1.1.9", true},
+		{"v1.0.0", "v1.0.0", false},
+		{"v1.0.0", "v2.0.0", false},
+		// non-semver versions cannot be compared
+		{"", "v1.0.0", false},
+		{"v1.0.0", "", false},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("isDowngrade(%s,%s)", tc.current, tc.target), func(t *testing.T) {
+			t.Parallel()
+			got := isDowngrade(Release{Version: tc.current}, Release{Version: tc.target})
+			assert.Equal(t, got, tc.expected, "is downgrade?")
+		})
+	}
+}
+
+func TestCheckDowngrades(t *testing.T) {
+	t.Parallel()
+	var (
+		v1 = Release{Version: "v1.0.0", CommitHash: "aaa111"}
+		v2 = Release{Version: "v2.0.0", CommitHash: "bbb222"}
+	)
+	root := Root{Workflows: map[string]Workflow{
+		"ci.yaml": {
+			FilePath: "ci.yaml",
+			Steps: []Step{
+				{LineNumber: 4, Action: Action{Name: "owner/upgrade", Release: v1, UpgradeCandidates: UpgradeCandidates{Latest: v2}}},
+				{LineNumber: 9, Action: Action{Name: "owner/downgrade", Release: v2, UpgradeCandidates: UpgradeCandidates{Latest: v1}}},
+			},
+		},
+	}}
+	engine := newEngine(root, nil, io.Discard, engineOpts{})
+	assert.NilError(t, engine.checkDowngrades(ModeCurrent))
+	assert.Error(t, engine.checkDowngrades(ModeLatest), errors.New("refusing to downgrade 1 action(s), pass --allow-downgrade to proceed:\n  ci.yaml:10 owner/downgrade from v2.0.0 to v1.0.0"))
+}
+
+func TestRewriteWorkflowsPreservesLineEndings(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	release := Release{CommitHash: commit, Version: "v1.0.0"}
+
+	testCases := map[string]struct {
+		input       string
+		ref         string
+		want        string
+		wantChanged bool
+	}{
+		"no trailing newline, no-op pin": {
+			input:       "steps:\n  - uses: owner/repo@" + commit + " # v1.0.0",
+			ref:         commit,
+			want:        "steps:\n  - uses: owner/repo@" + commit + " # v1.0.0",
+			wantChanged: false,
+		},
+		"no trailing newline, last line rewritten": {
+			input:       "steps:\n  - uses: owner/repo@v1",
+			ref:         "v1",
+			want:        "steps:\n  - uses: owner/repo@" + commit + " # v1.0.0",
+			wantChanged: true,
+		},
+		"trailing newline": {
+			input:       "steps:\n  - uses: owner/repo@v1\n",
+			ref:         "v1",
+			want:        "steps:\n  - uses: owner/repo@" + commit + " # v1.0.0\n",
+			wantChanged: true,
+		},
+		"crlf line endings without trailing newline": {
+			input:       "steps:\r\n  - uses: owner/repo@v1\r\n  - run: make test",
+			ref:         "v1",
+			want:        "steps:\r\n  - uses: owner/repo@" + commit + " # v1.0.0\r\n  - run: make test",
+			wantChanged: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			path := writeTestWorkflow(t, tc.input)
+			root := Root{Workflows: map[string]Workflow{
+				path: {
+					FilePath: path,
+					Steps:    []Step{{LineNumber: 1, Action: Action{Name: "owner/repo", Ref: tc.ref, Release: release}}},
+				},
+			}}
+			engine := newEngine(root, nil, io.Discard, engineOpts{})
+			result, err := engine.rewriteWorkflows(testCtx(), rewriteStrategyForMode(ModeCurrent))
+			assert.NilError(t, err)
+			assert.Equal(t, len(result.Changed) > 0, tc.wantChanged, "file changed?")
+
+			got, err := os.ReadFile(path) // #nosec G304
+			assert.NilError(t, err)
+			assert.Equal(t, string(got), tc.want, "incorrect file contents")
+		})
+	}
+}
+
+func TestRewriteWorkflowsIsIdempotent(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	path := writeTestWorkflow(t, "steps:\r\n  - uses: owner/repo@v1\r\n  - uses: 'owner/other@v2'\r\n  - run: make test")
+
+	rewrite := func() rewriteResult {
+		t.Helper()
+		root, err := ScanWorkflows([]string{path}, scanOpts{})
+		assert.NilError(t, err)
+		w := root.Workflows[path]
+		for i := range w.Steps {
+			w.Steps[i].Action.Release = Release{CommitHash: commit, Version: "v1.0.0"}
+		}
+		engine := newEngine(root, nil, io.Discard, engineOpts{})
+		result, err := engine.rewriteWorkflows(testCtx(), rewriteStrategyForMode(ModeCurrent))
+		assert.NilError(t, err)
+		return result
+	}
+
+	first := rewrite()
+	assert.Equal(t, first.StepsChanged, 2, "first run should pin every step")
+
+	// a second run over the pinned file must be a no-op that leaves the file
+	// untouched
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.NilError(t, os.Chtimes(path, past, past))
+	second := rewrite()
+	assert.DeepEqual(t, second, rewriteResult{}, "second run should change nothing")
+	info, err := os.Stat(path)
+	assert.NilError(t, err)
+	assert.Equal(t, info.ModTime().Equal(past), true, "unchanged file should not be rewritten")
+}
+
+func TestRewriteWorkflowsMultiDocument(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	input := strings.Join([]string{
+		"---",
+		"steps:",
+		"  - uses: owner/first@v1",
+		"...",
+		"--- # second document",
+		"steps:",
+		"  - uses: owner/second@v2",
+		"---",
+		"  - uses: owner/third@v3",
+		"",
+	}, "\n")
+	want := strings.Join([]string{
+		"---",
+		"steps:",
+		"  - uses: owner/first@" + commit + " # v1.0.0",
+		"...",
+		"--- # second document",
+		"steps:",
+		"  - uses: owner/second@" + commit + " # v1.0.0",
+		"---",
+		"  - uses: owner/third@" + commit + " # v1.0.0",
+		"",
+	}, "\n")
+
+	path := writeTestWorkflow(t, input)
+	root, err := ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+
+	// document separators are ordinary lines, so line numbers count straight
+	// through them
+	w := root.Workflows[path]
+	gotLines := make([]int, 0, len(w.Steps))
+	for i := range w.Steps {
+		gotLines = append(gotLines, w.Steps[i].LineNumber)
+		w.Steps[i].Action.Release = Release{CommitHash: commit, Version: "v1.0.0"}
+	}
+	assert.DeepEqual(t, gotLines, []int{2, 6, 8}, "incorrect step line numbers")
+
+	engine := newEngine(root, nil, io.Discard, engineOpts{})
+	_, err = engine.rewriteWorkflows(testCtx(), rewriteStrategyForMode(ModeCurrent))
+	assert.NilError(t, err)
+
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	if string(got) != want {
+		t.Fatalf("incorrect rewrite:\n\n%s", diffStrings(t, want, string(got)))
+	}
+}
+
+func TestRewriteWorkflowsPreservesQuotes(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	input := strings.Join([]string{
+		"steps:",
+		`  - uses: "owner/first@v1"`,
+		"  - uses: 'owner/second@v2' # v2",
+		"  - uses: owner/third@v3",
+		"",
+	}, "\n")
+	want := strings.Join([]string{
+		"steps:",
+		`  - uses: "owner/first@` + commit + `" # v1.0.0`,
+		"  - uses: 'owner/second@" + commit + "' # v1.0.0",
+		"  - uses: owner/third@" + commit + " # v1.0.0",
+		"",
+	}, "\n")
+
+	path := writeTestWorkflow(t, input)
+	root, err := ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+	w := root.Workflows[path]
+	assert.Equal(t, len(w.Steps), 3, "incorrect number of steps")
+	for i := range w.Steps {
+		w.Steps[i].Action.Release = Release{CommitHash: commit, Version: "v1.0.0"}
+	}
+
+	engine := newEngine(root, nil, io.Discard, engineOpts{})
+	_, err = engine.rewriteWorkflows(testCtx(), rewriteStrategyForMode(ModeCurrent))
+	assert.NilError(t, err)
+
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	if string(got) != want {
+		t.Fatalf("incorrect rewrite:\n\n%s", diffStrings(t, want, string(got)))
+	}
+}
+
+func TestPruneComments(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	input := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@" + commit + " # v4.2.0",
+		"  - uses: owner/repo@" + commit + " # ref:main",
+		"  - uses: owner/repo@" + commit + " # v4.2.0 (was:main)",
+		"  - uses: owner/repo@" + commit + " # pinned until the next release is fixed",
+		"  - uses: owner/repo@aaaaaaa # v4.2.0",
+		"  - uses: owner/repo@v4 # v4.2.0",
+		"",
+	}, "\n")
+	want := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@" + commit,
+		"  - uses: owner/repo@" + commit,
+		"  - uses: owner/repo@" + commit,
+		"  - uses: owner/repo@" + commit + " # pinned until the next release is fixed",
+		"  - uses: owner/repo@aaaaaaa # v4.2.0",
+		"  - uses: owner/repo@v4 # v4.2.0",
+		"",
+	}, "\n")
+
+	path := writeTestWorkflow(t, input)
+	root, err := ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+
+	engine := newEngine(root, nil, io.Discard, engineOpts{})
+	assert.NilError(t, engine.PruneComments(testCtx(), io.Discard))
+
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	if string(got) != want {
+		t.Fatalf("incorrect rewrite:\n\n%s", diffStrings(t, want, string(got)))
+	}
+}
+
+func TestPruneCommentsReport(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	input := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@" + commit + " # v4.2.0",
+		"  - uses: owner/repo@" + commit + " # v4.2.0",
+		"",
+	}, "\n")
+
+	t.Run("written from applied changes", func(t *testing.T) {
+		t.Parallel()
+		path := writeTestWorkflow(t, input)
+		root, err := ScanWorkflows([]string{path}, scanOpts{})
+		assert.NilError(t, err)
+
+		reportPath := filepath.Join(t.TempDir(), "report.json")
+		engine := newEngine(root, nil, io.Discard, engineOpts{ReportFile: reportPath, ReportRepo: "repo"})
+		assert.NilError(t, engine.PruneComments(testCtx(), io.Discard))
+
+		data, err := os.ReadFile(reportPath) // #nosec G304
+		assert.NilError(t, err)
+		var report Report
+		assert.NilError(t, json.Unmarshal(data, &report))
+		assert.Equal(t, len(report.Repos["repo"].Changes), 2, "incorrect number of reported changes")
+	})
+
+	t.Run("not written if rewrite fails", func(t *testing.T) {
+		t.Parallel()
+		path := writeTestWorkflow(t, input)
+		root, err := ScanWorkflows([]string{path}, scanOpts{})
+		assert.NilError(t, err)
+		assert.NilError(t, os.Remove(path))
+
+		reportPath := filepath.Join(t.TempDir(), "report.json")
+		engine := newEngine(root, nil, io.Discard, engineOpts{ReportFile: reportPath, ReportRepo: "repo"})
+		if err := engine.PruneComments(testCtx(), io.Discard); err == nil {
+			t.Fatalf("expected rewrite of missing workflow to fail")
+		}
+		_, err = os.Stat(reportPath)
+		assert.Equal(t, errors.Is(err, fs.ErrNotExist), true, "report file should not exist")
+	})
+}
+
+func TestRewriteOnly(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	input := strings.Join([]string{
+		"steps:",
+		"  - uses:   owner/repo@" + commit + "   #v4.2.0",
+		"  - uses: 'owner/repo@" + commit + "' #   v4.2.0",
+		"  - uses: owner/repo@" + commit + "#v4.2.0 (was:main)",
+		"  - uses: owner/repo@" + commit + "  ",
+		"  - uses: owner/repo@" + commit + "  #  ref:main",
+		"  - uses: owner/repo@" + commit + "  #  pinned until the next release is fixed",
+		"  - uses: owner/repo@v4   #  v4.2.0",
+		"",
+	}, "\n")
+	want := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@" + commit + " # v4.2.0",
+		"  - uses: 'owner/repo@" + commit + "' # v4.2.0",
+		"  - uses: owner/repo@" + commit + " # v4.2.0 (was:main)",
+		"  - uses: owner/repo@" + commit,
+		"  - uses: owner/repo@" + commit + "  #  ref:main",
+		"  - uses: owner/repo@" + commit + "  #  pinned until the next release is fixed",
+		"  - uses: owner/repo@v4   #  v4.2.0",
+		"",
+	}, "\n")
+
+	path := writeTestWorkflow(t, input)
+	root, err := ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+
+	// no client, since no API requests may be made
+	engine := newEngine(root, nil, io.Discard, engineOpts{})
+	assert.NilError(t, engine.RewriteOnly(testCtx(), io.Discard))
+
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	if string(got) != want {
+		t.Fatalf("incorrect rewrite:\n\n%s", diffStrings(t, want, string(got)))
+	}
+}
+
+func TestPinBranchesToLatest(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+		commitC = "cccccccccccccccccccccccccccccccccccccccc"
+		commitD = "dddddddddddddddddddddddddddddddddddddddd"
+	)
+	input := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@main",
+		"  - uses: owner/repo@v1.0.0",
+		"",
+	}, "\n")
+	want := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@" + commitB + " # v2.0.0 (was:main)",
+		"  - uses: owner/repo@" + commitA + " # v1.0.0",
+		"",
+	}, "\n")
+
+	client := newTestClient(t, map[string]httpResponse{
+		// version tags
+		"2590b2f6ce": okResponse(`{
+			"data": {
+				"repository": {
+					"refs": {
+						"nodes": [
+							{"name": "v2.0.0", "target": {"oid": "` + commitB + `"}},
+							{"name": "v1.0.0", "target": {"oid": "` + commitA + `"}}
+						],
+						"pageInfo": {"hasNextPage": false, "endCursor": ""}
+					}
+				}
+			}
+		}`),
+		// releases, where the newest is a prerelease
+		"6104c8d776": okResponse(`{
+			"data": {
+				"repository": {
+					"releases": {
+						"pageInfo": {"hasNextPage": false, "endCursor": ""},
+						"nodes": [
+							{"tag": {"target": {"oid": "` + commitD + `"}}, "tagName": "v3.0.0-rc.1"},
+							{"tag": {"target": {"oid": "` + commitB + `"}}, "tagName": "v2.0.0"},
+							{"tag": {"target": {"oid": "` + commitA + `"}}, "tagName": "v1.0.0"}
+						]
+					}
+				}
+			}
+		}`),
+	}, map[string]httpResponse{
+		"GET /repos/owner/repo/git/ref/heads/main":   okResponse(`{"object": {"sha": "` + commitC + `", "type": "commit"}}`),
+		"GET /repos/owner/repo/git/ref/heads/v1.0.0": errResponse(http.StatusNotFound, `{"message": "Not Found"}`),
+		"GET /repos/owner/repo/git/ref/tags/v1.0.0":  okResponse(`{"object": {"sha": "` + commitA + `", "type": "commit"}}`),
+	})
+
+	path := writeTestWorkflow(t, input)
+	root, err := ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+
+	engine := newEngine(root, client, io.Discard, engineOpts{BranchesToLatest: true})
+	assert.NilError(t, engine.Pin(testCtx(), io.Discard, ModeCurrent))
+
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	if string(got) != want {
+		t.Fatalf("incorrect rewrite:\n\n%s", diffStrings(t, want, string(got)))
+	}
+
+	// the original branch is parsed back out of the version comment
+	root, err = ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+	step := root.Workflows[path].Steps[0]
+	assert.Equal(t, step.Comment, "v2.0.0", "incorrect comment")
+	assert.Equal(t, step.OriginalRef, "main", "incorrect original ref")
+
+	// denied versions are skipped like any other upgrade candidate
+	path = writeTestWorkflow(t, input)
+	root, err = ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+	engine = newEngine(root, client, io.Discard, engineOpts{BranchesToLatest: true, DeniedVersions: map[string][]string{"owner/repo": {"v2.0.0"}}})
+	assert.NilError(t, engine.Pin(testCtx(), io.Discard, ModeCurrent))
+	got, err = os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	assert.Contains(t, string(got), "owner/repo@"+commitA+" # v1.0.0 (was:main)", "branch pinned despite denied version")
+}
+
+func TestPinFromLockfile(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	input := strings.Join([]string{
+		"steps:",
+		"  - uses: actions/checkout@v4",
+		"  - uses: actions/setup-go@v5 # newly added",
+		"  - uses: owner/repo@" + commitB + " # v2.0.0",
+		"",
+	}, "\n")
+
+	testCases := map[string]struct {
+		lock    func(workflow string) Plan
+		want    string
+		wantErr string
+	}{
+		"pins only locked actions": {
+			lock: func(workflow string) Plan {
+				return Plan{Changes: []PlannedChange{
+					{Workflow: workflow, Action: "actions/checkout", ProposedCommit: commitA, ProposedVersion: "v4.2.2"},
+					{Workflow: workflow, Action: "owner/repo", ProposedCommit: commitA, ProposedVersion: "v1.0.0"},
+				}}
+			},
+			want: strings.Join([]string{
+				"steps:",
+				"  - uses: actions/checkout@" + commitA + " # v4.2.2",
+				"  - uses: actions/setup-go@v5 # newly added",
+				"  - uses: owner/repo@" + commitA + " # v1.0.0",
+				"",
+			}, "\n"),
+		},
+		"missing entries are an error": {
+			lock: func(workflow string) Plan {
+				return Plan{Changes: []PlannedChange{
+					{Workflow: workflow, Action: "actions/checkout", ProposedCommit: commitA},
+					{Workflow: workflow, Action: "actions/cache", ProposedCommit: commitA},
+					{Workflow: "other.yaml", Action: "actions/checkout", ProposedCommit: commitA},
+				}}
+			},
+			wantErr: "lockfile entries not found in workflows:\n  WORKFLOW actions/cache\n  other.yaml actions/checkout",
+		},
+		"conflicting entries are an error": {
+			lock: func(workflow string) Plan {
+				return Plan{Changes: []PlannedChange{
+					{Workflow: workflow, Action: "actions/checkout", ProposedCommit: commitA},
+					{Workflow: workflow, Action: "actions/checkout", ProposedCommit: commitB},
+				}}
+			},
+			wantErr: "lockfile records conflicting versions of actions/checkout in WORKFLOW: " + commitA + " and " + commitB,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			path := writeTestWorkflow(t, input)
+			root, err := ScanWorkflows([]string{path}, scanOpts{})
+			assert.NilError(t, err)
+
+			// a nil client ensures no API requests are made
+			engine := newEngine(root, nil, io.Discard, engineOpts{})
+			err = engine.PinFromLockfile(testCtx(), io.Discard, tc.lock(path))
+			got, readErr := os.ReadFile(path) // #nosec G304
+			assert.NilError(t, readErr)
+			if tc.wantErr != "" {
+				assert.Error(t, err, errors.New(strings.ReplaceAll(tc.wantErr, "WORKFLOW", path)))
+				assert.Equal(t, string(got), input, "workflow should be unchanged on error")
+				return
+			}
+			assert.NilError(t, err)
+			if string(got) != tc.want {
+				t.Fatalf("incorrect rewrite:\n\n%s", diffStrings(t, tc.want, string(got)))
+			}
+		})
+	}
+}
+
+func TestRewriteJSONOutput(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	input := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/repo@v1",
+		"  - uses: owner/other@" + commitB + " # v2.0.0",
+		"",
+	}, "\n")
+	path := writeTestWorkflow(t, input)
+	root, err := ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+	lock := Plan{Changes: []PlannedChange{
+		{Workflow: path, Action: "owner/repo", ProposedCommit: commitA, ProposedVersion: "v1.2.0"},
+		{Workflow: path, Action: "owner/other", ProposedCommit: commitB, ProposedVersion: "v2.0.0"},
+	}}
+
+	run := func() Plan {
+		engine := newEngine(root, nil, io.Discard, engineOpts{Output: outputJSON})
+		var buf bytes.Buffer
+		assert.NilError(t, engine.PinFromLockfile(testCtx(), &buf, lock))
+		var got Plan
+		assert.NilError(t, json.Unmarshal(buf.Bytes(), &got))
+		return got
+	}
+
+	// only the step whose line actually changed is reported
+	assert.DeepEqual(t, run(), Plan{Changes: []PlannedChange{{
+		Workflow:        path,
+		Line:            2,
+		Action:          "owner/repo",
+		CurrentRef:      "v1",
+		ProposedVersion: "v1.2.0",
+		ProposedCommit:  commitA,
+		Change:          ChangeUnknown,
+	}}}, "incorrect applied changes")
+
+	// once applied, nothing changes, but the output is still a valid plan
+	assert.DeepEqual(t, run(), Plan{Changes: []PlannedChange{}}, "expected no applied changes")
+}
+
+func TestRelativePaths(t *testing.T) {
+	t.Parallel()
+
+	const commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	repo := t.TempDir()
+	workflowDir := filepath.Join(repo, ".github", "workflows")
+	assert.NilError(t, os.Mkdir(filepath.Join(repo, ".git"), 0o700))
+	assert.NilError(t, os.MkdirAll(workflowDir, 0o700))
+	path := filepath.Join(workflowDir, "ci.yaml")
+	assert.NilError(t, os.WriteFile(path, []byte("steps:\n  - uses: owner/repo@v1\n"), 0o600))
+	root, err := ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+
+	// a lockfile written with relative paths still matches the workflow
+	lock := Plan{Changes: []PlannedChange{
+		{Workflow: ".github/workflows/ci.yaml", Action: "owner/repo", ProposedCommit: commitA, ProposedVersion: "v1.2.0"},
+	}}
+	engine := newEngine(root, nil, io.Discard, engineOpts{Output: outputJSON, RelativePaths: true})
+	var buf bytes.Buffer
+	assert.NilError(t, engine.PinFromLockfile(testCtx(), &buf, lock))
+
+	var got Plan
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, len(got.Changes), 1, "incorrect number of applied changes")
+	assert.Equal(t, got.Changes[0].Workflow, ".github/workflows/ci.yaml", "incorrect workflow path")
+
+	var out bytes.Buffer
+	engine = newEngine(root, nil, &out, engineOpts{RelativePaths: true})
+	engine.showRewriteSummary(rewriteResult{Changed: []string{path}}, "pinned")
+	assert.Contains(t, out.String(), "updated   .github/workflows/ci.yaml", "incorrect summary")
+}
+
+func TestForEachStep(t *testing.T) {
+	t.Parallel()
+
+	root := Root{
+		Workflows: map[string]Workflow{
+			"a.yaml": {FilePath: "a.yaml", Steps: []Step{{LineNumber: 1}, {LineNumber: 5}}},
+			"b.yaml": {FilePath: "b.yaml", Steps: []Step{{LineNumber: 2}, {LineNumber: 3}}},
+		},
+	}
+	errFailed := errors.New("failed")
+	failSome := func(_ context.Context, w Workflow, s *Step) error {
+		if w.FilePath == "a.yaml" && s.LineNumber == 5 || w.FilePath == "b.yaml" && s.LineNumber == 2 {
+			return errFailed
+		}
+		return nil
+	}
+
+	testCases := map[string]struct {
+		opts      engineOpts
+		wantErr   error
+		wantCalls int
+	}{
+		"non-strict mode ignores errors": {
+			opts:      engineOpts{Workers: 1},
+			wantErr:   nil,
+			wantCalls: 4,
+		},
+		"strict mode aborts on first error": {
+			opts:    engineOpts{Workers: 1, Strict: true},
+			wantErr: errFailed,
+			// number of calls depends on scheduling
+		},
+		"strict mode without fail-fast reports all errors": {
+			opts:      engineOpts{Workers: 2, Strict: true, NoFailFast: true},
+			wantErr:   errors.New("2 step(s) failed:\na.yaml:6: failed\nb.yaml:3: failed"),
+			wantCalls: 4,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int64
+			engine := newEngine(root, nil, io.Discard, tc.opts)
+			engine.phaseLog.StartPhase("testing")
+			err := engine.forEachStep(testCtx(), func(ctx context.Context, w Workflow, s *Step) error {
+				calls.Add(1)
+				return failSome(ctx, w, s)
+			})
+			if tc.wantErr == nil {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err, tc.wantErr)
+			}
+			if tc.wantCalls > 0 {
+				assert.Equal(t, int(calls.Load()), tc.wantCalls, "incorrect number of calls")
+			}
+		})
+	}
+}
+
+func TestForEachStepWorkflowLimit(t *testing.T) {
+	t.Parallel()
+
+	root := Root{Workflows: map[string]Workflow{}}
+	for _, name := range []string{"a.yaml", "b.yaml", "c.yaml"} {
+		root.Workflows[name] = Workflow{FilePath: name, Steps: make([]Step, 3)}
+	}
+
+	for _, limit := range []int{1, 2} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			t.Parallel()
+			var (
+				mu           sync.Mutex
+				active       = map[string]int{}
+				maxWorkflows = 0
+				calls        atomic.Int64
+			)
+			engine := newEngine(root, nil, io.Discard, engineOpts{Workers: 9, WorkflowLimit: limit})
+			engine.phaseLog.StartPhase("testing")
+			err := engine.forEachStep(testCtx(), func(_ context.Context, w Workflow, _ *Step) error {
+				calls.Add(1)
+				mu.Lock()
+				active[w.FilePath]++
+				maxWorkflows = max(maxWorkflows, len(active))
+				mu.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+
+				mu.Lock()
+				if active[w.FilePath]--; active[w.FilePath] == 0 {
+					delete(active, w.FilePath)
+				}
+				mu.Unlock()
+				return nil
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, int(calls.Load()), 9, "incorrect number of calls")
+			if maxWorkflows > limit {
+				t.Fatalf("expected at most %d workflow(s) in flight, got %d", limit, maxWorkflows)
+			}
+		})
+	}
+}
+
+func TestForEachStepWorkflowAcquireError(t *testing.T) {
+	t.Parallel()
+
+	// a.yaml holds the only workflow slot until after the deadline expires,
+	// so b.yaml's steps can never be scheduled
+	root := Root{
+		Workflows: map[string]Workflow{
+			"a.yaml": {FilePath: "a.yaml", Steps: []Step{{LineNumber: 1}}},
+			"b.yaml": {FilePath: "b.yaml", Steps: []Step{{LineNumber: 2}}},
+		},
+	}
+
+	testCases := map[string]struct {
+		strict  bool
+		wantErr error
+	}{
+		"non-strict mode ignores errors": {
+			strict: false,
+		},
+		"strict mode reports the error": {
+			strict:  true,
+			wantErr: context.DeadlineExceeded,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithTimeout(testCtx(), 20*time.Millisecond)
+			defer cancel()
+
+			var finished atomic.Bool
+			engine := newEngine(root, nil, io.Discard, engineOpts{Workers: 2, WorkflowLimit: 1, Strict: tc.strict})
+			engine.phaseLog.StartPhase("testing")
+			err := engine.forEachStep(ctx, func(ctx context.Context, w Workflow, _ *Step) error {
+				if w.FilePath == "b.yaml" {
+					t.Errorf("unexpected call for %s", w.FilePath)
+				}
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				finished.Store(true)
+				return nil
+			})
+			if tc.wantErr == nil {
+				assert.NilError(t, err)
+			} else {
+				assert.Error(t, err, tc.wantErr)
+			}
+			assert.Equal(t, finished.Load(), true, "in-flight steps should finish before returning")
+		})
+	}
+}
+
+func TestRunPostWriteCommand(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		command    []string
+		ignoreErrs bool
+		wantErr    error
+		wantOut    string
+		wantFile   string
+	}{
+		"command runs over changed files": {
+			command:  []string{"sh", "-c", `for f; do echo "# formatted" >> "$f"; done`, "sh"},
+			wantFile: "steps:\n# formatted\n",
+		},
+		"failing command is an error": {
+			command:  []string{"sh", "-c", "echo bad yaml >&2; exit 3"},
+			wantErr:  errors.New("post-write command failed: exit status 3\nbad yaml"),
+			wantFile: "steps:\n",
+		},
+		"failing command is a warning when ignoring errors": {
+			command:    []string{"sh", "-c", "exit 3"},
+			ignoreErrs: true,
+			wantOut:    "warning: post-write command failed: exit status 3",
+			wantFile:   "steps:\n",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			path := writeTestWorkflow(t, "steps:\n")
+			out := &strings.Builder{}
+			engine := newEngine(Root{}, nil, out, engineOpts{
+				PostWriteCommand:      tc.command,
+				IgnorePostWriteErrors: tc.ignoreErrs,
+			})
+			err := engine.runPostWriteCommand(testCtx(), []string{path})
+			if tc.wantErr != nil {
+				assert.Error(t, err, tc.wantErr)
+			} else {
+				assert.NilError(t, err)
+			}
+			if tc.wantOut != "" {
+				assert.Contains(t, out.String(), tc.wantOut, "incorrect output")
+			}
+			got, err := os.ReadFile(path) // #nosec G304
+			assert.NilError(t, err)
+			assert.Equal(t, string(got), tc.wantFile, "incorrect file contents")
+		})
+	}
+}
+
+func TestWorkflowTracker(t *testing.T) {
+	t.Parallel()
+
+	var (
+		a     = Workflow{FilePath: "a.yaml", Steps: []Step{{LineNumber: 1}, {LineNumber: 2}}}
+		b     = Workflow{FilePath: "b.yaml"}
+		c     = Workflow{FilePath: "c.yaml", Steps: []Step{{LineNumber: 1}}}
+		root  = Root{Workflows: map[string]Workflow{"a.yaml": a, "b.yaml": b, "c.yaml": c}}
+		keys  = []string{"a.yaml", "b.yaml", "c.yaml"}
+		ready = func(tracker *workflowTracker, i int) bool {
+			select {
+			case <-tracker.done[i]:
+				return true
+			default:
+				return false
+			}
+		}
+	)
+
+	t.Run("workflows are done once all of their steps are done", func(t *testing.T) {
+		t.Parallel()
+		tracker := newWorkflowTracker(root, keys)
+		assert.Equal(t, ready(tracker, 0), false, "a done?")
+		assert.Equal(t, ready(tracker, 1), true, "empty workflow b done?")
+		assert.Equal(t, ready(tracker, 2), false, "c done?")
+
+		tracker.stepDone(c)
+		tracker.stepDone(a)
+		assert.Equal(t, ready(tracker, 0), false, "a done?")
+		assert.Equal(t, ready(tracker, 2), true, "c done?")
+
+		tracker.stepDone(a)
+		for i := range keys {
+			assert.Equal(t, tracker.wait(i), true, "wait(%d)", i)
+		}
+	})
+
+	t.Run("abort unblocks waiting for unfinished workflows", func(t *testing.T) {
+		t.Parallel()
+		tracker := newWorkflowTracker(root, keys)
+		tracker.stepDone(c)
+		tracker.abort()
+		tracker.abort() // idempotent
+		assert.Equal(t, tracker.wait(0), false, "wait(0)")
+		assert.Equal(t, tracker.wait(2), true, "wait(2)")
+	})
+}
+
+func TestResolveStepTrustHashes(t *testing.T) {
+	t.Parallel()
+
+	const commit = "abcdef1234abcdef1234abcdef1234abcdef1234"
+	tagsResp := okResponse(`{
+		"data": {
+			"repository": {
+				"refs": {
+					"nodes": [{"name": "v1.2.3", "target": {"oid": "` + commit + `"}}],
+					"pageInfo": {"hasNextPage": false, "endCursor": ""}
+				}
+			}
+		}
+	}`)
+	offlineResp := errResponse(http.StatusBadGateway, `{"message": "bad gateway"}`)
+
+	testCases := map[string]struct {
+		trustHashes  bool
+		gqlEndpoints map[string]httpResponse
+		want         Release
+		wantErr      bool
+	}{
+		"trusted hash skips ref lookup": {
+			trustHashes:  true,
+			gqlEndpoints: map[string]httpResponse{"2590b2f6ce": tagsResp},
+			want:         Release{CommitHash: commit, Version: "v1.2.3"},
+		},
+		"trusted hash falls back to existing comment when tags unavailable": {
+			trustHashes:  true,
+			gqlEndpoints: map[string]httpResponse{"2590b2f6ce": offlineResp},
+			want:         Release{CommitHash: commit, Version: "v1.0.0"},
+		},
+		"untrusted hash fails when tags unavailable": {
+			trustHashes: false,
+			gqlEndpoints: map[string]httpResponse{
+				"2590b2f6ce": offlineResp,
+			},
+			wantErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			restEndpoints := map[string]httpResponse{}
+			if !tc.trustHashes {
+				restEndpoints["GET /repos/owner/repo/commits/"+commit] = okResponse(`{"sha": "` + commit + `"}`)
+			}
+			client := newTestClient(t, tc.gqlEndpoints, restEndpoints)
+			engine := newEngine(Root{}, client, io.Discard, engineOpts{TrustHashes: tc.trustHashes})
+			engine.phaseLog.StartPhase("testing")
+
+			workflow := Workflow{FilePath: "test.yaml"}
+			step := &Step{Action: Action{Name: "owner/repo", Ref: commit}, Comment: "v1.0.0"}
+			err := engine.resolveStep(testCtx(), workflow, step, false)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, step.Action.Release, tc.want, "incorrect release")
+			assert.DeepEqual(t, step.Action.VersionTags, []string{tc.want.Version}, "incorrect version tags")
+		})
+	}
+}
+
+func TestResolveStepVersionMap(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commit = "abcdef1234abcdef1234abcdef1234abcdef1234"
+		other  = "1234abcdef1234abcdef1234abcdef1234abcdef"
+	)
+	tagsResp := okResponse(`{
+		"data": {
+			"repository": {
+				"refs": {
+					"nodes": [{"name": "v1.2.3", "target": {"oid": "` + other + `"}}],
+					"pageInfo": {"hasNextPage": false, "endCursor": ""}
+				}
+			}
+		}
+	}`)
+	versions := versionMap{versionMapKey("Owner/Repo", commit): "v1.0.0"}
+
+	testCases := map[string]struct {
+		ref          string
+		offline      bool
+		gqlEndpoints map[string]httpResponse
+		want         Release
+	}{
+		"mapped commit skips version tag lookup": {
+			ref:  commit,
+			want: Release{CommitHash: commit, Version: "v1.0.0"},
+		},
+		"unmapped commit falls back to version tag lookup": {
+			ref:          other,
+			gqlEndpoints: map[string]httpResponse{"2590b2f6ce": tagsResp},
+			want:         Release{CommitHash: other, Version: "v1.2.3"},
+		},
+		"unmapped commit has no version offline": {
+			ref:     other,
+			offline: true,
+			want:    Release{CommitHash: other},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := newTestClient(t, tc.gqlEndpoints, nil)
+			engine := newEngine(Root{}, client, io.Discard, engineOpts{TrustHashes: true, VersionMap: versions, Offline: tc.offline})
+			engine.phaseLog.StartPhase("testing")
+
+			workflow := Workflow{FilePath: "test.yaml"}
+			step := &Step{Action: Action{Name: "owner/repo", Ref: tc.ref}}
+			assert.NilError(t, engine.resolveStep(testCtx(), workflow, step, false))
+			assert.Equal(t, step.Action.Release, tc.want, "incorrect release")
+		})
+	}
+}
+
+func TestResolveStepPrefetchReleases(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	notFound := errResponse(http.StatusNotFound, `{"message": "Not Found"}`)
+	gqlEndpoints := map[string]httpResponse{
+		// version tags
+		"2590b2f6ce": okResponse(`{
+			"data": {
+				"repository": {
+					"refs": {
+						"nodes": [{"name": "v1.0.0", "target": {"oid": "` + commitA + `"}}],
+						"pageInfo": {"hasNextPage": false, "endCursor": ""}
+					}
+				}
+			}
+		}`),
+		// releases
+		"6104c8d776": okResponse(`{
+			"data": {
+				"repository": {
+					"releases": {
+						"pageInfo": {"hasNextPage": false, "endCursor": ""},
+						"nodes": [
+							{"tag": {"target": {"oid": "` + commitB + `"}}, "tagName": "v1.1.0"},
+							{"tag": {"target": {"oid": "` + commitA + `"}}, "tagName": "v1.0.0"}
+						]
+					}
+				}
+			}
+		}`),
+	}
+
+	t.Run("candidates are unchanged", func(t *testing.T) {
+		t.Parallel()
+		client := newTestClient(t, gqlEndpoints, map[string]httpResponse{
+			"GET /repos/owner/repo/git/ref/heads/v1.0.0": notFound,
+			"GET /repos/owner/repo/git/ref/tags/v1.0.0":  okResponse(`{"object": {"sha": "` + commitA + `", "type": "commit"}}`),
+		})
+		engine := newEngine(Root{}, client, io.Discard, engineOpts{PrefetchReleases: true})
+		engine.phaseLog.StartPhase("testing")
+
+		step := &Step{Action: Action{Name: "owner/repo", Ref: "v1.0.0"}}
+		assert.NilError(t, engine.resolveStep(testCtx(), Workflow{FilePath: "test.yaml"}, step, true))
+		assert.Equal(t, step.Action.Release, Release{CommitHash: commitA, Version: "v1.0.0"}, "incorrect release")
+		assert.Equal(t, step.Action.UpgradeCandidates.Latest, Release{CommitHash: commitB, Version: "v1.1.0"}, "incorrect latest release")
+	})
+
+	t.Run("releases are fetched before the ref is resolved", func(t *testing.T) {
+		t.Parallel()
+		client := newTestClient(t, gqlEndpoints, map[string]httpResponse{
+			"GET /repos/owner/repo/git/ref/heads/v9": notFound,
+			"GET /repos/owner/repo/git/ref/tags/v9":  notFound,
+			"GET /repos/owner/repo":                  okResponse(`{"full_name": "owner/repo"}`),
+		})
+		engine := newEngine(Root{}, client, io.Discard, engineOpts{PrefetchReleases: true})
+		engine.phaseLog.StartPhase("testing")
+
+		step := &Step{Action: Action{Name: "owner/repo", Ref: "v9"}}
+		if err := engine.resolveStep(testCtx(), Workflow{FilePath: "test.yaml"}, step, true); err == nil {
+			t.Fatalf("expected error resolving missing ref, got none")
+		}
+		_, started := client.releaseSets.Peek("owner/repo")
+		assert.Equal(t, started, true, "expected releases to be prefetched")
+
+		// the prefetched releases are shared by later lookups
+		var versions []string
+		for release, err := range client.iterAllReleases(testCtx(), "owner/repo") {
+			assert.NilError(t, err)
+			versions = append(versions, release.Version)
+		}
+		assert.DeepEqual(t, versions, []string{"v1.1.0", "v1.0.0"}, "incorrect prefetched releases")
+	})
+}
+
+func TestAnnotateUnresolvable(t *testing.T) {
+	t.Parallel()
+
+	notFound := errResponse(http.StatusNotFound, `{"message": "Not Found"}`)
+	client := newTestClient(t, nil, map[string]httpResponse{
+		// the repo is gone entirely
+		"GET /repos/gone/action/git/ref/heads/v1": notFound,
+		"GET /repos/gone/action/git/ref/tags/v1":  notFound,
+		"GET /repos/gone/action":                  notFound,
+		// the repo exists, but the ref does not
+		"GET /repos/other/action/git/ref/heads/v9": notFound,
+		"GET /repos/other/action/git/ref/tags/v9":  notFound,
+		"GET /repos/other/action":                  okResponse(`{"full_name": "other/action"}`),
+	})
+
+	path := writeTestWorkflow(t, strings.Join([]string{
+		"jobs:",
+		"  test:",
+		"    steps:",
+		"      - uses: gone/action@v1",
+		"      - uses: other/action@v9",
+		"",
+	}, "\n"))
+	want := strings.Join([]string{
+		"jobs:",
+		"  test:",
+		"    steps:",
+		"      # ghavm: WARNING unresolved action, repo may be deleted",
+		"      - uses: gone/action@v1",
+		"      - uses: other/action@v9",
+		"",
+	}, "\n")
+
+	// annotating again does not duplicate the annotation
+	for range 2 {
+		root, err := ScanWorkflows([]string{path}, scanOpts{})
+		assert.NilError(t, err)
+		engine := newEngine(root, client, io.Discard, engineOpts{AnnotateUnresolvable: true})
+		assert.NilError(t, engine.Pin(testCtx(), io.Discard, ModeCurrent))
+		got, err := os.ReadFile(path) // #nosec G304
+		assert.NilError(t, err)
+		assert.Equal(t, string(got), want, "incorrect annotated workflow")
+	}
+
+	t.Run("final line without line ending", func(t *testing.T) {
+		t.Parallel()
+		w := Workflow{FilePath: "ci.yaml", Steps: []Step{{LineNumber: 1, Action: Action{Name: "gone/action", Ref: "v1"}}}}
+		got, _, _, err := rewriteContent(testCtx(), w, []byte("steps:\r\n  - uses: gone/action@v1"), func(Workflow, Step) Release {
+			return Release{}
+		}, map[int]bool{1: true}, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, string(got), "steps:\r\n  # ghavm: WARNING unresolved action, repo may be deleted\r\n  - uses: gone/action@v1", "incorrect annotation")
+	})
+}
+
+func TestRequireRepoAccess(t *testing.T) {
+	t.Parallel()
+
+	notFound := errResponse(http.StatusNotFound, `{"message": "Not Found"}`)
+	client := newTestClient(t, nil, map[string]httpResponse{
+		"GET /repos/owner/private-a": notFound,
+		"GET /repos/owner/private-b": notFound,
+		"GET /repos/owner/public":    okResponse(`{"full_name": "owner/public"}`),
+	})
+
+	content := strings.Join([]string{
+		"steps:",
+		"  - uses: owner/public@v1",
+		"  - uses: owner/private-b@v1",
+		"  - uses: owner/private-a/subdir@v1",
+		"  - uses: owner/private-a@v2",
+		"",
+	}, "\n")
+	path := writeTestWorkflow(t, content)
+	root, err := ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+
+	var log strings.Builder
+	engine := newEngine(root, client, &log, engineOpts{RequireRepoAccess: true})
+	err = engine.Pin(testCtx(), io.Discard, ModeCurrent)
+	assert.Error(t, err, errors.New("failed to resolve commit refs: 2 action repo(s) not found or not accessible with the current token:\n  owner/private-a\n  owner/private-b"))
+
+	// the failed phase is finished, so that another may be started
+	assert.Contains(t, log.String(), "failed!", "log output")
+	engine.phaseLog.StartPhase("next phase")
+	engine.phaseLog.FinishPhase("done!")
+
+	// no step was resolved, so nothing was rewritten
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), content, "workflow should be unchanged")
+}
+
+func TestResolveStepTreeHashes(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commit = "abcdef1234abcdef1234abcdef1234abcdef1234"
+		tree   = "1234abcdef1234abcdef1234abcdef1234abcdef"
+	)
+	tagsResp := okResponse(`{
+		"data": {
+			"repository": {
+				"refs": {
+					"nodes": [{"name": "v1.2.3", "target": {"oid": "` + commit + `"}}],
+					"pageInfo": {"hasNextPage": false, "endCursor": ""}
+				}
+			}
+		}
+	}`)
+
+	testCases := map[string]struct {
+		treeResp httpResponse
+		want     Release
+		wantErr  bool
+	}{
+		"tree hash recorded": {
+			treeResp: okResponse(`{"sha": "` + commit + `", "tree": {"sha": "` + tree + `"}}`),
+			want:     Release{CommitHash: commit, Version: "v1.2.3", TreeHash: tree},
+		},
+		"tree lookup failure is an error": {
+			treeResp: errResponse(http.StatusNotFound, `{"message": "not found"}`),
+			wantErr:  true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := newTestClient(t, map[string]httpResponse{"2590b2f6ce": tagsResp}, map[string]httpResponse{
+				"GET /repos/owner/repo/git/commits/" + commit: tc.treeResp,
+			})
+			engine := newEngine(Root{}, client, io.Discard, engineOpts{TrustHashes: true, TreeHashes: true})
+			engine.phaseLog.StartPhase("testing")
+
+			workflow := Workflow{FilePath: "test.yaml"}
+			step := &Step{Action: Action{Name: "owner/repo", Ref: commit}}
+			err := engine.resolveStep(testCtx(), workflow, step, false)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, step.Action.Release, tc.want, "incorrect release")
+			assert.Equal(t, newPlannedChange(workflow, *step, step.Action.Release).ProposedTree, tree, "tree hash should be recorded in plan")
+		})
+	}
+}
+
+func TestTreeHashReleases(t *testing.T) {
+	t.Parallel()
+
+	step := &Step{}
+	for name, tc := range map[string]struct {
+		opts engineOpts
+		want []*Release
+	}{
+		"disabled":     {opts: engineOpts{}},
+		"verbose list": {opts: engineOpts{Verbose: true}, want: []*Release{&step.Action.Release}},
+		"tree hashes": {opts: engineOpts{TreeHashes: true}, want: []*Release{
+			&step.Action.Release,
+			&step.Action.UpgradeCandidates.Latest,
+			&step.Action.UpgradeCandidates.LatestCompatible,
+		}},
+	} {
+		engine := newEngine(Root{}, nil, io.Discard, tc.opts)
+		assert.DeepEqual(t, engine.treeHashReleases(step), tc.want, "incorrect releases for %s", name)
+	}
+}
+
+func TestResolveStepReleaseVersions(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commit = "abcdef1234abcdef1234abcdef1234abcdef1234"
+		other  = "1234abcdef1234abcdef1234abcdef1234abcdef"
+	)
+	gqlEndpoints := map[string]httpResponse{
+		// version tags, which miss the unprefixed tag
+		"2590b2f6ce": okResponse(`{
+			"data": {
+				"repository": {
+					"refs": {
+						"nodes": [{"name": "v1.0.0", "target": {"oid": "` + other + `"}}],
+						"pageInfo": {"hasNextPage": false, "endCursor": ""}
+					}
+				}
+			}
+		}`),
+		// releases
+		"6104c8d776": okResponse(`{
+			"data": {
+				"repository": {
+					"releases": {
+						"pageInfo": {"hasNextPage": false, "endCursor": ""},
+						"nodes": [
+							{"tag": {"target": {"oid": "tag111", "target": {"oid": "` + commit + `"}}}, "tagName": "1.2.0"},
+							{"tag": {"target": {"oid": "` + commit + `"}}, "tagName": "nightly"},
+							{"tag": {"target": {"oid": "` + other + `"}}, "tagName": "v1.0.0"}
+						]
+					}
+				}
+			}
+		}`),
+	}
+
+	testCases := map[string]struct {
+		releaseVersions bool
+		want            Release
+		wantTags        []string
+	}{
+		"release versions recovered": {
+			releaseVersions: true,
+			want:            Release{CommitHash: commit, Version: "1.2.0"},
+			wantTags:        []string{"1.2.0"},
+		},
+		"release versions not consulted by default": {
+			releaseVersions: false,
+			want:            Release{CommitHash: commit},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := newTestClient(t, gqlEndpoints, nil)
+			engine := newEngine(Root{}, client, io.Discard, engineOpts{TrustHashes: true, ReleaseVersions: tc.releaseVersions})
+			engine.phaseLog.StartPhase("testing")
+
+			step := &Step{Action: Action{Name: "owner/repo", Ref: commit}}
+			assert.NilError(t, engine.resolveStep(testCtx(), Workflow{FilePath: "test.yaml"}, step, false))
+			assert.Equal(t, step.Action.Release, tc.want, "incorrect release")
+			assert.DeepEqual(t, step.Action.VersionTags, tc.wantTags, "incorrect version tags")
+		})
+	}
+}
+
+func TestResolveStepVerifyComments(t *testing.T) {
+	t.Parallel()
+
+	const commit = "abcdef1234abcdef1234abcdef1234abcdef1234"
+	gqlEndpoints := map[string]httpResponse{
+		// version tags
+		"2590b2f6ce": okResponse(`{
+			"data": {
+				"repository": {
+					"refs": {
+						"nodes": [
+							{"name": "v1.2.0", "target": {"oid": "` + commit + `"}},
+							{"name": "v1", "target": {"oid": "` + commit + `"}}
+						],
+						"pageInfo": {"hasNextPage": false, "endCursor": ""}
+					}
+				}
+			}
+		}`),
+	}
+
+	testCases := map[string]struct {
+		comment     string
+		verify      bool
+		wantWarning string
+	}{
+		"matching comment": {
+			comment: "v1.2.0",
+			verify:  true,
+		},
+		"comment matching a less specific tag": {
+			comment: "v1",
+			verify:  true,
+		},
+		"mismatched comment": {
+			comment:     "v1.3.0",
+			verify:      true,
+			wantWarning: "version comment v1.3.0 does not match pinned commit " + commit + " (v1.2.0, v1), the pin may have been tampered with",
+		},
+		"mismatched comment without verification": {
+			comment: "v1.3.0",
+		},
+		"non-version comment": {
+			comment: "ref:main",
+			verify:  true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := newTestClient(t, gqlEndpoints, nil)
+			engine := newEngine(Root{}, client, io.Discard, engineOpts{TrustHashes: true, VerifyComments: tc.verify})
+			engine.phaseLog.StartPhase("testing")
+
+			step := &Step{Action: Action{Name: "owner/repo", Ref: commit}, Comment: tc.comment}
+			assert.NilError(t, engine.resolveStep(testCtx(), Workflow{FilePath: "test.yaml"}, step, false))
+			diagnostics := engine.phaseLog.diagnostics["test.yaml"]
+			if tc.wantWarning == "" {
+				assert.Equal(t, len(diagnostics), 0, "expected no warnings")
+				return
+			}
+			assert.Equal(t, len(diagnostics), 1, "expected a warning")
+			assert.Equal(t, diagnostics[0].Msg, tc.wantWarning, "incorrect warning")
+		})
+	}
+}
+
+func TestSanctionedRefs(t *testing.T) {
+	t.Parallel()
+
+	const commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	release := Release{CommitHash: commitA, Version: "v1.0.0"}
+	workflow := Workflow{
+		FilePath: "ci.yaml",
+		Steps: []Step{
+			{LineNumber: 1, Action: Action{Name: "myorg/canary", Ref: "main", Release: release}},
+			{LineNumber: 2, Action: Action{Name: "myorg/other", Ref: "main", Release: release}},
+		},
+	}
+	cfg := config{SanctionedRefs: map[string]bool{sanctionedRefKey("MyOrg/Canary", "main"): true}}
+	engine := newEngine(Root{Workflows: map[string]Workflow{"ci.yaml": workflow}}, nil, io.Discard, engineOpts{Config: cfg})
+
+	// sanctioned refs are left untouched when pinning
+	plan := buildPlan(engine.root, engine.pinStrategy(ModeCurrent), 0)
+	assert.Equal(t, len(plan.Changes), 1, "incorrect number of planned changes")
+	assert.Equal(t, plan.Changes[0].Action, "myorg/other", "incorrect planned change")
+
+	// but are still listed, marked as sanctioned
+	var out strings.Builder
+	engine.renderWorkflowVersions(&out, workflow)
+	assert.Contains(t, out.String(), "action myorg/canary@main versions: (sanctioned to float)", "incorrect listing")
+	assert.Equal(t, strings.Count(out.String(), "sanctioned"), 1, "only sanctioned refs should be marked")
+}
+
+func TestFormatCandidate(t *testing.T) {
+	t.Parallel()
+
+	release := Release{CommitHash: "abc123", Version: "v1.2.3", Verified: true}
+	for requireVerified, want := range map[bool]string{
+		false: "abc123 @ v1.2.3",
+		true:  "abc123 @ v1.2.3 (verified)",
+	} {
+		engine := newEngine(Root{}, nil, io.Discard, engineOpts{RequireVerified: requireVerified})
+		assert.Equal(t, engine.formatCandidate(release), want, "incorrect candidate with RequireVerified=%v", requireVerified)
+	}
+}
+
+func TestRenderWorkflowVersionsVerbose(t *testing.T) {
+	t.Parallel()
+
+	workflow := Workflow{
+		FilePath: "ci.yaml",
+		Steps: []Step{
+			{
+				Action: Action{
+					Name:        "owner/repo",
+					Ref:         "v1",
+					Release:     Release{CommitHash: "abc123", Version: "v1.2.3", Verified: true, TreeHash: "fff000"},
+					VersionTags: []string{"v1.2.3", "v1.2", "v1"},
+					UpgradeCandidates: UpgradeCandidates{
+						Latest:           Release{CommitHash: "abc123", Version: "v1.2.3", Verified: true},
+						LatestCompatible: Release{CommitHash: "abc123", Version: "v1.2.3", Verified: true},
+						CurrentVerified:  true,
+					},
+				},
+			},
+			{
+				Action: Action{
+					Name:    "owner/other",
+					Ref:     "main",
+					Release: Release{CommitHash: "def456"},
+				},
+				Matrix: true,
+			},
+			{
+				Action: Action{
+					Name:        "owner/tagged",
+					Ref:         "v2.1.0",
+					Release:     Release{CommitHash: "fed987", Version: "v2.1.0"},
+					VersionTags: []string{"v2.1.0"},
+					UpgradeCandidates: UpgradeCandidates{
+						CurrentUnreleased: true,
+					},
+				},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		verbose        bool
+		lang           string
+		annotateMatrix bool
+		want           string
+	}{
+		"default": {
+			want: `workflow ci.yaml
+  action owner/repo@v1 versions:
+    current: abc123 @ v1.2.3
+    ✓ already using latest version
+  action owner/other@main versions:
+    current: def456
+    (no upgrade versions found)
+  action owner/tagged@v2.1.0 versions:
+    current: fed987 @ v2.1.0
+    note:    v2.1.0 is a tag not published as a release; upgrades only consider releases, so newer tags may be missing
+    (no upgrade versions found)
+`,
+		},
+		"verbose": {
+			verbose: true,
+			want: `workflow ci.yaml
+  action owner/repo@v1 versions:
+    current: abc123 @ v1.2.3
+    tags:    v1.2.3, v1.2, v1
+    release: https://github.com/owner/repo/releases/tag/v1.2.3
+    signed:  yes
+    tree:    fff000
+    ✓ already using latest version
+  action owner/other@main versions:
+    current: def456
+    tags:    (none)
+    signed:  no
+    (no upgrade versions found)
+  action owner/tagged@v2.1.0 versions:
+    current: fed987 @ v2.1.0
+    tags:    v2.1.0
+    signed:  no
+    note:    v2.1.0 is a tag not published as a release; upgrades only consider releases, so newer tags may be missing
+    (no upgrade versions found)
+`,
+		},
+		"annotate matrix": {
+			annotateMatrix: true,
+			want: `workflow ci.yaml
+  action owner/repo@v1 versions:
+    current: abc123 @ v1.2.3
+    ✓ already using latest version
+  action owner/other@main versions: (matrix job, may run many times)
+    current: def456
+    (no upgrade versions found)
+  action owner/tagged@v2.1.0 versions:
+    current: fed987 @ v2.1.0
+    note:    v2.1.0 is a tag not published as a release; upgrades only consider releases, so newer tags may be missing
+    (no upgrade versions found)
+`,
+		},
+		"spanish": {
+			verbose: true,
+			lang:    "es",
+			want: `flujo de trabajo ci.yaml
+  versiones de la acción owner/repo@v1:
+    actual:     abc123 @ v1.2.3
+    etiquetas:  v1.2.3, v1.2, v1
+    release:    https://github.com/owner/repo/releases/tag/v1.2.3
+    firmada:    sí
+    árbol:      fff000
+    ✓ ya usa la última versión
+  versiones de la acción owner/other@main:
+    actual:     def456
+    etiquetas:  (ninguna)
+    firmada:    no
+    (no se encontraron versiones de actualización)
+  versiones de la acción owner/tagged@v2.1.0:
+    actual:     fed987 @ v2.1.0
+    etiquetas:  v2.1.0
+    firmada:    no
+    nota:       v2.1.0 es una etiqueta no publicada como release; las actualizaciones solo consideran releases, por lo que pueden faltar etiquetas más recientes
+    (no se encontraron versiones de actualización)
+`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			engine := newEngine(Root{}, nil, io.Discard, engineOpts{Verbose: tc.verbose, Lang: tc.lang, AnnotateMatrix: tc.annotateMatrix})
+			var buf bytes.Buffer
+			engine.renderWorkflowVersions(&buf, workflow)
+			assert.Equal(t, buf.String(), tc.want, "incorrect output")
+		})
+	}
+}
+
+func TestRenderReleasesBehind(t *testing.T) {
+	t.Parallel()
+
+	workflow := Workflow{
+		FilePath: "ci.yaml",
+		Steps: []Step{{
+			Action: Action{
+				Name:    "owner/repo",
+				Ref:     "v1",
+				Release: Release{CommitHash: "abc123", Version: "v1.2.3"},
+				UpgradeCandidates: UpgradeCandidates{
+					Latest:           Release{CommitHash: "def456", Version: "v2.0.0"},
+					LatestCompatible: Release{CommitHash: "abc123", Version: "v1.2.3"},
+					ReleasesBehind:   3,
+				},
+			},
+		}},
+	}
+	for verbose, want := range map[bool]bool{false: false, true: true} {
+		engine := newEngine(Root{}, nil, io.Discard, engineOpts{Verbose: verbose})
+		var buf bytes.Buffer
+		engine.renderWorkflowVersions(&buf, workflow)
+		assert.Equal(t, strings.Contains(buf.String(), "    behind:  3 release(s)\n"), want, "releases behind shown with Verbose=%v", verbose)
+	}
+}
+
+func TestResolveStepShowVerified(t *testing.T) {
+	t.Parallel()
+
+	const commit = "abcdef1234abcdef1234abcdef1234abcdef1234"
+	tagsResp := okResponse(`{
+		"data": {
+			"repository": {
+				"refs": {
+					"nodes": [{"name": "v1.2.3", "target": {"oid": "` + commit + `"}}],
+					"pageInfo": {"hasNextPage": false, "endCursor": ""}
+				}
+			}
+		}
+	}`)
+	testCases := map[string]struct {
+		orgResp    httpResponse
+		want       CreatorStatus
+		wantHeader string
+	}{
+		"verified": {
+			orgResp:    okResponse(`{"is_verified": true}`),
+			want:       CreatorVerified,
+			wantHeader: "  action owner/repo@" + commit + " versions: ✓ verified domain\n",
+		},
+		"unverified": {
+			orgResp:    errResponse(http.StatusNotFound, `{"message": "Not Found"}`),
+			want:       CreatorUnverified,
+			wantHeader: "  action owner/repo@" + commit + " versions: (no verified domain)\n",
+		},
+		"unknown": {
+			orgResp:    errResponse(http.StatusForbidden, `{"message": "Forbidden"}`),
+			want:       CreatorUnknown,
+			wantHeader: "  action owner/repo@" + commit + " versions:\n",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := newTestClient(t, map[string]httpResponse{"2590b2f6ce": tagsResp}, map[string]httpResponse{
+				"GET /orgs/owner": tc.orgResp,
+			})
+			engine := newEngine(Root{}, client, io.Discard, engineOpts{TrustHashes: true, ShowVerified: true})
+			engine.phaseLog.StartPhase("testing")
+
+			workflow := Workflow{FilePath: "test.yaml"}
+			step := &Step{Action: Action{Name: "owner/repo", Ref: commit}}
+			assert.NilError(t, engine.resolveStep(testCtx(), workflow, step, false))
+			assert.Equal(t, step.Action.Creator, tc.want, "incorrect creator status")
+
+			var buf bytes.Buffer
+			workflow.Steps = []Step{*step}
+			engine.renderWorkflowVersions(&buf, workflow)
+			assert.Contains(t, buf.String(), tc.wantHeader, "incorrect header")
+		})
+	}
+}
+
+func TestCandidateOptsFor(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		patterns []string
+		action   string
+		wantSkip bool
+	}{
+		"no patterns considers all prereleases": {
+			action:   "actions/checkout",
+			wantSkip: false,
+		},
+		"matching action considers prereleases": {
+			patterns: []string{"myorg/*"},
+			action:   "myorg/deploy",
+			wantSkip: false,
+		},
+		"non-matching action skips prereleases": {
+			patterns: []string{"myorg/*"},
+			action:   "actions/checkout",
+			wantSkip: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			engine := newEngine(Root{}, nil, io.Discard, engineOpts{PrereleasePatterns: tc.patterns, RequireVerified: true})
+			opts := engine.candidateOptsFor(Action{Name: tc.action})
+			assert.Equal(t, opts.SkipPrereleases, tc.wantSkip, "incorrect SkipPrereleases")
+			assert.Equal(t, opts.RequireVerified, true, "other options should be preserved")
+		})
+	}
+
+	t.Run("denied versions apply to every action in the repo", func(t *testing.T) {
+		t.Parallel()
+		engine := newEngine(Root{}, nil, io.Discard, engineOpts{
+			DeniedVersions: map[string][]string{"github/codeql-action": {"v3.1.0"}},
+		})
+		for _, name := range []string{"github/codeql-action/init", "GitHub/CodeQL-Action/analyze"} {
+			opts := engine.candidateOptsFor(Action{Name: name})
+			assert.DeepEqual(t, opts.DeniedVersions, []string{"v3.1.0"}, "incorrect DeniedVersions for %s", name)
+		}
+		opts := engine.candidateOptsFor(Action{Name: "actions/checkout"})
+		assert.Equal(t, len(opts.DeniedVersions), 0, "unrelated action should have no denied versions")
+	})
+}
+
+func TestRefPrecisionStrategy(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	action := func(ref string) Action {
+		return Action{
+			Name:              "actions/checkout",
+			Ref:               ref,
+			Release:           Release{CommitHash: commitA, Version: "v4.1.2"},
+			VersionTags:       []string{"v4.1.2", "v4.1", "v4"},
+			UpgradeCandidates: UpgradeCandidates{Latest: Release{CommitHash: commitB, Version: "v5.0.0"}},
+		}
+	}
+	testCases := map[string]struct {
+		step        Step
+		mode        PinMode
+		wantVersion string
+	}{
+		"floating major": {
+			step:        Step{Action: action("v4")},
+			mode:        ModeCurrent,
+			wantVersion: "v4",
+		},
+		"floating minor": {
+			step:        Step{Action: action("v4.1")},
+			mode:        ModeCurrent,
+			wantVersion: "v4.1",
+		},
+		"exact version": {
+			step:        Step{Action: action("v4.1.2")},
+			mode:        ModeCurrent,
+			wantVersion: "v4.1.2",
+		},
+		"pinned with major comment": {
+			step:        Step{Action: action(commitA), Comment: "v4"},
+			mode:        ModeCurrent,
+			wantVersion: "v4",
+		},
+		"pinned with stale comment": {
+			step:        Step{Action: action(commitA), Comment: "v3"},
+			mode:        ModeCurrent,
+			wantVersion: "v4.1.2",
+		},
+		"branch": {
+			step:        Step{Action: action("main")},
+			mode:        ModeCurrent,
+			wantVersion: "v4.1.2",
+		},
+		"upgraded to another commit": {
+			step:        Step{Action: action("v4")},
+			mode:        ModeLatest,
+			wantVersion: "v5.0.0",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			strategy := refPrecisionStrategy(rewriteStrategyForMode(tc.mode))
+			got := strategy(Workflow{}, tc.step)
+			assert.Equal(t, got.Version, tc.wantVersion, "incorrect version")
+		})
+	}
+}
+
+func TestRenderLatestStableNote(t *testing.T) {
+	t.Parallel()
+
+	step := func(version string) Step {
+		current := Release{CommitHash: "abc123", Version: version}
+		return Step{Action: Action{
+			Name:    "owner/repo",
+			Ref:     version,
+			Release: current,
+			UpgradeCandidates: UpgradeCandidates{
+				Latest:           current,
+				LatestCompatible: current,
+				LatestStable:     Release{CommitHash: "def456", Version: "v1.5.0"},
+			},
+		}}
+	}
+	workflow := Workflow{FilePath: "ci.yaml", Steps: []Step{step("v2.0.0-rc.1"), step("v2.0.0")}}
+	engine := newEngine(Root{}, nil, io.Discard, engineOpts{})
+
+	var out strings.Builder
+	engine.renderWorkflowVersions(&out, workflow)
+	assert.Equal(t, out.String(), `workflow ci.yaml
+  action owner/repo@v2.0.0-rc.1 versions:
+    current: abc123 @ v2.0.0-rc.1
+    note:    v2.0.0-rc.1 is a prerelease ahead of the latest stable release v1.5.0
+    ✓ already using latest version
+  action owner/repo@v2.0.0 versions:
+    current: abc123 @ v2.0.0
+    note:    v2.0.0 is ahead of the latest stable release v1.5.0, e.g. because it was yanked
+    ✓ already using latest version
+`, "incorrect listing")
+}
@@ -4,18 +4,24 @@ import (
 	"bytes"
 	"context"
 	_ "embed"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"iter"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"path"
 	"regexp"
 	"slices"
+	"strconv"
 	"strings"
-
-	"golang.org/x/mod/semver"
+	"sync"
+	"time"
 
 	"github.com/mccutchen/ghavm/internal/slogctx"
 )
@@ -25,9 +31,28 @@ import (
 type GitHubClient struct {
 	httpClient *http.Client
 
-	upgradeCache *Cache[string, UpgradeCandidates]
-	versionCache *Cache[string, []string]
-	refCache     *Cache[string, string]
+	// consistencyBackoff is the initial delay between retries when waiting
+	// for GitHub to become consistent (see [candidateOpts])
+	consistencyBackoff time.Duration
+
+	// maxRetries is the number of times to retry requests that fail with
+	// 5xx server errors, and retryBackoff the initial delay between those
+	// retries (see [GitHubClient.SetRetryOn5xx])
+	maxRetries   int
+	retryBackoff time.Duration
+
+	// mirror, if set, resolves repos it has local clones of without using
+	// the API
+	mirror *gitMirror
+
+	upgradeCache    *Cache[string, UpgradeCandidates]
+	releaseSets     *Cache[string, *releaseSet]
+	tagCache        *Cache[string, []versionTag]
+	refCache        *Cache[string, string]
+	commitCache     *Cache[string, gitCommitObjectResponse]
+	actionFileCache *Cache[string, string]
+	searchCache     *Cache[string, []string]
+	creatorCache    *Cache[string, bool]
 }
 
 // NewGitHubClient creates a new [GitHubClient] that will use the given
@@ -43,14 +68,78 @@ func NewGitHubClient(ghToken string, httpClient *http.Client) *GitHubClient {
 	httpClient.Transport = newAuthTransport(ghToken, httpClient.Transport)
 
 	return &GitHubClient{
-		httpClient: httpClient,
+		httpClient:         httpClient,
+		consistencyBackoff: time.Second,
+		retryBackoff:       time.Second,
+
+		upgradeCache:    newCache[string, UpgradeCandidates](Mutable),
+		releaseSets:     newReleaseSetCache(),
+		tagCache:        newCache[string, []versionTag](Mutable),
+		refCache:        newCache[string, string](Volatile),
+		commitCache:     newCache[string, gitCommitObjectResponse](Immutable),
+		actionFileCache: newCache[string, string](Volatile),
+		searchCache:     newCache[string, []string](Volatile),
+		creatorCache:    newCache[string, bool](Mutable),
+	}
+}
+
+// SetTokenProvider configures the client to fetch a fresh token from the
+// given provider, and retry once, when a request fails because its token
+// has expired.
+func (c *GitHubClient) SetTokenProvider(provider TokenProvider) {
+	if auth, ok := c.httpClient.Transport.(*authTransport); ok {
+		auth.mu.Lock()
+		auth.refresh = provider
+		auth.mu.Unlock()
+	}
+}
 
-		upgradeCache: &Cache[string, UpgradeCandidates]{},
-		versionCache: &Cache[string, []string]{},
-		refCache:     &Cache[string, string]{},
+// SetHostToken configures the client to authenticate requests to the given
+// host with its own token instead of the default token.
+func (c *GitHubClient) SetHostToken(host string, token string) {
+	if auth, ok := c.httpClient.Transport.(*authTransport); ok {
+		auth.mu.Lock()
+		if auth.hostTokens == nil {
+			auth.hostTokens = make(map[string]string)
+		}
+		auth.hostTokens[strings.ToLower(host)] = token
+		auth.mu.Unlock()
 	}
 }
 
+// SetGitMirror configures the client to resolve refs, tags, releases, and
+// commits for any repo with a local clone under the given directory from that
+// clone, instead of the API. See [gitMirror] for details.
+func (c *GitHubClient) SetGitMirror(dir string) {
+	c.mirror = &gitMirror{dir: dir}
+}
+
+// SetRetryOn5xx configures the client to retry requests that fail with 5xx
+// server errors (e.g. during transient GitHub outages) up to maxRetries
+// times, with exponential backoff and jitter.
+//
+// Every request made by the client is a read-only GET or GraphQL query, so
+// retrying is always safe.
+func (c *GitHubClient) SetRetryOn5xx(maxRetries int) {
+	c.maxRetries = maxRetries
+}
+
+// forgetReleases clears every cached result that depends on a repo's
+// releases, tags, or branches, which may change over time. Immutable results,
+// like details of specific commits (e.g. tree hashes and commit dates) and
+// anything looked up by full commit hash, are kept.
+//
+// Forgotten release sets stop fetching pages once no caller is still
+// iterating them, so that repeated calls (e.g. between watch runs) do not
+// leave producers running in the background.
+func (c *GitHubClient) forgetReleases() {
+	c.upgradeCache.ClearMutable()
+	c.releaseSets.ClearMutable()
+	c.tagCache.ClearMutable()
+	c.refCache.ClearMutable()
+	c.actionFileCache.ClearMutable()
+}
+
 type graphqlRequest struct {
 	Query     string         `json:"query"`
 	Variables map[string]any `json:"variables,omitempty"`
@@ -78,7 +167,7 @@ func (c *GitHubClient) doGraphql(ctx context.Context, queryString string, variab
 	req, _ := http.NewRequestWithContext(ctx, "POST", "https://api.github.com/graphql", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -113,13 +202,19 @@ func (c *GitHubClient) doGraphql(ctx context.Context, queryString string, variab
 // doREST makes a REST API call to the GitHub API and un-marshals the response
 // into the given target.
 func (c *GitHubClient) doREST(ctx context.Context, method string, url string, target any) error {
+	_, err := c.doRESTWithHeaders(ctx, method, url, target)
+	return err
+}
+
+// doRESTWithHeaders is like doREST, but also returns the response headers.
+func (c *GitHubClient) doRESTWithHeaders(ctx context.Context, method string, url string, target any) (http.Header, error) {
 	req, err := http.NewRequestWithContext(ctx, method, "https://api.github.com"+url, nil)
 	if err != nil {
 		panic("github: invalid URL: " + err.Error())
 	}
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return fmt.Errorf("request failure: %w", err)
+		return nil, fmt.Errorf("request failure: %w", err)
 	}
 	defer mustClose(resp.Body)
 	slogctx.Debug(
@@ -135,59 +230,277 @@ func (c *GitHubClient) doREST(ctx context.Context, method string, url string, ta
 	if resp.StatusCode >= 400 {
 		switch resp.StatusCode {
 		case 401:
-			return errors.New("invalid auth token")
+			return nil, errors.New("invalid auth token")
 		case 403:
-			return errors.New("access denied")
+			return nil, errors.New("access denied")
 		default:
 			body, _ := io.ReadAll(resp.Body)
-			return fmt.Errorf("http error: %s: %s", resp.Status, string(body))
+			return nil, &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
 		}
 	}
 	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
-		return fmt.Errorf("failed to unmarshal data: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
 	}
-	return nil
+	return resp.Header, nil
 }
 
+// do sends the given request, retrying it with exponential backoff and
+// jitter if it fails with a 5xx server error and retries are enabled. Once
+// retries are exhausted, the last error response is returned as-is.
+func (c *GitHubClient) do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := c.httpClient.Do(req)
+		if err != nil || resp.StatusCode < 500 || attempt >= c.maxRetries {
+			return resp, err
+		}
+		// the request body (for GraphQL queries) must be replayed
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return resp, nil
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			req.Body = body
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		mustClose(resp.Body)
+
+		// "equal jitter": wait at least half the backoff, so retries from
+		// concurrent requests are spread out but still back off
+		delay := c.retryBackoff << attempt
+		delay = delay/2 + rand.N(delay/2+1)
+		slogctx.Debug(
+			ctx, "github: retrying request after server error",
+			slog.String("method", req.Method),
+			slog.String("url", req.URL.String()),
+			slog.Int("status", resp.StatusCode),
+			slog.Int("attempt", attempt+1),
+			slog.Int("max_retries", c.maxRetries),
+			slog.Duration("delay", delay),
+		)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// httpStatusError is returned for REST API responses with unexpected error
+// statuses.
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("http error: %s: %s", e.Status, e.Body)
+}
+
+// candidateOpts customizes how upgrade candidates are chosen.
+type candidateOpts struct {
+	// AsOf, if non-zero, limits candidates to releases published on or
+	// before that time. Candidates may then be older than the current
+	// release (i.e. the newest release that existed at the time).
+	AsOf time.Time
+	// RequireVerified limits candidates to releases whose tag or commit has
+	// a valid signature.
+	RequireVerified bool
+	// Constraint, if non-nil, limits candidates to releases whose versions
+	// satisfy it.
+	Constraint versionConstraint
+	// SkipPrereleases ignores releases with a semver prerelease suffix (e.g.
+	// v2.0.0-rc.1).
+	SkipPrereleases bool
+	// DeniedVersions are versions that are never chosen as candidates (e.g.
+	// known-bad releases), in which case the next newest acceptable release
+	// is chosen instead.
+	DeniedVersions []string
+	// CommittedBefore, if non-zero, limits candidates to releases whose
+	// commits were made on or before that time, giving the community time
+	// to notice a malicious release. Commit dates are only fetched for
+	// releases that would otherwise be chosen, so ReleasesBehind may still
+	// count newer releases.
+	CommittedBefore time.Time
+	// ConsistencyRetries is the number of times to retry fetching releases,
+	// with exponential backoff, if the current release is missing from them
+	// (e.g. because GitHub has not yet caught up with a freshly published
+	// release).
+	ConsistencyRetries int
+	// VersionSource is where candidate versions come from, one of
+	// [versionSourceReleases] (the default if empty), [versionSourceTags],
+	// or [versionSourceBoth].
+	VersionSource string
+}
+
+// denies returns true if the given version is one of the denied versions,
+// ignoring any difference in "v" prefixes (e.g. 4.2.0 denies v4.2.0).
+func (opts candidateOpts) denies(version string) bool {
+	return slices.ContainsFunc(opts.DeniedVersions, func(denied string) bool {
+		return sameVersion(denied, version)
+	})
+}
+
+// Sources of candidate versions for upgrades.
+const (
+	// versionSourceReleases only considers versions published as releases.
+	versionSourceReleases = "releases"
+	// versionSourceTags considers every version tag, ignoring releases.
+	versionSourceTags = "tags"
+	// versionSourceBoth considers the union of releases and version tags,
+	// preferring the release for a version that is both.
+	versionSourceBoth = "both"
+)
+
 // GetUpgradeCandidates returns [UpgradeCandidates].
-func (c *GitHubClient) GetUpgradeCandidates(ctx context.Context, targetRepo string, currentRelease Release) (UpgradeCandidates, error) {
+func (c *GitHubClient) GetUpgradeCandidates(ctx context.Context, targetRepo string, currentRelease Release, opts candidateOpts) (UpgradeCandidates, error) {
 	// if we have not identified the semver version for the current release,
 	// we cannot meaningfully suggest upgrade versions, so we bail early
 	if currentRelease.Version == "" {
 		return UpgradeCandidates{}, nil
 	}
-	return c.upgradeCache.Do(ctx, cacheKey(targetRepo, currentRelease.Version), func() (UpgradeCandidates, error) {
-		return c.doGetUpgradeCandidates(ctx, targetRepo, currentRelease)
+	key := cacheKey(canonicalName(targetRepo), currentRelease.Version, opts.AsOf.Format(time.RFC3339), strconv.FormatBool(opts.RequireVerified), strconv.FormatBool(opts.SkipPrereleases), opts.Constraint.String(), strings.Join(opts.DeniedVersions, ","), opts.CommittedBefore.Format(time.RFC3339), opts.VersionSource)
+	return c.upgradeCache.Do(ctx, key, func() (UpgradeCandidates, error) {
+		for attempt := 0; ; attempt++ {
+			candidates, foundCurrent, err := c.doGetUpgradeCandidates(ctx, targetRepo, currentRelease, opts)
+			// a current release without a semver version (e.g. a branch) is
+			// never published as a release, so there is nothing to wait for
+			if err != nil || foundCurrent || attempt >= opts.ConsistencyRetries || !isValidVersion(currentRelease.Version) {
+				return candidates, err
+			}
+			// the shared releases are stale, so fetch them again
+			c.releaseSets.Forget(canonicalName(targetRepo))
+			delay := c.consistencyBackoff << attempt
+			slogctx.Debug(
+				ctx, "github: current release missing from releases, retrying",
+				"repo", targetRepo,
+				"release", currentRelease,
+				"attempt", attempt+1,
+				"delay", delay,
+			)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return UpgradeCandidates{}, ctx.Err()
+			}
+		}
 	})
 }
 
-func (c *GitHubClient) doGetUpgradeCandidates(ctx context.Context, targetRepo string, currentRelease Release) (UpgradeCandidates, error) {
+// doGetUpgradeCandidates chooses upgrade candidates from a repo's releases
+// and/or version tags, according to opts.VersionSource, also reporting
+// whether the current release was found among them.
+func (c *GitHubClient) doGetUpgradeCandidates(ctx context.Context, targetRepo string, currentRelease Release, opts candidateOpts) (UpgradeCandidates, bool, error) {
 	var (
-		currentMajorVersion     = semver.Major(currentRelease.Version)
+		currentMajorVersion     = majorVersion(currentRelease.Version)
 		latestCompatibleRelease = Release{}
 		latestRelease           = Release{}
+		latestStableRelease     = Release{}
+		releasesBehind          = 0
+		foundCurrent            = false
+		// whether the current release was found among the repo's releases,
+		// rather than only among its version tags
+		releasedCurrent = false
+		currentVerified = false
+		// whether any stable release is at least as new as the current
+		// release, in which case the current release is not ahead of the
+		// latest stable release
+		stableAtOrAbove = false
 	)
 
-	for candidate, err := range c.iterAllReleases(ctx, targetRepo) {
+	for candidate, err := range c.iterCandidates(ctx, targetRepo, opts.VersionSource) {
 		if err != nil {
-			return UpgradeCandidates{}, fmt.Errorf("failed to gather candidate versions: %w", err)
+			return UpgradeCandidates{}, false, fmt.Errorf("failed to gather candidate versions: %w", err)
 		}
-		// discard anything older than our current version
-		if !isUpgradeCandidate(currentRelease.Version, candidate.Version) {
-			break
+		if candidate.Version == currentRelease.Version || candidate.CommitHash == currentRelease.CommitHash {
+			foundCurrent = true
+			releasedCurrent = releasedCurrent || !candidate.TagOnly
+		}
+		if candidate.CommitHash == currentRelease.CommitHash {
+			currentVerified = candidate.Verified
+		}
+		if !opts.AsOf.IsZero() {
+			// when resolving as of a point in time, ignore anything published
+			// after the cutoff, but consider everything published before it,
+			// since the newest release at the time may be older than our
+			// current version
+			if candidate.PublishedAt.IsZero() || candidate.PublishedAt.After(opts.AsOf) || !isValidVersion(candidate.Version) {
+				continue
+			}
+		} else if !isUpgradeCandidate(currentRelease.Version, candidate.Version) {
+			// otherwise, discard anything older than our current version,
+			// except that the newest stable release is recorded if the
+			// current version is ahead of it, so we keep looking past older
+			// prereleases until we find it
+			if stableAtOrAbove {
+				break
+			}
+			if isStableVersion(candidate.Version) && !opts.denies(candidate.Version) {
+				latestStableRelease = candidate.Release
+				break
+			}
+			continue
+		} else if isStableVersion(candidate.Version) {
+			stableAtOrAbove = true
+		}
+		if opts.RequireVerified && !candidate.Verified {
+			continue
+		}
+		if opts.SkipPrereleases && isPrerelease(candidate.Version) {
+			continue
+		}
+		if opts.Constraint != nil && !opts.Constraint.allows(candidate.Version) {
+			continue
+		}
+		if opts.denies(candidate.Version) {
+			continue
+		}
+		if !opts.CommittedBefore.IsZero() && candidate.CommitHash != currentRelease.CommitHash {
+			// only releases that would be chosen need their commit dates
+			// checked, since the chosen releases only ever get newer
+			wouldChoose := compareVersions(candidate.Version, latestRelease.Version) > 0 ||
+				(majorVersion(candidate.Version) == currentMajorVersion && compareVersions(candidate.Version, latestCompatibleRelease.Version) > 0)
+			if wouldChoose {
+				date, err := c.GetCommitDate(ctx, targetRepo, candidate.CommitHash)
+				if err != nil {
+					return UpgradeCandidates{}, false, fmt.Errorf("failed to fetch commit date for %s: %w", candidate.Version, err)
+				}
+				if date.After(opts.CommittedBefore) {
+					slogctx.Debug(ctx, "github: skipping release with recent commit", "repo", targetRepo, "release", candidate.Version, "committed", date)
+					continue
+				}
+			}
+		}
+		if compareVersions(currentRelease.Version, candidate.Version) < 0 {
+			releasesBehind++
 		}
 		// track latest release and latest compatible release w/ same major
 		// version
-		latestRelease = chooseNewestRelease(latestRelease, candidate)
-		if semver.Major(candidate.Version) == currentMajorVersion {
-			latestCompatibleRelease = chooseNewestRelease(latestCompatibleRelease, candidate)
+		latestRelease = chooseNewestRelease(latestRelease, candidate.Release)
+		if majorVersion(candidate.Version) == currentMajorVersion {
+			latestCompatibleRelease = chooseNewestRelease(latestCompatibleRelease, candidate.Release)
 		}
 	}
+	if !releasedCurrent {
+		slogctx.Debug(
+			ctx, "github: current version not published as a release",
+			"repo", targetRepo,
+			"release", currentRelease,
+		)
+	}
 	result := UpgradeCandidates{
-		Latest:           latestRelease,
-		LatestCompatible: latestCompatibleRelease,
+		Latest:            latestRelease,
+		LatestCompatible:  latestCompatibleRelease,
+		ReleasesBehind:    releasesBehind,
+		CurrentVerified:   currentVerified,
+		CurrentUnreleased: !releasedCurrent,
+		LatestStable:      latestStableRelease,
 	}
-	return result, nil
+	return result, foundCurrent, nil
 }
 
 // isUpgradeCandidate returns true if the candidate version is equal to or
@@ -198,12 +511,12 @@ func (c *GitHubClient) doGetUpgradeCandidates(ctx context.Context, targetRepo st
 // version.
 func isUpgradeCandidate(currentVersion, candidateVersion string) bool {
 	var (
-		currentValid   = semver.IsValid(currentVersion)
-		candidateValid = semver.IsValid(candidateVersion)
+		currentValid   = isValidVersion(currentVersion)
+		candidateValid = isValidVersion(candidateVersion)
 	)
 	switch {
 	case currentValid && candidateValid:
-		return semver.Compare(currentVersion, candidateVersion) <= 0
+		return compareVersions(currentVersion, candidateVersion) <= 0
 	case candidateValid:
 		// if current version is not semver but candidate is, treat candidate
 		// as an upgrade
@@ -215,10 +528,16 @@ func isUpgradeCandidate(currentVersion, candidateVersion string) bool {
 }
 
 // chooseNewestRelease returns whichever release is newer, according to semver
-// rules.
+// rules. Of two equal versions, a complete version is preferred over a
+// floating one (e.g. v5.0.0 over v5).
 func chooseNewestRelease(a, b Release) Release {
-	if semver.Compare(a.Version, b.Version) == 1 {
+	switch compareVersions(a.Version, b.Version) {
+	case 1:
 		return a
+	case 0:
+		if isCompleteVersion(a.Version) && !isCompleteVersion(b.Version) {
+			return a
+		}
 	}
 	return b
 }
@@ -236,59 +555,366 @@ type getRepositoryReleasesResp struct {
 			Nodes []struct {
 				Tag struct {
 					Target struct {
-						OID    string `json:"oid"`
-						Target struct {
-							OID string `json:"oid"`
+						OID       string        `json:"oid"`
+						Signature *gitSignature `json:"signature"`
+						Target    struct {
+							OID       string        `json:"oid"`
+							Signature *gitSignature `json:"signature"`
 						} `json:"target"`
 					} `json:"target"`
 				} `json:"tag"`
-				TagName string `json:"tagName"`
-				URL     string `json:"url"`
+				TagName     string    `json:"tagName"`
+				IsDraft     bool      `json:"isDraft"`
+				URL         string    `json:"url"`
+				PublishedAt time.Time `json:"publishedAt"`
 			} `json:"nodes"`
 		} `json:"releases"`
 	} `json:"repository"`
 }
 
+// gitSignature is the signature of a git tag or commit.
+type gitSignature struct {
+	IsValid bool `json:"isValid"`
+}
+
+// publishedRelease is a [Release] along with the time it was published.
+type publishedRelease struct {
+	Release
+	PublishedAt time.Time
+	// TagOnly is true if the version was found among the repo's version tags
+	// rather than its releases (see [candidateOpts.VersionSource]).
+	TagOnly bool
+}
+
+// releaseSet returns the shared set of releases in a repo, starting to fetch
+// them in the background if they are not already being fetched.
+func (c *GitHubClient) releaseSet(ctx context.Context, targetRepo string) (*releaseSet, error) {
+	owner, repo, ok := strings.Cut(targetRepo, "/")
+	if !ok {
+		return nil, fmt.Errorf("targetRepo must be specified in \"owner/repo\" format, got %q", targetRepo)
+	}
+	return c.releaseSets.Do(ctx, canonicalName(targetRepo), func() (*releaseSet, error) {
+		// the set outlives the caller that creates it, so its pages must be
+		// fetched independently of the caller's context, until the set is
+		// fully fetched or forgotten
+		ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		pages := make(chan releasesPage, 1)
+		if dir, ok := c.mirror.repoDir(targetRepo); ok {
+			go func() {
+				releases, err := c.mirror.releases(ctx, dir)
+				pages <- releasesPage{releases: releases, err: err}
+				close(pages)
+			}()
+		} else {
+			go c.fetchReleasePages(ctx, owner, repo, pages)
+		}
+		return &releaseSet{ctx: ctx, cancel: cancel, pages: pages}, nil
+	})
+}
+
+// newReleaseSetCache creates the cache of each repo's shared [releaseSet],
+// which stops fetching a set's releases once the set is forgotten.
+func newReleaseSetCache() *Cache[string, *releaseSet] {
+	cache := newCache[string, *releaseSet](Mutable)
+	cache.onEvict = (*releaseSet).forget
+	return cache
+}
+
+// PrefetchReleases starts fetching the releases of the given repo in the
+// background, if they are not already being fetched, so that choosing its
+// upgrade candidates later need not wait for them from scratch. Any error
+// fetching them is reported when choosing upgrade candidates.
+func (c *GitHubClient) PrefetchReleases(ctx context.Context, targetRepo string) {
+	_, _ = c.releaseSet(ctx, targetRepo)
+}
+
 // iterAllReleases returns in iter over all [Release]s in a repo.
-func (c *GitHubClient) iterAllReleases(ctx context.Context, targetRepo string) iter.Seq2[Release, error] {
-	return func(yield func(Release, error) bool) {
-		owner, repo, ok := strings.Cut(targetRepo, "/")
-		if !ok {
-			yield(Release{}, fmt.Errorf("targetRepo must be specified in \"owner/repo\" format, got %q", targetRepo))
+//
+// Pages of releases are fetched by a separate goroutine, so that fetching the
+// next page overlaps with the caller's processing of the current page. This
+// means that one extra page may be fetched if the caller stops iterating
+// early.
+//
+// Releases are shared between every iteration over the same repo, so each
+// page is fetched at most once, until forgotten via c.releaseSets (e.g. to
+// retry after finding stale data).
+func (c *GitHubClient) iterAllReleases(ctx context.Context, targetRepo string) iter.Seq2[publishedRelease, error] {
+	return func(yield func(publishedRelease, error) bool) {
+		key := canonicalName(targetRepo)
+		set, err := c.releaseSet(ctx, targetRepo)
+		if err != nil {
+			yield(publishedRelease{}, err)
+			return
+		}
+		set.acquire()
+		defer set.release()
+		for i := 0; ; i++ {
+			release, ok, err := set.get(ctx, i)
+			if err != nil {
+				// let the next caller try again after a failed fetch
+				if ctx.Err() == nil {
+					c.releaseSets.Forget(key)
+				}
+				yield(publishedRelease{}, err)
+				return
+			}
+			if !ok || !yield(release, nil) {
+				return
+			}
+		}
+	}
+}
+
+// iterCandidates returns an iter over the releases of a repo that may be
+// chosen as upgrade candidates, taken from the given version source (see
+// [candidateOpts.VersionSource]).
+func (c *GitHubClient) iterCandidates(ctx context.Context, targetRepo string, source string) iter.Seq2[publishedRelease, error] {
+	switch source {
+	case versionSourceTags:
+		return c.iterVersionTags(ctx, targetRepo, nil)
+	case versionSourceBoth:
+		return c.iterReleasesAndTags(ctx, targetRepo)
+	default:
+		return c.iterAllReleases(ctx, targetRepo)
+	}
+}
+
+// iterVersionTags returns an iter over every complete version tag in a repo
+// (e.g. v4.2.1, but not a floating tag like v4) as a release, newest version
+// first, skipping any versions already in the given set of known releases,
+// along with any tags on the commits of those releases.
+//
+// Tags have no publication dates or signatures, so they are never chosen as
+// candidates when resolving as of a point in time or when verified releases
+// are required.
+func (c *GitHubClient) iterVersionTags(ctx context.Context, targetRepo string, known []publishedRelease) iter.Seq2[publishedRelease, error] {
+	return func(yield func(publishedRelease, error) bool) {
+		tags, err := c.getVersionTags(ctx, targetRepo)
+		if err != nil {
+			yield(publishedRelease{}, err)
 			return
 		}
-		variables := map[string]any{
-			"owner":  owner,
-			"repo":   repo,
-			"cursor": "",
+		commits := make(map[string]string, len(tags))
+		for _, tag := range tags {
+			if isCompleteVersion(tag.Name) {
+				commits[tag.Name] = tag.CommitHash
+			}
+		}
+		released := make(map[string]bool, len(known))
+		for _, r := range known {
+			delete(commits, r.Version)
+			released[r.CommitHash] = true
 		}
-		for {
-			var resp getRepositoryReleasesResp
-			if err := c.doGraphql(ctx, getRepositoryReleasesQuery, variables, &resp); err != nil {
-				yield(Release{}, fmt.Errorf("graphql error: %w", err))
+		for version, commit := range commits {
+			if released[commit] {
+				delete(commits, version)
+			}
+		}
+		versions := slices.Collect(maps.Keys(commits))
+		sortVersionsNewestFirst(versions)
+		for _, version := range versions {
+			tag := publishedRelease{Release: Release{Version: version, CommitHash: commits[version]}, TagOnly: true}
+			if !yield(tag, nil) {
 				return
 			}
-			for _, release := range resp.Repository.Releases.Nodes {
-				// check for a match in the direct commit OID (for
-				// "lightweight" tags) or the nested commit OID (for
-				// "annotated" tags)
-				commit := release.Tag.Target.OID
-				if release.Tag.Target.Target.OID != "" {
-					commit = release.Tag.Target.Target.OID
-				}
-				release := Release{
-					Version:    release.TagName,
-					CommitHash: commit,
-				}
-				if !yield(release, nil) {
-					return
+		}
+	}
+}
+
+// iterReleasesAndTags returns an iter over the union of a repo's releases and
+// version tags, newest version first. A version that is both a release and a
+// tag is only included once, as the release, which carries its publication
+// date and signature, and tags on the commit of a release are dropped (see
+// [GitHubClient.iterVersionTags]).
+//
+// Unlike [GitHubClient.iterAllReleases], every release must be fetched before
+// the first one is returned, since they must be merged with the tags.
+func (c *GitHubClient) iterReleasesAndTags(ctx context.Context, targetRepo string) iter.Seq2[publishedRelease, error] {
+	return func(yield func(publishedRelease, error) bool) {
+		var releases []publishedRelease
+		for release, err := range c.iterAllReleases(ctx, targetRepo) {
+			if err != nil {
+				yield(publishedRelease{}, err)
+				return
+			}
+			releases = append(releases, release)
+		}
+		all := slices.Clone(releases)
+		for tag, err := range c.iterVersionTags(ctx, targetRepo, releases) {
+			if err != nil {
+				yield(publishedRelease{}, err)
+				return
+			}
+			all = append(all, tag)
+		}
+		slices.SortStableFunc(all, func(a, b publishedRelease) int {
+			return compareVersions(b.Version, a.Version)
+		})
+		for _, release := range all {
+			if !yield(release, nil) {
+				return
+			}
+		}
+	}
+}
+
+// releaseSet shares the releases of a single repo between every caller that
+// iterates over them, fetching each page lazily and at most once.
+//
+// Pages are fetched until every release has been fetched, or until the set
+// has been forgotten and no caller is still iterating over it, so that a
+// forgotten set does not leave its producer blocked forever.
+type releaseSet struct {
+	// ctx governs fetching pages, and cancel stops it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	pages     <-chan releasesPage
+	releases  []publishedRelease
+	err       error
+	done      bool
+	users     int
+	forgotten bool
+}
+
+// acquire registers a caller iterating over the set, so that its pages keep
+// being fetched even if the set is forgotten in the meantime.
+func (s *releaseSet) acquire() {
+	s.mu.Lock()
+	s.users++
+	s.mu.Unlock()
+}
+
+// release unregisters a caller registered via acquire, stopping the fetching
+// of pages if the set has been forgotten and it was the last caller.
+func (s *releaseSet) release() {
+	s.mu.Lock()
+	s.users--
+	stop := s.forgotten && s.users == 0
+	s.mu.Unlock()
+	if stop {
+		s.cancel()
+	}
+}
+
+// forget marks the set as forgotten, stopping the fetching of pages unless
+// any caller is still iterating over it.
+func (s *releaseSet) forget() {
+	s.mu.Lock()
+	s.forgotten = true
+	stop := s.users == 0
+	s.mu.Unlock()
+	if stop {
+		s.cancel()
+	}
+}
+
+// get returns the i-th release, waiting for more pages to be fetched as
+// necessary. ok is false if there are no more releases.
+func (s *releaseSet) get(ctx context.Context, i int) (release publishedRelease, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i >= len(s.releases) && !s.done {
+		if err := ctx.Err(); err != nil {
+			return publishedRelease{}, false, err
+		}
+		select {
+		case page, open := <-s.pages:
+			switch {
+			case !open:
+				s.done = true
+				if err := s.ctx.Err(); err != nil {
+					s.err = fmt.Errorf("stopped fetching releases: %w", err)
 				}
+			case page.err != nil:
+				s.err, s.done = page.err, true
+			default:
+				s.releases = append(s.releases, page.releases...)
 			}
-			if !resp.Repository.Releases.PageInfo.HasNextPage {
-				break
+		case <-ctx.Done():
+			return publishedRelease{}, false, ctx.Err()
+		}
+	}
+	if s.done {
+		// every page has been received, so nothing is left to fetch
+		s.cancel()
+	}
+	if i < len(s.releases) {
+		return s.releases[i], true, nil
+	}
+	return publishedRelease{}, false, s.err
+}
+
+// releasesPage is a single page of results produced by fetchReleasePages.
+type releasesPage struct {
+	releases []publishedRelease
+	err      error
+}
+
+// fetchReleasePages fetches every page of releases for a repo, sending each
+// one to the given channel until there are no more pages, an error occurs, or
+// the context is canceled. The channel is closed before returning.
+func (c *GitHubClient) fetchReleasePages(ctx context.Context, owner string, repo string, pages chan<- releasesPage) {
+	defer close(pages)
+	send := func(page releasesPage) bool {
+		select {
+		case pages <- page:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	variables := map[string]any{
+		"owner":  owner,
+		"repo":   repo,
+		"cursor": "",
+	}
+	for {
+		var resp getRepositoryReleasesResp
+		if err := c.doGraphql(ctx, getRepositoryReleasesQuery, variables, &resp); err != nil {
+			send(releasesPage{err: fmt.Errorf("graphql error: %w", err)})
+			return
+		}
+		page := releasesPage{
+			releases: make([]publishedRelease, 0, len(resp.Repository.Releases.Nodes)),
+		}
+		for _, release := range resp.Repository.Releases.Nodes {
+			// drafts are visible to tokens with push access, but have not
+			// actually been released, so they must never be candidates
+			if release.IsDraft {
+				continue
+			}
+			// check for a match in the direct commit OID (for
+			// "lightweight" tags) or the nested commit OID (for
+			// "annotated" tags)
+			commit := release.Tag.Target.OID
+			if release.Tag.Target.Target.OID != "" {
+				commit = release.Tag.Target.Target.OID
 			}
-			variables["cursor"] = resp.Repository.Releases.PageInfo.EndCursor
+			// a release is verified if either its (annotated) tag or the
+			// commit it points to is signed
+			verified := false
+			for _, sig := range []*gitSignature{release.Tag.Target.Signature, release.Tag.Target.Target.Signature} {
+				verified = verified || (sig != nil && sig.IsValid)
+			}
+			page.releases = append(page.releases, publishedRelease{
+				Release: Release{
+					Version:    release.TagName,
+					CommitHash: commit,
+					Verified:   verified,
+				},
+				PublishedAt: release.PublishedAt,
+			})
+		}
+		if !send(page) {
+			return
 		}
+		if !resp.Repository.Releases.PageInfo.HasNextPage {
+			return
+		}
+		variables["cursor"] = resp.Repository.Releases.PageInfo.EndCursor
 	}
 }
 
@@ -315,21 +941,80 @@ type versionTagsForRefResp struct {
 	} `json:"repository"`
 }
 
+// versionTag is a semver tag and the commit it points to.
+type versionTag struct {
+	Name       string
+	CommitHash string
+}
+
 // GetVersionTagsForCommitHash returns any semver-compatible tags pointing to the
 // given commit hash.
+//
+// Every version tag in the repo is fetched at most once, and shared by all
+// lookups for the same repo.
 func (c *GitHubClient) GetVersionTagsForCommitHash(ctx context.Context, targetRepo string, commitHash string) ([]string, error) {
-	return c.versionCache.Do(ctx, cacheKey(targetRepo, commitHash), func() ([]string, error) {
-		return c.doGetVersionTagsForHash(ctx, targetRepo, commitHash)
+	allTags, err := c.getVersionTags(ctx, targetRepo)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, tag := range allTags {
+		if tag.CommitHash == commitHash {
+			tags = append(tags, tag.Name)
+		}
+	}
+	// return any matching version tags in descending order, with the newest
+	// and most specific semver tag first
+	sortVersionsNewestFirst(tags)
+	return tags, nil
+}
+
+// GetReleaseVersionsForCommitHash returns the tag names of any semver releases
+// targeting the given commit hash, in the same order as
+// [GitHubClient.GetVersionTagsForCommitHash].
+//
+// This recovers versions whose tags are missed by the version tag lookup,
+// e.g. tags without a "v" prefix or annotated tags pointing to other tags,
+// as long as they were published as releases.
+func (c *GitHubClient) GetReleaseVersionsForCommitHash(ctx context.Context, targetRepo string, commitHash string) ([]string, error) {
+	var versions []string
+	for release, err := range c.iterAllReleases(ctx, targetRepo) {
+		if err != nil {
+			return nil, err
+		}
+		if release.CommitHash == commitHash && isValidVersion(release.Version) {
+			versions = append(versions, release.Version)
+		}
+	}
+	sortVersionsNewestFirst(versions)
+	return versions, nil
+}
+
+// getVersionTags returns every semver tag in a repo.
+func (c *GitHubClient) getVersionTags(ctx context.Context, targetRepo string) ([]versionTag, error) {
+	return c.tagCache.Do(ctx, canonicalName(targetRepo), func() ([]versionTag, error) {
+		return c.doGetVersionTags(ctx, targetRepo)
 	})
 }
 
-func (c *GitHubClient) doGetVersionTagsForHash(ctx context.Context, targetRepo string, commitHash string) ([]string, error) {
+func (c *GitHubClient) doGetVersionTags(ctx context.Context, targetRepo string) ([]versionTag, error) {
 	owner, repo, ok := strings.Cut(targetRepo, "/")
 	if !ok {
 		return nil, fmt.Errorf("targetRepo must be specified in \"owner/repo\" format, got %q", targetRepo)
 	}
+	if dir, ok := c.mirror.repoDir(targetRepo); ok {
+		releases, err := c.mirror.versionTags(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		tags := make([]versionTag, 0, len(releases))
+		for _, r := range releases {
+			tags = append(tags, versionTag{Name: r.Version, CommitHash: r.CommitHash})
+		}
+		return tags, nil
+	}
 
-	var tags []string
+	var tags []versionTag
 	variables := map[string]any{
 		"owner":  owner,
 		"repo":   repo,
@@ -341,40 +1026,60 @@ func (c *GitHubClient) doGetVersionTagsForHash(ctx context.Context, targetRepo s
 			return nil, fmt.Errorf("graphql error: %w", err)
 		}
 		for _, node := range resp.Repository.Refs.Nodes {
-			if !semver.IsValid(node.Name) {
+			if !isValidVersion(node.Name) {
 				continue
 			}
-			// check for a match in the direct commit OID (for "lightweight"
-			// tags) or the nested commit OID (for "annotated" tags)
-			if node.Target.Oid == commitHash || node.Target.Target.Oid == commitHash {
-				tags = append(tags, node.Name)
+			// use the direct commit OID (for "lightweight" tags) or the
+			// nested commit OID (for "annotated" tags)
+			commit := node.Target.Oid
+			if node.Target.Target.Oid != "" {
+				commit = node.Target.Target.Oid
 			}
+			tags = append(tags, versionTag{Name: node.Name, CommitHash: commit})
 		}
 		if !resp.Repository.Refs.PageInfo.HasNextPage {
 			break
 		}
 		variables["cursor"] = resp.Repository.Refs.PageInfo.EndCursor
 	}
-	// return any matching version tags in descending order, with the newest
-	// and most specific semver tag first
-	semver.Sort(tags)
-	slices.Reverse(tags)
 	return tags, nil
 }
 
 // GetCommitHashForRef returns the full SHA commit hash for the given ref,
 // which may be a (possibly shortened) commit hash, a branch name, or a tag
 // name.
+//
+// Version tags are resolved without any requests if the repo's version tags
+// have already been fetched by [GitHubClient.GetVersionTagsForCommitHash].
 func (c *GitHubClient) GetCommitHashForRef(ctx context.Context, targetRepo string, ref string) (string, error) {
-	return c.refCache.Do(ctx, cacheKey(targetRepo, ref), func() (string, error) {
+	return c.refCache.DoClassified(ctx, cacheKey(canonicalName(targetRepo), ref), func() (string, Volatility, error) {
+		if tags, ok := c.tagCache.Peek(canonicalName(targetRepo)); ok {
+			for _, tag := range tags {
+				if tag.Name == ref {
+					slogctx.Debug(ctx, "github: ref resolved from cached version tags", "repo", targetRepo, "ref", ref, "commit", tag.CommitHash)
+					return tag.CommitHash, Mutable, nil
+				}
+			}
+		}
 		return c.doGetCommitHashForRef(ctx, targetRepo, ref)
 	})
 }
 
-func (c *GitHubClient) doGetCommitHashForRef(ctx context.Context, targetRepo string, ref string) (string, error) {
+// doGetCommitHashForRef resolves a ref to a commit hash, classifying the
+// result by the kind of ref: a commit hash never moves, a tag rarely does,
+// and a branch may move at any time.
+//
+// A fully qualified ref (e.g. refs/pull/123/merge) is looked up exactly as
+// given, while the kind of any other ref is guessed by trying each kind in
+// turn.
+func (c *GitHubClient) doGetCommitHashForRef(ctx context.Context, targetRepo string, ref string) (string, Volatility, error) {
 	owner, repo, ok := strings.Cut(targetRepo, "/")
 	if !ok {
-		return "", fmt.Errorf("targetRepo must be specified in \"owner/repo\" format, got %q", targetRepo)
+		return "", Volatile, fmt.Errorf("targetRepo must be specified in \"owner/repo\" format, got %q", targetRepo)
+	}
+	if dir, ok := c.mirror.repoDir(targetRepo); ok {
+		commit, err := c.mirror.commitHashForRef(ctx, dir, ref)
+		return commit, refVolatility(ref), err
 	}
 
 	log := slogctx.From(ctx)
@@ -383,6 +1088,23 @@ func (c *GitHubClient) doGetCommitHashForRef(ctx context.Context, targetRepo str
 		"ref", ref,
 	)
 
+	// a fully qualified ref (e.g. refs/pull/123/merge) names exactly one
+	// ref, so there's no need to guess its kind
+	if isQualifiedRef(ref) {
+		var gitRef gitRefResponse
+		if err := c.doREST(ctx, "GET", fmt.Sprintf("/repos/%s/%s/git/ref/%s", owner, repo, strings.TrimPrefix(ref, "refs/")), &gitRef); err != nil {
+			return "", Volatile, fmt.Errorf("failed to resolve reference %s: %w", ref, err)
+		}
+		// need another request for annotated tags
+		if gitRef.Object.Type == "tag" {
+			if err := c.doREST(ctx, "GET", fmt.Sprintf("/repos/%s/%s/git/tags/%s", owner, repo, gitRef.Object.SHA), &gitRef); err != nil {
+				return "", Volatile, fmt.Errorf("failed to resolve annotated tag %s: %w", ref, err)
+			}
+		}
+		log.DebugContext(ctx, "ref resolved as fully qualified ref", "commit", gitRef.Object.SHA)
+		return gitRef.Object.SHA, refVolatility(ref), nil
+	}
+
 	// Note: we check whether the ref is a (possibly short) commit hash,
 	// branch name, or tag name, in that order.
 	//
@@ -397,7 +1119,7 @@ func (c *GitHubClient) doGetCommitHashForRef(ctx context.Context, targetRepo str
 			err := c.doREST(ctx, "GET", fmt.Sprintf("/repos/%s/%s/commits/%s", owner, repo, ref), &commit)
 			if err == nil {
 				log.DebugContext(ctx, "ref resolved to commit hash", "commit", commit.SHA)
-				return commit.SHA, nil
+				return commit.SHA, Immutable, nil
 			}
 			log.DebugContext(ctx, "ref is not a commit hash", "error", err)
 		}
@@ -409,7 +1131,7 @@ func (c *GitHubClient) doGetCommitHashForRef(ctx context.Context, targetRepo str
 		err := c.doREST(ctx, "GET", fmt.Sprintf("/repos/%s/%s/git/ref/heads/%s", owner, repo, ref), &gitRef)
 		if err == nil {
 			log.DebugContext(ctx, "ref resolved to branch", "commit", gitRef.Object.SHA)
-			return gitRef.Object.SHA, nil
+			return gitRef.Object.SHA, Volatile, nil
 		}
 		log.DebugContext(ctx, "ref is not a branch", "error", err)
 	}
@@ -422,38 +1144,296 @@ func (c *GitHubClient) doGetCommitHashForRef(ctx context.Context, targetRepo str
 			// lightweight tag, we're done
 			if gitRef.Object.Type == "commit" {
 				log.DebugContext(ctx, "ref resolved to lightweight tag", "commit", gitRef.Object.SHA)
-				return gitRef.Object.SHA, nil
+				return gitRef.Object.SHA, Mutable, nil
 			}
 
 			// need another request for annotated tags
 			if err := c.doREST(ctx, "GET", fmt.Sprintf("/repos/%s/%s/git/tags/%s", owner, repo, gitRef.Object.SHA), &gitRef); err == nil {
 				log.DebugContext(ctx, "ref resolved to annotated tag", "commit", gitRef.Object.SHA)
-				return gitRef.Object.SHA, nil
+				return gitRef.Object.SHA, Mutable, nil
 			}
 			log.DebugContext(ctx, "ref is not a lightweight or annotated tag", "error", err)
 		}
 		log.DebugContext(ctx, "ref is not a tag", "error", err)
 	}
 
-	return "", fmt.Errorf("failed to resolve reference %s", ref)
+	return "", Volatile, fmt.Errorf("failed to resolve reference %s", ref)
+}
+
+// refVolatility classifies a ref whose kind is unknown, which is immutable
+// only if it is a full commit hash. A fully qualified tag ref is classified
+// like any other tag.
+func refVolatility(ref string) Volatility {
+	switch {
+	case isFullCommitHash(ref):
+		return Immutable
+	case strings.HasPrefix(ref, "refs/tags/"):
+		return Mutable
+	default:
+		return Volatile
+	}
+}
+
+// isQualifiedRef returns true if ref is a fully qualified git ref (e.g.
+// refs/heads/main or refs/pull/123/merge), rather than a short name whose
+// kind must be guessed.
+func isQualifiedRef(ref string) bool {
+	return strings.HasPrefix(ref, "refs/")
+}
+
+// RepoExists reports whether the given repo exists, returning false only if
+// GitHub definitively reports it missing. Note that GitHub also reports
+// private repos that the token cannot access as missing.
+func (c *GitHubClient) RepoExists(ctx context.Context, targetRepo string) (bool, error) {
+	owner, repo, ok := strings.Cut(targetRepo, "/")
+	if !ok {
+		return false, fmt.Errorf("targetRepo must be specified in \"owner/repo\" format, got %q", targetRepo)
+	}
+	if _, ok := c.mirror.repoDir(targetRepo); ok {
+		return true, nil
+	}
+	var resp struct{}
+	err := c.doREST(ctx, "GET", fmt.Sprintf("/repos/%s/%s", owner, repo), &resp)
+	var statusErr *httpStatusError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// IsVerifiedCreator returns true if the given owner is an organization that
+// has verified ownership of a domain with GitHub, as shown by the "Verified"
+// badge on its profile. This is not the Marketplace's verified creator badge,
+// which is not available via the API. Users are never verified.
+func (c *GitHubClient) IsVerifiedCreator(ctx context.Context, owner string) (bool, error) {
+	return c.creatorCache.Do(ctx, strings.ToLower(owner), func() (bool, error) {
+		var resp struct {
+			IsVerified bool `json:"is_verified"`
+		}
+		err := c.doREST(ctx, "GET", "/orgs/"+url.PathEscape(owner), &resp)
+		var statusErr *httpStatusError
+		switch {
+		case err == nil:
+			return resp.IsVerified, nil
+		case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+			// not an organization
+			return false, nil
+		default:
+			return false, fmt.Errorf("failed to fetch organization %s: %w", owner, err)
+		}
+	})
+}
+
+// SearchRepos returns the full names (e.g. "actions/checkout") of the repos
+// matching the given search query (e.g. "checkout in:name"), in order of
+// relevance. Only the first page of results is returned.
+func (c *GitHubClient) SearchRepos(ctx context.Context, query string) ([]string, error) {
+	return c.searchCache.Do(ctx, query, func() ([]string, error) {
+		var resp struct {
+			Items []struct {
+				FullName string `json:"full_name"`
+			} `json:"items"`
+		}
+		if err := c.doREST(ctx, "GET", "/search/repositories?per_page=50&q="+url.QueryEscape(query), &resp); err != nil {
+			return nil, fmt.Errorf("failed to search repos: %w", err)
+		}
+		names := make([]string, 0, len(resp.Items))
+		for _, item := range resp.Items {
+			names = append(names, item.FullName)
+		}
+		return names, nil
+	})
+}
+
+// GetTreeHashForCommit returns the hash of the git tree for the given full
+// commit hash, which identifies the exact content of the repo at that commit.
+func (c *GitHubClient) GetTreeHashForCommit(ctx context.Context, targetRepo string, commitHash string) (string, error) {
+	commit, err := c.getCommitObject(ctx, targetRepo, commitHash)
+	if err != nil {
+		return "", err
+	}
+	if commit.Tree.SHA == "" {
+		return "", fmt.Errorf("no tree found for commit %s", commitHash)
+	}
+	return commit.Tree.SHA, nil
+}
+
+// GetCommitDate returns the committer date of the given full commit hash.
+//
+// Note that commit dates are recorded by whoever made the commit, so they
+// cannot be fully trusted.
+func (c *GitHubClient) GetCommitDate(ctx context.Context, targetRepo string, commitHash string) (time.Time, error) {
+	commit, err := c.getCommitObject(ctx, targetRepo, commitHash)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if commit.Committer.Date.IsZero() {
+		return time.Time{}, fmt.Errorf("no committer date found for commit %s", commitHash)
+	}
+	return commit.Committer.Date, nil
+}
+
+// getCommitObject returns the git commit object for the given full commit
+// hash, which is fetched at most once.
+func (c *GitHubClient) getCommitObject(ctx context.Context, targetRepo string, commitHash string) (gitCommitObjectResponse, error) {
+	return c.commitCache.Do(ctx, cacheKey(canonicalName(targetRepo), commitHash), func() (gitCommitObjectResponse, error) {
+		owner, repo, ok := strings.Cut(targetRepo, "/")
+		if !ok {
+			return gitCommitObjectResponse{}, fmt.Errorf("targetRepo must be specified in \"owner/repo\" format, got %q", targetRepo)
+		}
+		if dir, ok := c.mirror.repoDir(targetRepo); ok {
+			return c.mirror.commitObject(ctx, dir, commitHash)
+		}
+		var commit gitCommitObjectResponse
+		if err := c.doREST(ctx, "GET", fmt.Sprintf("/repos/%s/%s/git/commits/%s", owner, repo, commitHash), &commit); err != nil {
+			return gitCommitObjectResponse{}, err
+		}
+		return commit, nil
+	})
+}
+
+// GetActionMetadataFile returns the contents of the action.yml (or
+// action.yaml) metadata file defining the given action at the given ref.
+func (c *GitHubClient) GetActionMetadataFile(ctx context.Context, action Action, ref string) (string, error) {
+	return c.actionFileCache.DoClassified(ctx, cacheKey(action.CanonicalName(), ref), func() (string, Volatility, error) {
+		content, err := c.doGetActionMetadataFile(ctx, action, ref)
+		return content, refVolatility(ref), err
+	})
+}
+
+func (c *GitHubClient) doGetActionMetadataFile(ctx context.Context, action Action, ref string) (string, error) {
+	owner, repo, ok := strings.Cut(action.Repo(), "/")
+	if !ok {
+		return "", fmt.Errorf("targetRepo must be specified in \"owner/repo\" format, got %q", action.Repo())
+	}
+	if dir, ok := c.mirror.repoDir(action.Repo()); ok {
+		return c.mirror.actionMetadataFile(ctx, dir, action, ref)
+	}
+	for _, filename := range []string{"action.yml", "action.yaml"} {
+		filePath := path.Join(action.Path(), filename)
+		var file gitContentsResponse
+		err := c.doREST(ctx, "GET", fmt.Sprintf("/repos/%s/%s/contents/%s?ref=%s", owner, repo, filePath, url.QueryEscape(ref)), &file)
+		var statusErr *httpStatusError
+		switch {
+		case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+			slogctx.Debug(ctx, "github: action metadata file not found", "action", action.Name, "path", filePath)
+			continue
+		case err != nil:
+			return "", fmt.Errorf("failed to fetch %s: %w", filePath, err)
+		}
+		if file.Encoding != "base64" {
+			return "", fmt.Errorf("unexpected encoding %q for %s", file.Encoding, filePath)
+		}
+		// the API wraps base64-encoded content at 60 columns
+		content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+		if err != nil {
+			return "", fmt.Errorf("failed to decode %s: %w", filePath, err)
+		}
+		return string(content), nil
+	}
+	return "", fmt.Errorf("no action.yml or action.yaml found for %s at ref %s", action.Name, ref)
 }
 
 // ValidateAuth ensures that the configured auth token is valid by fetching
 // info on the authenticated user.
 func (c *GitHubClient) ValidateAuth(ctx context.Context) (string, error) {
+	info, err := c.GetAuthInfo(ctx)
+	return info.Login, err
+}
+
+// AuthInfo describes the user authenticated by the client's token.
+type AuthInfo struct {
+	Login string
+	// Scopes holds the token's OAuth scopes, which GitHub only reports for
+	// classic personal access tokens. It is nil if no scopes were reported.
+	Scopes []string
+}
+
+// GetAuthInfo returns the login and, if known, the OAuth scopes of the user
+// authenticated by the client's token.
+func (c *GitHubClient) GetAuthInfo(ctx context.Context) (AuthInfo, error) {
 	var user struct {
 		Login string `json:"login"`
 	}
-	if err := c.doREST(ctx, "GET", "/user", &user); err != nil {
-		return "", err
+	header, err := c.doRESTWithHeaders(ctx, "GET", "/user", &user)
+	if err != nil {
+		return AuthInfo{}, err
 	}
-	return user.Login, nil
+	info := AuthInfo{Login: user.Login}
+	if values, ok := header["X-Oauth-Scopes"]; ok {
+		info.Scopes = []string{}
+		for _, value := range values {
+			for _, scope := range strings.Split(value, ",") {
+				if scope = strings.TrimSpace(scope); scope != "" {
+					info.Scopes = append(info.Scopes, scope)
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+// RateLimit describes the state of one of the client's API rate limits.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// RateLimits holds the client's REST and GraphQL API rate limits.
+type RateLimits struct {
+	REST    RateLimit
+	GraphQL RateLimit
+}
+
+// GetRateLimits returns the client's current API rate limits. Checking rate
+// limits does not count against them.
+func (c *GitHubClient) GetRateLimits(ctx context.Context) (RateLimits, error) {
+	type rateLimitResp struct {
+		Limit     int   `json:"limit"`
+		Remaining int   `json:"remaining"`
+		Reset     int64 `json:"reset"`
+	}
+	var resp struct {
+		Resources struct {
+			Core    rateLimitResp `json:"core"`
+			GraphQL rateLimitResp `json:"graphql"`
+		} `json:"resources"`
+	}
+	if err := c.doREST(ctx, "GET", "/rate_limit", &resp); err != nil {
+		return RateLimits{}, err
+	}
+	convert := func(r rateLimitResp) RateLimit {
+		return RateLimit{Limit: r.Limit, Remaining: r.Remaining, Reset: time.Unix(r.Reset, 0)}
+	}
+	return RateLimits{
+		REST:    convert(resp.Resources.Core),
+		GraphQL: convert(resp.Resources.GraphQL),
+	}, nil
 }
 
 type gitCommitResponse struct {
 	SHA string `json:"sha"`
 }
 
+type gitCommitObjectResponse struct {
+	Tree struct {
+		SHA string `json:"sha"`
+	} `json:"tree"`
+	Committer struct {
+		Date time.Time `json:"date"`
+	} `json:"committer"`
+}
+
+type gitContentsResponse struct {
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
 type gitRefResponse struct {
 	Object struct {
 		SHA  string `json:"sha"`
@@ -466,15 +1446,44 @@ var (
 	isHex      = hexPattern.MatchString
 )
 
+// isFullCommitHash returns true if ref is a full length SHA-1 commit hash.
+func isFullCommitHash(ref string) bool {
+	return len(ref) == 40 && isHex(ref)
+}
+
+// isCommitHashFor returns true if ref is the given full commit hash or an
+// abbreviation of it at least as long as git's shortest abbreviation, so
+// that short branch or tag names which happen to look like hex are not
+// mistaken for commit hashes.
+func isCommitHashFor(ref, commit string) bool {
+	return len(ref) >= minShortHashLength && isHex(ref) && strings.HasPrefix(commit, strings.ToLower(ref))
+}
+
 func cacheKey(s ...string) string {
 	return strings.Join(s, "/")
 }
 
+// TokenProvider returns a fresh GitHub access token, e.g. by running a
+// credential helper. It is used to replace a token that expires mid-run.
+type TokenProvider func(ctx context.Context) (string, error)
+
 // authTransport is an http.RoundTripper that adds GitHub authentication
 // to outbound requests by injecting a Bearer token in the Authorization header.
+//
+// The token is chosen by the request's host: hosts with their own credential
+// (e.g. a GitHub Enterprise Server instance) use it, and every other host
+// uses the default token.
+//
+// If a refresh [TokenProvider] is configured, a 401 response to a request
+// using the default token triggers one attempt to fetch a new token and retry
+// the request. If the provider returns the same token, the token is
+// considered genuinely invalid and the original 401 response is returned.
 type authTransport struct {
-	token     string
-	transport http.RoundTripper
+	mu         sync.Mutex
+	token      string
+	hostTokens map[string]string
+	refresh    TokenProvider
+	transport  http.RoundTripper
 }
 
 // newAuthTransport creates a new authTransport with the given token.
@@ -492,8 +1501,160 @@ func newAuthTransport(token string, transport http.RoundTripper) *authTransport
 // RoundTrip implements http.RoundTripper by adding the Authorization header
 // and delegating to the underlying transport.
 func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	token, refresh := t.token, t.refresh
+	if hostToken, ok := t.hostTokens[strings.ToLower(req.URL.Hostname())]; ok {
+		// per-host credentials are static, so they are never refreshed
+		token, refresh = hostToken, nil
+	}
+	t.mu.Unlock()
+
+	resp, err := t.roundTrip(req, req.Body, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || refresh == nil {
+		return resp, err
+	}
+	// we can only retry if the request body can be replayed
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if hasBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	newToken, err := t.refreshToken(req.Context(), token)
+	if err != nil {
+		mustClose(resp.Body)
+		return nil, fmt.Errorf("failed to refresh auth token: %w", err)
+	}
+	if newToken == token {
+		return resp, nil
+	}
+	var body io.ReadCloser
+	if hasBody {
+		if body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	slogctx.Debug(req.Context(), "github: retrying request with refreshed auth token", slog.String("url", req.URL.String()))
+	_, _ = io.Copy(io.Discard, resp.Body)
+	mustClose(resp.Body)
+	return t.roundTrip(req, body, newToken)
+}
+
+func (t *authTransport) roundTrip(req *http.Request, body io.ReadCloser, token string) (*http.Response, error) {
 	// Clone the request to avoid modifying the original
 	reqCopy := req.Clone(req.Context())
-	reqCopy.Header.Set("Authorization", "Bearer "+t.token)
+	reqCopy.Body = body
+	reqCopy.Header.Set("Authorization", "Bearer "+token)
+	return t.transport.RoundTrip(reqCopy)
+}
+
+// refreshToken fetches a new token from the refresh provider, unless another
+// request has already replaced the stale token, in which case the current
+// token is returned without calling the provider again.
+func (t *authTransport) refreshToken(ctx context.Context, stale string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != stale {
+		return t.token, nil
+	}
+	token, err := t.refresh(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	return token, nil
+}
+
+// newHTTPClient creates an [http.Client] for talking to GitHub that routes
+// requests through the given proxy URL and adds the given User-Agent and
+// static headers, in "Name: value" format, to every request. A User-Agent
+// given as a static header takes precedence.
+//
+// If proxyURL is empty, the standard HTTP_PROXY, HTTPS_PROXY, and NO_PROXY
+// env vars are honored instead. If userAgent is empty, Go's default
+// User-Agent is sent.
+func newHTTPClient(proxyURL string, userAgent string, headerArgs []string) (*http.Client, error) {
+	headers, err := parseHeaders(headerArgs)
+	if err != nil {
+		return nil, err
+	}
+	if userAgent != "" && headers.Get("User-Agent") == "" {
+		headers.Set("User-Agent", userAgent)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxyURL != "" {
+		u, err := parseProxyURL(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if len(headers) == 0 {
+		return &http.Client{Transport: transport}, nil
+	}
+	return &http.Client{Transport: &headerTransport{headers: headers, transport: transport}}, nil
+}
+
+// defaultUserAgent returns the User-Agent header identifying ghavm to GitHub,
+// given version info in the format passed to [NewApp] (e.g. "ghavm version
+// v1.2.3 abc123 go1.24.0 (built 2025-01-01)").
+func defaultUserAgent(versionInfo string) string {
+	if info, ok := strings.CutPrefix(versionInfo, "ghavm version "); ok {
+		if fields := strings.Fields(info); len(fields) > 0 {
+			return "ghavm/" + fields[0]
+		}
+	}
+	return "ghavm"
+}
+
+// parseProxyURL parses and validates a proxy URL given on the command line.
+func parseProxyURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be one of http, https, or socks5", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", s)
+	}
+	return u, nil
+}
+
+// parseHeaders parses static request headers given on the command line in
+// "Name: value" format.
+func parseHeaders(values []string) (http.Header, error) {
+	headers := make(http.Header, len(values))
+	for _, v := range values {
+		name, value, found := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header %q: must be in \"Name: value\" format", v)
+		}
+		if http.CanonicalHeaderKey(name) == "Authorization" {
+			return nil, fmt.Errorf("invalid header %q: use --github-token to configure authentication", v)
+		}
+		headers.Add(name, strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+// headerTransport is an http.RoundTripper that adds a static set of headers
+// to outbound requests.
+type headerTransport struct {
+	headers   http.Header
+	transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper by adding the configured headers and
+// delegating to the underlying transport.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqCopy := req.Clone(req.Context())
+	for name, values := range t.headers {
+		reqCopy.Header[name] = values
+	}
 	return t.transport.RoundTrip(reqCopy)
 }
@@ -10,7 +10,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/mccutchen/ghavm/internal/slogctx"
 	"github.com/mccutchen/ghavm/internal/testing/assert"
@@ -37,7 +39,9 @@ func TestGetUpgradeCandidates(t *testing.T) {
 	tests := map[string]struct {
 		targetRepo     string
 		currentRelease Release
+		opts           candidateOpts
 		gqlEndpoints   map[string]httpResponse
+		restEndpoints  map[string]httpResponse
 		expected       UpgradeCandidates
 		expectError    error
 	}{
@@ -64,7 +68,7 @@ func TestGetUpgradeCandidates(t *testing.T) {
 			targetRepo:     "owner/repo",
 			currentRelease: Release{Version: "v2.0.0", CommitHash: "currenthash"},
 			gqlEndpoints: map[string]httpResponse{
-				"d20dbd468b": okResponse(`{
+				"6104c8d776": okResponse(`{
 					"data": {
 						"repository": {
 							"releases": {
@@ -108,11 +112,133 @@ func TestGetUpgradeCandidates(t *testing.T) {
 				},
 			},
 		},
+		"prerelease ahead of latest stable release": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v2.0.0-rc.1", CommitHash: "currenthash"},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+					"data": {
+						"repository": {
+							"releases": {
+								"pageInfo": {
+									"hasNextPage": false,
+									"endCursor": ""
+								},
+								"nodes": [
+									{
+										"tag": {"target": {"oid": "currenthash"}},
+										"tagName": "v2.0.0-rc.1"
+									},
+									{
+										"tag": {"target": {"oid": "betahash"}},
+										"tagName": "v2.0.0-beta.1"
+									},
+									{
+										"tag": {"target": {"oid": "stablehash"}},
+										"tagName": "v1.5.0"
+									},
+									{
+										"tag": {"target": {"oid": "olderhash"}},
+										"tagName": "v1.4.0"
+									}
+								]
+							}
+						}
+					}
+				}`),
+			},
+			expected: UpgradeCandidates{
+				LatestCompatible: Release{Version: "v2.0.0-rc.1", CommitHash: "currenthash"},
+				Latest:           Release{Version: "v2.0.0-rc.1", CommitHash: "currenthash"},
+				LatestStable:     Release{Version: "v1.5.0", CommitHash: "stablehash"},
+			},
+		},
+		"prerelease behind a stable release": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v2.0.0-rc.1", CommitHash: "currenthash"},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+					"data": {
+						"repository": {
+							"releases": {
+								"pageInfo": {
+									"hasNextPage": false,
+									"endCursor": ""
+								},
+								"nodes": [
+									{
+										"tag": {"target": {"oid": "stablehash"}},
+										"tagName": "v2.0.0"
+									},
+									{
+										"tag": {"target": {"oid": "currenthash"}},
+										"tagName": "v2.0.0-rc.1"
+									},
+									{
+										"tag": {"target": {"oid": "olderhash"}},
+										"tagName": "v1.5.0"
+									}
+								]
+							}
+						}
+					}
+				}`),
+			},
+			expected: UpgradeCandidates{
+				LatestCompatible: Release{Version: "v2.0.0", CommitHash: "stablehash"},
+				Latest:           Release{Version: "v2.0.0", CommitHash: "stablehash"},
+				ReleasesBehind:   1,
+			},
+		},
+		"draft releases are skipped": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+					"data": {
+						"repository": {
+							"releases": {
+								"pageInfo": {
+									"hasNextPage": false,
+									"endCursor": ""
+								},
+								"nodes": [
+									{
+										"tag": {"target": {"oid": "drafthash"}},
+										"tagName": "v2.0.0",
+										"isDraft": true
+									},
+									{
+										"tag": {"target": {"oid": "drafthash2"}},
+										"tagName": "v1.2.0",
+										"isDraft": true
+									},
+									{
+										"tag": {"target": {"oid": "newhash"}},
+										"tagName": "v1.1.0",
+										"isDraft": false
+									},
+									{
+										"tag": {"target": {"oid": "currenthash"}},
+										"tagName": "v1.0.0"
+									}
+								]
+							}
+						}
+					}
+				}`),
+			},
+			expected: UpgradeCandidates{
+				LatestCompatible: Release{Version: "v1.1.0", CommitHash: "newhash"},
+				Latest:           Release{Version: "v1.1.0", CommitHash: "newhash"},
+				ReleasesBehind:   1,
+			},
+		},
 		"compatible and major upgrades available": {
 			targetRepo:     "owner/repo",
 			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
 			gqlEndpoints: map[string]httpResponse{
-				"d20dbd468b": okResponse(`{
+				"6104c8d776": okResponse(`{
 						"data": {
 							"repository": {
 								"releases": {
@@ -172,6 +298,7 @@ func TestGetUpgradeCandidates(t *testing.T) {
 					Version:    "v1.2.0",
 					CommitHash: "bbb222",
 				},
+				ReleasesBehind: 3,
 			},
 		},
 		"annotated tag handling": {
@@ -181,7 +308,7 @@ func TestGetUpgradeCandidates(t *testing.T) {
 				CommitHash: "currenthash",
 			},
 			gqlEndpoints: map[string]httpResponse{
-				"d20dbd468b": okResponse(`{
+				"6104c8d776": okResponse(`{
 				  "data": {
 				    "repository": {
 				      "releases": {
@@ -226,13 +353,14 @@ func TestGetUpgradeCandidates(t *testing.T) {
 					Version:    "v1.1.0",
 					CommitHash: "annotated456",
 				},
+				ReleasesBehind: 1,
 			},
 		},
 		"multiple pages": {
 			targetRepo:     "owner/repo",
 			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
 			gqlEndpoints: map[string]httpResponse{
-				"d20dbd468b": okResponse(`{
+				"6104c8d776": okResponse(`{
 						"data": {
 							"repository": {
 								"releases": {
@@ -255,7 +383,7 @@ func TestGetUpgradeCandidates(t *testing.T) {
 							}
 						}
 					}`),
-				"30f6d0ee9a": okResponse(`{
+				"b133fe855e": okResponse(`{
 						"data": {
 							"repository": {
 								"releases": {
@@ -278,7 +406,7 @@ func TestGetUpgradeCandidates(t *testing.T) {
 							}
 						}
 					}`),
-				"15b363e95e": okResponse(`{
+				"b8efebc514": okResponse(`{
 						"data": {
 							"repository": {
 								"releases": {
@@ -311,13 +439,478 @@ func TestGetUpgradeCandidates(t *testing.T) {
 					Version:    "v1.2.0",
 					CommitHash: "bbb222",
 				},
+				ReleasesBehind: 2,
+			},
+		},
+		"as of a point in time": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v2.0.0", CommitHash: "currenthash"},
+			opts:           candidateOpts{AsOf: time.Date(2023, 1, 1, 23, 59, 59, 0, time.UTC)},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+						"data": {
+							"repository": {
+								"releases": {
+									"pageInfo": {
+										"hasNextPage": false,
+										"endCursor": ""
+									},
+									"nodes": [
+										{
+											"tag": {"target": {"oid": "currenthash"}},
+											"tagName": "v2.0.0",
+											"publishedAt": "2024-03-01T12:00:00Z"
+										},
+										{
+											"tag": {"target": {"oid": "bbb222"}},
+											"tagName": "v1.2.0",
+											"publishedAt": "2023-01-02T00:00:00Z"
+										},
+										{
+											"tag": {"target": {"oid": "ccc333"}},
+											"tagName": "v1.1.0",
+											"publishedAt": "2023-01-01T18:30:00Z"
+										},
+										{
+											"tag": {"target": {"oid": "ddd444"}},
+											"tagName": "v1.0.0",
+											"publishedAt": "2022-06-01T00:00:00Z"
+										}
+									]
+								}
+							}
+						}
+					}`),
+			},
+			expected: UpgradeCandidates{
+				Latest: Release{
+					Version:    "v1.1.0",
+					CommitHash: "ccc333",
+				},
+			},
+		},
+		"require verified": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
+			opts:           candidateOpts{RequireVerified: true},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+						"data": {
+							"repository": {
+								"releases": {
+									"pageInfo": {
+										"hasNextPage": false,
+										"endCursor": ""
+									},
+									"nodes": [
+										{
+											"tag": {"target": {"oid": "aaa111", "signature": {"isValid": false}}},
+											"tagName": "v2.0.0"
+										},
+										{
+											"tag": {"target": {"oid": "tag222", "signature": {"isValid": true}, "target": {"oid": "bbb222"}}},
+											"tagName": "v1.2.0"
+										},
+										{
+											"tag": {"target": {"oid": "ccc333", "signature": {"isValid": true}}},
+											"tagName": "v1.1.0"
+										},
+										{
+											"tag": {"target": {"oid": "currenthash"}},
+											"tagName": "v1.0.0"
+										}
+									]
+								}
+							}
+						}
+					}`),
+			},
+			expected: UpgradeCandidates{
+				Latest: Release{
+					Version:    "v1.2.0",
+					CommitHash: "bbb222",
+					Verified:   true,
+				},
+				LatestCompatible: Release{
+					Version:    "v1.2.0",
+					CommitHash: "bbb222",
+					Verified:   true,
+				},
+				ReleasesBehind: 2,
+			},
+		},
+		"skip prereleases": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
+			opts:           candidateOpts{SkipPrereleases: true},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+						"data": {
+							"repository": {
+								"releases": {
+									"pageInfo": {
+										"hasNextPage": false,
+										"endCursor": ""
+									},
+									"nodes": [
+										{
+											"tag": {"target": {"oid": "aaa111"}},
+											"tagName": "v2.0.0-rc.1"
+										},
+										{
+											"tag": {"target": {"oid": "bbb222"}},
+											"tagName": "v1.1.0"
+										},
+										{
+											"tag": {"target": {"oid": "currenthash"}},
+											"tagName": "v1.0.0"
+										}
+									]
+								}
+							}
+						}
+					}`),
+			},
+			expected: UpgradeCandidates{
+				Latest: Release{
+					Version:    "v1.1.0",
+					CommitHash: "bbb222",
+				},
+				LatestCompatible: Release{
+					Version:    "v1.1.0",
+					CommitHash: "bbb222",
+				},
+				ReleasesBehind: 1,
+			},
+		},
+		"min commit age": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
+			opts: candidateOpts{
+				CommittedBefore: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+			},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+						"data": {
+							"repository": {
+								"releases": {
+									"pageInfo": {"hasNextPage": false, "endCursor": ""},
+									"nodes": [
+										{"tag": {"target": {"oid": "aaa111"}}, "tagName": "v2.0.0"},
+										{"tag": {"target": {"oid": "bbb222"}}, "tagName": "v1.2.0"},
+										{"tag": {"target": {"oid": "ccc333"}}, "tagName": "v1.1.0"},
+										{"tag": {"target": {"oid": "currenthash"}}, "tagName": "v1.0.0"}
+									]
+								}
+							}
+						}
+					}`),
+			},
+			restEndpoints: map[string]httpResponse{
+				// too recent
+				"GET /repos/owner/repo/git/commits/aaa111": okResponse(`{"sha": "aaa111", "committer": {"date": "2025-06-05T12:00:00Z"}}`),
+				"GET /repos/owner/repo/git/commits/bbb222": okResponse(`{"sha": "bbb222", "committer": {"date": "2025-06-01T00:00:01Z"}}`),
+				// old enough
+				"GET /repos/owner/repo/git/commits/ccc333": okResponse(`{"sha": "ccc333", "committer": {"date": "2025-05-01T12:00:00Z"}}`),
+				// the current release is never checked
+			},
+			expected: UpgradeCandidates{
+				Latest:           Release{Version: "v1.1.0", CommitHash: "ccc333"},
+				LatestCompatible: Release{Version: "v1.1.0", CommitHash: "ccc333"},
+				ReleasesBehind:   1,
+			},
+		},
+		"mixed tag schemes": {
+			// the repo switched from 1.x to v1.x tags partway through
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "1.4.0", CommitHash: "currenthash"},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+						"data": {
+							"repository": {
+								"releases": {
+									"pageInfo": {
+										"hasNextPage": false,
+										"endCursor": ""
+									},
+									"nodes": [
+										{
+											"tag": {"target": {"oid": "aaa111"}},
+											"tagName": "v2.1.0"
+										},
+										{
+											"tag": {"target": {"oid": "bbb222"}},
+											"tagName": "v1.5.0"
+										},
+										{
+											"tag": {"target": {"oid": "currenthash"}},
+											"tagName": "1.4.0"
+										},
+										{
+											"tag": {"target": {"oid": "ccc333"}},
+											"tagName": "1.3.0"
+										}
+									]
+								}
+							}
+						}
+					}`),
+			},
+			expected: UpgradeCandidates{
+				Latest: Release{
+					Version:    "v2.1.0",
+					CommitHash: "aaa111",
+				},
+				LatestCompatible: Release{
+					Version:    "v1.5.0",
+					CommitHash: "bbb222",
+				},
+				ReleasesBehind: 2,
+			},
+		},
+		"denied versions": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
+			opts:           candidateOpts{DeniedVersions: []string{"v2.0.0", "v1.2.0"}},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+						"data": {
+							"repository": {
+								"releases": {
+									"pageInfo": {
+										"hasNextPage": false,
+										"endCursor": ""
+									},
+									"nodes": [
+										{
+											"tag": {"target": {"oid": "aaa111"}},
+											"tagName": "v2.0.0"
+										},
+										{
+											"tag": {"target": {"oid": "bbb222"}},
+											"tagName": "v1.2.0"
+										},
+										{
+											"tag": {"target": {"oid": "ccc333"}},
+											"tagName": "v1.1.0"
+										},
+										{
+											"tag": {"target": {"oid": "currenthash"}},
+											"tagName": "v1.0.0"
+										}
+									]
+								}
+							}
+						}
+					}`),
+			},
+			expected: UpgradeCandidates{
+				Latest: Release{
+					Version:    "v1.1.0",
+					CommitHash: "ccc333",
+				},
+				LatestCompatible: Release{
+					Version:    "v1.1.0",
+					CommitHash: "ccc333",
+				},
+				ReleasesBehind: 1,
+			},
+		},
+		"version constraint": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
+			opts:           candidateOpts{Constraint: versionConstraint{{Op: "<", Version: "v1.2"}}},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+						"data": {
+							"repository": {
+								"releases": {
+									"pageInfo": {
+										"hasNextPage": false,
+										"endCursor": ""
+									},
+									"nodes": [
+										{
+											"tag": {"target": {"oid": "aaa111"}},
+											"tagName": "v2.0.0"
+										},
+										{
+											"tag": {"target": {"oid": "bbb222"}},
+											"tagName": "v1.2.0"
+										},
+										{
+											"tag": {"target": {"oid": "ccc333"}},
+											"tagName": "v1.1.0"
+										},
+										{
+											"tag": {"target": {"oid": "currenthash"}},
+											"tagName": "v1.0.0"
+										}
+									]
+								}
+							}
+						}
+					}`),
+			},
+			expected: UpgradeCandidates{
+				Latest: Release{
+					Version:    "v1.1.0",
+					CommitHash: "ccc333",
+				},
+				LatestCompatible: Release{
+					Version:    "v1.1.0",
+					CommitHash: "ccc333",
+				},
+				ReleasesBehind: 1,
+			},
+		},
+		"tags version source": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
+			opts:           candidateOpts{VersionSource: versionSourceTags},
+			gqlEndpoints: map[string]httpResponse{
+				// no releases endpoint, since releases are ignored
+				"2590b2f6ce": okResponse(`{
+					"data": {
+						"repository": {
+							"refs": {
+								"nodes": [
+									{"name": "v1.0.0", "target": {"oid": "currenthash"}},
+									{"name": "v2.0.0", "target": {"oid": "aaa111"}},
+									{"name": "v2", "target": {"oid": "aaa111"}},
+									{"name": "v1.1.0", "target": {"oid": "ccc333"}},
+									{"name": "not-semver", "target": {"oid": "ddd444"}}
+								],
+								"pageInfo": {
+									"hasNextPage": false,
+									"endCursor": ""
+								}
+							}
+						}
+					}
+				}`),
+			},
+			expected: UpgradeCandidates{
+				Latest:           Release{Version: "v2.0.0", CommitHash: "aaa111"},
+				LatestCompatible: Release{Version: "v1.1.0", CommitHash: "ccc333"},
+				ReleasesBehind:   2,
+				// releases were not consulted, so the current version is
+				// not known to be a release
+				CurrentUnreleased: true,
+			},
+		},
+		"both version sources": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
+			opts:           candidateOpts{VersionSource: versionSourceBoth},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+					"data": {
+						"repository": {
+							"releases": {
+								"pageInfo": {
+									"hasNextPage": false,
+									"endCursor": ""
+								},
+								"nodes": [
+									{
+										"tag": {"target": {"oid": "ccc333", "signature": {"isValid": true}}},
+										"tagName": "v1.1.0"
+									},
+									{
+										"tag": {"target": {"oid": "currenthash"}},
+										"tagName": "v1.0.0"
+									}
+								]
+							}
+						}
+					}
+				}`),
+				"2590b2f6ce": okResponse(`{
+					"data": {
+						"repository": {
+							"refs": {
+								"nodes": [
+									{"name": "v1.0.0", "target": {"oid": "currenthash"}},
+									{"name": "v2.0.0", "target": {"oid": "aaa111"}},
+									{"name": "v1.1.0", "target": {"oid": "ccc333"}},
+									{"name": "v1.1.1", "target": {"oid": "ccc333"}},
+									{"name": "not-semver", "target": {"oid": "ddd444"}}
+								],
+								"pageInfo": {
+									"hasNextPage": false,
+									"endCursor": ""
+								}
+							}
+						}
+					}
+				}`),
+			},
+			expected: UpgradeCandidates{
+				// v2.0.0 is only a tag, while v1.1.0 is both a tag and a
+				// release, which is used since it has a signature. v1.1.1
+				// is dropped, since its commit is already released as v1.1.0
+				Latest:           Release{Version: "v2.0.0", CommitHash: "aaa111"},
+				LatestCompatible: Release{Version: "v1.1.0", CommitHash: "ccc333", Verified: true},
+				ReleasesBehind:   2,
+			},
+		},
+		"floating tags are not candidates": {
+			targetRepo:     "owner/repo",
+			currentRelease: Release{Version: "v4.2.0", CommitHash: "currenthash"},
+			opts:           candidateOpts{VersionSource: versionSourceBoth},
+			gqlEndpoints: map[string]httpResponse{
+				"6104c8d776": okResponse(`{
+					"data": {
+						"repository": {
+							"releases": {
+								"pageInfo": {
+									"hasNextPage": false,
+									"endCursor": ""
+								},
+								"nodes": [
+									{
+										"tag": {"target": {"oid": "currenthash"}},
+										"tagName": "v4.2.0"
+									}
+								]
+							}
+						}
+					}
+				}`),
+				"2590b2f6ce": okResponse(`{
+					"data": {
+						"repository": {
+							"refs": {
+								"nodes": [
+									{"name": "v5", "target": {"oid": "eee555"}},
+									{"name": "v5.0.0", "target": {"oid": "eee555"}},
+									{"name": "v4.2", "target": {"oid": "ddd444"}},
+									{"name": "v4.2.1", "target": {"oid": "ddd444"}},
+									{"name": "v4.2.0", "target": {"oid": "currenthash"}}
+								],
+								"pageInfo": {
+									"hasNextPage": false,
+									"endCursor": ""
+								}
+							}
+						}
+					}
+				}`),
+			},
+			expected: UpgradeCandidates{
+				// v5 and v4.2 float along with the complete versions, so
+				// they are neither chosen nor counted
+				Latest:           Release{Version: "v5.0.0", CommitHash: "eee555"},
+				LatestCompatible: Release{Version: "v4.2.1", CommitHash: "ddd444"},
+				ReleasesBehind:   2,
 			},
 		},
 		"graphql error": {
 			targetRepo:     "owner/repo",
 			currentRelease: Release{Version: "v1.0.0", CommitHash: "currenthash"},
 			gqlEndpoints: map[string]httpResponse{
-				"d20dbd468b": okResponse(`{"errors": [{"message": "API error"}]}`),
+				"6104c8d776": okResponse(`{"errors": [{"message": "API error"}]}`),
 			},
 			expectError: errors.New("failed to gather candidate versions: graphql error: query errors: [{API error}]"),
 		},
@@ -325,8 +918,8 @@ func TestGetUpgradeCandidates(t *testing.T) {
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
-			client := newTestClient(t, tc.gqlEndpoints, nil)
-			candidates, err := client.GetUpgradeCandidates(testCtx(), tc.targetRepo, tc.currentRelease)
+			client := newTestClient(t, tc.gqlEndpoints, tc.restEndpoints)
+			candidates, err := client.GetUpgradeCandidates(testCtx(), tc.targetRepo, tc.currentRelease, tc.opts)
 			if tc.expectError != nil {
 				assert.Error(t, err, tc.expectError)
 			} else {
@@ -337,6 +930,346 @@ func TestGetUpgradeCandidates(t *testing.T) {
 	}
 }
 
+func TestGetUpgradeCandidatesConsistencyRetry(t *testing.T) {
+	t.Parallel()
+
+	const (
+		staleResp = `{"data": {"repository": {"releases": {"pageInfo": {"hasNextPage": false}, "nodes": [
+			{"tag": {"target": {"oid": "aaa111"}}, "tagName": "v1.0.0"}
+		]}}}}`
+		freshResp = `{"data": {"repository": {"releases": {"pageInfo": {"hasNextPage": false}, "nodes": [
+			{"tag": {"target": {"oid": "bbb222"}}, "tagName": "v1.1.0"},
+			{"tag": {"target": {"oid": "aaa111"}}, "tagName": "v1.0.0"}
+		]}}}}`
+	)
+	current := Release{Version: "v1.1.0", CommitHash: "bbb222"}
+	// while the current release is missing, it appears to be ahead of the
+	// latest stable release
+	stale := Release{Version: "v1.0.0", CommitHash: "aaa111"}
+
+	testCases := map[string]struct {
+		retries      int
+		staleCount   int
+		wantRequests int64
+		want         UpgradeCandidates
+	}{
+		"no retries": {
+			retries:      0,
+			staleCount:   1,
+			wantRequests: 1,
+			want:         UpgradeCandidates{CurrentUnreleased: true, LatestStable: stale},
+		},
+		"retries until consistent": {
+			retries:      3,
+			staleCount:   2,
+			wantRequests: 3,
+			want:         UpgradeCandidates{Latest: current, LatestCompatible: current},
+		},
+		"gives up after max retries": {
+			retries:      2,
+			staleCount:   10,
+			wantRequests: 3,
+			want:         UpgradeCandidates{CurrentUnreleased: true, LatestStable: stale},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var requests atomic.Int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if requests.Add(1) <= int64(tc.staleCount) {
+					fprintln(w, staleResp)
+				} else {
+					fprintln(w, freshResp)
+				}
+			}))
+			t.Cleanup(srv.Close)
+
+			client := NewGitHubClient("token", &http.Client{Transport: &fakeTransport{url: srv.URL}})
+			client.consistencyBackoff = time.Millisecond
+
+			got, err := client.GetUpgradeCandidates(testCtx(), "owner/repo", current, candidateOpts{ConsistencyRetries: tc.retries})
+			assert.NilError(t, err)
+			assert.Equal(t, got, tc.want, "incorrect candidates")
+			assert.Equal(t, requests.Load(), tc.wantRequests, "incorrect number of requests")
+		})
+	}
+}
+
+func TestRequestDeduplication(t *testing.T) {
+	t.Parallel()
+
+	const (
+		releasesResp = `{"data": {"repository": {"releases": {"pageInfo": {"hasNextPage": false}, "nodes": [
+			{"tag": {"target": {"oid": "ccc333"}}, "tagName": "v2.0.0"},
+			{"tag": {"target": {"oid": "bbb222"}}, "tagName": "v1.1.0"},
+			{"tag": {"target": {"oid": "aaa111"}}, "tagName": "v1.0.0"}
+		]}}}}`
+		tagsResp = `{"data": {"repository": {"refs": {"pageInfo": {"hasNextPage": false}, "nodes": [
+			{"name": "v2.0.0", "target": {"oid": "ccc333"}},
+			{"name": "v1.1.0", "target": {"target": {"oid": "bbb222"}}},
+			{"name": "v1", "target": {"oid": "bbb222"}},
+			{"name": "v1.0.0", "target": {"oid": "aaa111"}}
+		]}}}}`
+	)
+	var releaseRequests, tagRequests, restRequests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		body := must.ReadAll(t, r.Body)
+		switch {
+		case strings.Contains(body, "GetRepositoryReleases"):
+			releaseRequests.Add(1)
+			fprintln(w, releasesResp)
+		case strings.Contains(body, "GetVersionTagsForRef"):
+			tagRequests.Add(1)
+			fprintln(w, tagsResp)
+		default:
+			restRequests.Add(1)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client := NewGitHubClient("token", &http.Client{Transport: &fakeTransport{url: srv.URL}})
+
+	// steps using the same repo at different versions
+	for _, current := range []Release{
+		{Version: "v1.0.0", CommitHash: "aaa111"},
+		{Version: "v1.1.0", CommitHash: "bbb222"},
+		{Version: "v2.0.0", CommitHash: "ccc333"},
+	} {
+		candidates, err := client.GetUpgradeCandidates(testCtx(), "owner/repo", current, candidateOpts{})
+		assert.NilError(t, err)
+		assert.Equal(t, candidates.Latest.Version, "v2.0.0", "incorrect latest version")
+
+		tags, err := client.GetVersionTagsForCommitHash(testCtx(), "Owner/Repo", current.CommitHash)
+		assert.NilError(t, err)
+		assert.Equal(t, tags[0], current.Version, "incorrect version tags")
+	}
+	// version tags are resolved from the cached tags, without REST requests
+	commit, err := client.GetCommitHashForRef(testCtx(), "owner/repo", "v1")
+	assert.NilError(t, err)
+	assert.Equal(t, commit, "bbb222", "incorrect commit for ref")
+
+	assert.Equal(t, releaseRequests.Load(), int64(1), "releases should be fetched once")
+	assert.Equal(t, tagRequests.Load(), int64(1), "tags should be fetched once")
+	assert.Equal(t, restRequests.Load(), int64(0), "no REST requests expected")
+}
+
+func TestRetryOn5xx(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		maxRetries   int
+		statuses     []int // statuses to respond with before succeeding
+		wantRequests int64
+		wantErr      bool
+	}{
+		"retries disabled": {
+			maxRetries:   0,
+			statuses:     []int{http.StatusBadGateway},
+			wantRequests: 1,
+			wantErr:      true,
+		},
+		"retries until success": {
+			maxRetries:   3,
+			statuses:     []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+			wantRequests: 3,
+		},
+		"gives up after max retries": {
+			maxRetries:   2,
+			statuses:     []int{500, 500, 500, 500},
+			wantRequests: 3,
+			wantErr:      true,
+		},
+		"client errors are not retried": {
+			maxRetries:   3,
+			statuses:     []int{http.StatusNotFound},
+			wantRequests: 1,
+			wantErr:      true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			for _, kind := range []string{"rest", "graphql"} {
+				var requests atomic.Int64
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					if r.Method == http.MethodPost {
+						// the query must be replayed on every attempt
+						assert.Contains(t, must.ReadAll(t, r.Body), "query", "missing graphql query")
+					}
+					if n := requests.Add(1); n <= int64(len(tc.statuses)) {
+						w.WriteHeader(tc.statuses[n-1])
+						return
+					}
+					fprintln(w, `{"data": {"ok": true}, "ok": true}`)
+				}))
+				t.Cleanup(srv.Close)
+
+				client := NewGitHubClient("token", &http.Client{Transport: &fakeTransport{url: srv.URL}})
+				client.SetRetryOn5xx(tc.maxRetries)
+				client.retryBackoff = time.Millisecond
+
+				var (
+					target map[string]any
+					err    error
+				)
+				if kind == "rest" {
+					err = client.doREST(testCtx(), http.MethodGet, "/test", &target)
+				} else {
+					err = client.doGraphql(testCtx(), "query { ok }", nil, &target)
+				}
+				assert.Equal(t, err != nil, tc.wantErr, kind+": unexpected error: "+fmt.Sprint(err))
+				assert.Equal(t, requests.Load(), tc.wantRequests, kind+": incorrect number of requests")
+			}
+		})
+	}
+
+	t.Run("respects context cancellation", func(t *testing.T) {
+		t.Parallel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		t.Cleanup(srv.Close)
+
+		client := NewGitHubClient("token", &http.Client{Transport: &fakeTransport{url: srv.URL}})
+		client.SetRetryOn5xx(3)
+		client.retryBackoff = time.Hour
+
+		ctx, cancel := context.WithTimeout(testCtx(), 10*time.Millisecond)
+		defer cancel()
+		var target map[string]any
+		err := client.doREST(ctx, http.MethodGet, "/test", &target)
+		assert.Equal(t, errors.Is(err, context.DeadlineExceeded), true, "expected deadline exceeded, got "+fmt.Sprint(err))
+	})
+}
+
+func TestCandidateOptsDenies(t *testing.T) {
+	t.Parallel()
+
+	denied, err := parseDeniedVersions([]string{"owner/repo@4.2.0", "owner/repo@v1.0.0", "owner/repo@nightly"})
+	assert.NilError(t, err)
+	opts := candidateOpts{DeniedVersions: denied["owner/repo"]}
+	for version, want := range map[string]bool{
+		"v4.2.0":  true,
+		"4.2.0":   true,
+		"v1.0.0":  true,
+		"1.0.0":   true,
+		"nightly": true,
+		"v4.2.1":  false,
+		"v1":      false,
+	} {
+		assert.Equal(t, opts.denies(version), want, "incorrect denial of %s", version)
+	}
+}
+
+func TestIterAllReleases(t *testing.T) {
+	t.Parallel()
+
+	t.Run("stopping early", func(t *testing.T) {
+		t.Parallel()
+		client := newTestClient(t, map[string]httpResponse{
+			"6104c8d776": okResponse(`{
+				"data": {
+					"repository": {
+						"releases": {
+							"pageInfo": {"hasNextPage": true, "endCursor": "cursor1"},
+							"nodes": [
+								{"tag": {"target": {"oid": "aaa111"}}, "tagName": "v2.0.0"},
+								{"tag": {"target": {"oid": "bbb222"}}, "tagName": "v1.0.0"}
+							]
+						}
+					}
+				}
+			}`),
+			// the second page may or may not be prefetched before we stop
+			"b133fe855e": okResponse(`{
+				"data": {
+					"repository": {
+						"releases": {
+							"pageInfo": {"hasNextPage": false, "endCursor": ""},
+							"nodes": [
+								{"tag": {"target": {"oid": "ccc333"}}, "tagName": "v0.1.0"}
+							]
+						}
+					}
+				}
+			}`),
+		}, nil)
+
+		var got []publishedRelease
+		for release, err := range client.iterAllReleases(testCtx(), "owner/repo") {
+			assert.NilError(t, err)
+			got = append(got, release)
+			break
+		}
+		assert.DeepEqual(t, got, []publishedRelease{{Release: Release{Version: "v2.0.0", CommitHash: "aaa111"}}}, "incorrect releases")
+	})
+
+	t.Run("canceled context", func(t *testing.T) {
+		t.Parallel()
+		client := newTestClient(t, nil, nil)
+		ctx, cancel := context.WithCancel(testCtx())
+		cancel()
+
+		var gotErr error
+		for _, err := range client.iterAllReleases(ctx, "owner/repo") {
+			gotErr = err
+		}
+		assert.Error(t, gotErr, context.Canceled)
+	})
+
+	t.Run("forgotten sets stop fetching once unused", func(t *testing.T) {
+		t.Parallel()
+		client := newTestClient(t, map[string]httpResponse{
+			"6104c8d776": okResponse(`{
+				"data": {
+					"repository": {
+						"releases": {
+							"pageInfo": {"hasNextPage": true, "endCursor": "cursor1"},
+							"nodes": [{"tag": {"target": {"oid": "aaa111"}}, "tagName": "v2.0.0"}]
+						}
+					}
+				}
+			}`),
+			"b133fe855e": okResponse(`{
+				"data": {
+					"repository": {
+						"releases": {
+							"pageInfo": {"hasNextPage": false, "endCursor": ""},
+							"nodes": [{"tag": {"target": {"oid": "bbb222"}}, "tagName": "v1.0.0"}]
+						}
+					}
+				}
+			}`),
+		}, nil)
+
+		set, err := client.releaseSet(testCtx(), "owner/repo")
+		assert.NilError(t, err)
+		_, ok, err := set.get(testCtx(), 0)
+		assert.NilError(t, err)
+		assert.Equal(t, ok, true, "expected first release")
+
+		// a caller still iterating keeps the set alive
+		set.acquire()
+		client.forgetReleases()
+		assert.NilError(t, set.ctx.Err())
+		set.release()
+		assert.Error(t, set.ctx.Err(), context.Canceled)
+
+		// a new set is created for later callers
+		other, err := client.releaseSet(testCtx(), "owner/repo")
+		assert.NilError(t, err)
+		assert.Equal(t, other != set, true, "expected a new release set")
+		for _, err := range client.iterAllReleases(testCtx(), "owner/repo") {
+			assert.NilError(t, err)
+		}
+		assert.Error(t, other.ctx.Err(), context.Canceled)
+	})
+}
+
 func TestGetVersionTagsForHash(t *testing.T) {
 	t.Parallel()
 	tests := map[string]struct {
@@ -461,6 +1394,56 @@ func TestGetVersionTagsForHash(t *testing.T) {
 				"v1",
 			},
 		},
+		"tied tags": {
+			targetRepo: "owner/repo",
+			commitHash: "abcdef123456",
+			gqlEndpoints: map[string]httpResponse{
+				"2590b2f6ce": okResponse(`{
+					"data": {
+						"repository": {
+							"refs": {
+								"nodes": [
+									{
+										"name": "1.2.0",
+										"target": {
+											"oid": "abcdef123456"
+										}
+									},
+									{
+										"name": "v1.2.0+build.1",
+										"target": {
+											"oid": "abcdef123456"
+										}
+									},
+									{
+										"name": "v1.2.0-beta",
+										"target": {
+											"oid": "abcdef123456"
+										}
+									},
+									{
+										"name": "v1.2.0",
+										"target": {
+											"oid": "abcdef123456"
+										}
+									}
+								],
+								"pageInfo": {
+									"hasNextPage": false,
+									"endCursor": ""
+								}
+							}
+						}
+					}
+				}`),
+			},
+			expected: []string{
+				"v1.2.0",
+				"v1.2.0+build.1",
+				"1.2.0",
+				"v1.2.0-beta",
+			},
+		},
 		"multiple pages with tags": {
 			targetRepo: "owner/repo",
 			commitHash: "abcdef123456",
@@ -535,12 +1518,13 @@ func TestGetVersionTagsForHash(t *testing.T) {
 func TestGetCommitHashForRef(t *testing.T) {
 	t.Parallel()
 	tests := map[string]struct {
-		targetRepo      string
-		ref             string
-		restEndpoints   map[string]httpResponse
-		expectedCommit  string
-		expectError     error
-		expectedAPIURLs []string
+		targetRepo         string
+		ref                string
+		restEndpoints      map[string]httpResponse
+		expectedCommit     string
+		expectedVolatility Volatility
+		expectError        error
+		expectedAPIURLs    []string
 	}{
 		"invalid repo format": {
 			targetRepo:  "invalid-format",
@@ -558,7 +1542,8 @@ func TestGetCommitHashForRef(t *testing.T) {
 					}`,
 				},
 			},
-			expectedCommit: "0123456789abcdef0123456789abcdef01234567",
+			expectedCommit:     "0123456789abcdef0123456789abcdef01234567",
+			expectedVolatility: Immutable,
 		},
 		"short commit hash": {
 			targetRepo: "owner/repo",
@@ -571,7 +1556,8 @@ func TestGetCommitHashForRef(t *testing.T) {
 					}`,
 				},
 			},
-			expectedCommit: "0123456789abcdef0123456789abcdef01234567",
+			expectedCommit:     "0123456789abcdef0123456789abcdef01234567",
+			expectedVolatility: Immutable,
 		},
 		"branch name": {
 			targetRepo: "owner/repo",
@@ -587,7 +1573,8 @@ func TestGetCommitHashForRef(t *testing.T) {
 					}`,
 				},
 			},
-			expectedCommit: "0123456789abcdef0123456789abcdef01234567",
+			expectedCommit:     "0123456789abcdef0123456789abcdef01234567",
+			expectedVolatility: Volatile,
 		},
 		"tag name exists": {
 			targetRepo: "owner/repo",
@@ -607,7 +1594,53 @@ func TestGetCommitHashForRef(t *testing.T) {
 					}`,
 				},
 			},
-			expectedCommit: "0123456789abcdef0123456789abcdef01234567",
+			expectedCommit:     "0123456789abcdef0123456789abcdef01234567",
+			expectedVolatility: Mutable,
+		},
+		"pull request merge ref": {
+			targetRepo: "owner/repo",
+			ref:        "refs/pull/123/merge",
+			restEndpoints: map[string]httpResponse{
+				"GET /repos/owner/repo/git/ref/pull/123/merge": okResponse(`{
+					"object": {
+						"sha": "0123456789abcdef0123456789abcdef01234567",
+						"type": "commit"
+					}
+				}`),
+			},
+			expectedCommit:     "0123456789abcdef0123456789abcdef01234567",
+			expectedVolatility: Volatile,
+		},
+		"fully qualified annotated tag": {
+			targetRepo: "owner/repo",
+			ref:        "refs/tags/v1.0.0",
+			restEndpoints: map[string]httpResponse{
+				"GET /repos/owner/repo/git/ref/tags/v1.0.0": okResponse(`{
+					"object": {
+						"sha": "fedcba9876543210fedcba9876543210fedcba98",
+						"type": "tag"
+					}
+				}`),
+				"GET /repos/owner/repo/git/tags/fedcba9876543210fedcba9876543210fedcba98": okResponse(`{
+					"object": {
+						"sha": "0123456789abcdef0123456789abcdef01234567",
+						"type": "commit"
+					}
+				}`),
+			},
+			expectedCommit:     "0123456789abcdef0123456789abcdef01234567",
+			expectedVolatility: Mutable,
+		},
+		"fully qualified ref not found": {
+			targetRepo: "owner/repo",
+			ref:        "refs/pull/123/merge",
+			restEndpoints: map[string]httpResponse{
+				"GET /repos/owner/repo/git/ref/pull/123/merge": {
+					status: 404,
+					body:   `{"message": "Not Found"}`,
+				},
+			},
+			expectError: errors.New("failed to resolve reference refs/pull/123/merge: http error: 404 Not Found: {\"message\": \"Not Found\"}\n"),
 		},
 		"ref not found": {
 			targetRepo: "owner/repo",
@@ -636,6 +1669,136 @@ func TestGetCommitHashForRef(t *testing.T) {
 			}
 			assert.NilError(t, err)
 			assert.Equal(t, hash, tc.expectedCommit, "unexpected commit hash")
+			volatility, ok := client.refCache.Volatility(cacheKey(tc.targetRepo, tc.ref))
+			assert.Equal(t, ok, true, "expected cached ref")
+			assert.Equal(t, volatility, tc.expectedVolatility, "unexpected volatility")
+		})
+	}
+}
+
+func TestGetCommitHashForRefMixedCase(t *testing.T) {
+	t.Parallel()
+
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	client := newTestClient(t, nil, map[string]httpResponse{
+		"GET /repos/owner/repo/commits/" + commit: okResponse(`{"sha": "` + commit + `"}`),
+	})
+	// only the first lookup reaches the test server, which would fail for
+	// the mixed-case path, so the rest must be served from the cache
+	for _, repo := range []string{"owner/repo", "Owner/Repo", "OWNER/repo"} {
+		hash, err := client.GetCommitHashForRef(testCtx(), repo, commit)
+		assert.NilError(t, err)
+		assert.Equal(t, hash, commit, "unexpected commit hash for %s", repo)
+	}
+}
+
+func TestGetActionMetadataFile(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		action        Action
+		ref           string
+		restEndpoints map[string]httpResponse
+		expected      string
+		expectError   error
+	}{
+		"action.yml at repo root": {
+			action: Action{Name: "owner/repo"},
+			ref:    "abc123",
+			restEndpoints: map[string]httpResponse{
+				"GET /repos/owner/repo/contents/action.yml?ref=abc123": okResponse(`{
+					"encoding": "base64",
+					"content": "cnVuczoKICB1c2luZzog\nbm9kZTIwCg==\n"
+				}`),
+			},
+			expected: "runs:\n  using: node20\n",
+		},
+		"action.yaml in subdirectory": {
+			action: Action{Name: "owner/repo/path/to/action"},
+			ref:    "v1",
+			restEndpoints: map[string]httpResponse{
+				"GET /repos/owner/repo/contents/path/to/action/action.yml?ref=v1": errResponse(http.StatusNotFound, `{"message": "Not Found"}`),
+				"GET /repos/owner/repo/contents/path/to/action/action.yaml?ref=v1": okResponse(`{
+					"encoding": "base64",
+					"content": "cnVuczoKICB1c2luZzogY29tcG9zaXRlCg=="
+				}`),
+			},
+			expected: "runs:\n  using: composite\n",
+		},
+		"no metadata file": {
+			action: Action{Name: "owner/repo"},
+			ref:    "v1",
+			restEndpoints: map[string]httpResponse{
+				"GET /repos/owner/repo/contents/action.yml?ref=v1":  errResponse(http.StatusNotFound, `{"message": "Not Found"}`),
+				"GET /repos/owner/repo/contents/action.yaml?ref=v1": errResponse(http.StatusNotFound, `{"message": "Not Found"}`),
+			},
+			expectError: errors.New("no action.yml or action.yaml found for owner/repo at ref v1"),
+		},
+		"error other than not found": {
+			action: Action{Name: "owner/repo"},
+			ref:    "v1",
+			restEndpoints: map[string]httpResponse{
+				"GET /repos/owner/repo/contents/action.yml?ref=v1": errResponse(http.StatusUnprocessableEntity, `{"message": "Unprocessable"}`),
+			},
+			expectError: errors.New("failed to fetch action.yml: http error: 422 Unprocessable Entity: {\"message\": \"Unprocessable\"}\n"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := newTestClient(t, nil, tc.restEndpoints)
+			content, err := client.GetActionMetadataFile(testCtx(), tc.action, tc.ref)
+			if tc.expectError != nil {
+				assert.Error(t, err, tc.expectError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, content, tc.expected, "incorrect content")
+		})
+	}
+}
+
+func TestIsVerifiedCreator(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		owner     string
+		resp      httpResponse
+		expected  bool
+		expectErr bool
+	}{
+		"verified org": {
+			owner:    "actions",
+			resp:     okResponse(`{"login": "actions", "is_verified": true}`),
+			expected: true,
+		},
+		"unverified org": {
+			owner:    "actions",
+			resp:     okResponse(`{"login": "actions", "is_verified": false}`),
+			expected: false,
+		},
+		"user": {
+			owner:    "actions",
+			resp:     errResponse(http.StatusNotFound, `{"message": "Not Found"}`),
+			expected: false,
+		},
+		"error": {
+			owner:     "actions",
+			resp:      errResponse(http.StatusForbidden, `{"message": "Forbidden"}`),
+			expectErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := newTestClient(t, nil, map[string]httpResponse{"GET /orgs/" + tc.owner: tc.resp})
+			verified, err := client.IsVerifiedCreator(testCtx(), tc.owner)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, got none")
+				}
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, verified, tc.expected, "incorrect verification")
 		})
 	}
 }
@@ -686,6 +1849,138 @@ func TestValidateAuth(t *testing.T) {
 	}
 }
 
+func TestAuthTransportRefresh(t *testing.T) {
+	t.Parallel()
+
+	// the server only accepts the "fresh" token, and echoes back the request
+	// body
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = io.Copy(w, r.Body)
+	}))
+	t.Cleanup(srv.Close)
+
+	testCases := map[string]struct {
+		provider   func(ctx context.Context) (string, error)
+		wantStatus int
+		wantErr    string
+		wantCalls  int32
+	}{
+		"no provider": {
+			wantStatus: http.StatusUnauthorized,
+		},
+		"expired token is refreshed": {
+			provider:   func(context.Context) (string, error) { return "fresh", nil },
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		"unchanged token is genuinely invalid": {
+			provider:   func(context.Context) (string, error) { return "stale", nil },
+			wantStatus: http.StatusUnauthorized,
+			wantCalls:  1,
+		},
+		"still invalid after refresh": {
+			provider:   func(context.Context) (string, error) { return "bogus", nil },
+			wantStatus: http.StatusUnauthorized,
+			wantCalls:  1,
+		},
+		"provider error": {
+			provider:  func(context.Context) (string, error) { return "", errors.New("boom") },
+			wantErr:   "failed to refresh auth token: boom",
+			wantCalls: 1,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var calls atomic.Int32
+			client := NewGitHubClient("stale", nil)
+			if tc.provider != nil {
+				client.SetTokenProvider(func(ctx context.Context) (string, error) {
+					calls.Add(1)
+					return tc.provider(ctx)
+				})
+			}
+
+			req, err := http.NewRequestWithContext(testCtx(), http.MethodPost, srv.URL, strings.NewReader("payload"))
+			assert.NilError(t, err)
+			resp, err := client.httpClient.Do(req)
+			assert.Equal(t, calls.Load(), tc.wantCalls, "incorrect number of provider calls")
+			if tc.wantErr != "" {
+				if err == nil {
+					t.Fatal("expected error but got nil")
+				}
+				assert.Contains(t, err.Error(), tc.wantErr, "incorrect error")
+				return
+			}
+			assert.NilError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, resp.StatusCode, tc.wantStatus, "incorrect status")
+			if tc.wantStatus == http.StatusOK {
+				assert.Equal(t, must.ReadAll(t, resp.Body), "payload", "request body not replayed on retry")
+			}
+		})
+	}
+
+	t.Run("concurrent requests share one refresh", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int32
+		client := NewGitHubClient("stale", nil)
+		client.SetTokenProvider(func(context.Context) (string, error) {
+			calls.Add(1)
+			return "fresh", nil
+		})
+		auth := client.httpClient.Transport.(*authTransport)
+
+		// simulate a request that raced with another one which already
+		// refreshed the token
+		auth.token = "fresh"
+		token, err := auth.refreshToken(testCtx(), "stale")
+		assert.NilError(t, err)
+		assert.Equal(t, token, "fresh", "incorrect token")
+		assert.Equal(t, calls.Load(), int32(0), "provider should not be called")
+	})
+}
+
+func TestAuthTransportHostTokens(t *testing.T) {
+	t.Parallel()
+
+	// the fake "proxy" echoes back the host and credential of each request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fprintf(w, "%s %s", r.URL.Host, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(proxy.Close)
+
+	httpClient, err := newHTTPClient(proxy.URL, "", nil)
+	assert.NilError(t, err)
+	client := NewGitHubClient("default-token", httpClient)
+	client.SetHostToken("GHES.example.com", "ghes-token")
+	client.SetTokenProvider(func(context.Context) (string, error) {
+		t.Error("host tokens should never be refreshed")
+		return "", nil
+	})
+
+	testCases := map[string]string{
+		"http://api.github.com/user":           "api.github.com Bearer default-token",
+		"http://ghes.example.com/api/v3/user":  "ghes.example.com Bearer ghes-token",
+		"http://ghes.example.com:8080/api/v3/": "ghes.example.com:8080 Bearer ghes-token",
+	}
+	for url, want := range testCases {
+		t.Run(url, func(t *testing.T) {
+			t.Parallel()
+			req, err := http.NewRequestWithContext(testCtx(), http.MethodGet, url, nil)
+			assert.NilError(t, err)
+			resp, err := client.httpClient.Do(req)
+			assert.NilError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, must.ReadAll(t, resp.Body), want, "incorrect credential for host")
+		})
+	}
+}
+
 func TestReleaseExists(t *testing.T) {
 	t.Parallel()
 	var (
@@ -752,6 +2047,16 @@ func TestChooseNewestRelease(t *testing.T) {
 			b:        Release{Version: "v1.0.0", CommitHash: "def"},
 			expected: Release{Version: "v1.0.0", CommitHash: "def"},
 		},
+		"same version (complete a wins over floating b)": {
+			a:        Release{Version: "v5.0.0", CommitHash: "abc"},
+			b:        Release{Version: "v5", CommitHash: "abc"},
+			expected: Release{Version: "v5.0.0", CommitHash: "abc"},
+		},
+		"same version (complete b wins over floating a)": {
+			a:        Release{Version: "v4.2", CommitHash: "abc"},
+			b:        Release{Version: "v4.2.0", CommitHash: "abc"},
+			expected: Release{Version: "v4.2.0", CommitHash: "abc"},
+		},
 	}
 	for name, tc := range releaseCases {
 		t.Run(name, func(t *testing.T) {
@@ -796,6 +2101,9 @@ func newTestClient(t testing.TB, graphqlEndpoints map[string]httpResponse, restE
 			if !ok {
 				t.Fatalf("no response for rest request %q", sig)
 			}
+			for k, v := range resp.header {
+				w.Header()[k] = v
+			}
 			w.Header().Set("Content-Type", "application/json")
 			if resp.status != 0 {
 				w.WriteHeader(resp.status)
@@ -838,12 +2146,149 @@ func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 type httpResponse struct {
 	status int
 	body   string
+	header http.Header
 }
 
 func okResponse(body string) httpResponse {
-	return httpResponse{http.StatusOK, body}
+	return httpResponse{status: http.StatusOK, body: body}
 }
 
 func errResponse(code int, body string) httpResponse {
-	return httpResponse{code, body}
+	return httpResponse{status: code, body: body}
+}
+
+func TestParseHeaders(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		values  []string
+		want    http.Header
+		wantErr error
+	}{
+		"empty": {
+			values: nil,
+			want:   http.Header{},
+		},
+		"multiple headers": {
+			values: []string{"X-Waf-Token: abc123", "x-team:platform", "X-Team: infra"},
+			want: http.Header{
+				"X-Waf-Token": {"abc123"},
+				"X-Team":      {"platform", "infra"},
+			},
+		},
+		"missing separator": {
+			values:  []string{"X-Waf-Token abc123"},
+			wantErr: errors.New(`invalid header "X-Waf-Token abc123": must be in "Name: value" format`),
+		},
+		"missing name": {
+			values:  []string{": abc123"},
+			wantErr: errors.New(`invalid header ": abc123": must be in "Name: value" format`),
+		},
+		"authorization not allowed": {
+			values:  []string{"authorization: Bearer abc"},
+			wantErr: errors.New(`invalid header "authorization: Bearer abc": use --github-token to configure authentication`),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseHeaders(tc.values)
+			if tc.wantErr != nil {
+				assert.Error(t, err, tc.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tc.want, "incorrect headers")
+		})
+	}
+}
+
+func TestParseProxyURL(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		value   string
+		wantErr error
+	}{
+		"http proxy":   {value: "http://proxy.corp.example:3128"},
+		"socks5 proxy": {value: "socks5://127.0.0.1:1080"},
+		"missing scheme": {
+			value:   "proxy.corp.example:3128",
+			wantErr: errors.New(`invalid proxy URL "proxy.corp.example:3128": scheme must be one of http, https, or socks5`),
+		},
+		"missing host": {
+			value:   "http://",
+			wantErr: errors.New(`invalid proxy URL "http://": missing host`),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := parseProxyURL(tc.value)
+			if tc.wantErr != nil {
+				assert.Error(t, err, tc.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+		})
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	// the fake "proxy" receives the absolute-form request meant for GitHub and
+	// echoes back the details we care about
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fprintf(w, "%s %s %s %s", r.URL.Host, r.Header.Get("Authorization"), r.Header.Get("X-Waf-Token"), r.Header.Get("User-Agent"))
+	}))
+	t.Cleanup(proxy.Close)
+
+	testCases := map[string]struct {
+		userAgent string
+		headers   []string
+		want      string
+	}{
+		"user agent and extra headers": {
+			userAgent: "ghavm/v1.2.3",
+			headers:   []string{"X-Waf-Token: abc123"},
+			want:      "api.github.com Bearer token abc123 ghavm/v1.2.3",
+		},
+		"user agent overridden by header": {
+			userAgent: "ghavm/v1.2.3",
+			headers:   []string{"User-Agent: my-proxy-agent"},
+			want:      "api.github.com Bearer token  my-proxy-agent",
+		},
+		"default go user agent": {
+			want: "api.github.com Bearer token  Go-http-client/1.1",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			httpClient, err := newHTTPClient(proxy.URL, tc.userAgent, tc.headers)
+			assert.NilError(t, err)
+			client := NewGitHubClient("token", httpClient)
+
+			req, err := http.NewRequestWithContext(testCtx(), http.MethodGet, "http://api.github.com/rate_limit", nil)
+			assert.NilError(t, err)
+			resp, err := client.httpClient.Do(req)
+			assert.NilError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, must.ReadAll(t, resp.Body), tc.want, "incorrect request seen by proxy")
+		})
+	}
+}
+
+func TestDefaultUserAgent(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"ghavm version v1.2.3 abc123 go1.24.0 (built 2025-01-01)": "ghavm/v1.2.3",
+		"ghavm version dev unknown go1.24.0 (built unknown)":      "ghavm/dev",
+		"test version": "ghavm",
+	}
+	for versionInfo, want := range testCases {
+		t.Run(versionInfo, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, defaultUserAgent(versionInfo), want, "incorrect user agent")
+		})
+	}
 }
@@ -0,0 +1,220 @@
+package ghavm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mccutchen/ghavm/internal/slogctx"
+)
+
+// gitMirror resolves refs, tags, and commits from local clones of action
+// repos instead of the GitHub API, for environments where the API is
+// unavailable or rate limits are tight.
+//
+// Repos are looked up under the mirror's directory as <owner>/<repo> or
+// <owner>/<repo>.git, so both regular clones and bare mirrors (e.g. from
+// `git clone --mirror`) are supported. Repos missing from the mirror are
+// resolved via the API as usual.
+//
+// Git has no notion of releases, so the complete version tags in a mirrored
+// repo stand in for its releases, dated by their tag (or commit) dates. Like
+// version tags found via the API, they are marked as tag-only, since none of
+// them is known to have been published as a release. Signatures cannot be
+// verified locally, so no mirrored release is considered verified.
+type gitMirror struct {
+	dir string
+}
+
+// repoDir returns the local clone of the given repo, if the mirror has one.
+// It is safe to call on a nil mirror.
+func (m *gitMirror) repoDir(targetRepo string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	owner, repo, ok := strings.Cut(targetRepo, "/")
+	if !ok || !isMirrorPathElem(owner) || !isMirrorPathElem(repo) {
+		return "", false
+	}
+	// owner and repo names are case-insensitive on GitHub, so we also try
+	// the canonical lowercase names
+	for _, name := range []string{targetRepo, canonicalName(owner + "/" + repo)} {
+		for _, candidate := range []string{name, name + ".git"} {
+			dir := filepath.Join(m.dir, filepath.FromSlash(candidate))
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				return dir, true
+			}
+		}
+	}
+	return "", false
+}
+
+// isMirrorPathElem returns true if the owner or repo name may safely be
+// joined to the mirror's directory, i.e. it is neither empty nor a relative
+// path element, and contains no path separators that could escape the mirror.
+func isMirrorPathElem(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// git runs a git command in the given repo dir, returning its stdout.
+func (m *gitMirror) git(ctx context.Context, dir string, args ...string) (string, error) {
+	slogctx.Debug(ctx, "gitmirror: running git", "dir", dir, "args", args)
+	// #nosec G204 -- args are built by ghavm, not taken from user input
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// mirrorTagFormat is the for-each-ref format used to list tags, which gives
+// the commits that annotated tags point to via the "*" (peeled) fields.
+const mirrorTagFormat = "%(refname:strip=2)%00%(objecttype)%00%(objectname)%00%(*objecttype)%00%(*objectname)%00%(creatordate:iso-strict)"
+
+// versionTags returns every semver tag in the repo, newest first, along with
+// the time each tag was created.
+func (m *gitMirror) versionTags(ctx context.Context, dir string) ([]publishedRelease, error) {
+	out, err := m.git(ctx, dir, "for-each-ref", "--format="+mirrorTagFormat, "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	var tags []publishedRelease
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 6 || !isValidVersion(fields[0]) {
+			continue
+		}
+		// use the direct commit (for "lightweight" tags) or the peeled
+		// commit (for "annotated" tags)
+		commit := ""
+		switch {
+		case fields[1] == "commit":
+			commit = fields[2]
+		case fields[3] == "commit":
+			commit = fields[4]
+		default:
+			continue
+		}
+		created, _ := time.Parse(time.RFC3339, fields[5])
+		tags = append(tags, publishedRelease{
+			Release:     Release{Version: fields[0], CommitHash: commit},
+			PublishedAt: created,
+		})
+	}
+	// newest first, like releases from the API
+	slices.SortStableFunc(tags, func(a, b publishedRelease) int {
+		return compareVersions(b.Version, a.Version)
+	})
+	return tags, nil
+}
+
+// releases returns the version tags in the repo that stand in for releases,
+// newest first, marked as tag-only like the version tags found via the API.
+// Floating tags (e.g. v4) are never published as releases, so only complete
+// versions are included.
+func (m *gitMirror) releases(ctx context.Context, dir string) ([]publishedRelease, error) {
+	tags, err := m.versionTags(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	tags = slices.DeleteFunc(tags, func(r publishedRelease) bool {
+		return !isCompleteVersion(r.Version)
+	})
+	for i := range tags {
+		tags[i].TagOnly = true
+	}
+	return tags, nil
+}
+
+// commitHashForRef resolves a (possibly shortened) commit hash, branch name,
+// or tag name to a full commit hash, checking in that order like
+// [GitHubClient.GetCommitHashForRef]. Branches are found among local
+// branches (e.g. in a bare mirror) and origin's remote branches (e.g. in a
+// regular clone). A fully qualified ref (e.g. refs/pull/123/merge) is only
+// resolved as given.
+func (m *gitMirror) commitHashForRef(ctx context.Context, dir string, ref string) (string, error) {
+	var candidates []string
+	if isHex(ref) {
+		candidates = append(candidates, ref)
+	}
+	candidates = append(candidates, "refs/heads/"+ref, "refs/remotes/origin/"+ref, "refs/tags/"+ref)
+	if isQualifiedRef(ref) {
+		candidates = []string{ref}
+	}
+	for _, candidate := range candidates {
+		out, err := m.git(ctx, dir, "rev-parse", "--verify", "--quiet", "--end-of-options", candidate+"^{commit}")
+		if err != nil {
+			continue
+		}
+		commit := strings.TrimSpace(out)
+		// a hex ref may also be a branch or tag name that rev-parse would
+		// happily resolve, so it only counts as a commit hash if it is a
+		// prefix of the resolved hash
+		if candidate == ref && isHex(ref) && !strings.HasPrefix(commit, strings.ToLower(ref)) {
+			continue
+		}
+		return commit, nil
+	}
+	return "", fmt.Errorf("failed to resolve reference %s", ref)
+}
+
+// commitObject returns the tree hash and committer date of the given commit.
+func (m *gitMirror) commitObject(ctx context.Context, dir string, commitHash string) (gitCommitObjectResponse, error) {
+	out, err := m.git(ctx, dir, "show", "--no-patch", "--format=%T%n%cI", "--end-of-options", commitHash+"^{commit}")
+	if err != nil {
+		return gitCommitObjectResponse{}, err
+	}
+	tree, date, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	var commit gitCommitObjectResponse
+	commit.Tree.SHA = tree
+	commit.Committer.Date, err = time.Parse(time.RFC3339, date)
+	if err != nil {
+		return gitCommitObjectResponse{}, fmt.Errorf("invalid committer date for commit %s: %w", commitHash, err)
+	}
+	return commit, nil
+}
+
+// actionMetadataFile returns the contents of the action.yml (or action.yaml)
+// metadata file defining the given action at the given ref.
+func (m *gitMirror) actionMetadataFile(ctx context.Context, dir string, action Action, ref string) (string, error) {
+	for _, filename := range []string{"action.yml", "action.yaml"} {
+		filePath := path.Join(action.Path(), filename)
+		out, err := m.git(ctx, dir, "show", "--end-of-options", ref+":"+filePath)
+		if err != nil {
+			slogctx.Debug(ctx, "gitmirror: action metadata file not found", "action", action.Name, "path", filePath, "error", err)
+			continue
+		}
+		return out, nil
+	}
+	return "", fmt.Errorf("no action.yml or action.yaml found for %s at ref %s", action.Name, ref)
+}
+
+// validateGitMirror checks that the given --git-mirror directory exists and
+// that git is available to read it.
+func validateGitMirror(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return errors.New("git must be installed to use a git mirror")
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package ghavm
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+// newTestMirror creates a git mirror containing a single owner/repo clone
+// with the following history, returning the mirror dir and the commits:
+//
+//	commit 1: v1.0.0 (lightweight), v1
+//	commit 2: v1.1.0 (annotated), main branch
+//	commit 3: v2.0.0 (annotated), not-a-version tag
+func newTestMirror(t *testing.T) (string, []string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	mirror := t.TempDir()
+	dir := filepath.Join(mirror, "owner", "repo")
+	assert.NilError(t, os.MkdirAll(dir, 0o700))
+
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		stamp := date.Format(time.RFC3339)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_AUTHOR_DATE="+stamp,
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com", "GIT_COMMITTER_DATE="+stamp,
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %s\n%s", args[0], err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(content string) string {
+		t.Helper()
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, "action.yml"), []byte(content), 0o600))
+		git("add", "action.yml")
+		git("commit", "--quiet", "--message", content)
+		date = date.Add(24 * time.Hour)
+		return git("rev-parse", "HEAD")
+	}
+
+	git("init", "--quiet", "--initial-branch=main")
+	commits := []string{commit("runs:\n  using: node16\n")}
+	git("tag", "v1.0.0")
+	git("tag", "v1")
+	commits = append(commits, commit("runs:\n  using: node20\n"))
+	git("tag", "--annotate", "--message", "v1.1.0", "v1.1.0")
+	git("branch", "release")
+	commits = append(commits, commit("runs:\n  using: node24\n"))
+	git("tag", "--annotate", "--message", "v2.0.0", "v2.0.0")
+	git("tag", "not-a-version")
+	// leave main behind the newest commit
+	git("reset", "--quiet", "--hard", commits[1])
+	git("tag", "--annotate", "--message", "unrelated", "also-not-a-version")
+	return mirror, commits
+}
+
+func TestGitMirror(t *testing.T) {
+	t.Parallel()
+
+	mirrorDir, commits := newTestMirror(t)
+	newClient := func(t *testing.T) *GitHubClient {
+		// any API request fails the test, so everything must be resolved
+		// from the mirror
+		client := newTestClient(t, nil, nil)
+		client.SetGitMirror(mirrorDir)
+		return client
+	}
+
+	t.Run("refs", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t)
+		for ref, want := range map[string]string{
+			"v1.0.0":           commits[0],
+			"v1":               commits[0],
+			"v1.1.0":           commits[1],
+			"main":             commits[1],
+			"release":          commits[1],
+			"v2.0.0":           commits[2],
+			commits[2][:7]:     commits[2],
+			commits[0]:         commits[0],
+			"not-a-version":    commits[2],
+			"refs/heads/main":  commits[1],
+			"refs/tags/v1.1.0": commits[1],
+		} {
+			got, err := client.GetCommitHashForRef(testCtx(), "Owner/Repo", ref)
+			assert.NilError(t, err)
+			assert.Equal(t, got, want, "incorrect commit for ref "+ref)
+		}
+		_, err := client.GetCommitHashForRef(testCtx(), "owner/repo", "missing")
+		assert.Error(t, err, errors.New("failed to resolve reference missing"))
+		// fully qualified refs are not guessed at
+		_, err = client.GetCommitHashForRef(testCtx(), "owner/repo", "refs/release")
+		assert.Error(t, err, errors.New("failed to resolve reference refs/release"))
+	})
+
+	t.Run("version tags", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t)
+		tags, err := client.GetVersionTagsForCommitHash(testCtx(), "owner/repo", commits[0])
+		assert.NilError(t, err)
+		assert.DeepEqual(t, tags, []string{"v1.0.0", "v1"}, "incorrect version tags")
+		tags, err = client.GetVersionTagsForCommitHash(testCtx(), "owner/repo", commits[2])
+		assert.NilError(t, err)
+		assert.DeepEqual(t, tags, []string{"v2.0.0"}, "incorrect version tags")
+	})
+
+	t.Run("upgrade candidates", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t)
+		current := Release{Version: "v1.0.0", CommitHash: commits[0]}
+		got, err := client.GetUpgradeCandidates(testCtx(), "owner/repo", current, candidateOpts{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, got, UpgradeCandidates{
+			Latest:           Release{Version: "v2.0.0", CommitHash: commits[2]},
+			LatestCompatible: Release{Version: "v1.1.0", CommitHash: commits[1]},
+			ReleasesBehind:   2,
+			// like a version tag found via the API, the current version is
+			// not known to have been published as a release
+			CurrentUnreleased: true,
+		}, "incorrect upgrade candidates")
+
+		// tags are dated like releases, so as-of resolution works too (each
+		// annotated tag is created a day after its commit)
+		asOf := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+		got, err = client.GetUpgradeCandidates(testCtx(), "owner/repo", current, candidateOpts{AsOf: asOf})
+		assert.NilError(t, err)
+		assert.Equal(t, got.Latest.Version, "v1.1.0", "incorrect latest version as of "+asOf.String())
+	})
+
+	t.Run("commits", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t)
+		date, err := client.GetCommitDate(testCtx(), "owner/repo", commits[1])
+		assert.NilError(t, err)
+		assert.Equal(t, date.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)), true, "incorrect commit date "+date.String())
+		tree, err := client.GetTreeHashForCommit(testCtx(), "owner/repo", commits[1])
+		assert.NilError(t, err)
+		assert.Equal(t, isFullCommitHash(tree), true, "incorrect tree hash "+tree)
+		exists, err := client.RepoExists(testCtx(), "owner/repo")
+		assert.NilError(t, err)
+		assert.Equal(t, exists, true, "mirrored repo should exist")
+	})
+
+	t.Run("action metadata", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t)
+		content, err := client.GetActionMetadataFile(testCtx(), Action{Name: "owner/repo"}, commits[0])
+		assert.NilError(t, err)
+		assert.Equal(t, parseActionRuntime(content), "node16", "incorrect runtime")
+	})
+
+	t.Run("repo names cannot escape the mirror", func(t *testing.T) {
+		t.Parallel()
+		m := &gitMirror{dir: filepath.Join(mirrorDir, "owner")}
+		_, ok := m.repoDir("owner/repo")
+		assert.Equal(t, ok, false, "owner/repo should not be found under owner")
+		for _, name := range []string{"../owner", "./repo", "owner/..", "..\\owner", "/repo", "owner/"} {
+			_, ok := m.repoDir(name)
+			assert.Equal(t, ok, false, "invalid repo name should be rejected: "+name)
+		}
+		_, ok = (&gitMirror{dir: mirrorDir}).repoDir("owner/repo")
+		assert.Equal(t, ok, true, "valid repo should be found")
+	})
+
+	t.Run("repos missing from the mirror use the API", func(t *testing.T) {
+		t.Parallel()
+		client := newTestClient(t, nil, map[string]httpResponse{
+			"GET /repos/other/repo": okResponse(`{}`),
+		})
+		client.SetGitMirror(mirrorDir)
+		exists, err := client.RepoExists(testCtx(), "other/repo")
+		assert.NilError(t, err)
+		assert.Equal(t, exists, true, "repo should exist")
+	})
+}
@@ -0,0 +1,159 @@
+package ghavm
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// outputHTML is the HTML output format for list, a self-contained drift
+// report meant to be shared with people who don't use ghavm themselves.
+const outputHTML = "html"
+
+// driftUnresolved is the drift of an entry whose current version could not be
+// resolved, which therefore cannot be compared with the latest release.
+const driftUnresolved = "unresolved"
+
+// drift returns how far the entry's current version has drifted behind the
+// latest release, as a [ChangeLevel] or [driftUnresolved].
+func (e InventoryEntry) drift() string {
+	if e.Commit == "" {
+		return driftUnresolved
+	}
+	if !e.hasUpgrade() {
+		return string(ChangeNone)
+	}
+	current := Release{Version: e.Version, CommitHash: e.Commit}
+	latest := Release{Version: e.LatestVersion, CommitHash: e.LatestCommit}
+	return string(classifyChange(current, latest))
+}
+
+// htmlDriftOrder ranks drift levels from most to least severe, which is the
+// order in which the report summarizes them and sorts its drift column.
+var htmlDriftOrder = []string{
+	string(ChangeMajor),
+	string(ChangeMinor),
+	string(ChangePatch),
+	string(ChangeUnknown),
+	driftUnresolved,
+	string(ChangeNone),
+}
+
+type htmlReportRow struct {
+	InventoryEntry
+	Drift     string
+	DriftRank int
+}
+
+type htmlReportCount struct {
+	Drift string
+	Count int
+}
+
+type htmlReport struct {
+	Rows    []htmlReportRow
+	Summary []htmlReportCount
+}
+
+// writeHTMLReport writes a self-contained HTML page describing the given
+// inventory to dst, with a table of every action step that can be sorted by
+// clicking its column headers and whose rows are colored by drift.
+func writeHTMLReport(dst io.Writer, inv Inventory) error {
+	report := htmlReport{Rows: make([]htmlReportRow, 0, len(inv.Actions))}
+	counts := make(map[string]int, len(htmlDriftOrder))
+	for _, entry := range inv.Actions {
+		drift := entry.drift()
+		counts[drift]++
+		report.Rows = append(report.Rows, htmlReportRow{
+			InventoryEntry: entry,
+			Drift:          drift,
+			DriftRank:      driftRank(drift),
+		})
+	}
+	for _, drift := range htmlDriftOrder {
+		if counts[drift] > 0 {
+			report.Summary = append(report.Summary, htmlReportCount{drift, counts[drift]})
+		}
+	}
+	if err := htmlReportTemplate.Execute(dst, report); err != nil {
+		return fmt.Errorf("failed to write html report: %w", err)
+	}
+	return nil
+}
+
+// driftRank returns the position of the given drift in [htmlDriftOrder].
+func driftRank(drift string) int {
+	for i, d := range htmlDriftOrder {
+		if d == drift {
+			return i
+		}
+	}
+	return len(htmlDriftOrder)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"short": func(commit string) string {
+		if len(commit) > minShortHashLength {
+			return commit[:minShortHashLength]
+		}
+		return commit
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ghavm drift report</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1f2328; }
+h1 { font-size: 1.5em; }
+.summary span { display: inline-block; margin-right: 0.5em; padding: 0.2em 0.6em; border-radius: 1em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: 0.4em 0.8em; border-bottom: 1px solid #d0d7de; text-align: left; }
+th { cursor: pointer; user-select: none; background: #f6f8fa; }
+th[aria-sort="ascending"]::after { content: " \25b2"; }
+th[aria-sort="descending"]::after { content: " \25bc"; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; }
+.drift-major { background: #ffebe9; }
+.drift-minor { background: #fff1e5; }
+.drift-patch { background: #fff8c5; }
+.drift-unknown, .drift-unresolved { background: #eaeef2; }
+.drift-none { background: #dafbe1; }
+</style>
+</head>
+<body>
+<h1>ghavm drift report</h1>
+<p class="summary">{{len .Rows}} action(s):{{range .Summary}} <span class="drift-{{.Drift}}">{{.Count}} {{.Drift}}</span>{{end}}</p>
+<table>
+<thead>
+<tr><th>Workflow</th><th data-type="number">Line</th><th>Action</th><th>Ref</th><th>Version</th><th>Commit</th><th>Latest</th><th data-type="number">Drift</th></tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr class="drift-{{.Drift}}"><td>{{.Workflow}}</td><td data-value="{{.Line}}">{{.Line}}</td><td>{{.Action}}</td><td><code>{{.Ref}}</code></td><td>{{.Version}}</td><td><code title="{{.Commit}}">{{short .Commit}}</code></td><td>{{.LatestVersion}}</td><td data-value="{{.DriftRank}}">{{.Drift}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+document.querySelectorAll("th").forEach(function (th, col) {
+  th.addEventListener("click", function () {
+    var tbody = th.closest("table").tBodies[0];
+    var asc = th.getAttribute("aria-sort") !== "ascending";
+    var numeric = th.dataset.type === "number";
+    var value = function (row) {
+      var td = row.cells[col];
+      return numeric ? Number(td.dataset.value) : td.textContent;
+    };
+    var rows = Array.from(tbody.rows).sort(function (a, b) {
+      var x = value(a), y = value(b);
+      var cmp = numeric ? x - y : x.localeCompare(y);
+      return asc ? cmp : -cmp;
+    });
+    th.parentNode.querySelectorAll("th").forEach(function (h) { h.removeAttribute("aria-sort"); });
+    th.setAttribute("aria-sort", asc ? "ascending" : "descending");
+    rows.forEach(function (row) { tbody.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
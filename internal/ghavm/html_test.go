@@ -0,0 +1,83 @@
+package ghavm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestInventoryEntryDrift(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		entry InventoryEntry
+		want  string
+	}{
+		"unresolved": {
+			entry: InventoryEntry{Version: "v1"},
+			want:  driftUnresolved,
+		},
+		"up to date": {
+			entry: InventoryEntry{Version: "v1.2.3", Commit: "c1", LatestVersion: "v1.2.3", LatestCommit: "c1"},
+			want:  string(ChangeNone),
+		},
+		"no latest release": {
+			entry: InventoryEntry{Version: "v1.2.3", Commit: "c1"},
+			want:  string(ChangeNone),
+		},
+		"patch": {
+			entry: InventoryEntry{Version: "v1.2.3", Commit: "c1", LatestVersion: "v1.2.4", LatestCommit: "c2"},
+			want:  string(ChangePatch),
+		},
+		"major": {
+			entry: InventoryEntry{Version: "v1.2.3", Commit: "c1", LatestVersion: "v2.0.0", LatestCommit: "c2"},
+			want:  string(ChangeMajor),
+		},
+		"not semver": {
+			entry: InventoryEntry{Version: "main", Commit: "c1", LatestVersion: "v2.0.0", LatestCommit: "c2"},
+			want:  string(ChangeUnknown),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.entry.drift(), tc.want, "incorrect drift")
+		})
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	t.Parallel()
+
+	inv := Inventory{Actions: []InventoryEntry{
+		{
+			Workflow:      ".github/workflows/ci.yaml",
+			Line:          5,
+			Action:        "actions/checkout",
+			Ref:           "v4",
+			Version:       "v4.1.0",
+			Commit:        "8ade135a41bc03ea155e62e844d188df1ea18608",
+			LatestVersion: "v5.0.0",
+			LatestCommit:  "08c6903cd8c0fde910a37f88322edcfb5dd907a8",
+		},
+		{
+			Workflow: ".github/workflows/ci.yaml",
+			Line:     9,
+			Action:   "owner/<repo>",
+			Ref:      "main",
+		},
+	}}
+	var buf strings.Builder
+	assert.NilError(t, writeHTMLReport(&buf, inv))
+	got := buf.String()
+
+	assert.Contains(t, got, "<!DOCTYPE html>", "missing doctype")
+	assert.Contains(t, got, "<style>", "missing embedded css")
+	assert.Contains(t, got, "<script>", "missing sort script")
+	assert.Contains(t, got, "2 action(s):", "missing action count")
+	assert.Contains(t, got, `<span class="drift-major">1 major</span> <span class="drift-unresolved">1 unresolved</span>`, "incorrect summary")
+	assert.Contains(t, got, `<tr class="drift-major"><td>.github/workflows/ci.yaml</td><td data-value="5">5</td><td>actions/checkout</td>`, "missing outdated row")
+	assert.Contains(t, got, `<code title="8ade135a41bc03ea155e62e844d188df1ea18608">8ade135</code>`, "missing short commit")
+	assert.Contains(t, got, "owner/&lt;repo&gt;", "action name not escaped")
+}
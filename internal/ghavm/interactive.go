@@ -0,0 +1,256 @@
+package ghavm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// upgradeChoice tracks the upgrade chosen for a single step in interactive
+// mode.
+type upgradeChoice struct {
+	workflow Workflow
+	step     Step
+	// compat and latest are the available upgrade targets, either of which
+	// may be missing
+	compat Release
+	latest Release
+	// useLatest targets the latest release instead of the compat release
+	useLatest bool
+	selected  bool
+}
+
+// option returns the currently targeted upgrade, whether or not the choice
+// is selected.
+func (c upgradeChoice) option() Release {
+	if c.useLatest {
+		return c.latest
+	}
+	return c.compat
+}
+
+// target returns the release to upgrade to, or an empty release if the
+// choice is not selected.
+func (c upgradeChoice) target() Release {
+	if !c.selected {
+		return Release{}
+	}
+	return c.option()
+}
+
+// choiceKey identifies a step within a workflow.
+type choiceKey struct {
+	path string
+	line int
+}
+
+// interactiveHelp lists the commands accepted at the interactive prompt.
+const interactiveHelp = "commands: <n> toggle, c <n> target compat, l <n> target latest, a select all, n select none, y apply, q quit"
+
+// Interactive resolves upgrade candidates for each step and then lets the
+// user choose which steps to upgrade, and to which version, by prompting
+// for one command per line from in, re-listing the upgrades after each. This
+// is a plain line-based prompt rather than a full-screen UI, so it works with
+// any terminal and can be scripted in tests. The chosen upgrades are applied once the user confirms,
+// with every other step pinned to its current version, and nothing is
+// changed if they quit or in reaches EOF first.
+//
+// The given mode determines which upgrades are initially selected. In dry
+// run mode, the planned changes are written to dst instead.
+func (e *Engine) Interactive(ctx context.Context, in io.Reader, dst io.Writer, mode PinMode) error {
+	if err := e.resolveSteps(ctx, mode); err != nil {
+		return fmt.Errorf("failed to resolve commit refs: %w", err)
+	}
+	return e.chooseUpgrades(ctx, in, dst, mode)
+}
+
+// chooseUpgrades runs the interactive prompt over already-resolved steps.
+func (e *Engine) chooseUpgrades(ctx context.Context, in io.Reader, dst io.Writer, mode PinMode) error {
+	choices := e.upgradeChoices(mode)
+	out := e.phaseLog.out
+	if len(choices) == 0 {
+		fprintln(out, e.style.Green("✓ all actions are up to date"))
+		return nil
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		e.renderChoices(out, choices)
+		fprint(out, "> ")
+		if !scanner.Scan() {
+			fprintln(out)
+			fprintln(out, "no changes made")
+			return scanner.Err()
+		}
+		cmd := strings.Fields(scanner.Text())
+		if len(cmd) == 0 {
+			continue
+		}
+		switch cmd[0] {
+		case "y":
+			return e.applyChoices(ctx, dst, choices)
+		case "q":
+			fprintln(out, "no changes made")
+			return nil
+		case "a", "n":
+			for i := range choices {
+				choices[i].selected = cmd[0] == "a"
+			}
+		case "c", "l":
+			c, err := lookupChoice(choices, cmd[1:])
+			if err != nil {
+				fprintln(out, e.style.Red(err.Error()))
+				continue
+			}
+			label, target := "compat", c.compat
+			if cmd[0] == "l" {
+				label, target = "latest", c.latest
+			}
+			if !target.Exists() {
+				fprintln(out, e.style.Red(fmt.Sprintf("no %s upgrade available for %s", label, c.step.Action.Name)))
+				continue
+			}
+			c.useLatest = cmd[0] == "l"
+			c.selected = true
+		default:
+			c, err := lookupChoice(choices, cmd)
+			if err != nil {
+				fprintln(out, e.style.Red(err.Error()))
+				fprintln(out, interactiveHelp)
+				continue
+			}
+			c.selected = !c.selected
+		}
+	}
+}
+
+// lookupChoice returns the choice numbered by the single given arg.
+func lookupChoice(choices []upgradeChoice, args []string) (*upgradeChoice, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected a single action number")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(choices) {
+		return nil, fmt.Errorf("invalid action number %q, must be between 1 and %d", args[0], len(choices))
+	}
+	return &choices[n-1], nil
+}
+
+// upgradeChoices returns a choice for every resolved step with at least one
+// upgrade available, initially selecting the upgrade the given mode would
+// choose, if any. Downgrades are only offered if they are allowed.
+func (e *Engine) upgradeChoices(mode PinMode) []upgradeChoice {
+	var choices []upgradeChoice
+	for _, key := range slices.Sorted(maps.Keys(e.root.Workflows)) {
+		w := e.root.Workflows[key]
+		for _, step := range w.Steps {
+			current := step.Action.Release
+			if !current.Exists() || e.config.sanctions(step.Action) {
+				continue
+			}
+			isOption := func(r Release) bool {
+				return r.Exists() && r.CommitHash != current.CommitHash && (e.allowDowngrade || !isDowngrade(current, r))
+			}
+			c := upgradeChoice{workflow: w, step: step}
+			candidates := step.Action.UpgradeCandidates
+			if isOption(candidates.LatestCompatible) {
+				c.compat = candidates.LatestCompatible
+			}
+			if isOption(candidates.Latest) && candidates.Latest.CommitHash != c.compat.CommitHash {
+				c.latest = candidates.Latest
+			}
+			if !c.compat.Exists() && !c.latest.Exists() {
+				continue
+			}
+			c.useLatest = !c.compat.Exists() || (mode == ModeLatest && c.latest.Exists())
+			preferred := chooseUpgrade(step, mode)
+			c.selected = preferred.CommitHash != current.CommitHash && preferred.CommitHash == c.option().CommitHash
+			choices = append(choices, c)
+		}
+	}
+	return choices
+}
+
+// renderChoices writes a numbered list of the available upgrades to dst,
+// marking the selected ones and their targets.
+func (e *Engine) renderChoices(dst io.Writer, choices []upgradeChoice) {
+	fprintln(dst)
+	fprintln(dst, e.style.Boldf("upgrades available for %d action(s):", len(choices)))
+	for i, c := range choices {
+		mark := "[ ]"
+		if c.selected {
+			mark = e.style.Green("[x]")
+		}
+		option := func(label string, r Release, chosen bool) string {
+			if !r.Exists() {
+				return ""
+			}
+			s := fmt.Sprintf("%s %s", label, r.Version)
+			if chosen {
+				return e.style.Bold("*" + s)
+			}
+			return s
+		}
+		opts := strings.Join(slices.DeleteFunc([]string{
+			option("compat", c.compat, !c.useLatest),
+			option("latest", c.latest, c.useLatest),
+		}, func(s string) bool { return s == "" }), ", ")
+		fprintf(dst, "  %2d %s %s:%d %s %s -> %s\n",
+			i+1, mark,
+			e.workflowName(c.workflow.FilePath), c.step.LineNumber+1,
+			c.step.Action.Name, c.step.Action.Release.Version, opts,
+		)
+	}
+	fprintln(dst, interactiveHelp)
+}
+
+// applyChoices pins each selected step to its chosen target, and every other
+// step to its current release, or shows the plan in dry run mode.
+func (e *Engine) applyChoices(ctx context.Context, dst io.Writer, choices []upgradeChoice) error {
+	chosen := make(map[choiceKey]Release, len(choices))
+	for _, c := range choices {
+		if target := c.target(); target.Exists() {
+			chosen[choiceKey{c.workflow.FilePath, c.step.LineNumber}] = target
+		}
+	}
+	pinCurrent := e.pinStrategy(ModeCurrent)
+	strategy := func(w Workflow, step Step) Release {
+		if target, ok := chosen[choiceKey{w.FilePath, step.LineNumber}]; ok {
+			return target
+		}
+		return pinCurrent(w, step)
+	}
+	return e.applyChosen(ctx, dst, strategy, len(chosen))
+}
+
+// applyChosen upgrades the n steps chosen by the given strategy, or shows
+// the plan in dry run mode.
+func (e *Engine) applyChosen(ctx context.Context, dst io.Writer, strategy RewriteStrategy, n int) error {
+	if e.dryRun {
+		return e.showPlan(dst, strategy)
+	}
+	e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseUpgradeChosen, n))
+	result, err := e.rewriteWorkflows(ctx, strategy)
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+	if err := e.reportRewrite(dst, result, "upgraded"); err != nil {
+		return err
+	}
+	return e.runPostWriteCommand(ctx, result.Changed)
+}
+
+// isTerminal returns true if the given reader or writer is connected to a
+// terminal, which interactive mode and in-place progress updates require.
+func isTerminal(rw any) bool {
+	f, ok := rw.(interface{ Fd() uintptr })
+	return ok && term.IsTerminal(int(f.Fd()))
+}
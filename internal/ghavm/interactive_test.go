@@ -0,0 +1,129 @@
+package ghavm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestChooseUpgrades(t *testing.T) {
+	t.Parallel()
+
+	var (
+		checkoutV4  = Release{Version: "v4.0.0", CommitHash: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+		checkoutV41 = Release{Version: "v4.1.0", CommitHash: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+		checkoutV5  = Release{Version: "v5.0.0", CommitHash: "cccccccccccccccccccccccccccccccccccccccc"}
+		setupGoV5   = Release{Version: "v5.0.0", CommitHash: "dddddddddddddddddddddddddddddddddddddddd"}
+	)
+	newRoot := func() Root {
+		return Root{Workflows: map[string]Workflow{
+			"ci.yaml": {
+				FilePath: "ci.yaml",
+				Steps: []Step{
+					{LineNumber: 1, Action: Action{Name: "actions/checkout", Ref: "v4", Release: checkoutV4, UpgradeCandidates: UpgradeCandidates{
+						Latest:           checkoutV5,
+						LatestCompatible: checkoutV41,
+					}}},
+					// already up to date, so not offered
+					{LineNumber: 2, Action: Action{Name: "actions/setup-go", Ref: "v5", Release: setupGoV5, UpgradeCandidates: UpgradeCandidates{
+						Latest:           setupGoV5,
+						LatestCompatible: setupGoV5,
+					}}},
+				},
+			},
+		}}
+	}
+
+	testCases := map[string]struct {
+		mode  PinMode
+		input string
+		// wantProposed is the proposed version for actions/checkout, or
+		// empty if no changes are expected; unselected steps are pinned to
+		// their current versions
+		wantProposed string
+		wantUI       []string
+	}{
+		"apply defaults in compat mode": {
+			mode:         ModeCompat,
+			input:        "y\n",
+			wantProposed: "v4.1.0",
+			wantUI:       []string{"1 [x] ci.yaml:2 actions/checkout v4.0.0 -> *compat v4.1.0, latest v5.0.0"},
+		},
+		"target latest": {
+			mode:         ModeCompat,
+			input:        "l 1\ny\n",
+			wantProposed: "v5.0.0",
+			wantUI:       []string{"1 [x] ci.yaml:2 actions/checkout v4.0.0 -> compat v4.1.0, *latest v5.0.0"},
+		},
+		"toggle off": {
+			mode:         ModeLatest,
+			input:        "1\ny\n",
+			wantProposed: "v4.0.0",
+			wantUI:       []string{"1 [ ] ci.yaml:2 actions/checkout v4.0.0 -> compat v4.1.0, *latest v5.0.0"},
+		},
+		"invalid commands are reported": {
+			mode:         ModeCompat,
+			input:        "7\nfoo\nc\ny\n",
+			wantProposed: "v4.1.0",
+			wantUI: []string{
+				`invalid action number "7", must be between 1 and 1`,
+				`invalid action number "foo", must be between 1 and 1`,
+				"expected a single action number",
+			},
+		},
+		"quit": {
+			mode:   ModeCompat,
+			input:  "q\n",
+			wantUI: []string{"no changes made"},
+		},
+		"eof": {
+			mode:   ModeCompat,
+			input:  "n\n",
+			wantUI: []string{"1 [ ] ci.yaml:2", "no changes made"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var ui, out bytes.Buffer
+			engine := newEngine(newRoot(), nil, &ui, engineOpts{DryRun: true, Output: outputJSON})
+			assert.NilError(t, engine.chooseUpgrades(testCtx(), strings.NewReader(tc.input), &out, tc.mode))
+			for _, want := range tc.wantUI {
+				assert.Contains(t, ui.String(), want, "incorrect ui output")
+			}
+			assert.Equal(t, strings.Contains(ui.String(), "actions/setup-go"), false, "up to date actions should not be offered")
+
+			if tc.input == "q\n" || !strings.HasSuffix(tc.input, "y\n") {
+				assert.Equal(t, out.String(), "", "expected no plan")
+				return
+			}
+			var plan Plan
+			assert.NilError(t, json.Unmarshal(out.Bytes(), &plan))
+			var got []string
+			for _, c := range plan.Changes {
+				got = append(got, c.Action+"@"+c.ProposedVersion)
+			}
+			var want []string
+			if tc.wantProposed != "" {
+				want = []string{"actions/checkout@" + tc.wantProposed, "actions/setup-go@v5.0.0"}
+			}
+			assert.DeepEqual(t, got, want, "incorrect planned changes")
+		})
+	}
+
+	t.Run("nothing to upgrade", func(t *testing.T) {
+		t.Parallel()
+		root := newRoot()
+		w := root.Workflows["ci.yaml"]
+		w.Steps = w.Steps[1:]
+		root.Workflows["ci.yaml"] = w
+		var ui bytes.Buffer
+		engine := newEngine(root, nil, &ui, engineOpts{DryRun: true})
+		assert.NilError(t, engine.chooseUpgrades(testCtx(), strings.NewReader(""), io.Discard, ModeLatest))
+		assert.Contains(t, ui.String(), "all actions are up to date", "incorrect ui output")
+	})
+}
@@ -0,0 +1,225 @@
+package ghavm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Inventory describes the resolved version and latest available release of
+// every action step, as written by list --output json. A saved inventory can
+// later be used as a baseline for list --compare-to.
+type Inventory struct {
+	Actions []InventoryEntry `json:"actions"`
+}
+
+// InventoryEntry describes a single action step in an [Inventory].
+type InventoryEntry struct {
+	Workflow      string `json:"workflow"`
+	Line          int    `json:"line"`
+	Action        string `json:"action"`
+	Ref           string `json:"ref"`
+	Version       string `json:"version"`
+	Commit        string `json:"commit"`
+	LatestVersion string `json:"latest_version"`
+	LatestCommit  string `json:"latest_commit"`
+	// LatestStableVersion is the newest stable release, if the current
+	// version is ahead of it (e.g. a release candidate).
+	LatestStableVersion string `json:"latest_stable_version,omitempty"`
+	// Dependencies are the actions used by the action, if it is a composite
+	// action, as found with list --transitive.
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+// key identifies an entry across inventories, independent of its line number,
+// which shifts whenever unrelated lines are added or removed. The nth use of
+// the same action in the same workflow is distinguished by n.
+func (e InventoryEntry) key(n int) string {
+	return fmt.Sprintf("%s\x00%s\x00%d", e.Workflow, canonicalName(e.Action), n)
+}
+
+// hasUpgrade returns true if a newer release than the entry's current
+// version is available.
+func (e InventoryEntry) hasUpgrade() bool {
+	return e.LatestCommit != "" && e.LatestCommit != e.Commit
+}
+
+// buildInventory describes every resolved step in root.
+func buildInventory(root Root) Inventory {
+	inv := Inventory{Actions: []InventoryEntry{}}
+	for _, key := range slices.Sorted(maps.Keys(root.Workflows)) {
+		w := root.Workflows[key]
+		for _, step := range w.Steps {
+			a := step.Action
+			inv.Actions = append(inv.Actions, InventoryEntry{
+				Workflow:            w.FilePath,
+				Line:                step.LineNumber + 1,
+				Action:              a.Name,
+				Ref:                 a.Ref,
+				Version:             a.Release.Version,
+				Commit:              a.Release.CommitHash,
+				LatestVersion:       a.UpgradeCandidates.Latest.Version,
+				LatestCommit:        a.UpgradeCandidates.Latest.CommitHash,
+				LatestStableVersion: a.UpgradeCandidates.LatestStable.Version,
+				Dependencies:        step.Dependencies,
+			})
+		}
+	}
+	return inv
+}
+
+// readInventory reads an inventory previously written by list --output json.
+func readInventory(path string) (Inventory, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return Inventory{}, fmt.Errorf("failed to read baseline: %w", err)
+	}
+	var inv Inventory
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return Inventory{}, fmt.Errorf("failed to parse baseline %s: %w", path, err)
+	}
+	for _, entry := range inv.Actions {
+		if entry.Workflow == "" || entry.Action == "" {
+			return Inventory{}, fmt.Errorf("invalid baseline %s: every action must have a workflow and action", path)
+		}
+	}
+	return inv, nil
+}
+
+// InventoryDelta describes what changed between a baseline inventory and the
+// current one.
+type InventoryDelta struct {
+	// Added are the steps that are not in the baseline.
+	Added []InventoryEntry `json:"added"`
+	// Removed are the steps in the baseline that no longer exist.
+	Removed []InventoryEntry `json:"removed"`
+	// Drifted are the steps whose ref, version, or commit changed.
+	Drifted []InventoryChange `json:"drifted"`
+	// NewUpgrades are the steps with an upgrade available that was not
+	// available in the baseline.
+	NewUpgrades []InventoryChange `json:"new_upgrades"`
+}
+
+// InventoryChange describes a single step in both the baseline and current
+// inventories.
+type InventoryChange struct {
+	Baseline InventoryEntry `json:"baseline"`
+	Current  InventoryEntry `json:"current"`
+}
+
+// empty returns true if nothing changed.
+func (d InventoryDelta) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Drifted) == 0 && len(d.NewUpgrades) == 0
+}
+
+// compareInventories computes the delta from the baseline inventory to the
+// current one. Steps are matched by workflow and action rather than by line.
+func compareInventories(baseline, current Inventory) InventoryDelta {
+	delta := InventoryDelta{
+		Added:       []InventoryEntry{},
+		Removed:     []InventoryEntry{},
+		Drifted:     []InventoryChange{},
+		NewUpgrades: []InventoryChange{},
+	}
+	before := indexInventory(baseline)
+	seen := make(map[string]bool, len(current.Actions))
+	counts := make(map[string]int)
+	for _, entry := range current.Actions {
+		key := entry.key(counts[entry.key(0)])
+		counts[entry.key(0)]++
+		seen[key] = true
+
+		prev, ok := before[key]
+		if !ok {
+			delta.Added = append(delta.Added, entry)
+			continue
+		}
+		change := InventoryChange{Baseline: prev, Current: entry}
+		if prev.Ref != entry.Ref || prev.Version != entry.Version || prev.Commit != entry.Commit {
+			delta.Drifted = append(delta.Drifted, change)
+		}
+		if entry.hasUpgrade() && entry.LatestCommit != prev.LatestCommit {
+			delta.NewUpgrades = append(delta.NewUpgrades, change)
+		}
+	}
+	counts = make(map[string]int)
+	for _, entry := range baseline.Actions {
+		key := entry.key(counts[entry.key(0)])
+		counts[entry.key(0)]++
+		if !seen[key] {
+			delta.Removed = append(delta.Removed, entry)
+		}
+	}
+	return delta
+}
+
+// indexInventory indexes the entries of an inventory by their keys.
+func indexInventory(inv Inventory) map[string]InventoryEntry {
+	index := make(map[string]InventoryEntry, len(inv.Actions))
+	counts := make(map[string]int)
+	for _, entry := range inv.Actions {
+		index[entry.key(counts[entry.key(0)])] = entry
+		counts[entry.key(0)]++
+	}
+	return index
+}
+
+// Inventory resolves every step and describes the results, with workflow
+// paths as shown in the engine's output.
+func (e *Engine) Inventory(ctx context.Context) (Inventory, error) {
+	if err := e.resolveSteps(ctx, ModeLatest); err != nil {
+		return Inventory{}, fmt.Errorf("failed to resolve commit refs: %w", err)
+	}
+	inv := buildInventory(e.root)
+	for i := range inv.Actions {
+		inv.Actions[i].Workflow = e.workflowPath(inv.Actions[i].Workflow)
+	}
+	return inv, nil
+}
+
+// renderInventoryDelta writes a human-readable version of the delta to dst.
+func (e *Engine) renderInventoryDelta(dst io.Writer, delta InventoryDelta) {
+	if delta.empty() {
+		fprintln(dst, "no changes since baseline")
+		return
+	}
+	describe := func(entry InventoryEntry) string {
+		return fmt.Sprintf("%s %s", e.style.Bold(entry.Workflow), e.style.Boldf("%s@%s", entry.Action, entry.Ref))
+	}
+	release := func(version, commit string) Release {
+		return Release{Version: version, CommitHash: commit}
+	}
+	if len(delta.Added) > 0 {
+		fprintf(dst, "%d action(s) added:\n", len(delta.Added))
+		for _, entry := range delta.Added {
+			fprintf(dst, "  + %s: %s\n", describe(entry), release(entry.Version, entry.Commit))
+		}
+	}
+	if len(delta.Removed) > 0 {
+		fprintf(dst, "%d action(s) removed:\n", len(delta.Removed))
+		for _, entry := range delta.Removed {
+			fprintf(dst, "  - %s: %s\n", describe(entry), release(entry.Version, entry.Commit))
+		}
+	}
+	if len(delta.Drifted) > 0 {
+		fprintf(dst, "%d action(s) changed version:\n", len(delta.Drifted))
+		for _, c := range delta.Drifted {
+			fprintf(dst, "  ~ %s: %s → %s\n", describe(c.Current), release(c.Baseline.Version, c.Baseline.Commit), release(c.Current.Version, c.Current.Commit))
+		}
+	}
+	if len(delta.NewUpgrades) > 0 {
+		fprintf(dst, "%d new upgrade(s) available:\n", len(delta.NewUpgrades))
+		for _, c := range delta.NewUpgrades {
+			msg := fmt.Sprintf("  ↑ %s: %s → %s", describe(c.Current), release(c.Current.Version, c.Current.Commit), release(c.Current.LatestVersion, c.Current.LatestCommit))
+			if c.Baseline.hasUpgrade() {
+				msg += fmt.Sprintf(" (previously %s)", release(c.Baseline.LatestVersion, c.Baseline.LatestCommit))
+			}
+			fprintln(dst, msg)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package ghavm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestBuildInventory(t *testing.T) {
+	t.Parallel()
+
+	root := Root{Workflows: map[string]Workflow{
+		"ci.yaml": {FilePath: "ci.yaml", Steps: []Step{{
+			LineNumber: 4,
+			Action: Action{
+				Name:              "owner/repo",
+				Ref:               "v1",
+				Release:           Release{Version: "v1.0.0", CommitHash: "c1"},
+				UpgradeCandidates: UpgradeCandidates{Latest: Release{Version: "v2.0.0", CommitHash: "c2"}},
+			},
+		}}},
+	}}
+	assert.DeepEqual(t, buildInventory(root), Inventory{Actions: []InventoryEntry{{
+		Workflow:      "ci.yaml",
+		Line:          5,
+		Action:        "owner/repo",
+		Ref:           "v1",
+		Version:       "v1.0.0",
+		Commit:        "c1",
+		LatestVersion: "v2.0.0",
+		LatestCommit:  "c2",
+	}}}, "incorrect inventory")
+}
+
+func TestCompareInventories(t *testing.T) {
+	t.Parallel()
+
+	entry := func(workflow, action string, line int, version, latest string) InventoryEntry {
+		return InventoryEntry{
+			Workflow:      workflow,
+			Line:          line,
+			Action:        action,
+			Ref:           version,
+			Version:       version,
+			Commit:        "c-" + version,
+			LatestVersion: latest,
+			LatestCommit:  "c-" + latest,
+		}
+	}
+	baseline := Inventory{Actions: []InventoryEntry{
+		entry("ci.yaml", "actions/checkout", 3, "v4", "v4"),
+		entry("ci.yaml", "owner/repo", 5, "v1", "v2"),
+		entry("ci.yaml", "owner/repo", 7, "v1", "v2"),
+		entry("ci.yaml", "owner/removed", 9, "v1", "v1"),
+	}}
+	current := Inventory{Actions: []InventoryEntry{
+		// moved down a line and a new upgrade is available
+		entry("ci.yaml", "Actions/Checkout", 4, "v4", "v5"),
+		// unchanged
+		entry("ci.yaml", "owner/repo", 6, "v1", "v2"),
+		// upgraded
+		entry("ci.yaml", "owner/repo", 8, "v2", "v2"),
+		entry("release.yaml", "owner/added", 3, "v1", "v1"),
+	}}
+
+	delta := compareInventories(baseline, current)
+	assert.DeepEqual(t, delta.Added, []InventoryEntry{current.Actions[3]}, "incorrect added")
+	assert.DeepEqual(t, delta.Removed, []InventoryEntry{baseline.Actions[3]}, "incorrect removed")
+	assert.DeepEqual(t, delta.Drifted, []InventoryChange{{Baseline: baseline.Actions[2], Current: current.Actions[2]}}, "incorrect drifted")
+	assert.DeepEqual(t, delta.NewUpgrades, []InventoryChange{{Baseline: baseline.Actions[0], Current: current.Actions[0]}}, "incorrect new upgrades")
+
+	engine := newEngine(Root{}, nil, nil, engineOpts{})
+	var out strings.Builder
+	engine.renderInventoryDelta(&out, delta)
+	assert.Equal(t, out.String(), strings.Join([]string{
+		"1 action(s) added:",
+		"  + release.yaml owner/added@v1: c-v1 @ v1",
+		"1 action(s) removed:",
+		"  - ci.yaml owner/removed@v1: c-v1 @ v1",
+		"1 action(s) changed version:",
+		"  ~ ci.yaml owner/repo@v2: c-v1 @ v1 → c-v2 @ v2",
+		"1 new upgrade(s) available:",
+		"  ↑ ci.yaml Actions/Checkout@v4: c-v4 @ v4 → c-v5 @ v5",
+		"",
+	}, "\n"), "incorrect output")
+
+	out.Reset()
+	engine.renderInventoryDelta(&out, compareInventories(current, current))
+	assert.Equal(t, out.String(), "no changes since baseline\n", "incorrect output")
+}
+
+func TestReadInventory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		assert.NilError(t, os.WriteFile(p, []byte(content), 0o600))
+		return p
+	}
+
+	inv, err := readInventory(write("valid.json", `{"actions": [{"workflow": "ci.yaml", "action": "owner/repo", "ref": "v1"}]}`))
+	assert.NilError(t, err)
+	assert.Equal(t, len(inv.Actions), 1, "incorrect number of actions")
+
+	_, err = readInventory(write("invalid.json", "{"))
+	assert.Contains(t, err.Error(), "failed to parse baseline", "incorrect error")
+
+	_, err = readInventory(write("incomplete.json", `{"actions": [{"workflow": "ci.yaml"}]}`))
+	assert.Contains(t, err.Error(), "every action must have a workflow and action", "incorrect error")
+}
@@ -0,0 +1,111 @@
+package ghavm
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// outputJUnit is the JUnit XML output format for check and policy, which
+// many CI systems (e.g. Jenkins, GitLab, Azure DevOps) display as a test
+// report.
+const outputJUnit = "junit"
+
+// junitTestSuites is the minimal subset of a JUnit XML report needed for CI
+// systems to display findings, in which each workflow is a test suite and
+// each of its steps is a test case that fails if it has any findings.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr"`
+	Line      int           `xml:"line,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes a JUnit XML report of the findings for every step in
+// root to dst, under the given report name (e.g. "ghavm check").
+//
+// A step with several findings is a single failed test case, whose failure
+// message joins the findings' messages and whose body lists each finding.
+func writeJUnit(dst io.Writer, name string, root Root, findings []Finding) error {
+	type stepKey struct {
+		workflow string
+		line     int
+	}
+	stepFindings := make(map[stepKey][]Finding, len(findings))
+	for _, f := range findings {
+		key := stepKey{f.Workflow, f.Step.LineNumber}
+		stepFindings[key] = append(stepFindings[key], f)
+	}
+
+	report := junitTestSuites{Name: name, Suites: []junitTestSuite{}}
+	for _, key := range slices.Sorted(maps.Keys(root.Workflows)) {
+		w := root.Workflows[key]
+		file := workflowPath(w.FilePath, true)
+		suite := junitTestSuite{Name: file, Cases: []junitTestCase{}}
+		for _, step := range w.Steps {
+			tc := junitTestCase{
+				Name:      fmt.Sprintf("%s@%s (%s:%d)", step.Action.Name, step.Action.Ref, file, step.LineNumber+1),
+				Classname: file,
+				File:      file,
+				Line:      step.LineNumber + 1,
+			}
+			if fs := stepFindings[stepKey{w.FilePath, step.LineNumber}]; len(fs) > 0 {
+				var checks, msgs, lines []string
+				for _, f := range fs {
+					if !slices.Contains(checks, f.Check) {
+						checks = append(checks, f.Check)
+					}
+					msgs = append(msgs, f.Msg)
+					lines = append(lines, fmt.Sprintf("%s: %s", f.Check, f.Msg))
+				}
+				tc.Failure = &junitFailure{
+					Message: strings.Join(msgs, "; "),
+					Type:    strings.Join(checks, ","),
+					Text:    strings.Join(lines, "\n"),
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+			suite.Tests++
+		}
+		report.Suites = append(report.Suites, suite)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+	}
+
+	if _, err := io.WriteString(dst, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(dst)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	_, err := io.WriteString(dst, "\n")
+	return err
+}
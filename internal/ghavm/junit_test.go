@@ -0,0 +1,45 @@
+package ghavm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	t.Parallel()
+
+	// a .git dir marks the repo root that file paths are relative to
+	dir := t.TempDir()
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, ".git"), 0o755))
+	workflow := filepath.Join(dir, ".github", "workflows", "ci.yaml")
+	checkout := Step{LineNumber: 9, Action: Action{Name: "actions/checkout", Ref: "v4"}}
+	setupGo := Step{LineNumber: 12, Action: Action{Name: "actions/setup-go", Ref: "v5"}}
+	root := Root{Workflows: map[string]Workflow{
+		workflow: {FilePath: workflow, Steps: []Step{checkout, setupGo}},
+	}}
+	findings := []Finding{
+		{Check: "deprecated-runtime", Workflow: workflow, Step: checkout, Msg: "runs on node16"},
+		{Check: "floating-major", Workflow: workflow, Step: checkout, Msg: "newer major version v5 available"},
+	}
+
+	var buf strings.Builder
+	assert.NilError(t, writeJUnit(&buf, "ghavm check", root, findings))
+	assert.Equal(t, buf.String(), `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="ghavm check" tests="2" failures="1">
+  <testsuite name=".github/workflows/ci.yaml" tests="2" failures="1">
+    <testcase name="actions/checkout@v4 (.github/workflows/ci.yaml:10)" classname=".github/workflows/ci.yaml" file=".github/workflows/ci.yaml" line="10">
+      <failure message="runs on node16; newer major version v5 available" type="deprecated-runtime,floating-major">deprecated-runtime: runs on node16&#xA;floating-major: newer major version v5 available</failure>
+    </testcase>
+    <testcase name="actions/setup-go@v5 (.github/workflows/ci.yaml:13)" classname=".github/workflows/ci.yaml" file=".github/workflows/ci.yaml" line="13"></testcase>
+  </testsuite>
+</testsuites>
+`, "incorrect report")
+
+	buf.Reset()
+	assert.NilError(t, writeJUnit(&buf, "ghavm policy", Root{}, nil))
+	assert.Contains(t, buf.String(), `<testsuites name="ghavm policy" tests="0" failures="0"></testsuites>`, "incorrect empty report")
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package ghavm
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockFile opens the file at path, creating it if necessary, and blocks until
+// it holds an exclusive advisory lock on it. Closing the returned file
+// releases the lock.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil { // #nosec G115
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package ghavm
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile opens the file at path, creating it if necessary, and blocks until
+// it holds an exclusive lock on it. Closing the returned file releases the
+// lock.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, new(windows.Overlapped)); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,246 @@
+package ghavm
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// message identifies a user-facing string in a [catalog].
+type message int
+
+const (
+	msgWorkflow message = iota
+	msgTemplated
+	msgActionVersions
+	msgUnresolved
+	msgNoUpgrades
+	msgUsingLatest
+	msgUsingLatestCompat
+	msgUnreleasedNote
+	msgPrereleaseAheadNote
+	msgAheadOfStableNote
+	msgReleasesBehind
+	msgVerified
+	msgNone
+	msgYes
+	msgNo
+	msgDiagnostics
+	msgDone
+	msgFailed
+	msgMatrix
+	msgVerifiedCreator
+	msgUnverifiedCreator
+	msgSanctioned
+	msgDependencyCycle
+	msgDepthLimit
+	msgDependencyError
+	msgNoNewUpgrades
+	msgNewUpgrades
+	msgPreviously
+
+	// headers for the phases of a run (see [PhaseLogger.StartPhase])
+	msgPhasePin
+	msgPhaseReconcile
+	msgPhasePrune
+	msgPhaseRewrite
+	msgPhaseLockfile
+	msgPhasePostWrite
+	msgPhaseRepoAccess
+	msgPhaseResolve
+	msgPhaseRuntimes
+	msgPhaseComments
+	msgPhaseCommitAges
+	msgPhaseUpgradeChosen
+
+	// labels for the fields of an action's versions, which are aligned in a
+	// column (see [catalog.label])
+	msgLabelCurrent
+	msgLabelTags
+	msgLabelRelease
+	msgLabelSigned
+	msgLabelTree
+	msgLabelNote
+	msgLabelCompat
+	msgLabelLatest
+	msgLabelBehind
+	msgLabelUses
+)
+
+// fieldLabels are the messages used as field labels.
+var fieldLabels = []message{
+	msgLabelCurrent, msgLabelTags, msgLabelRelease, msgLabelSigned, msgLabelTree,
+	msgLabelNote, msgLabelCompat, msgLabelLatest, msgLabelBehind, msgLabelUses,
+}
+
+// catalog maps each user-facing message to a fmt format string in a single
+// language.
+type catalog map[message]string
+
+// defaultLang is the language used when none is given or detected.
+const defaultLang = "en"
+
+// catalogs holds the catalog for each supported language. Every catalog must
+// define every message, which is enforced by tests.
+var catalogs = map[string]catalog{
+	"en": {
+		msgWorkflow:            "workflow %s",
+		msgTemplated:           "(templated)",
+		msgActionVersions:      "action %s versions:",
+		msgUnresolved:          "(could not resolve action versions, unable to pin or upgrade)",
+		msgNoUpgrades:          "(no upgrade versions found)",
+		msgUsingLatest:         "✓ already using latest version",
+		msgUsingLatestCompat:   "✓ already using latest compat version",
+		msgUnreleasedNote:      "%s is a tag not published as a release; upgrades only consider releases, so newer tags may be missing",
+		msgPrereleaseAheadNote: "%s is a prerelease ahead of the latest stable release %s",
+		msgAheadOfStableNote:   "%s is ahead of the latest stable release %s, e.g. because it was yanked",
+		msgReleasesBehind:      "%d release(s)",
+		msgVerified:            "(verified)",
+		msgNone:                "(none)",
+		msgYes:                 "yes",
+		msgNo:                  "no",
+		msgDiagnostics:         "diagnostics",
+		msgDone:                "done!",
+		msgFailed:              "failed!",
+		msgMatrix:              "(matrix job, may run many times)",
+		msgVerifiedCreator:     "✓ verified domain",
+		msgUnverifiedCreator:   "(no verified domain)",
+		msgSanctioned:          "(sanctioned to float)",
+		msgDependencyCycle:     "(cycle)",
+		msgDepthLimit:          "(depth limit reached)",
+		msgDependencyError:     "(could not find dependencies: %s)",
+		msgNoNewUpgrades:       "no new upgrades since last run",
+		msgNewUpgrades:         "%d new upgrade(s) since last run:",
+		msgPreviously:          "(previously %s)",
+		msgPhasePin:            "pinning %d action(s) to immutable hashes for their %s versions in %d workflow(s) ...",
+		msgPhaseReconcile:      "reconciling version comments for %d action(s) in %d workflow(s) ...",
+		msgPhasePrune:          "pruning version comments for %d action(s) in %d workflow(s) ...",
+		msgPhaseRewrite:        "rewriting %d action(s) in %d workflow(s) ...",
+		msgPhaseLockfile:       "pinning actions to their locked hashes in %d workflow(s) ...",
+		msgPhasePostWrite:      "running post-write command %s on %d workflow(s) ...",
+		msgPhaseRepoAccess:     "checking access to %d action repo(s) ...",
+		msgPhaseResolve:        "resolving action versions for %d step(s) across %d workflow(s) with %d worker(s) ...",
+		msgPhaseRuntimes:       "checking action runtimes for %d step(s) ...",
+		msgPhaseComments:       "checking version comments for %d step(s) ...",
+		msgPhaseCommitAges:     "checking commit ages for %d step(s) ...",
+		msgPhaseUpgradeChosen:  "upgrading %d chosen action(s) ...",
+		msgLabelCurrent:        "current:",
+		msgLabelTags:           "tags:",
+		msgLabelRelease:        "release:",
+		msgLabelSigned:         "signed:",
+		msgLabelTree:           "tree:",
+		msgLabelNote:           "note:",
+		msgLabelCompat:         "compat:",
+		msgLabelLatest:         "latest:",
+		msgLabelBehind:         "behind:",
+		msgLabelUses:           "uses:",
+	},
+	"es": {
+		msgWorkflow:            "flujo de trabajo %s",
+		msgTemplated:           "(plantilla)",
+		msgActionVersions:      "versiones de la acción %s:",
+		msgUnresolved:          "(no se pudieron resolver las versiones de la acción, no se puede fijar ni actualizar)",
+		msgNoUpgrades:          "(no se encontraron versiones de actualización)",
+		msgUsingLatest:         "✓ ya usa la última versión",
+		msgUsingLatestCompat:   "✓ ya usa la última versión compatible",
+		msgUnreleasedNote:      "%s es una etiqueta no publicada como release; las actualizaciones solo consideran releases, por lo que pueden faltar etiquetas más recientes",
+		msgPrereleaseAheadNote: "%s es una versión preliminar posterior a la última release estable %s",
+		msgAheadOfStableNote:   "%s es posterior a la última release estable %s, p. ej. porque fue retirada",
+		msgReleasesBehind:      "%d release(s)",
+		msgVerified:            "(verificada)",
+		msgNone:                "(ninguna)",
+		msgYes:                 "sí",
+		msgNo:                  "no",
+		msgDiagnostics:         "diagnósticos",
+		msgDone:                "¡listo!",
+		msgFailed:              "¡falló!",
+		msgMatrix:              "(job con matriz, puede ejecutarse muchas veces)",
+		msgVerifiedCreator:     "✓ dominio verificado",
+		msgUnverifiedCreator:   "(sin dominio verificado)",
+		msgSanctioned:          "(autorizada a flotar)",
+		msgDependencyCycle:     "(ciclo)",
+		msgDepthLimit:          "(límite de profundidad alcanzado)",
+		msgDependencyError:     "(no se pudieron encontrar las dependencias: %s)",
+		msgNoNewUpgrades:       "no hay actualizaciones nuevas desde la última ejecución",
+		msgNewUpgrades:         "%d actualización(es) nueva(s) desde la última ejecución:",
+		msgPreviously:          "(antes %s)",
+		msgPhasePin:            "fijando %d acción(es) a hashes inmutables de sus versiones %s en %d flujo(s) de trabajo ...",
+		msgPhaseReconcile:      "conciliando comentarios de versión de %d acción(es) en %d flujo(s) de trabajo ...",
+		msgPhasePrune:          "eliminando comentarios de versión de %d acción(es) en %d flujo(s) de trabajo ...",
+		msgPhaseRewrite:        "reescribiendo %d acción(es) en %d flujo(s) de trabajo ...",
+		msgPhaseLockfile:       "fijando acciones a sus hashes bloqueados en %d flujo(s) de trabajo ...",
+		msgPhasePostWrite:      "ejecutando el comando posterior a la escritura %s en %d flujo(s) de trabajo ...",
+		msgPhaseRepoAccess:     "comprobando el acceso a %d repositorio(s) de acciones ...",
+		msgPhaseResolve:        "resolviendo versiones de acciones para %d paso(s) en %d flujo(s) de trabajo con %d trabajador(es) ...",
+		msgPhaseRuntimes:       "comprobando los entornos de ejecución de acciones para %d paso(s) ...",
+		msgPhaseComments:       "comprobando comentarios de versión para %d paso(s) ...",
+		msgPhaseCommitAges:     "comprobando la antigüedad de los commits para %d paso(s) ...",
+		msgPhaseUpgradeChosen:  "actualizando %d acción(es) elegida(s) ...",
+		msgLabelCurrent:        "actual:",
+		msgLabelTags:           "etiquetas:",
+		msgLabelRelease:        "release:",
+		msgLabelSigned:         "firmada:",
+		msgLabelTree:           "árbol:",
+		msgLabelNote:           "nota:",
+		msgLabelCompat:         "compatible:",
+		msgLabelLatest:         "última:",
+		msgLabelBehind:         "atraso:",
+		msgLabelUses:           "usa:",
+	},
+}
+
+// supportedLangs returns the supported languages, sorted.
+func supportedLangs() []string {
+	return slices.Sorted(maps.Keys(catalogs))
+}
+
+// catalogFor returns the catalog for the given language, or the default
+// catalog if the language is not supported.
+func catalogFor(lang string) catalog {
+	if c, ok := catalogs[lang]; ok {
+		return c
+	}
+	return catalogs[defaultLang]
+}
+
+// validateLang checks that the given --lang value is supported.
+func validateLang(lang string) error {
+	if _, ok := catalogs[lang]; !ok {
+		return fmt.Errorf("unsupported language %q, must be one of %s", lang, strings.Join(supportedLangs(), ", "))
+	}
+	return nil
+}
+
+// langFromLocale returns the supported language for a POSIX locale (e.g.
+// "es_ES.UTF-8"), as found in LC_ALL, LC_MESSAGES, or LANG, or an empty
+// string if the language is not supported.
+func langFromLocale(locale string) string {
+	lang, _, _ := strings.Cut(locale, ".")
+	lang, _, _ = strings.Cut(lang, "_")
+	lang = strings.ToLower(lang)
+	if _, ok := catalogs[lang]; !ok {
+		return ""
+	}
+	return lang
+}
+
+// Sprintf formats the given message.
+func (c catalog) Sprintf(msg message, args ...any) string {
+	format, ok := c[msg]
+	if !ok {
+		format = catalogs[defaultLang][msg]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// label returns the given field label, padded so that the values following
+// every label line up in a column.
+func (c catalog) label(msg message) string {
+	width := 0
+	for _, l := range fieldLabels {
+		width = max(width, utf8.RuneCountInString(c.Sprintf(l)))
+	}
+	return fmt.Sprintf("%-*s ", width, c.Sprintf(msg))
+}
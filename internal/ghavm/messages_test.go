@@ -0,0 +1,68 @@
+package ghavm
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestCatalogs(t *testing.T) {
+	t.Parallel()
+
+	// every catalog must define every message, with the same verbs in the
+	// same order as the default catalog
+	verbs := regexp.MustCompile(`%[a-z]`)
+	defaults := catalogs[defaultLang]
+	for lang, c := range catalogs {
+		t.Run(lang, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, len(c), len(defaults), "incorrect number of messages")
+			for msg, format := range defaults {
+				translated, ok := c[msg]
+				assert.Equal(t, ok, true, "missing message "+format)
+				assert.DeepEqual(t, verbs.FindAllString(translated, -1), verbs.FindAllString(format, -1), "mismatched verbs in "+translated)
+			}
+		})
+	}
+}
+
+func TestCatalogLabel(t *testing.T) {
+	t.Parallel()
+
+	en := catalogFor("en")
+	assert.Equal(t, en.label(msgLabelCurrent), "current: ", "incorrect label")
+	assert.Equal(t, en.label(msgLabelTree), "tree:    ", "incorrect label")
+
+	// padding counts characters, not bytes
+	es := catalogFor("es")
+	assert.Equal(t, es.label(msgLabelTree), "árbol:      ", "incorrect label")
+	assert.Equal(t, es.label(msgLabelCompat), "compatible: ", "incorrect label")
+
+	// a nil catalog falls back to the default catalog
+	var empty catalog
+	assert.Equal(t, empty.Sprintf(msgReleasesBehind, 2), "2 release(s)", "incorrect message")
+	assert.Equal(t, empty.label(msgLabelNote), "note:    ", "incorrect label")
+}
+
+func TestLangFromLocale(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"es_ES.UTF-8": "es",
+		"es":          "es",
+		"ES_mx":       "es",
+		"en_US.UTF-8": "en",
+		"fr_FR.UTF-8": "",
+		"C":           "",
+		"":            "",
+	}
+	for locale, want := range testCases {
+		t.Run(locale, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, langFromLocale(locale), want, "incorrect language")
+		})
+	}
+	assert.Equal(t, slices.Equal(supportedLangs(), []string{"en", "es"}), true, "incorrect supported languages")
+}
@@ -0,0 +1,128 @@
+package ghavm
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// apiCommands are the commands that use the GitHub API, in the order they
+// are listed in help output.
+var apiCommands = []string{"list", "pin", "upgrade", "check", "policy", "analyze", "doctor"}
+
+// apiUsage describes a group of GitHub API endpoints used by ghavm and the
+// fine-grained token permission needed to call them for private repos.
+type apiUsage struct {
+	Endpoints []string
+	Purpose   string
+	// Permission is the repository permission required, or empty if none is
+	// required (e.g. for endpoints that are not specific to a repo).
+	Permission string
+	Commands   []string
+}
+
+// apiUsages describes every GitHub API endpoint used by ghavm, from which
+// the permissions required by each command are derived. It must be kept in
+// sync with [GitHubClient].
+var apiUsages = []apiUsage{
+	{
+		Endpoints: []string{"GET /user"},
+		Purpose:   "validate the token",
+		Commands:  []string{"list", "pin", "upgrade", "check", "policy", "doctor"},
+	},
+	{
+		Endpoints: []string{"GET /rate_limit"},
+		Purpose:   "check rate limits",
+		Commands:  []string{"list", "doctor"},
+	},
+	{
+		Endpoints:  []string{"POST /graphql (releases, refs)", "GET /repos/{owner}/{repo}/commits/{ref}", "GET /repos/{owner}/{repo}/git/*"},
+		Purpose:    "resolve releases, tags, and commits",
+		Permission: "Contents",
+		Commands:   []string{"list", "pin", "upgrade", "check", "policy", "analyze"},
+	},
+	{
+		Endpoints:  []string{"GET /repos/{owner}/{repo}/contents/{path}"},
+		Purpose:    "read action.yml files",
+		Permission: "Contents",
+		Commands:   []string{"list", "check", "policy"},
+	},
+	{
+		Endpoints:  []string{"GET /repos/{owner}/{repo}"},
+		Purpose:    "check that action repos exist",
+		Permission: "Metadata",
+		Commands:   []string{"list", "pin", "upgrade", "check", "policy", "analyze"},
+	},
+	{
+		Endpoints: []string{"GET /search/repositories"},
+		Purpose:   "suggest repos for typos (with --suggest-typos)",
+		Commands:  []string{"list", "pin", "upgrade", "check", "policy"},
+	},
+	{
+		Endpoints: []string{"GET /orgs/{org}"},
+		Purpose:   "check whether action owners have verified domains (with --show-verified)",
+		Commands:  []string{"list"},
+	},
+}
+
+// tokenPermission is a read-only repository permission a fine-grained token
+// needs, along with why ghavm needs it.
+type tokenPermission struct {
+	Name     string
+	Purposes []string
+}
+
+// requiredPermissions returns the repository permissions needed to run the
+// given commands against actions in private repos, sorted by name. Actions in
+// public repos need no permissions beyond read-only access to public repos.
+func requiredPermissions(commands []string) ([]tokenPermission, error) {
+	for _, command := range commands {
+		if !slices.Contains(apiCommands, command) {
+			return nil, fmt.Errorf("unknown command %q, must be one of %s", command, strings.Join(apiCommands, ", "))
+		}
+	}
+	var perms []tokenPermission
+	for _, usage := range apiUsages {
+		if usage.Permission == "" || !slices.ContainsFunc(commands, func(c string) bool { return slices.Contains(usage.Commands, c) }) {
+			continue
+		}
+		idx := slices.IndexFunc(perms, func(p tokenPermission) bool { return p.Name == usage.Permission })
+		if idx == -1 {
+			perms = append(perms, tokenPermission{Name: usage.Permission})
+			idx = len(perms) - 1
+		}
+		perms[idx].Purposes = append(perms[idx].Purposes, usage.Purpose)
+	}
+	slices.SortFunc(perms, func(a, b tokenPermission) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return perms, nil
+}
+
+// renderPermissions writes advice on creating a least-privilege token for
+// the given commands to dst.
+func renderPermissions(dst io.Writer, commands []string, perms []tokenPermission) {
+	fprintf(dst, "Token permissions required by ghavm %s:\n\n", strings.Join(commands, ", "))
+	fprintln(dst, "Fine-grained personal access token:")
+	if len(perms) == 0 {
+		fprintln(dst, "  Repository access: Public repositories (read-only)")
+		fprintln(dst, "  Repository permissions: none")
+	} else {
+		fprintln(dst, "  Repository access:")
+		fprintln(dst, "    - for actions in public repos: Public repositories (read-only), with no permissions")
+		fprintln(dst, "    - for actions in private repos: Only select repositories, including each of them")
+		fprintln(dst, "  Repository permissions (for private repos only):")
+		for _, perm := range perms {
+			fprintf(dst, "    - %s: Read-only, to %s\n", perm.Name, strings.Join(perm.Purposes, "; "))
+		}
+	}
+	fprintln(dst, "  Account permissions: none")
+	fprintln(dst)
+	fprintln(dst, "Classic personal access token:")
+	if len(perms) == 0 {
+		fprintln(dst, "  Scopes: none")
+	} else {
+		fprintln(dst, "  Scopes: none for actions in public repos, or repo for actions in private repos")
+	}
+}
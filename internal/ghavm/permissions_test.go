@@ -0,0 +1,88 @@
+package ghavm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestRequiredPermissions(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		commands []string
+		want     []tokenPermission
+		wantErr  error
+	}{
+		"pin": {
+			commands: []string{"pin"},
+			want: []tokenPermission{
+				{Name: "Contents", Purposes: []string{"resolve releases, tags, and commits"}},
+				{Name: "Metadata", Purposes: []string{"check that action repos exist"}},
+			},
+		},
+		"check also reads action metadata": {
+			commands: []string{"list", "check"},
+			want: []tokenPermission{
+				{Name: "Contents", Purposes: []string{"resolve releases, tags, and commits", "read action.yml files"}},
+				{Name: "Metadata", Purposes: []string{"check that action repos exist"}},
+			},
+		},
+		"doctor needs no permissions": {
+			commands: []string{"doctor"},
+			want:     nil,
+		},
+		"unknown command": {
+			commands: []string{"pin", "frobnicate"},
+			wantErr:  errors.New(`unknown command "frobnicate", must be one of list, pin, upgrade, check, policy, analyze, doctor`),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := requiredPermissions(tc.commands)
+			if tc.wantErr != nil {
+				assert.Error(t, err, tc.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tc.want, "incorrect permissions")
+		})
+	}
+}
+
+func TestRenderPermissions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("permissions", func(t *testing.T) {
+		t.Parallel()
+		perms, err := requiredPermissions([]string{"upgrade"})
+		assert.NilError(t, err)
+		var buf strings.Builder
+		renderPermissions(&buf, []string{"upgrade"}, perms)
+		assert.Equal(t, buf.String(), `Token permissions required by ghavm upgrade:
+
+Fine-grained personal access token:
+  Repository access:
+    - for actions in public repos: Public repositories (read-only), with no permissions
+    - for actions in private repos: Only select repositories, including each of them
+  Repository permissions (for private repos only):
+    - Contents: Read-only, to resolve releases, tags, and commits
+    - Metadata: Read-only, to check that action repos exist
+  Account permissions: none
+
+Classic personal access token:
+  Scopes: none for actions in public repos, or repo for actions in private repos
+`, "incorrect output")
+	})
+
+	t.Run("no permissions", func(t *testing.T) {
+		t.Parallel()
+		var buf strings.Builder
+		renderPermissions(&buf, []string{"doctor"}, nil)
+		assert.Contains(t, buf.String(), "  Repository permissions: none\n", "incorrect output")
+		assert.Contains(t, buf.String(), "  Scopes: none\n", "incorrect output")
+	})
+}
@@ -0,0 +1,493 @@
+package ghavm
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// policyFileName is the name of the policy file ghavm looks for at the root
+// of the repo when no policy file is given.
+const policyFileName = ".ghavm-policy.yaml"
+
+// Policy output formats, in addition to [outputText] and [outputJSON].
+const outputSARIF = "sarif"
+
+// policy is a set of rules every action step must follow, loaded from a
+// policy file using the same YAML subset as the config file:
+//
+//	require-pinned: true
+//	require-verified: true
+//	min-age: 7d
+//	deny-deprecated-runtimes: true
+//	allowed-owners:
+//	  - actions
+//	  - myorg
+//	denied-actions:
+//	  - some-org/*
+//	denied-versions:
+//	  - actions/foo@v4.2.0
+//	constraints:
+//	  actions/checkout: ">=4"
+type policy struct {
+	// RequirePinned requires every action to be pinned to a full commit
+	// hash.
+	RequirePinned bool
+	// RequireVerified requires the current release of every action to have a
+	// verified signature.
+	RequireVerified bool
+	// MinAge, if non-zero, requires the current commit of every action to
+	// have been committed at least this long ago.
+	MinAge time.Duration
+	// DenyDeprecatedRuntimes denies actions whose action.yml targets a Node
+	// runtime deprecated by GitHub.
+	DenyDeprecatedRuntimes bool
+	// AllowedOwners, if given, denies actions published by any other owner.
+	AllowedOwners []string
+	// DeniedActions denies actions matching any of these patterns.
+	DeniedActions []string
+	// DeniedVersions maps canonical repo names to versions that may not be
+	// used.
+	DeniedVersions map[string][]string
+	// Constraints requires the current versions of matching actions to
+	// satisfy a version constraint. The first entry whose pattern matches an
+	// action applies.
+	Constraints []actionConstraint
+}
+
+// policyRules describes each rule that may appear in a policy file, keyed by
+// the name used in the file and reported with each violation.
+var policyRules = map[string]string{
+	"require-pinned":           "Actions must be pinned to a full commit hash",
+	"require-verified":         "Actions must use releases with verified signatures",
+	"min-age":                  "Actions must use commits older than the minimum age",
+	"deny-deprecated-runtimes": "Actions must not target a deprecated Node runtime",
+	"allowed-owners":           "Actions must be published by an allowed owner",
+	"denied-actions":           "Actions must not be denied by name",
+	"denied-versions":          "Actions must not use a denied version",
+	"constraints":              "Actions must satisfy their version constraints",
+}
+
+var errEmptyPolicy = errors.New("policy must configure at least one rule")
+
+// empty returns true if the policy has no rules.
+func (p policy) empty() bool {
+	return !p.RequirePinned && !p.RequireVerified && p.MinAge == 0 && !p.DenyDeprecatedRuntimes && len(p.AllowedOwners) == 0 && len(p.DeniedActions) == 0 && len(p.DeniedVersions) == 0 && len(p.Constraints) == 0
+}
+
+// needsVersions returns true if evaluating the policy requires resolving each
+// step's current version.
+func (p policy) needsVersions() bool {
+	return p.RequireVerified || p.MinAge > 0 || p.DenyDeprecatedRuntimes || len(p.DeniedVersions) > 0 || len(p.Constraints) > 0
+}
+
+// loadPolicy loads the policy file at the given path. If path is empty, the
+// default policy file at the root of the current repo is loaded. Unlike the
+// config file, a policy file is required.
+func loadPolicy(path string) (policy, error) {
+	if path == "" {
+		path = filepath.Join(findRepoRoot("."), policyFileName)
+	}
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return policy{}, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	p, err := parsePolicy(string(content))
+	if err != nil {
+		return policy{}, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	if p.empty() {
+		return policy{}, fmt.Errorf("invalid policy file %s: %w", path, errEmptyPolicy)
+	}
+	return p, nil
+}
+
+// parsePolicy parses the contents of a policy file.
+func parsePolicy(content string) (policy, error) {
+	nodes, err := parseSimpleYAML(content)
+	if err != nil {
+		return policy{}, err
+	}
+	var p policy
+	for _, node := range nodes {
+		if !node.IsKey() {
+			return policy{}, fmt.Errorf("line %d: expected \"key: value\", got %q", node.Line, node.Text)
+		}
+		key, value := node.Key, node.Value
+		switch key {
+		case "require-pinned", "require-verified", "deny-deprecated-runtimes":
+			if value != "true" && value != "false" {
+				return policy{}, fmt.Errorf("line %d: %s must be true or false", node.Line, key)
+			}
+			switch key {
+			case "require-pinned":
+				p.RequirePinned = value == "true"
+			case "require-verified":
+				p.RequireVerified = value == "true"
+			default:
+				p.DenyDeprecatedRuntimes = value == "true"
+			}
+		case "min-age":
+			age, err := parseAge(value)
+			if err != nil {
+				return policy{}, fmt.Errorf("line %d: %s %w", node.Line, key, err)
+			}
+			p.MinAge = age
+		case "allowed-owners", "denied-actions", "denied-versions":
+			if value != "" {
+				return policy{}, fmt.Errorf("line %d: %s must be a list", node.Line, key)
+			}
+			if err := p.parseList(key, node.Children); err != nil {
+				return policy{}, err
+			}
+		case "constraints":
+			if value != "" {
+				return policy{}, fmt.Errorf("line %d: %s must be a mapping of actions to version constraints", node.Line, key)
+			}
+			constraints, err := parseConstraints(node.Children)
+			if err != nil {
+				return policy{}, err
+			}
+			p.Constraints = append(p.Constraints, constraints...)
+		default:
+			return policy{}, fmt.Errorf("line %d: unknown key %q", node.Line, key)
+		}
+	}
+	return p, nil
+}
+
+// parseList parses the items of one of the policy's list rules.
+func (p *policy) parseList(rule string, items []*yamlNode) error {
+	for _, item := range items {
+		if !item.List {
+			return fmt.Errorf("line %d: expected a list item (\"- value\"), got %q", item.Line, item.Text)
+		}
+		switch rule {
+		case "allowed-owners":
+			if err := validateOwner(item.Value); err != nil {
+				return fmt.Errorf("line %d: invalid owner: %w", item.Line, err)
+			}
+			p.AllowedOwners = append(p.AllowedOwners, item.Value)
+		case "denied-actions":
+			if err := validatePattern(item.Value); err != nil {
+				return fmt.Errorf("line %d: invalid action pattern: %w", item.Line, err)
+			}
+			p.DeniedActions = append(p.DeniedActions, item.Value)
+		case "denied-versions":
+			repo, version, err := parseDeniedVersion(item.Value)
+			if err != nil {
+				return fmt.Errorf("line %d: denied version %w", item.Line, err)
+			}
+			if p.DeniedVersions == nil {
+				p.DeniedVersions = make(map[string][]string)
+			}
+			p.DeniedVersions[repo] = append(p.DeniedVersions[repo], version)
+		}
+	}
+	return nil
+}
+
+// EvaluatePolicy resolves each step's current version, if required by the
+// policy, and returns a finding for every step that violates one of its
+// rules. No files are modified.
+func (e *Engine) EvaluatePolicy(ctx context.Context, p policy) ([]Finding, error) {
+	if p.empty() {
+		return nil, errEmptyPolicy
+	}
+	if p.needsVersions() {
+		// a release's signature is only known once its upgrade candidates
+		// have been fetched
+		mode := ModeCurrent
+		if p.RequireVerified {
+			mode = ModeCompat
+		}
+		if err := e.resolveSteps(ctx, mode); err != nil {
+			return nil, fmt.Errorf("failed to resolve commit refs: %w", err)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		findings []Finding
+	)
+	addFinding := func(f Finding) {
+		mu.Lock()
+		defer mu.Unlock()
+		findings = append(findings, f)
+	}
+
+	if p.DenyDeprecatedRuntimes {
+		e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseRuntimes, e.root.StepCount()))
+		err := e.forEachStep(ctx, func(ctx context.Context, workflow Workflow, step *Step) error {
+			msg, err := e.checkDeprecatedRuntime(ctx, workflow, step)
+			if err != nil {
+				return err
+			}
+			if msg != "" {
+				addFinding(Finding{
+					Check:    "deny-deprecated-runtimes",
+					Priority: PriorityHigh,
+					Workflow: workflow.FilePath,
+					Step:     *step,
+					Msg:      msg,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check action runtimes: %w", err)
+		}
+		e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+		e.phaseLog.ShowDiagnostics()
+	}
+
+	if p.MinAge > 0 {
+		cutoff := time.Now().Add(-p.MinAge)
+		e.phaseLog.StartPhase(e.msgs.Sprintf(msgPhaseCommitAges, e.root.StepCount()))
+		err := e.forEachStep(ctx, func(ctx context.Context, workflow Workflow, step *Step) error {
+			current := step.Action.Release
+			if !current.Exists() {
+				return nil
+			}
+			date, err := e.gh.GetCommitDate(ctx, step.Action.Repo(), current.CommitHash)
+			if err != nil {
+				return fmt.Errorf("failed to get commit date: %w", err)
+			}
+			if date.After(cutoff) {
+				addFinding(Finding{
+					Check:    "min-age",
+					Priority: PriorityHigh,
+					Workflow: workflow.FilePath,
+					Step:     *step,
+					Msg:      fmt.Sprintf("commit %s was committed on %s, more recently than the minimum age of %s", current.CommitHash, date.Format(time.DateOnly), formatAge(p.MinAge)),
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check commit ages: %w", err)
+		}
+		e.phaseLog.FinishPhase(e.msgs.Sprintf(msgDone))
+		e.phaseLog.ShowDiagnostics()
+	}
+
+	for _, workflow := range e.root.Workflows {
+		for _, step := range workflow.Steps {
+			for _, f := range evaluateStepPolicy(step, p) {
+				f.Workflow = workflow.FilePath
+				addFinding(f)
+			}
+		}
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// evaluateStepPolicy returns a finding for each rule the step violates,
+// except for rules that require fetching action metadata.
+func evaluateStepPolicy(step Step, p policy) []Finding {
+	var (
+		action   = step.Action
+		findings []Finding
+	)
+	violation := func(rule, msg string) {
+		findings = append(findings, Finding{Check: rule, Priority: PriorityHigh, Step: step, Msg: msg})
+	}
+
+	if p.RequirePinned && !isFullCommitHash(action.Ref) {
+		violation("require-pinned", fmt.Sprintf("ref %s is not a full commit hash", action.Ref))
+	}
+	if len(p.AllowedOwners) > 0 {
+		if f, found := checkAllowedOwner(step, p.AllowedOwners); found {
+			findings = append(findings, f)
+		}
+	}
+	for _, pattern := range p.DeniedActions {
+		if matchesPattern(action.Name, pattern) {
+			violation("denied-actions", fmt.Sprintf("action matches denied pattern %s", pattern))
+			break
+		}
+	}
+	if p.RequireVerified {
+		switch {
+		case !action.Release.Exists():
+			violation("require-verified", "current version could not be resolved to check its signature")
+		case !action.Release.Verified:
+			violation("require-verified", fmt.Sprintf("version %s does not have a verified signature", cmp.Or(action.Release.Version, action.Release.CommitHash)))
+		}
+	}
+	if p.MinAge > 0 && !action.Release.Exists() {
+		violation("min-age", "current version could not be resolved to check its age")
+	}
+	if denied := p.DeniedVersions[canonicalName(action.Repo())]; len(denied) > 0 && action.Release.Exists() {
+		for _, version := range denied {
+			isDenied := func(v string) bool { return sameVersion(v, version) }
+			if isDenied(action.Release.Version) || slices.ContainsFunc(action.VersionTags, isDenied) {
+				violation("denied-versions", fmt.Sprintf("version %s is denied", version))
+				break
+			}
+		}
+	}
+	for _, ac := range p.Constraints {
+		if !matchesPattern(action.Name, ac.Pattern) {
+			continue
+		}
+		switch {
+		case !action.Release.Exists():
+			violation("constraints", fmt.Sprintf("current version could not be resolved to check constraint %s", ac.Constraint))
+		case !ac.Constraint.allows(action.Release.Version):
+			violation("constraints", fmt.Sprintf("version %s does not satisfy constraint %s", cmp.Or(action.Release.Version, action.Release.CommitHash), ac.Constraint))
+		}
+		break
+	}
+	return findings
+}
+
+// formatAge formats an age as a whole number of days if possible, as it would
+// usually be given in a policy file.
+func formatAge(age time.Duration) string {
+	if age%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", age/(24*time.Hour))
+	}
+	return age.String()
+}
+
+// policyReport is the JSON representation of a policy evaluation.
+type policyReport struct {
+	Passed     bool              `json:"passed"`
+	Violations []policyViolation `json:"violations"`
+}
+
+// policyViolation is the JSON representation of a single policy violation.
+type policyViolation struct {
+	Rule     string `json:"rule"`
+	Workflow string `json:"workflow"`
+	Line     int    `json:"line"`
+	Action   string `json:"action"`
+	Ref      string `json:"ref"`
+	Message  string `json:"message"`
+}
+
+// writePolicyJSON writes the findings of a policy evaluation to dst as JSON,
+// optionally with workflow paths relative to their repo roots (see
+// [workflowPath]).
+func writePolicyJSON(dst io.Writer, findings []Finding, relative bool) error {
+	report := policyReport{
+		Passed:     len(findings) == 0,
+		Violations: make([]policyViolation, 0, len(findings)),
+	}
+	for _, f := range findings {
+		report.Violations = append(report.Violations, policyViolation{
+			Rule:     f.Check,
+			Workflow: workflowPath(f.Workflow, relative),
+			Line:     f.Step.LineNumber + 1,
+			Action:   f.Step.Action.Name,
+			Ref:      f.Step.Action.Ref,
+			Message:  f.Msg,
+		})
+	}
+	return writeJSON(dst, report)
+}
+
+// sarifLog is the minimal subset of a SARIF 2.1.0 log needed for code
+// scanning tools to display policy violations.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writePolicySARIF writes the findings of a policy evaluation to dst as a
+// SARIF log, with workflow paths relative to their repo roots as code
+// scanning expects.
+func writePolicySARIF(dst io.Writer, findings []Finding) error {
+	rules := make([]sarifRule, 0, len(policyRules))
+	for id, desc := range policyRules {
+		rules = append(rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: desc}})
+	}
+	slices.SortFunc(rules, func(a, b sarifRule) int { return cmp.Compare(a.ID, b.ID) })
+
+	results := make([]sarifResult, 0, len(findings))
+	for _, f := range findings {
+		results = append(results, sarifResult{
+			RuleID:  f.Check,
+			Level:   "error",
+			Message: sarifMessage{Text: fmt.Sprintf("%s@%s: %s", f.Step.Action.Name, f.Step.Action.Ref, f.Msg)},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: workflowPath(f.Workflow, true)},
+					Region:           sarifRegion{StartLine: f.Step.LineNumber + 1},
+				},
+			}},
+		})
+	}
+
+	return writeJSON(dst, sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "ghavm",
+				InformationURI: "https://github.com/mccutchen/ghavm",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	})
+}
@@ -0,0 +1,326 @@
+package ghavm
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestParsePolicy(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		content string
+		want    policy
+		wantErr error
+	}{
+		"every rule": {
+			content: `# org-wide action policy
+require-pinned: true
+require-verified: true
+min-age: 7d
+deny-deprecated-runtimes: false
+allowed-owners:
+  - actions
+  - "myorg"  # our own actions
+denied-actions:
+- sketchy/*
+denied-versions:
+  - Actions/Foo@v4.2.0
+  - actions/foo/sub@4.2.1
+constraints:
+  actions/checkout: ">=4"
+`,
+			want: policy{
+				RequirePinned:   true,
+				RequireVerified: true,
+				MinAge:          7 * 24 * time.Hour,
+				AllowedOwners:   []string{"actions", "myorg"},
+				DeniedActions:   []string{"sketchy/*"},
+				DeniedVersions: map[string][]string{
+					"actions/foo": {"v4.2.0", "v4.2.1"},
+				},
+				Constraints: []actionConstraint{
+					{Pattern: "actions/checkout", Constraint: versionConstraint{{Op: ">=", Version: "v4"}}},
+				},
+			},
+		},
+		"unknown key": {
+			content: "require-signed: true\n",
+			wantErr: errors.New(`line 1: unknown key "require-signed"`),
+		},
+		"invalid boolean": {
+			content: "require-pinned: yes\n",
+			wantErr: errors.New("line 1: require-pinned must be true or false"),
+		},
+		"list given a value": {
+			content: "allowed-owners: actions\n",
+			wantErr: errors.New("line 1: allowed-owners must be a list"),
+		},
+		"list item without dash": {
+			content: "allowed-owners:\n  actions\n",
+			wantErr: errors.New(`line 2: expected a list item ("- value"), got "actions"`),
+		},
+		"indentation after scalar rule": {
+			content: "require-pinned: true\n  - actions\n",
+			wantErr: errors.New("line 2: unexpected indentation"),
+		},
+		"invalid owner": {
+			content: "allowed-owners:\n  - actions/checkout\n",
+			wantErr: errors.New(`line 2: invalid owner: must be an owner name without slashes or wildcards (e.g. "actions"), got "actions/checkout"`),
+		},
+		"invalid denied version": {
+			content: "denied-versions:\n  - checkout@v4\n",
+			wantErr: errors.New(`line 2: denied version must be in owner/repo@version format, got "checkout@v4"`),
+		},
+		"invalid min age": {
+			content: "min-age: a week\n",
+			wantErr: errors.New(`line 1: min-age must be a number of days (e.g. 3d) or a duration (e.g. 36h), got "a week"`),
+		},
+		"invalid constraint": {
+			content: "constraints:\n  actions/checkout: latest\n",
+			wantErr: errors.New(`line 2: invalid constraint for actions/checkout: invalid version "latest"`),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parsePolicy(tc.content)
+			if tc.wantErr != nil {
+				assert.Error(t, err, tc.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tc.want, "incorrect policy")
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.yaml")
+	assert.NilError(t, os.WriteFile(path, []byte("require-pinned: false\n"), 0o600))
+	_, err := loadPolicy(path)
+	assert.Error(t, err, errors.New("invalid policy file "+path+": policy must configure at least one rule"))
+
+	_, err = loadPolicy(filepath.Join(dir, "missing.yaml"))
+	assert.Contains(t, err.Error(), "failed to read policy file", "incorrect error")
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+
+	t.Run("rules without versions", func(t *testing.T) {
+		t.Parallel()
+
+		root := Root{Workflows: map[string]Workflow{
+			"ci.yaml": {
+				FilePath: "ci.yaml",
+				Steps: []Step{
+					{LineNumber: 3, Action: Action{Name: "actions/checkout", Ref: commitA}},
+					{LineNumber: 5, Action: Action{Name: "actions/setup-go", Ref: "v5"}},
+					{LineNumber: 7, Action: Action{Name: "sketchy/action", Ref: commitB}},
+				},
+			},
+		}}
+		p := policy{
+			RequirePinned: true,
+			AllowedOwners: []string{"actions", "sketchy"},
+			DeniedActions: []string{"sketchy/*"},
+		}
+
+		// no versions need to be resolved, so no GitHub client is needed
+		engine := newEngine(root, nil, io.Discard, engineOpts{})
+		findings, err := engine.EvaluatePolicy(testCtx(), p)
+		assert.NilError(t, err)
+		assert.Equal(t, len(findings), 2, "incorrect number of findings")
+		assert.Equal(t, findings[0].Check, "require-pinned", "incorrect rule")
+		assert.Equal(t, findings[0].Msg, "ref v5 is not a full commit hash", "incorrect message")
+		assert.Equal(t, findings[1].Check, "denied-actions", "incorrect rule")
+		assert.Equal(t, findings[1].Msg, "action matches denied pattern sketchy/*", "incorrect message")
+	})
+
+	t.Run("rules with versions", func(t *testing.T) {
+		t.Parallel()
+
+		client := newTestClient(t, map[string]httpResponse{
+			// version tags
+			"2590b2f6ce": okResponse(`{
+				"data": {
+					"repository": {
+						"refs": {
+							"nodes": [
+								{"name": "v1.1.0", "target": {"oid": "` + commitB + `"}},
+								{"name": "v1.0.0", "target": {"oid": "` + commitA + `"}}
+							],
+							"pageInfo": {"hasNextPage": false, "endCursor": ""}
+						}
+					}
+				}
+			}`),
+		}, nil)
+		root := Root{Workflows: map[string]Workflow{
+			"ci.yaml": {
+				FilePath: "ci.yaml",
+				Steps: []Step{
+					{LineNumber: 1, Action: Action{Name: "owner/repo", Ref: commitA}},
+					{LineNumber: 2, Action: Action{Name: "owner/repo", Ref: commitB}},
+				},
+			},
+		}}
+		p := policy{
+			DeniedVersions: map[string][]string{"owner/repo": {"v1.0.0"}},
+			Constraints: []actionConstraint{
+				{Pattern: "owner/*", Constraint: versionConstraint{{Op: ">=", Version: "v1.1"}}},
+			},
+		}
+
+		engine := newEngine(root, client, io.Discard, engineOpts{TrustHashes: true})
+		findings, err := engine.EvaluatePolicy(testCtx(), p)
+		assert.NilError(t, err)
+		assert.Equal(t, len(findings), 2, "incorrect number of findings")
+		for _, f := range findings {
+			assert.Equal(t, f.Step.LineNumber, 1, "only the step on v1.0.0 should violate the policy")
+		}
+		assert.Equal(t, findings[0].Msg, "version v1.0.0 is denied", "incorrect message")
+		assert.Equal(t, findings[1].Msg, "version v1.0.0 does not satisfy constraint >=v1.1", "incorrect message")
+	})
+
+	t.Run("signatures and commit ages", func(t *testing.T) {
+		t.Parallel()
+
+		client := newTestClient(t, map[string]httpResponse{
+			// version tags
+			"2590b2f6ce": okResponse(`{
+				"data": {
+					"repository": {
+						"refs": {
+							"nodes": [
+								{"name": "v1.1.0", "target": {"oid": "` + commitB + `"}},
+								{"name": "v1.0.0", "target": {"oid": "` + commitA + `"}}
+							],
+							"pageInfo": {"hasNextPage": false, "endCursor": ""}
+						}
+					}
+				}
+			}`),
+			// releases
+			"6104c8d776": okResponse(`{
+				"data": {
+					"repository": {
+						"releases": {
+							"pageInfo": {"hasNextPage": false, "endCursor": ""},
+							"nodes": [
+								{"tag": {"target": {"oid": "` + commitB + `", "signature": {"isValid": true}}}, "tagName": "v1.1.0"},
+								{"tag": {"target": {"oid": "` + commitA + `"}}, "tagName": "v1.0.0"}
+							]
+						}
+					}
+				}
+			}`),
+		}, map[string]httpResponse{
+			"GET /repos/owner/repo/git/commits/" + commitA: okResponse(`{"sha": "` + commitA + `", "committer": {"date": "2020-01-01T00:00:00Z"}}`),
+			"GET /repos/owner/repo/git/commits/" + commitB: okResponse(`{"sha": "` + commitB + `", "committer": {"date": "2999-01-01T00:00:00Z"}}`),
+		})
+		root := Root{Workflows: map[string]Workflow{
+			"ci.yaml": {
+				FilePath: "ci.yaml",
+				Steps: []Step{
+					{LineNumber: 1, Action: Action{Name: "owner/repo", Ref: commitA}},
+					{LineNumber: 2, Action: Action{Name: "owner/repo", Ref: commitB}},
+				},
+			},
+		}}
+		p := policy{RequireVerified: true, MinAge: 7 * 24 * time.Hour}
+
+		engine := newEngine(root, client, io.Discard, engineOpts{TrustHashes: true})
+		findings, err := engine.EvaluatePolicy(testCtx(), p)
+		assert.NilError(t, err)
+		assert.Equal(t, len(findings), 2, "incorrect number of findings")
+		assert.Equal(t, findings[0].Step.LineNumber, 1, "incorrect step")
+		assert.Equal(t, findings[0].Check, "require-verified", "incorrect rule")
+		assert.Equal(t, findings[0].Msg, "version v1.0.0 does not have a verified signature", "incorrect message")
+		assert.Equal(t, findings[1].Step.LineNumber, 2, "incorrect step")
+		assert.Equal(t, findings[1].Check, "min-age", "incorrect rule")
+		assert.Equal(t, findings[1].Msg, "commit "+commitB+" was committed on 2999-01-01, more recently than the minimum age of 7d", "incorrect message")
+	})
+}
+
+func TestWritePolicyReports(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0o700))
+	workflow := filepath.Join(dir, ".github", "workflows", "ci.yaml")
+	findings := []Finding{
+		{
+			Check:    "require-pinned",
+			Priority: PriorityHigh,
+			Workflow: workflow,
+			Step:     Step{LineNumber: 9, Action: Action{Name: "actions/checkout", Ref: "v4"}},
+			Msg:      "ref v4 is not a full commit hash",
+		},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		var buf strings.Builder
+		assert.NilError(t, writePolicyJSON(&buf, findings, false))
+		var got policyReport
+		assert.NilError(t, json.Unmarshal([]byte(buf.String()), &got))
+		assert.DeepEqual(t, got, policyReport{
+			Passed: false,
+			Violations: []policyViolation{{
+				Rule:     "require-pinned",
+				Workflow: workflow,
+				Line:     10,
+				Action:   "actions/checkout",
+				Ref:      "v4",
+				Message:  "ref v4 is not a full commit hash",
+			}},
+		}, "incorrect report")
+	})
+
+	t.Run("json without violations", func(t *testing.T) {
+		t.Parallel()
+		var buf strings.Builder
+		assert.NilError(t, writePolicyJSON(&buf, nil, false))
+		assert.Equal(t, buf.String(), "{\n  \"passed\": true,\n  \"violations\": []\n}\n", "incorrect report")
+	})
+
+	t.Run("sarif", func(t *testing.T) {
+		t.Parallel()
+		var buf strings.Builder
+		assert.NilError(t, writePolicySARIF(&buf, findings))
+		var got sarifLog
+		assert.NilError(t, json.Unmarshal([]byte(buf.String()), &got))
+		assert.Equal(t, got.Version, "2.1.0", "incorrect SARIF version")
+		assert.Equal(t, len(got.Runs), 1, "incorrect number of runs")
+		assert.Equal(t, len(got.Runs[0].Tool.Driver.Rules), len(policyRules), "every rule should be described")
+		assert.DeepEqual(t, got.Runs[0].Results, []sarifResult{{
+			RuleID:  "require-pinned",
+			Level:   "error",
+			Message: sarifMessage{Text: "actions/checkout@v4: ref v4 is not a full commit hash"},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: ".github/workflows/ci.yaml"},
+					Region:           sarifRegion{StartLine: 10},
+				},
+			}},
+		}}, "incorrect results")
+	})
+}
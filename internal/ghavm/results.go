@@ -0,0 +1,238 @@
+package ghavm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ChangeLevel classifies the difference between two versions of an action.
+type ChangeLevel string
+
+// Change levels.
+const (
+	ChangeNone    ChangeLevel = "none"
+	ChangePatch   ChangeLevel = "patch"
+	ChangeMinor   ChangeLevel = "minor"
+	ChangeMajor   ChangeLevel = "major"
+	ChangeUnknown ChangeLevel = "unknown"
+)
+
+// classifyChange returns the [ChangeLevel] between the current and proposed
+// releases. Changes to or from a release without a semver version cannot be
+// classified and are reported as [ChangeUnknown].
+func classifyChange(current, proposed Release) ChangeLevel {
+	switch {
+	case current.CommitHash == proposed.CommitHash:
+		return ChangeNone
+	case !isValidVersion(current.Version) || !isValidVersion(proposed.Version):
+		return ChangeUnknown
+	case majorVersion(current.Version) != majorVersion(proposed.Version):
+		return ChangeMajor
+	case majorMinorVersion(current.Version) != majorMinorVersion(proposed.Version):
+		return ChangeMinor
+	default:
+		return ChangePatch
+	}
+}
+
+// Plan describes the changes that pinning or upgrading would make in a dry
+// run, or the changes that were actually made otherwise.
+type Plan struct {
+	Changes []PlannedChange `json:"changes"`
+}
+
+// PlannedChange describes the change that pinning or upgrading would make to
+// a single step.
+type PlannedChange struct {
+	Workflow        string      `json:"workflow"`
+	Line            int         `json:"line"`
+	Action          string      `json:"action"`
+	CurrentRef      string      `json:"current_ref"`
+	CurrentVersion  string      `json:"current_version"`
+	CurrentCommit   string      `json:"current_commit"`
+	ProposedVersion string      `json:"proposed_version"`
+	ProposedCommit  string      `json:"proposed_commit"`
+	ProposedTree    string      `json:"proposed_tree,omitempty"`
+	Change          ChangeLevel `json:"change"`
+	// Group is a suggested key for batching related changes together (e.g.
+	// into a single pull request), if a grouping was requested.
+	Group string `json:"group,omitempty"`
+	// Owners are the owners of the workflow file according to its repo's
+	// CODEOWNERS file, if requested.
+	Owners []string `json:"owners,omitempty"`
+}
+
+// Ways of grouping planned changes.
+const (
+	groupByOwner  = "owner"
+	groupByChange = "change"
+)
+
+// groupPlan returns a copy of plan with each change's Group set according to
+// groupBy, which is either [groupByOwner], [groupByChange], or empty to leave
+// changes ungrouped.
+func groupPlan(plan Plan, groupBy string) Plan {
+	if groupBy == "" {
+		return plan
+	}
+	grouped := Plan{Changes: make([]PlannedChange, len(plan.Changes))}
+	for i, c := range plan.Changes {
+		switch groupBy {
+		case groupByOwner:
+			c.Group = Action{Name: canonicalName(c.Action)}.Owner()
+		case groupByChange:
+			c.Group = string(c.Change)
+		}
+		grouped.Changes[i] = c
+	}
+	return grouped
+}
+
+// buildPlan computes the changes the given rewrite strategy would make to the
+// resolved steps in root. Steps for which the strategy does not choose a
+// release (e.g. because they could not be resolved) are omitted, as are
+// steps that rewriting would leave unchanged, so that a dry run plans the
+// same changes that a real run applies, given the length of the commit
+// hashes written (see [writtenHash]).
+func buildPlan(root Root, strategy RewriteStrategy, hashLength int) Plan {
+	plan := Plan{
+		Changes: []PlannedChange{},
+	}
+	for _, key := range slices.Sorted(maps.Keys(root.Workflows)) {
+		w := root.Workflows[key]
+		for _, step := range w.Steps {
+			proposed := strategy(w, step)
+			if !proposed.Exists() || isNoOp(step, proposed, hashLength) {
+				continue
+			}
+			plan.Changes = append(plan.Changes, newPlannedChange(w, step, proposed))
+		}
+	}
+	return plan
+}
+
+// isNoOp returns true if pinning the step to the proposed release would
+// leave its `uses:` line exactly as it is, so that rewriting would not
+// modify it. Steps whose lines are not known are assumed to change.
+func isNoOp(step Step, proposed Release, hashLength int) bool {
+	if step.Line == "" {
+		return false
+	}
+	rewritten, ok := rewriteUsesLine(step.Line, step, proposed, hashLength)
+	return ok && rewritten == step.Line
+}
+
+// newPlannedChange describes the change from a step's current release to the
+// proposed release.
+func newPlannedChange(w Workflow, step Step, proposed Release) PlannedChange {
+	current := step.Action.Release
+	return PlannedChange{
+		Workflow:        w.FilePath,
+		Line:            step.LineNumber + 1,
+		Action:          step.Action.Name,
+		CurrentRef:      step.Action.Ref,
+		CurrentVersion:  current.Version,
+		CurrentCommit:   current.CommitHash,
+		ProposedVersion: proposed.Version,
+		ProposedCommit:  proposed.CommitHash,
+		ProposedTree:    proposed.TreeHash,
+		Change:          classifyChange(current, proposed),
+	}
+}
+
+// Report collects plans from multiple runs, keyed by repo, so that a single
+// document can cover many repos.
+type Report struct {
+	Repos map[string]Plan `json:"repos"`
+}
+
+// mergeReport records the plan for the given repo in the report file at path,
+// creating the file if necessary. Any existing plan for the same repo is
+// replaced, and plans for other repos are preserved.
+//
+// Concurrent writers are serialized via a lock on a separate path + ".lock"
+// file, which is left in place afterwards.
+func mergeReport(path string, repo string, plan Plan) error {
+	lock, err := lockFile(path + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock report file: %w", err)
+	}
+	defer mustClose(lock)
+
+	report := Report{}
+	data, err := os.ReadFile(filepath.Clean(path))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// start a new report
+	case err != nil:
+		return fmt.Errorf("failed to read report file: %w", err)
+	default:
+		if err := json.Unmarshal(data, &report); err != nil {
+			return fmt.Errorf("failed to parse existing report file %s: %w", path, err)
+		}
+	}
+	if report.Repos == nil {
+		report.Repos = make(map[string]Plan, 1)
+	}
+	report.Repos[repo] = plan
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, report); err != nil {
+		return err
+	}
+	if err := writeFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write report file: %w", err)
+	}
+	return nil
+}
+
+// readLockfile reads a plan previously written by --dry-run --output json,
+// which records the exact commit hash and version to pin for each action in
+// each workflow.
+func readLockfile(path string) (Plan, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return Plan{}, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return Plan{}, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+	}
+	for _, c := range plan.Changes {
+		if c.Workflow == "" || c.Action == "" || !isFullCommitHash(c.ProposedCommit) {
+			return Plan{}, fmt.Errorf("invalid lockfile %s: entry for %q in %q must have a workflow, action, and full proposed_commit hash", path, c.Action, c.Workflow)
+		}
+	}
+	return plan, nil
+}
+
+// writeJSON writes v to dst as indented JSON.
+func writeJSON(dst io.Writer, v any) error {
+	enc := json.NewEncoder(dst)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// renderPlan writes a human-readable version of the plan to dst.
+func (e *Engine) renderPlan(dst io.Writer, plan Plan) {
+	lastWorkflow := ""
+	for _, c := range plan.Changes {
+		if c.Workflow != lastWorkflow {
+			if lastWorkflow != "" {
+				fprintln(dst)
+			}
+			fprintln(dst, "workflow", e.style.Bold(e.workflowName(c.Workflow)))
+			lastWorkflow = c.Workflow
+		}
+		proposed := Release{Version: c.ProposedVersion, CommitHash: c.ProposedCommit}
+		fprintf(dst, "  line %d: %s → %s (%s)\n", c.Line, e.style.Boldf("%s@%s", c.Action, c.CurrentRef), proposed, c.Change)
+	}
+}
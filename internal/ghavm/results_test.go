@@ -0,0 +1,269 @@
+package ghavm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestClassifyChange(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		current  Release
+		proposed Release
+		expected ChangeLevel
+	}{
+		"same commit": {
+			current:  Release{Version: "v1.0.0", CommitHash: "aaa"},
+			proposed: Release{Version: "v1.0.0", CommitHash: "aaa"},
+			expected: ChangeNone,
+		},
+		"patch": {
+			current:  Release{Version: "v1.0.0", CommitHash: "aaa"},
+			proposed: Release{Version: "v1.0.1", CommitHash: "bbb"},
+			expected: ChangePatch,
+		},
+		"minor": {
+			current:  Release{Version: "v1.0.0", CommitHash: "aaa"},
+			proposed: Release{Version: "v1.1.0", CommitHash: "bbb"},
+			expected: ChangeMinor,
+		},
+		"major": {
+			current:  Release{Version: "v1.2.3", CommitHash: "aaa"},
+			proposed: Release{Version: "v2.0.0", CommitHash: "bbb"},
+			expected: ChangeMajor,
+		},
+		"prerelease of same version": {
+			current:  Release{Version: "v1.0.0-rc.1", CommitHash: "aaa"},
+			proposed: Release{Version: "v1.0.0", CommitHash: "bbb"},
+			expected: ChangePatch,
+		},
+		"current has no version": {
+			current:  Release{CommitHash: "aaa"},
+			proposed: Release{Version: "v1.0.0", CommitHash: "bbb"},
+			expected: ChangeUnknown,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, classifyChange(tc.current, tc.proposed), tc.expected, "incorrect change level")
+		})
+	}
+}
+
+func TestBuildPlan(t *testing.T) {
+	t.Parallel()
+	var (
+		v1 = Release{Version: "v1.0.0", CommitHash: "aaa111"}
+		v2 = Release{Version: "v2.0.0", CommitHash: "bbb222"}
+	)
+	root := Root{Workflows: map[string]Workflow{
+		"b.yaml": {
+			FilePath: "b.yaml",
+			Steps: []Step{
+				{LineNumber: 2, Action: Action{Name: "owner/repo", Ref: "v1", Release: v1, UpgradeCandidates: UpgradeCandidates{Latest: v2, LatestCompatible: v1}}},
+			},
+		},
+		"a.yaml": {
+			FilePath: "a.yaml",
+			Steps: []Step{
+				// unresolved steps are omitted
+				{LineNumber: 5, Action: Action{Name: "owner/missing", Ref: "v1"}},
+				{LineNumber: 9, Action: Action{Name: "owner/repo", Ref: "v2", Release: v2, UpgradeCandidates: UpgradeCandidates{Latest: v2, LatestCompatible: v2}}},
+				// steps whose lines would be left unchanged are omitted
+				{LineNumber: 12, Line: "  - uses: owner/repo@bbb222 # v2.0.0", Action: Action{Name: "owner/repo", Ref: "bbb222", Release: v2, UpgradeCandidates: UpgradeCandidates{Latest: v2, LatestCompatible: v2}}, Comment: "v2.0.0"},
+			},
+		},
+	}}
+
+	plan := buildPlan(root, rewriteStrategyForMode(ModeLatest), 0)
+	assert.DeepEqual(t, plan, Plan{Changes: []PlannedChange{
+		{
+			Workflow:        "a.yaml",
+			Line:            10,
+			Action:          "owner/repo",
+			CurrentRef:      "v2",
+			CurrentVersion:  "v2.0.0",
+			CurrentCommit:   "bbb222",
+			ProposedVersion: "v2.0.0",
+			ProposedCommit:  "bbb222",
+			Change:          ChangeNone,
+		},
+		{
+			Workflow:        "b.yaml",
+			Line:            3,
+			Action:          "owner/repo",
+			CurrentRef:      "v1",
+			CurrentVersion:  "v1.0.0",
+			CurrentCommit:   "aaa111",
+			ProposedVersion: "v2.0.0",
+			ProposedCommit:  "bbb222",
+			Change:          ChangeMajor,
+		},
+	}}, "incorrect plan")
+
+	buf := &bytes.Buffer{}
+	assert.NilError(t, writeJSON(buf, Plan{Changes: plan.Changes[1:]}))
+	assert.Equal(t, buf.String(), `{
+  "changes": [
+    {
+      "workflow": "b.yaml",
+      "line": 3,
+      "action": "owner/repo",
+      "current_ref": "v1",
+      "current_version": "v1.0.0",
+      "current_commit": "aaa111",
+      "proposed_version": "v2.0.0",
+      "proposed_commit": "bbb222",
+      "change": "major"
+    }
+  ]
+}
+`, "incorrect json")
+}
+
+func TestGroupPlan(t *testing.T) {
+	t.Parallel()
+	plan := Plan{Changes: []PlannedChange{
+		{Action: "actions/checkout", Change: ChangeMajor},
+		{Action: "MyOrg/deploy/staging", Change: ChangePatch},
+	}}
+
+	testCases := map[string]struct {
+		groupBy string
+		want    []string
+	}{
+		"ungrouped": {
+			groupBy: "",
+			want:    []string{"", ""},
+		},
+		"by owner": {
+			groupBy: groupByOwner,
+			want:    []string{"actions", "myorg"},
+		},
+		"by change": {
+			groupBy: groupByChange,
+			want:    []string{"major", "patch"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			grouped := groupPlan(plan, tc.groupBy)
+			got := make([]string, 0, len(grouped.Changes))
+			for _, c := range grouped.Changes {
+				got = append(got, c.Group)
+			}
+			assert.DeepEqual(t, got, tc.want, "incorrect groups")
+			assert.Equal(t, plan.Changes[0].Group, "", "original plan should not be modified")
+		})
+	}
+}
+
+func TestMergeReport(t *testing.T) {
+	t.Parallel()
+
+	readReport := func(t *testing.T, path string) Report {
+		t.Helper()
+		data, err := os.ReadFile(path) // #nosec G304
+		assert.NilError(t, err)
+		var report Report
+		assert.NilError(t, json.Unmarshal(data, &report))
+		return report
+	}
+	planFor := func(action string) Plan {
+		return Plan{Changes: []PlannedChange{{Workflow: "ci.yaml", Line: 1, Action: action, Change: ChangeMinor}}}
+	}
+
+	t.Run("merges plans by repo", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "report.json")
+		assert.NilError(t, mergeReport(path, "/src/a", planFor("actions/checkout")))
+		assert.NilError(t, mergeReport(path, "/src/b", planFor("actions/setup-go")))
+		assert.NilError(t, mergeReport(path, "/src/a", planFor("actions/cache")))
+		assert.DeepEqual(t, readReport(t, path), Report{
+			Repos: map[string]Plan{
+				"/src/a": planFor("actions/cache"),
+				"/src/b": planFor("actions/setup-go"),
+			},
+		}, "incorrect report")
+	})
+
+	t.Run("concurrent writers", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "report.json")
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NilError(t, mergeReport(path, fmt.Sprintf("repo-%d", i), planFor("actions/checkout")))
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, len(readReport(t, path).Repos), 10, "expected every repo in report")
+	})
+
+	t.Run("invalid existing report is an error", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "report.json")
+		assert.NilError(t, os.WriteFile(path, []byte("not json"), 0o600))
+		err := mergeReport(path, "/src/a", planFor("actions/checkout"))
+		if err == nil {
+			t.Fatal("expected error but got nil")
+		}
+		assert.Contains(t, err.Error(), "failed to parse existing report file", "error message")
+	})
+}
+
+func TestReadLockfile(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		content string
+		want    Plan
+		wantErr string
+	}{
+		"valid": {
+			content: `{"changes": [{"workflow": "ci.yaml", "action": "actions/checkout", "proposed_version": "v4.2.2", "proposed_commit": "11bd71901bbe5b1630ceea73d27597364c9af683"}]}`,
+			want: Plan{Changes: []PlannedChange{{
+				Workflow:        "ci.yaml",
+				Action:          "actions/checkout",
+				ProposedVersion: "v4.2.2",
+				ProposedCommit:  "11bd71901bbe5b1630ceea73d27597364c9af683",
+			}}},
+		},
+		"invalid json": {
+			content: "not json",
+			wantErr: "failed to parse lockfile",
+		},
+		"short commit hash": {
+			content: `{"changes": [{"workflow": "ci.yaml", "action": "actions/checkout", "proposed_commit": "11bd719"}]}`,
+			wantErr: `entry for "actions/checkout" in "ci.yaml" must have a workflow, action, and full proposed_commit hash`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "ghavm.lock.json")
+			assert.NilError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+			got, err := readLockfile(path)
+			if tc.wantErr != "" {
+				if err == nil {
+					t.Fatal("expected error but got nil")
+				}
+				assert.Contains(t, err.Error(), tc.wantErr, "error message")
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tc.want, "incorrect lockfile")
+		})
+	}
+}
@@ -2,18 +2,34 @@ package ghavm
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+
+	"golang.org/x/mod/semver"
 )
 
-// FindWorkflows finds any workflow yaml files in the standard location under
-// the given repo root dir.
-func FindWorkflows(paths []string) ([]string, error) {
+// FindWorkflows finds any workflow yaml files in the given paths or, if no
+// paths are given, in the standard location under the root of the git repo
+// containing the current directory (or the current directory itself, if it
+// is not inside a git repo).
+//
+// Templated workflow sources (e.g. ci.yaml.j2) found in the same places are
+// included if their file names match any of the given template patterns.
+//
+// An error is returned if any of the given paths (or the standard workflow
+// directory, if no paths are given) is missing or unreadable. A readable
+// directory with no workflow files in it is not an error.
+func FindWorkflows(paths []string, templatePatterns ...string) ([]string, error) {
 	if len(paths) == 0 {
-		return findWorkflowsInRepo("."), nil
+		return findWorkflowsInRepo(findRepoRoot("."), templatePatterns)
 	}
 
 	var files []string
@@ -25,10 +41,20 @@ func FindWorkflows(paths []string) ([]string, error) {
 		if info.IsDir() {
 			if gitInfo, err := os.Stat(filepath.Join(path, ".git")); err == nil {
 				if gitInfo.IsDir() {
-					files = append(files, findWorkflowsInRepo(path)...)
+					repoFiles, err := findWorkflowsInRepo(path, templatePatterns)
+					// a repo without a workflows dir is fine here, because
+					// we'll also look for workflows in the dir itself below
+					if err != nil && !errors.Is(err, fs.ErrNotExist) {
+						return nil, err
+					}
+					files = append(files, repoFiles...)
 				}
 			}
-			files = append(files, findWorkflowsInDir(path)...)
+			dirFiles, err := findWorkflowsInDir(path, templatePatterns)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, dirFiles...)
 		} else {
 			files = append(files, path)
 		}
@@ -36,24 +62,218 @@ func FindWorkflows(paths []string) ([]string, error) {
 	return files, nil
 }
 
-func findWorkflowsInRepo(rootDir string) []string {
+// findRepoRoot walks up from dir looking for the top level of a git repo,
+// like `git rev-parse --show-toplevel`. The result is relative to dir, so
+// that discovered workflow paths stay relative to the current directory. If
+// dir is not inside a git repo, dir itself is returned.
+func findRepoRoot(dir string) string {
+	start, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+	for candidate := start; ; {
+		// a .git file (rather than a dir) marks a worktree or submodule
+		if _, err := os.Stat(filepath.Join(candidate, ".git")); err == nil {
+			rel, err := filepath.Rel(start, candidate)
+			if err != nil {
+				return dir
+			}
+			return filepath.Join(dir, rel)
+		}
+		parent := filepath.Dir(candidate)
+		if parent == candidate {
+			return dir
+		}
+		candidate = parent
+	}
+}
+
+// workflowPath returns the path of the workflow file at path as shown in
+// output. If relative is set and the file is in a git repo, the path is
+// relative to the repo root (e.g. .github/workflows/ci.yaml), so that output
+// is the same wherever the repo is checked out. Otherwise, it is returned as
+// given.
+func workflowPath(path string, relative bool) string {
+	if relative {
+		if rel, ok := repoRelative(path); ok {
+			return rel
+		}
+	}
+	return path
+}
+
+// workflowName returns the short name of the workflow file at path as shown
+// in human-readable output, i.e. its path relative to the repo root as with
+// [workflowPath], or else its base name.
+func workflowName(path string, relative bool) string {
+	if relative {
+		if _, ok := repoRootOf(filepath.Dir(path)); ok {
+			return workflowPath(path, relative)
+		}
+	}
+	return filepath.Base(path)
+}
+
+// repoRelative returns the slash-separated path of the file at path relative
+// to the root of its git repo, or false if it is not in a git repo.
+func repoRelative(path string) (string, bool) {
+	root, ok := repoRootOf(filepath.Dir(path))
+	if !ok {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// repoRoots caches the repo root found by [repoRootOf] for each directory,
+// since a workflow's path may be made relative to its repo root for every
+// line of output that shows it.
+var repoRoots sync.Map // dir -> repo root, or "" if not in a git repo
+
+// repoRootOf returns the root of the git repo containing dir, or false if it
+// is not in a git repo.
+func repoRootOf(dir string) (string, bool) {
+	if cached, ok := repoRoots.Load(dir); ok {
+		root, _ := cached.(string)
+		return root, root != ""
+	}
+	root := findRepoRoot(dir)
+	if _, err := os.Stat(filepath.Join(root, ".git")); err != nil {
+		root = ""
+	}
+	repoRoots.Store(dir, root)
+	return root, root != ""
+}
+
+// inGitRepo returns true if dir is in a git repo.
+func inGitRepo(dir string) bool {
+	_, err := os.Stat(filepath.Join(findRepoRoot(dir), ".git"))
+	return err == nil
+}
+
+func findWorkflowsInRepo(rootDir string, templatePatterns []string) ([]string, error) {
 	workflowDir := filepath.Join(rootDir, ".github", "workflows")
-	return findWorkflowsInDir(workflowDir)
+	return findWorkflowsInDir(workflowDir, templatePatterns)
+}
+
+func findWorkflowsInDir(dir string, templatePatterns []string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workflow directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		// match *.yml and *.yaml
+		if matched, _ := filepath.Match("*.y*ml", entry.Name()); matched || isTemplated(entry.Name(), templatePatterns) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
 }
 
-func findWorkflowsInDir(dir string) []string {
-	workflowGlob := filepath.Join(dir, "*.y*ml") // match *.yml and *.yaml
-	files, err := filepath.Glob(workflowGlob)
+// findWorkflowsUnder finds the workflow files in every .github/workflows
+// directory within dir, at any depth, e.g. in the sub-projects of a monorepo.
+func findWorkflowsUnder(dir string, templatePatterns []string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" || d.Name() == "node_modules" {
+			return filepath.SkipDir
+		}
+		if d.Name() == "workflows" && filepath.Base(filepath.Dir(path)) == ".github" {
+			found, err := findWorkflowsInDir(path, templatePatterns)
+			if err != nil {
+				return err
+			}
+			files = append(files, found...)
+			return filepath.SkipDir
+		}
+		return nil
+	})
 	if err != nil {
-		panic(err) // only possible with illegal glob pattern
+		return nil, fmt.Errorf("failed to find workflows in %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// scopeWorkflows returns the given workflow files that are physically within
+// the scope directory, in their original order.
+func scopeWorkflows(files []string, scope string) ([]string, error) {
+	absScope, err := filepath.Abs(scope)
+	if err != nil {
+		return nil, err
+	}
+	var scoped []string
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(absScope, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		scoped = append(scoped, f)
+	}
+	return scoped, nil
+}
+
+// isTemplated returns true if the given file name matches any of the given
+// template patterns (e.g. "*.yaml.j2").
+func isTemplated(name string, templatePatterns []string) bool {
+	for _, pattern := range templatePatterns {
+		if matched, _ := filepath.Match(pattern, filepath.Base(name)); matched {
+			return true
+		}
 	}
-	return files
+	return false
+}
+
+// validateTemplatePattern checks that a template pattern is a valid glob
+// matching file names, rather than paths.
+func validateTemplatePattern(pattern string) error {
+	if pattern == "" || strings.ContainsAny(pattern, `/\`) {
+		return fmt.Errorf("must be a file name pattern without slashes (e.g. \"*.yaml.j2\"), got %q", pattern)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return nil
 }
 
 // scanOpts configures the workflow scanner.
 type scanOpts struct {
-	Selects  []string
+	Selects []string
+	// Excludes is an ordered list of exclude rules. A rule prefixed with "!"
+	// re-includes matching actions, gitignore-style, and the last matching
+	// rule wins.
 	Excludes []string
+	// TemplatePatterns marks workflows whose file names match any of these
+	// patterns as templated sources (see [Workflow.Templated]).
+	TemplatePatterns []string
+	// RefKinds, if non-empty, limits the scan to actions whose refs are of
+	// these kinds (e.g. only pinned actions), after selects and excludes are
+	// applied.
+	RefKinds []RefKind
+	// FixMissingOwner treats action references missing an owner (e.g.
+	// "checkout@v4") as references to first-party actions/* actions, which
+	// are then rewritten with the owner, instead of skipping them with a
+	// warning.
+	FixMissingOwner bool
+	// ChangedSince, if set, limits the scan to steps whose uses: values were
+	// added or changed since this git ref.
+	ChangedSince string
 }
 
 // ScanWorkflows walks the given files and parses them into a tree of
@@ -72,44 +292,224 @@ func ScanWorkflows(filePaths []string, opts scanOpts) (Root, error) {
 	return root, nil
 }
 
+// scanFile scans a single workflow file for action steps.
+//
+// Files are treated as a flat sequence of lines, so a file containing
+// multiple YAML documents separated by `---` is scanned (and later rewritten)
+// exactly like a single document, with line numbers counting straight through
+// any document separators.
 func scanFile(filePath string, opts scanOpts) (Workflow, error) {
 	f, err := os.Open(filepath.Clean(filePath))
 	if err != nil {
 		return Workflow{}, fmt.Errorf("scanner: failed to open file %s: %w", filePath, err)
 	}
+	defer func() { _ = f.Close() }()
+	workflow, err := scanContent(filePath, f, opts)
+	if err != nil || opts.ChangedSince == "" {
+		return workflow, err
+	}
+	return onlyChangedSince(workflow, opts.ChangedSince, opts)
+}
 
-	var steps []Step
-	scanner := bufio.NewScanner(f)
+// scanContent scans workflow content read from r for action steps, using
+// filePath only to identify the workflow.
+func scanContent(filePath string, r io.Reader, opts scanOpts) (Workflow, error) {
+	var (
+		steps    []Step
+		warnings []string
+		// block is the multi-line `uses:` value being assembled, if any
+		block *usesBlock
+		// jobs tracks the job each line belongs to, and stepJobs records
+		// the job of each step, so that steps in matrix jobs can be
+		// flagged once every job's strategy is known
+		jobs     = newJobTracker()
+		stepJobs []int
+	)
+	scanner := bufio.NewScanner(r)
 	for lineNum := 0; scanner.Scan(); lineNum++ {
 		line := scanner.Text()
-		action := maybeParseAction(line)
-		if action == (Action{}) {
+		jobs.track(line)
+		if block != nil {
+			if block.add(line) {
+				continue
+			}
+			warnings = append(warnings, block.warning())
+			block = nil
+		}
+		if b, ok := parseUsesBlock(lineNum, line); ok {
+			block = b
 			continue
 		}
-		// Excludes take precedence, so we select first then exclude
-		if len(opts.Selects) > 0 && !matchesAnyPattern(action.Name, opts.Selects) {
+		m, ok := parseUsesLine(line)
+		if !ok {
+			if url, ok := parseURLUsesLine(line); ok {
+				warnings = append(warnings, urlUsesWarning(lineNum, url))
+				continue
+			}
+			if m, ok = parseOwnerlessUsesLine(line); !ok {
+				continue
+			}
+			if !opts.FixMissingOwner {
+				warnings = append(warnings, fmt.Sprintf("line %d: action reference %s@%s missing owner; did you mean %s/%s@%s? (use --fix-missing-owner to treat it as such)", lineNum+1, m.Name, m.Ref, firstPartyOwner, m.Name, m.Ref))
+				continue
+			}
+			m.Name = firstPartyOwner + "/" + m.Name
+		}
+		action := Action{Name: m.Name, Ref: m.Ref}
+		if !isSelected(action.Name, opts) {
 			continue
 		}
-		if len(opts.Excludes) > 0 && matchesAnyPattern(action.Name, opts.Excludes) {
+		if len(opts.RefKinds) > 0 && !slices.Contains(opts.RefKinds, action.RefKind()) {
 			continue
 		}
+		comment, originalRef := splitOriginalRef(m.Comment)
 		steps = append(steps, Step{
-			LineNumber: lineNum,
-			Action:     action,
+			LineNumber:  lineNum,
+			Line:        line,
+			Action:      action,
+			Comment:     comment,
+			OriginalRef: originalRef,
 		})
+		stepJobs = append(stepJobs, jobs.job)
 	}
 	if err := scanner.Err(); err != nil {
 		return Workflow{}, fmt.Errorf("error scanning file %s: %w", filePath, err)
 	}
+	if block != nil {
+		warnings = append(warnings, block.warning())
+	}
+	for i, job := range stepJobs {
+		steps[i].Matrix = jobs.matrix[job]
+	}
 	return Workflow{
-		FilePath: filePath,
-		Steps:    steps,
+		FilePath:  filePath,
+		Steps:     steps,
+		Templated: isTemplated(filePath, opts.TemplatePatterns),
+		Warnings:  warnings,
 	}, nil
 }
 
+// jobTracker tracks the job that each line of a workflow belongs to, and
+// which jobs use a matrix strategy, e.g.:
+//
+//	jobs:
+//	  test:
+//	    strategy:
+//	      matrix:
+//	        go-version: [stable, oldstable]
+//
+// Like the rest of the scanner, it relies only on indentation rather than
+// parsing workflows as YAML, so it is deliberately minimal.
+type jobTracker struct {
+	// inJobs is true while inside the top-level `jobs:` mapping
+	inJobs bool
+	// jobIndent is the indentation of job keys, or -1 until the first job
+	jobIndent int
+	// job identifies the current job, counting from 1, or is 0 outside of
+	// any job. Jobs are counted rather than named, since a file with
+	// multiple documents may reuse job names.
+	job   int
+	count int
+	// strategyIndent is the indentation of the current job's `strategy:`
+	// key, or -1 outside of it
+	strategyIndent int
+	// matrix records the jobs using a matrix strategy
+	matrix map[int]bool
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{jobIndent: -1, strategyIndent: -1, matrix: make(map[int]bool)}
+}
+
+// track updates the job context with the next line of the workflow.
+func (t *jobTracker) track(line string) {
+	content := strings.TrimSpace(line)
+	if content == "" || strings.HasPrefix(content, "#") {
+		return
+	}
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	key, rest, isKey := strings.Cut(content, ":")
+	isKey = isKey && !strings.ContainsAny(key, " \t")
+	switch {
+	case indent == 0:
+		// a new top-level key (or document) ends any previous jobs
+		t.inJobs = key == "jobs" && isKey
+		t.jobIndent, t.job, t.strategyIndent = -1, 0, -1
+	case !t.inJobs:
+	case t.jobIndent == -1 || indent == t.jobIndent:
+		if isKey {
+			t.count++
+			t.jobIndent, t.job, t.strategyIndent = indent, t.count, -1
+		}
+	case t.job == 0 || indent < t.jobIndent:
+	case key == "strategy" && isKey:
+		t.strategyIndent = indent
+		// e.g. "strategy: {matrix: {os: [ubuntu, macos]}}"
+		if strings.Contains(rest, "matrix") {
+			t.matrix[t.job] = true
+		}
+	case t.strategyIndent >= 0 && indent <= t.strategyIndent:
+		t.strategyIndent = -1
+	case t.strategyIndent >= 0 && key == "matrix" && isKey:
+		t.matrix[t.job] = true
+	}
+}
+
+// usesBlockPattern matches a `uses:` key whose value is a YAML block scalar
+// (e.g. "uses: >-"), which continues on the following, more indented lines.
+var usesBlockPattern = regexp.MustCompile(`^(\s*-?\s*)uses:\s*[|>][-+0-9]*\s*(?:#.*)?$`)
+
+// usesBlock is a `uses:` value given as a multi-line YAML block scalar, e.g.:
+//
+//   - uses: >-
+//     actions/checkout@v4
+//
+// Steps are found and rewritten one line at a time, so such values cannot be
+// managed. Instead, they are assembled only to warn about the steps that will
+// be skipped.
+type usesBlock struct {
+	lineNum int
+	indent  int
+	value   []string
+}
+
+// parseUsesBlock returns a [usesBlock] if the given line starts one.
+func parseUsesBlock(lineNum int, line string) (*usesBlock, bool) {
+	m := usesBlockPattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	return &usesBlock{lineNum: lineNum, indent: len(m[1])}, true
+}
+
+// add adds the given line to the block's value, returning false if the line
+// is not part of the block.
+func (b *usesBlock) add(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return true
+	}
+	if len(line)-len(strings.TrimLeft(line, " \t")) <= b.indent {
+		return false
+	}
+	b.value = append(b.value, trimmed)
+	return true
+}
+
+// warning describes the step skipped because of the block.
+func (b *usesBlock) warning() string {
+	value := strings.Join(b.value, "")
+	if value == "" {
+		value = "(empty)"
+	}
+	return fmt.Sprintf("line %d: skipping multi-line uses: value %s, which must be on a single line to be managed", b.lineNum+1, value)
+}
+
 // matchesPattern checks if a string matches a pattern with optional trailing wildcard.
 // Supports patterns like "actions/*" but not complex patterns like "*/setup".
+// The owner/repo portions of s and pattern are compared case-insensitively.
 func matchesPattern(s, pattern string) bool {
+	s, pattern = canonicalName(s), canonicalName(pattern)
 	if strings.HasSuffix(pattern, "*") {
 		prefix := strings.TrimSuffix(pattern, "*")
 		return strings.HasPrefix(s, prefix)
@@ -127,6 +527,23 @@ func matchesAnyPattern(s string, patterns []string) bool {
 	return false
 }
 
+// isSelected determines whether an action should be included in a scan.
+// Exclude rules are evaluated in order so that a later "!pattern" rule can
+// re-include actions excluded by an earlier one, but never actions that the
+// selects did not select in the first place. Without any negated rules,
+// excludes always take precedence.
+func isSelected(name string, opts scanOpts) bool {
+	selected := len(opts.Selects) == 0 || matchesAnyPattern(name, opts.Selects)
+	excluded := false
+	for _, rule := range opts.Excludes {
+		pattern, negated := strings.CutPrefix(rule, "!")
+		if matchesPattern(name, pattern) {
+			excluded = !negated
+		}
+	}
+	return selected && !excluded
+}
+
 // validatePattern checks if a pattern is supported. Only trailing wildcards are allowed.
 func validatePattern(pattern string) error {
 	if pattern == "" {
@@ -151,19 +568,163 @@ func validatePattern(pattern string) error {
 // workflow yaml file.
 //
 // Yes, this regex is now hairy enough to definitely be in "now you have 2
-// problems" territory.
+// problems" territory. Roughly, it matches:
+//
+//	uses: [quote]owner/repo[/path...]@ref[quote] [# comment]
+//
+// where owner is alphanumeric with hyphens, repo may also contain dots and
+// underscores, each path segment may also contain dots (e.g. a reusable
+// workflow file), and ref is a tag, branch, or commit hash, which may contain
+// slashes but never another "@". Go's regexp has no backreferences, so
+// matching quotes are enforced by [parseUsesLine].
 //
 // Explore matches:
 // https://regex101.com/r/0gKnNw/2
-var usesPattern = regexp.MustCompile(`^\s*-?\s*uses:\s*([\w\-]+/[\w\-]+(?:/[\w\-\.]+)*(?:\.ya?ml)?)@([\w\-\./]+)(?:\s*#.*)?$`)
+var usesPattern = regexp.MustCompile(`^\s*-?\s*uses:\s*(["']?)([\w\-]+/[\w\-\.]+(?:/[\w\-\.]+)*)@([\w\-\./+]+)(["']?)\s*(?:#\s*(.*))?$`)
+
+// ownerlessUsesPattern matches "uses:" declarations like [usesPattern], but
+// for legacy references to first-party actions that omit the owner (e.g.
+// "uses: checkout@v4"), which GitHub does not resolve.
+var ownerlessUsesPattern = regexp.MustCompile(`^\s*-?\s*uses:\s*(["']?)([\w\-\.]+)@([\w\-\./+]+)(["']?)\s*(?:#\s*(.*))?$`)
+
+// urlUsesPattern matches "uses:" declarations that refer to an action by a
+// full git URL (e.g. "uses: https://github.com/owner/repo@v1" or "uses:
+// git@github.com:owner/repo@v1"), which GitHub does not support but which
+// some self-hosted runners do. Docker image references are not matched.
+var urlUsesPattern = regexp.MustCompile(`^\s*-?\s*uses:\s*(["']?)((?:[a-z][a-z0-9+\-\.]*://|[\w\-\.]+@[\w\-\.]+:)[^\s"']+)(["']?)\s*(?:#.*)?$`)
+
+// parseURLUsesLine parses a `uses:` line referring to an action by a full git
+// URL, returning the URL, or false if the line is not one.
+func parseURLUsesLine(line string) (string, bool) {
+	matches := urlUsesPattern.FindStringSubmatch(line)
+	if matches == nil || matches[1] != matches[3] || strings.HasPrefix(matches[2], "docker://") {
+		return "", false
+	}
+	return matches[2], true
+}
+
+// urlUsesWarning describes an unsupported URL-form reference on the given
+// line, suggesting the equivalent owner/repo@ref reference when the URL
+// points at GitHub.
+func urlUsesWarning(lineNum int, url string) string {
+	warning := fmt.Sprintf("line %d: skipping unsupported reference form %s, which must be owner/repo@ref to be managed", lineNum+1, url)
+	if ref, ok := githubURLReference(url); ok {
+		warning += fmt.Sprintf("; did you mean %s?", ref)
+	}
+	return warning
+}
+
+// githubURLReference returns the owner/repo[/path]@ref reference equivalent
+// to a git URL reference to an action hosted on GitHub, e.g. owner/repo@v1
+// for https://github.com/owner/repo.git@v1, or false if there is none.
+func githubURLReference(url string) (string, bool) {
+	rest := url
+	if _, after, found := strings.Cut(rest, "://"); found {
+		rest = after
+	}
+	hostEnd := strings.IndexAny(rest, ":/")
+	if hostEnd < 0 {
+		return "", false
+	}
+	// drop any user info (e.g. git@) before the host
+	if at := strings.LastIndex(rest[:hostEnd], "@"); at >= 0 {
+		rest = rest[at+1:]
+		hostEnd -= at + 1
+	}
+	if !strings.EqualFold(rest[:hostEnd], "github.com") {
+		return "", false
+	}
+	name, ref, found := strings.Cut(rest[hostEnd+1:], "@")
+	if !found {
+		return "", false
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) >= 2 {
+		parts[1] = strings.TrimSuffix(parts[1], ".git")
+	}
+	reference := strings.Join(parts, "/") + "@" + ref
+	if _, ok := parseUsesLine("uses: " + reference); !ok {
+		return "", false
+	}
+	return reference, true
+}
+
+// firstPartyOwner is the owner of GitHub's first-party actions, assumed for
+// references missing an owner.
+const firstPartyOwner = "actions"
+
+// usesMatch holds the parts of a parsed `uses:` line.
+type usesMatch struct {
+	Name    string
+	Ref     string
+	Quote   string
+	Comment string
+}
+
+// parseUsesLine parses a `uses:` line referring to a remote action or
+// reusable workflow, returning false if the line is not one.
+func parseUsesLine(line string) (usesMatch, bool) {
+	return matchUsesLine(usesPattern, line)
+}
+
+// parseOwnerlessUsesLine parses a `uses:` line referring to an action without
+// an owner (e.g. "checkout@v4"), returning false if the line is not one.
+func parseOwnerlessUsesLine(line string) (usesMatch, bool) {
+	return matchUsesLine(ownerlessUsesPattern, line)
+}
+
+func matchUsesLine(pattern *regexp.Regexp, line string) (usesMatch, bool) {
+	matches := pattern.FindStringSubmatch(line)
+	if matches == nil || matches[1] != matches[4] {
+		return usesMatch{}, false
+	}
+	return usesMatch{
+		Name:    matches[2],
+		Ref:     matches[3],
+		Quote:   matches[1],
+		Comment: strings.TrimSpace(matches[5]),
+	}, true
+}
 
 func maybeParseAction(line string) Action {
-	matches := usesPattern.FindStringSubmatch(line)
-	if matches == nil {
+	m, ok := parseUsesLine(line)
+	if !ok {
 		return Action{}
 	}
 	return Action{
-		Name: matches[1],
-		Ref:  matches[2],
+		Name: m.Name,
+		Ref:  m.Ref,
+	}
+}
+
+// maybeParseComment returns the text of the trailing comment on a `uses:`
+// line, if any.
+func maybeParseComment(line string) string {
+	m, _ := parseUsesLine(line)
+	return m.Comment
+}
+
+// isManagedComment returns true if a trailing comment looks like one written
+// by ghavm itself (e.g. "v1.2.3" or "ref:main") rather than by a human.
+func isManagedComment(comment string) bool {
+	if semver.IsValid(comment) {
+		return true
+	}
+	ref, found := strings.CutPrefix(comment, "ref:")
+	return found && ref != "" && !strings.ContainsAny(ref, " \t")
+}
+
+// originalRefPattern matches a version comment recording the ref an action
+// tracked before it was pinned, e.g. "v4 (was:main)".
+var originalRefPattern = regexp.MustCompile(`^(\S+) \(was:([^\s()]+)\)$`)
+
+// splitOriginalRef splits a version comment like "v4 (was:main)" into the
+// version and the original ref. Any other comment is returned as-is, with an
+// empty original ref.
+func splitOriginalRef(comment string) (string, string) {
+	m := originalRefPattern.FindStringSubmatch(comment)
+	if m == nil || !semver.IsValid(m[1]) {
+		return comment, ""
 	}
+	return m[1], m[2]
 }
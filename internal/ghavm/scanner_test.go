@@ -1,7 +1,10 @@
 package ghavm
 
 import (
+	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/mccutchen/ghavm/internal/testing/assert"
@@ -72,6 +75,48 @@ func TestMaybeParseAction(t *testing.T) {
 				Ref:  "main",
 			},
 		},
+		{
+			line: "uses: owner/repo.js@v1",
+			want: Action{
+				Name: "owner/repo.js",
+				Ref:  "v1",
+			},
+		},
+		{
+			line: "uses: octo-org/example_repo/.github/workflows/reusable.workflow.yml@refs/heads/main",
+			want: Action{
+				Name: "octo-org/example_repo/.github/workflows/reusable.workflow.yml",
+				Ref:  "refs/heads/main",
+			},
+		},
+		{
+			line: "uses: owner/repo/sub.dir/action@v1.0.0+build.5",
+			want: Action{
+				Name: "owner/repo/sub.dir/action",
+				Ref:  "v1.0.0+build.5",
+			},
+		},
+		{
+			line: `uses: "owner/repo/path@v1" # double quoted`,
+			want: Action{
+				Name: "owner/repo/path",
+				Ref:  "v1",
+			},
+		},
+		{
+			line: "- uses: 'owner/repo@v1'",
+			want: Action{
+				Name: "owner/repo",
+				Ref:  "v1",
+			},
+		},
+		{
+			line: "uses: owner/repo@v1   ",
+			want: Action{
+				Name: "owner/repo",
+				Ref:  "v1",
+			},
+		},
 
 		// testing a variety of ref formats we need to support
 		{
@@ -121,6 +166,36 @@ func TestMaybeParseAction(t *testing.T) {
 			line: "uses: owner/repo@v1.2.3@foo # malformed ref",
 			want: Action{},
 		},
+		{
+			// malformed ref (@ inside a path segment)
+			line: "uses: owner/repo/path@v1/more@v2",
+			want: Action{},
+		},
+		{
+			// mismatched quotes
+			line: `uses: "owner/repo@v1'`,
+			want: Action{},
+		},
+		{
+			// missing ref
+			line: "uses: owner/repo",
+			want: Action{},
+		},
+		{
+			// empty ref
+			line: "uses: owner/repo@",
+			want: Action{},
+		},
+		{
+			// empty path segment
+			line: "uses: owner/repo//path@v1",
+			want: Action{},
+		},
+		{
+			// dots are not allowed in owner names
+			line: "uses: own.er/repo@v1",
+			want: Action{},
+		},
 		{
 			// local workflow definitions
 			line: "uses: ./.github/actions/custom-action",
@@ -136,11 +211,159 @@ func TestMaybeParseAction(t *testing.T) {
 		t.Run(tc.line, func(t *testing.T) {
 			t.Parallel()
 			got := maybeParseAction(tc.line)
-			assert.Equal(t, got, tc.want, "incorrect result")
+			assert.DeepEqual(t, got, tc.want, "incorrect result")
 		})
 	}
 }
 
+func TestFindWorkflows(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default to workflows in current repo", func(t *testing.T) {
+		t.Parallel()
+		files, err := FindWorkflows(nil)
+		assert.NilError(t, err)
+		assert.Equal(t, len(files) > 0, true, "expected to find this repo's own workflows")
+	})
+
+	t.Run("default to workflows at repo root from a subdirectory", func(t *testing.T) {
+		t.Parallel()
+		root := t.TempDir()
+		subdir := filepath.Join(root, "cmd", "foo")
+		assert.NilError(t, os.Mkdir(filepath.Join(root, ".git"), 0o700))
+		assert.NilError(t, os.MkdirAll(subdir, 0o700))
+		assert.Equal(t, findRepoRoot(subdir), root, "incorrect repo root")
+		assert.Equal(t, findRepoRoot(root), root, "incorrect repo root")
+	})
+
+	t.Run("directory with workflows", func(t *testing.T) {
+		t.Parallel()
+		files, err := FindWorkflows([]string{filepath.Join("testdata", "workflows")})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, files, []string{
+			filepath.Join("testdata", "workflows", "01-already-pinned.yaml"),
+			filepath.Join("testdata", "workflows", "02-semver-unpinned.yaml"),
+			filepath.Join("testdata", "workflows", "03-edge-cases.yml"),
+		}, "incorrect workflow files")
+	})
+
+	t.Run("empty directory is not an error", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, "README.md"), nil, 0o600))
+		files, err := FindWorkflows([]string{dir})
+		assert.NilError(t, err)
+		assert.Equal(t, len(files), 0, "expected no workflow files")
+	})
+
+	t.Run("repo without workflows directory is not an error", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		assert.NilError(t, os.Mkdir(filepath.Join(dir, ".git"), 0o700))
+		files, err := FindWorkflows([]string{dir})
+		assert.NilError(t, err)
+		assert.Equal(t, len(files), 0, "expected no workflow files")
+	})
+
+	t.Run("templated workflows", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		workflowDir := filepath.Join(dir, ".github", "workflows")
+		assert.NilError(t, os.Mkdir(filepath.Join(dir, ".git"), 0o700))
+		assert.NilError(t, os.MkdirAll(workflowDir, 0o700))
+		for _, name := range []string{"ci.yaml", "ci.yaml.j2", "release.yml.tmpl", "notes.txt"} {
+			assert.NilError(t, os.WriteFile(filepath.Join(workflowDir, name), []byte("    - uses: actions/checkout@v4\n"), 0o600))
+		}
+
+		files, err := FindWorkflows([]string{dir})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, files, []string{filepath.Join(workflowDir, "ci.yaml")}, "templated workflows should be ignored by default")
+
+		patterns := []string{"*.yaml.j2", "*.tmpl"}
+		files, err = FindWorkflows([]string{dir}, patterns...)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, files, []string{
+			filepath.Join(workflowDir, "ci.yaml"),
+			filepath.Join(workflowDir, "ci.yaml.j2"),
+			filepath.Join(workflowDir, "release.yml.tmpl"),
+		}, "incorrect workflow files")
+
+		root, err := ScanWorkflows(files, scanOpts{TemplatePatterns: patterns})
+		assert.NilError(t, err)
+		assert.Equal(t, root.Workflows[files[0]].Templated, false, "plain workflow should not be templated")
+		assert.Equal(t, root.Workflows[files[1]].Templated, true, "j2 workflow should be templated")
+		assert.Equal(t, len(root.Workflows[files[1]].Steps), 1, "templated workflow steps should be scanned")
+
+		rewritable, skipped := root.withoutTemplated()
+		assert.Equal(t, rewritable.WorkflowCount(), 1, "incorrect number of rewritable workflows")
+		assert.DeepEqual(t, skipped, files[1:], "incorrect skipped workflows")
+	})
+
+	t.Run("missing path is an error", func(t *testing.T) {
+		t.Parallel()
+		_, err := FindWorkflows([]string{filepath.Join(t.TempDir(), "typo")})
+		if err == nil {
+			t.Fatal("expected error but got nil")
+		}
+	})
+
+	t.Run("unreadable directory is an error", func(t *testing.T) {
+		t.Parallel()
+		if os.Geteuid() == 0 {
+			t.Skip("directory permissions are not enforced for root")
+		}
+		dir := filepath.Join(t.TempDir(), "unreadable")
+		assert.NilError(t, os.Mkdir(dir, 0o000))
+		_, err := FindWorkflows([]string{dir})
+		if err == nil {
+			t.Fatal("expected error but got nil")
+		}
+		assert.Contains(t, err.Error(), "failed to read workflow directory", "error message")
+	})
+}
+
+func TestScopedWorkflows(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, path := range []string{
+		".github/workflows/ci.yaml",
+		"services/payments/.github/workflows/deploy.yaml",
+		"services/payments/api/.github/workflows/test.yml",
+		"services/payments/node_modules/pkg/.github/workflows/ci.yaml",
+		"services/search/.github/workflows/deploy.yaml",
+	} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		assert.NilError(t, os.WriteFile(path, nil, 0o600))
+	}
+	payments := filepath.Join(dir, "services", "payments")
+	want := []string{
+		filepath.Join(payments, ".github", "workflows", "deploy.yaml"),
+		filepath.Join(payments, "api", ".github", "workflows", "test.yml"),
+	}
+
+	t.Run("find workflows under scope", func(t *testing.T) {
+		t.Parallel()
+		files, err := findWorkflowsUnder(payments, nil)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, files, want, "incorrect workflow files")
+	})
+
+	t.Run("filter workflows to scope", func(t *testing.T) {
+		t.Parallel()
+		files := []string{
+			filepath.Join(dir, ".github", "workflows", "ci.yaml"),
+			want[0],
+			filepath.Join(dir, "services", "payments-legacy", "ci.yaml"),
+			want[1],
+		}
+		scoped, err := scopeWorkflows(files, payments)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, scoped, want, "incorrect scoped workflow files")
+	})
+}
+
 func TestScanFileFiltering(t *testing.T) {
 	t.Parallel()
 
@@ -192,6 +415,30 @@ func TestScanFileFiltering(t *testing.T) {
 			opts:     scanOpts{Selects: []string{"actions/*"}, Excludes: []string{"actions/*"}},
 			expected: []string{},
 		},
+		"negated exclude re-includes": {
+			opts:     scanOpts{Excludes: []string{"actions/*", "!actions/checkout"}},
+			expected: []string{"actions/checkout", "golangci/golangci-lint-action", "codecov/codecov-action"},
+		},
+		"later exclude overrides earlier negation": {
+			opts:     scanOpts{Excludes: []string{"actions/*", "!actions/checkout", "actions/checkout"}},
+			expected: []string{"golangci/golangci-lint-action", "codecov/codecov-action"},
+		},
+		"selects ignore owner/repo case": {
+			opts:     scanOpts{Selects: []string{"Actions/Checkout", "CodeCov/*"}},
+			expected: []string{"actions/checkout", "codecov/codecov-action"},
+		},
+		"excludes ignore owner/repo case": {
+			opts:     scanOpts{Excludes: []string{"ACTIONS/*", "!Actions/Setup-Go"}},
+			expected: []string{"actions/setup-go", "golangci/golangci-lint-action", "codecov/codecov-action"},
+		},
+		"negation without matching exclude is a no-op": {
+			opts:     scanOpts{Selects: []string{"actions/*"}, Excludes: []string{"!actions/checkout"}},
+			expected: []string{"actions/setup-go", "actions/checkout"},
+		},
+		"negation does not re-include unselected actions": {
+			opts:     scanOpts{Selects: []string{"actions/*"}, Excludes: []string{"codecov/*", "!codecov/codecov-action"}},
+			expected: []string{"actions/setup-go", "actions/checkout"},
+		},
 	}
 
 	for name, tc := range testCases {
@@ -211,6 +458,226 @@ func TestScanFileFiltering(t *testing.T) {
 	}
 }
 
+func TestScanFileRefKinds(t *testing.T) {
+	t.Parallel()
+
+	const content = `steps:
+  - uses: actions/checkout@b4ffde65f46336ab88eb53be808477a3936bae11 # v4.1.1
+  - uses: actions/setup-go@v5
+  - uses: golangci/golangci-lint-action@main
+  - uses: codecov/codecov-action@b4ffde65f46336ab88eb53be808477a3936bae11
+`
+	testCases := map[string]struct {
+		opts     scanOpts
+		expected []string
+	}{
+		"every kind": {
+			opts:     scanOpts{},
+			expected: []string{"actions/checkout", "actions/setup-go", "golangci/golangci-lint-action", "codecov/codecov-action"},
+		},
+		"only pinned": {
+			opts:     scanOpts{RefKinds: []RefKind{RefKindCommit}},
+			expected: []string{"actions/checkout", "codecov/codecov-action"},
+		},
+		"only floating": {
+			opts:     scanOpts{RefKinds: []RefKind{RefKindVersion, RefKindOther}},
+			expected: []string{"actions/setup-go", "golangci/golangci-lint-action"},
+		},
+		"combined with selects and excludes": {
+			opts:     scanOpts{Selects: []string{"actions/*", "codecov/*"}, Excludes: []string{"codecov/*"}, RefKinds: []RefKind{RefKindCommit}},
+			expected: []string{"actions/checkout"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			workflow, err := scanContent("ci.yaml", strings.NewReader(content), tc.opts)
+			assert.NilError(t, err)
+
+			actualNames := make([]string, 0, len(workflow.Steps))
+			for _, step := range workflow.Steps {
+				actualNames = append(actualNames, step.Action.Name)
+			}
+			assert.DeepEqual(t, actualNames, tc.expected, "filtered action names should match expected")
+		})
+	}
+}
+
+func TestScanURLUses(t *testing.T) {
+	t.Parallel()
+
+	content := `steps:
+  - uses: https://github.com/actions/checkout.git@v4
+  - uses: "git@github.com:owner/repo/subdir@main"
+  - uses: ssh://git@git.example.com/owner/repo@v1 # self-hosted
+  - uses: https://github.com/owner@v1
+  - uses: docker://alpine:3.20
+  - uses: actions/setup-go@v5
+`
+	workflow, err := scanContent("ci.yaml", strings.NewReader(content), scanOpts{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(workflow.Steps), 1, "only the owner/repo reference should be scanned")
+	assert.Equal(t, workflow.Steps[0].Action.Name, "actions/setup-go", "incorrect step")
+	assert.DeepEqual(t, workflow.Warnings, []string{
+		"line 2: skipping unsupported reference form https://github.com/actions/checkout.git@v4, which must be owner/repo@ref to be managed; did you mean actions/checkout@v4?",
+		"line 3: skipping unsupported reference form git@github.com:owner/repo/subdir@main, which must be owner/repo@ref to be managed; did you mean owner/repo/subdir@main?",
+		"line 4: skipping unsupported reference form ssh://git@git.example.com/owner/repo@v1, which must be owner/repo@ref to be managed",
+		"line 5: skipping unsupported reference form https://github.com/owner@v1, which must be owner/repo@ref to be managed",
+	}, "incorrect warnings")
+}
+
+func TestScanMultilineUses(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		content      string
+		wantSteps    []string
+		wantWarnings []string
+	}{
+		"folded scalar": {
+			content: `steps:
+  - uses: >-
+      actions/checkout@v4
+  - uses: actions/setup-go@v5
+`,
+			wantSteps:    []string{"actions/setup-go"},
+			wantWarnings: []string{"line 2: skipping multi-line uses: value actions/checkout@v4, which must be on a single line to be managed"},
+		},
+		"literal scalar with comment at end of file": {
+			content: `steps:
+  - name: checkout
+    uses: |  # weird, but valid
+      actions/checkout@v4
+
+`,
+			wantSteps:    nil,
+			wantWarnings: []string{"line 3: skipping multi-line uses: value actions/checkout@v4, which must be on a single line to be managed"},
+		},
+		"empty block": {
+			content: `steps:
+  - uses: >
+  - uses: actions/setup-go@v5
+`,
+			wantSteps:    []string{"actions/setup-go"},
+			wantWarnings: []string{"line 2: skipping multi-line uses: value (empty), which must be on a single line to be managed"},
+		},
+		"quoted pipe is not a block": {
+			content: `steps:
+  - uses: actions/checkout@v4
+  - run: echo "uses: |"
+`,
+			wantSteps: []string{"actions/checkout"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			workflow, err := scanContent("ci.yaml", strings.NewReader(tc.content), scanOpts{})
+			assert.NilError(t, err)
+			var names []string
+			for _, step := range workflow.Steps {
+				names = append(names, step.Action.Name)
+			}
+			assert.DeepEqual(t, names, tc.wantSteps, "incorrect steps")
+			assert.DeepEqual(t, workflow.Warnings, tc.wantWarnings, "incorrect warnings")
+		})
+	}
+}
+
+func TestScanMatrixJobs(t *testing.T) {
+	t.Parallel()
+
+	const content = `on: push
+jobs:
+  # steps after the matrix
+  test:
+    runs-on: ${{ matrix.os }}
+    strategy:
+      fail-fast: false
+      matrix:
+        os: [ubuntu-latest, macos-latest]
+    steps:
+      - uses: actions/checkout@v4
+  lint:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/setup-go@v5
+    strategy:
+      fail-fast: false
+  # steps before the matrix
+  build:
+    steps:
+      - uses: actions/upload-artifact@v4
+    strategy: {matrix: {go: [stable, oldstable]}}
+---
+jobs:
+  test:
+    steps:
+      - uses: actions/cache@v4
+`
+	workflow, err := scanContent("ci.yaml", strings.NewReader(content), scanOpts{})
+	assert.NilError(t, err)
+	got := map[string]bool{}
+	for _, step := range workflow.Steps {
+		got[step.Action.Name] = step.Matrix
+	}
+	assert.DeepEqual(t, got, map[string]bool{
+		"actions/checkout":        true,
+		"actions/setup-go":        false,
+		"actions/upload-artifact": true,
+		"actions/cache":           false,
+	}, "incorrect matrix steps")
+}
+
+func TestScanMissingOwner(t *testing.T) {
+	t.Parallel()
+
+	const content = `steps:
+  - uses: checkout@v4 # v4.1.1
+  - uses: "setup-go@v5"
+  - uses: ./local/action
+  - uses: docker://alpine:3
+  - uses: actions/cache@v4
+`
+	t.Run("warns by default", func(t *testing.T) {
+		t.Parallel()
+		workflow, err := scanContent("ci.yaml", strings.NewReader(content), scanOpts{})
+		assert.NilError(t, err)
+		assert.Equal(t, len(workflow.Steps), 1, "incorrect number of steps")
+		assert.DeepEqual(t, workflow.Warnings, []string{
+			"line 2: action reference checkout@v4 missing owner; did you mean actions/checkout@v4? (use --fix-missing-owner to treat it as such)",
+			"line 3: action reference setup-go@v5 missing owner; did you mean actions/setup-go@v5? (use --fix-missing-owner to treat it as such)",
+		}, "incorrect warnings")
+	})
+
+	t.Run("fixed", func(t *testing.T) {
+		t.Parallel()
+		workflow, err := scanContent("ci.yaml", strings.NewReader(content), scanOpts{FixMissingOwner: true})
+		assert.NilError(t, err)
+		assert.Equal(t, len(workflow.Warnings), 0, "expected no warnings")
+		assert.DeepEqual(t, workflow.Steps, []Step{
+			{LineNumber: 1, Line: "  - uses: checkout@v4 # v4.1.1", Action: Action{Name: "actions/checkout", Ref: "v4"}, Comment: "v4.1.1"},
+			{LineNumber: 2, Line: `  - uses: "setup-go@v5"`, Action: Action{Name: "actions/setup-go", Ref: "v5"}},
+			{LineNumber: 5, Line: "  - uses: actions/cache@v4", Action: Action{Name: "actions/cache", Ref: "v4"}},
+		}, "incorrect steps")
+
+		// the owner is added when the steps are rewritten
+		const hash = "b4ffde65f46336ab88eb53be808477a3936bae11"
+		got, _, _, err := rewriteContent(testCtx(), workflow, []byte(content), func(Workflow, Step) Release {
+			return Release{CommitHash: hash, Version: "v4.1.1"}
+		}, nil, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, string(got), `steps:
+  - uses: actions/checkout@`+hash+` # v4.1.1
+  - uses: "actions/setup-go@`+hash+`" # v4.1.1
+  - uses: ./local/action
+  - uses: docker://alpine:3
+  - uses: actions/cache@`+hash+` # v4.1.1
+`, "incorrect rewritten content")
+	})
+}
+
 func TestValidatePattern(t *testing.T) {
 	t.Parallel()
 
@@ -278,3 +745,184 @@ func TestActionRepo(t *testing.T) {
 		})
 	}
 }
+
+func TestActionCanonicalName(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"actions/checkout", "actions/checkout"},
+		{"Actions/Checkout", "actions/checkout"},
+		{"Owner/Repo/Path/To/Action", "owner/repo/Path/To/Action"},
+		{"Single-Part", "single-part"},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			action := Action{Name: tc.name}
+			assert.Equal(t, action.CanonicalName(), tc.expected, "incorrect canonical name")
+		})
+	}
+}
+
+func TestActionPath(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		expected string
+	}{
+		{"actions/checkout", ""},
+		{"owner/repo/path/to/action", "path/to/action"},
+		{"owner/repo/.github/workflows/workflow.yaml", ".github/workflows/workflow.yaml"},
+		{"single-part", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			action := Action{Name: tc.name}
+			assert.Equal(t, action.Path(), tc.expected, "incorrect path extraction")
+		})
+	}
+}
+
+func TestActionRefKind(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		ref      string
+		expected RefKind
+	}{
+		{"b4ffde65f46336ab88eb53be808477a3936bae11", RefKindCommit},
+		{"v4", RefKindVersion},
+		{"v4.1.2", RefKindVersion},
+		{"main", RefKindOther},
+		{"release/v1", RefKindOther},
+		{"b4ffde6", RefKindOther},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			t.Parallel()
+			action := Action{Name: "actions/checkout", Ref: tc.ref}
+			assert.Equal(t, action.RefKind(), tc.expected, "incorrect ref kind")
+		})
+	}
+}
+
+func TestMaybeParseComment(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		line string
+		want string
+	}{
+		{"uses: owner/repo@v1.2.3", ""},
+		{"uses: owner/repo@abcd1234 # v1.2.3", "v1.2.3"},
+		{"uses: owner/repo@abcd1234 #v1.2.3  ", "v1.2.3"},
+		{"uses: owner/repo@abcd1234 # v0.0.1: extra context", "v0.0.1: extra context"},
+		{"# uses: owner/repo@v1.2.3 # not a step", ""},
+		{`uses: "owner/repo@abcd1234" # v1.2.3`, "v1.2.3"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, maybeParseComment(tc.line), tc.want, "incorrect comment")
+		})
+	}
+}
+
+func TestSplitOriginalRef(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		comment         string
+		wantComment     string
+		wantOriginalRef string
+	}{
+		{"v4", "v4", ""},
+		{"v4 (was:main)", "v4", "main"},
+		{"v4.1.2 (was:release/v4)", "v4.1.2", "release/v4"},
+		{"ref:main", "ref:main", ""},
+		{"v4 (was: main)", "v4 (was: main)", ""},
+		{"pinned (was:main)", "pinned (was:main)", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.comment, func(t *testing.T) {
+			t.Parallel()
+			comment, originalRef := splitOriginalRef(tc.comment)
+			assert.Equal(t, comment, tc.wantComment, "incorrect comment")
+			assert.Equal(t, originalRef, tc.wantOriginalRef, "incorrect original ref")
+		})
+	}
+}
+
+func TestIsManagedComment(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		comment string
+		want    bool
+	}{
+		{"v1.2.3", true},
+		{"v3", true},
+		{"v1.0.0-rc.1", true},
+		{"ref:main", true},
+		{"ref:feature/foo", true},
+		{"", false},
+		{"ref:", false},
+		{"v0.0.1: extra context", false},
+		{"pinned for reasons", false},
+		{"1.2.3", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.comment, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, isManagedComment(tc.comment), tc.want, "is managed comment?")
+		})
+	}
+}
+
+func TestWorkflowPath(t *testing.T) {
+	t.Parallel()
+
+	repo := t.TempDir()
+	assert.NilError(t, os.Mkdir(filepath.Join(repo, ".git"), 0o700))
+	inRepo := filepath.Join(repo, ".github", "workflows", "ci.yaml")
+	outside := filepath.Join(t.TempDir(), "ci.yaml")
+
+	testCases := map[string]struct {
+		path     string
+		relative bool
+		wantPath string
+		wantName string
+	}{
+		"relative in repo":       {inRepo, true, ".github/workflows/ci.yaml", ".github/workflows/ci.yaml"},
+		"relative outside repo":  {outside, true, outside, "ci.yaml"},
+		"as given in repo":       {inRepo, false, inRepo, "ci.yaml"},
+		"as given outside repo":  {outside, false, outside, "ci.yaml"},
+		"relative in nested dir": {filepath.Join(repo, "svc", ".github", "workflows", "ci.yaml"), true, "svc/.github/workflows/ci.yaml", "svc/.github/workflows/ci.yaml"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, workflowPath(tc.path, tc.relative), tc.wantPath, "incorrect path")
+			assert.Equal(t, workflowName(tc.path, tc.relative), tc.wantName, "incorrect name")
+		})
+	}
+
+	assert.Equal(t, inGitRepo(filepath.Dir(inRepo)), true, "expected dir to be in a git repo")
+	assert.Equal(t, inGitRepo(filepath.Dir(outside)), false, "expected dir to be outside a git repo")
+
+	// repo roots are cached rather than found again for every path shown
+	cached := t.TempDir()
+	assert.NilError(t, os.Mkdir(filepath.Join(cached, ".git"), 0o700))
+	root, ok := repoRootOf(cached)
+	assert.Equal(t, ok, true, "expected dir to be in a git repo")
+	assert.NilError(t, os.Remove(filepath.Join(cached, ".git")))
+	again, ok := repoRootOf(cached)
+	assert.Equal(t, ok, true, "expected cached repo root")
+	assert.Equal(t, again, root, "incorrect cached repo root")
+}
@@ -0,0 +1,76 @@
+package ghavm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stagedFile is a rewritten workflow file staged in a temp file alongside
+// it, to be swapped into place only once every rewritten file is staged (see
+// [engineOpts.AllOrNothing]).
+type stagedFile struct {
+	path     string
+	tempPath string
+	// original is the file's original content, to restore if it is replaced
+	// but a later file cannot be
+	original []byte
+}
+
+// stageFile writes data to a temp file in the same directory as path (and so
+// on the same filesystem, so that it can be renamed into place), with the
+// same permissions as path.
+func stageFile(path string, data []byte, original []byte) (stagedFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stagedFile{}, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".ghavm-*")
+	if err != nil {
+		return stagedFile{}, err
+	}
+	staged := stagedFile{path: path, tempPath: f.Name(), original: original}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(staged.tempPath, info.Mode().Perm())
+	}
+	if err != nil {
+		_ = os.Remove(staged.tempPath)
+		return stagedFile{}, err
+	}
+	return staged, nil
+}
+
+// commitStaged renames each staged file into place. If any rename fails,
+// the files already replaced are restored to their original contents and the
+// remaining temp files are removed, so that either every file is changed or
+// none are.
+func commitStaged(staged []stagedFile) error {
+	for i, s := range staged {
+		if err := os.Rename(s.tempPath, s.path); err != nil {
+			err = fmt.Errorf("failed to replace %s: %w", s.path, err)
+			discardStaged(staged[i:])
+			for _, done := range staged[:i] {
+				if restoreErr := writeFile(done.path, done.original, 0); restoreErr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to restore %s: %w", done.path, restoreErr))
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// discardStaged removes the temp files of the given staged files.
+func discardStaged(staged []stagedFile) {
+	for _, s := range staged {
+		_ = os.Remove(s.tempPath)
+	}
+}
@@ -0,0 +1,62 @@
+package ghavm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestStageFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ci.yaml")
+	assert.NilError(t, os.WriteFile(path, []byte("old"), 0o640))
+
+	staged, err := stageFile(path, []byte("new"), []byte("old"))
+	assert.NilError(t, err)
+	assert.Equal(t, filepath.Dir(staged.tempPath), dir, "temp file should be alongside the original")
+	info, err := os.Stat(staged.tempPath)
+	assert.NilError(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0o640), "temp file should have the original's permissions")
+
+	// the original is untouched until committed
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), "old", "original should not change when staged")
+
+	assert.NilError(t, commitStaged([]stagedFile{staged}))
+	got, err = os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), "new", "original should be replaced when committed")
+	entries, err := os.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1, "no temp files should remain")
+}
+
+func TestCommitStagedRollsBack(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.yaml")
+	assert.NilError(t, os.WriteFile(first, []byte("a-old"), 0o600))
+	// renaming a file over a non-empty directory fails
+	second := filepath.Join(dir, "b.yaml")
+	assert.NilError(t, os.MkdirAll(filepath.Join(second, "nested"), 0o700))
+
+	stagedA, err := stageFile(first, []byte("a-new"), []byte("a-old"))
+	assert.NilError(t, err)
+	stagedB, err := stageFile(second, []byte("b-new"), nil)
+	assert.NilError(t, err)
+
+	err = commitStaged([]stagedFile{stagedA, stagedB})
+	assert.Contains(t, err.Error(), "failed to replace "+second, "incorrect error")
+
+	got, err := os.ReadFile(first) // #nosec G304
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), "a-old", "replaced file should be restored")
+	_, err = os.Stat(stagedB.tempPath)
+	assert.Equal(t, os.IsNotExist(err), true, "remaining temp files should be removed")
+}
@@ -0,0 +1,227 @@
+package ghavm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// defaultStateFile is the state file used by `list --since-last-run` when no
+// path is given.
+const defaultStateFile = ".ghavm-state.json"
+
+// runState records the resolved versions and upgrade candidates of each
+// action as of a previous `list --since-last-run`, so that later runs can
+// skip resolving actions whose state is still fresh and report only upgrades
+// that have become available since.
+type runState struct {
+	// Actions are keyed by canonical action name and ref on disk (see
+	// [stateKey]), so an action whose ref changes is resolved again.
+	Actions map[string]actionState `json:"actions"`
+
+	// freshAfter is the time after which recorded state is fresh enough to
+	// be reused without resolving the action again.
+	freshAfter time.Time
+}
+
+// actionState is the recorded state of a single action.
+type actionState struct {
+	ResolvedAt        time.Time     `json:"resolved_at"`
+	Commit            string        `json:"commit"`
+	Version           string        `json:"version,omitempty"`
+	VersionTags       []string      `json:"version_tags,omitempty"`
+	Latest            stateRelease  `json:"latest"`
+	LatestCompatible  stateRelease  `json:"latest_compatible"`
+	ReleasesBehind    int           `json:"releases_behind"`
+	CurrentUnreleased bool          `json:"current_unreleased,omitempty"`
+	LatestStable      *stateRelease `json:"latest_stable,omitempty"`
+}
+
+// stateRelease is the recorded state of an upgrade candidate.
+type stateRelease struct {
+	Version  string `json:"version,omitempty"`
+	Commit   string `json:"commit,omitempty"`
+	Verified bool   `json:"verified,omitempty"`
+}
+
+func newStateRelease(r Release) stateRelease {
+	return stateRelease{Version: r.Version, Commit: r.CommitHash, Verified: r.Verified}
+}
+
+func (r stateRelease) release() Release {
+	return Release{Version: r.Version, CommitHash: r.Commit, Verified: r.Verified}
+}
+
+// stateKey identifies an action in a [runState].
+func stateKey(a Action) string {
+	return a.CanonicalName() + "@" + a.Ref
+}
+
+// readState reads the state file at path, returning an empty state if it does
+// not exist yet. Recorded state is reused if it was resolved less than ttl
+// before now.
+func readState(path string, now time.Time, ttl time.Duration) (*runState, error) {
+	state := &runState{freshAfter: now.Add(-ttl)}
+	data, err := os.ReadFile(filepath.Clean(path))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		// first run
+	case err != nil:
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	default:
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+		}
+	}
+	if state.Actions == nil {
+		state.Actions = make(map[string]actionState)
+	}
+	return state, nil
+}
+
+// writeState writes the state to the file at path.
+func writeState(path string, state *runState) error {
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, state); err != nil {
+		return err
+	}
+	if err := writeFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// lookup returns the recorded state of the given action, if it is fresh. It
+// is safe to call on a nil state.
+func (s *runState) lookup(a Action) (actionState, bool) {
+	if s == nil {
+		return actionState{}, false
+	}
+	entry, ok := s.Actions[stateKey(a)]
+	if !ok || !entry.ResolvedAt.After(s.freshAfter) {
+		return actionState{}, false
+	}
+	return entry, true
+}
+
+// apply populates the given action's resolved versions from recorded state.
+func (entry actionState) apply(a *Action) {
+	a.Release = Release{CommitHash: entry.Commit, Version: entry.Version}
+	a.VersionTags = entry.VersionTags
+	a.UpgradeCandidates = UpgradeCandidates{
+		Latest:            entry.Latest.release(),
+		LatestCompatible:  entry.LatestCompatible.release(),
+		ReleasesBehind:    entry.ReleasesBehind,
+		CurrentUnreleased: entry.CurrentUnreleased,
+	}
+	if entry.LatestStable != nil {
+		a.UpgradeCandidates.LatestStable = entry.LatestStable.release()
+	}
+}
+
+// update records the resolved state of every step in root, keeping the
+// original resolution time of any fresh state that was reused. Actions no
+// longer found in root are forgotten.
+func (s *runState) update(root Root, now time.Time) {
+	actions := make(map[string]actionState, len(s.Actions))
+	for _, w := range root.Workflows {
+		for _, step := range w.Steps {
+			a := step.Action
+			if !a.Release.Exists() {
+				continue
+			}
+			if entry, ok := s.lookup(a); ok {
+				actions[stateKey(a)] = entry
+				continue
+			}
+			entry := actionState{
+				ResolvedAt:        now,
+				Commit:            a.Release.CommitHash,
+				Version:           a.Release.Version,
+				VersionTags:       a.VersionTags,
+				Latest:            newStateRelease(a.UpgradeCandidates.Latest),
+				LatestCompatible:  newStateRelease(a.UpgradeCandidates.LatestCompatible),
+				ReleasesBehind:    a.UpgradeCandidates.ReleasesBehind,
+				CurrentUnreleased: a.UpgradeCandidates.CurrentUnreleased,
+			}
+			if stable := a.UpgradeCandidates.LatestStable; stable.Exists() {
+				r := newStateRelease(stable)
+				entry.LatestStable = &r
+			}
+			actions[stateKey(a)] = entry
+		}
+	}
+	s.Actions = actions
+}
+
+// drift is an upgrade that has become available since the last run.
+type drift struct {
+	Workflow string
+	Step     Step
+	// Previous is the latest release as of the last run, if the action was
+	// recorded then.
+	Previous Release
+}
+
+// findDrift returns the steps in root with an upgrade available that was not
+// already available as of the recorded state, sorted by workflow and line.
+// Steps whose actions were not recorded (e.g. new steps, or steps whose refs
+// have changed) report any available upgrade.
+func (s *runState) findDrift(root Root) []drift {
+	var drifts []drift
+	for _, key := range slices.Sorted(maps.Keys(root.Workflows)) {
+		w := root.Workflows[key]
+		for _, step := range w.Steps {
+			var (
+				current = step.Action.Release
+				latest  = step.Action.UpgradeCandidates.Latest
+			)
+			if !current.Exists() || !latest.Exists() || latest.CommitHash == current.CommitHash {
+				continue
+			}
+			entry, recorded := s.Actions[stateKey(step.Action)]
+			if recorded && entry.Latest.Commit == latest.CommitHash {
+				continue
+			}
+			drifts = append(drifts, drift{Workflow: w.FilePath, Step: step, Previous: entry.Latest.release()})
+		}
+	}
+	return drifts
+}
+
+// ListSinceLastRun resolves each step like [Engine.List], but writes only the
+// upgrades that have become available since the given state was recorded to
+// dst, and then updates the state with the newly resolved versions.
+//
+// Actions with fresh recorded state are not resolved again (see
+// [engineOpts.State]).
+func (e *Engine) ListSinceLastRun(ctx context.Context, dst io.Writer, state *runState, now time.Time) error {
+	if err := e.resolveSteps(ctx, ModeLatest); err != nil {
+		return fmt.Errorf("failed to resolve commit refs: %w", err)
+	}
+	drifts := state.findDrift(e.root)
+	state.update(e.root, now)
+	if len(drifts) == 0 {
+		fprintln(dst, e.msgs.Sprintf(msgNoNewUpgrades))
+		return nil
+	}
+	fprintln(dst, e.msgs.Sprintf(msgNewUpgrades, len(drifts)))
+	for _, d := range drifts {
+		a := d.Step.Action
+		msg := fmt.Sprintf("  %s %s: %s → %s", e.style.Bold(e.workflowName(d.Workflow)), e.style.Boldf("%s@%s", a.Name, a.Ref), a.Release, e.formatCandidate(a.UpgradeCandidates.Latest))
+		if d.Previous.Exists() {
+			msg += " " + e.msgs.Sprintf(msgPreviously, d.Previous)
+		}
+		fprintln(dst, msg)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package ghavm
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestReadState(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	now := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	state, err := readState(filepath.Join(dir, "missing.json"), now, time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, len(state.Actions), 0, "new state should be empty")
+
+	invalid := filepath.Join(dir, "invalid.json")
+	assert.NilError(t, os.WriteFile(invalid, []byte("{"), 0o600))
+	_, err = readState(invalid, now, time.Hour)
+	assert.Contains(t, err.Error(), "failed to parse state file", "incorrect error")
+
+	// only state resolved within the ttl is fresh
+	valid := filepath.Join(dir, "valid.json")
+	assert.NilError(t, os.WriteFile(valid, []byte(`{"actions": {
+		"owner/repo@v1": {"resolved_at": "2025-01-01T23:30:00Z", "commit": "abc123"},
+		"owner/repo@v2": {"resolved_at": "2025-01-01T22:30:00Z", "commit": "def456"}
+	}}`), 0o600))
+	state, err = readState(valid, now, time.Hour)
+	assert.NilError(t, err)
+	_, fresh := state.lookup(Action{Name: "Owner/Repo", Ref: "v1"})
+	assert.Equal(t, fresh, true, "recent state should be fresh")
+	_, fresh = state.lookup(Action{Name: "owner/repo", Ref: "v2"})
+	assert.Equal(t, fresh, false, "old state should be stale")
+	_, fresh = state.lookup(Action{Name: "owner/repo", Ref: "v3"})
+	assert.Equal(t, fresh, false, "unknown action should not be found")
+
+	// with no ttl (i.e. --force-refresh), no state is fresh, but it is
+	// still recorded
+	state, err = readState(valid, now, 0)
+	assert.NilError(t, err)
+	_, fresh = state.lookup(Action{Name: "owner/repo", Ref: "v1"})
+	assert.Equal(t, fresh, false, "state should never be fresh without a ttl")
+	assert.Equal(t, len(state.Actions), 2, "state should still be recorded")
+}
+
+func TestListSinceLastRun(t *testing.T) {
+	t.Parallel()
+
+	const (
+		commitA = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		commitB = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	)
+	newRoot := func() Root {
+		return Root{Workflows: map[string]Workflow{
+			"ci.yaml": {
+				FilePath: "ci.yaml",
+				Steps:    []Step{{LineNumber: 1, Action: Action{Name: "owner/repo", Ref: commitA}}},
+			},
+		}}
+	}
+	apiClient := func(t *testing.T) *GitHubClient {
+		return newTestClient(t, map[string]httpResponse{
+			// version tags
+			"2590b2f6ce": okResponse(`{
+				"data": {
+					"repository": {
+						"refs": {
+							"nodes": [
+								{"name": "v1.1.0", "target": {"oid": "` + commitB + `"}},
+								{"name": "v1.0.0", "target": {"oid": "` + commitA + `"}}
+							],
+							"pageInfo": {"hasNextPage": false, "endCursor": ""}
+						}
+					}
+				}
+			}`),
+			// releases
+			"6104c8d776": okResponse(`{
+				"data": {
+					"repository": {
+						"releases": {
+							"pageInfo": {"hasNextPage": false, "endCursor": ""},
+							"nodes": [
+								{"tag": {"target": {"oid": "` + commitB + `"}}, "tagName": "v1.1.0"},
+								{"tag": {"target": {"oid": "` + commitA + `"}}, "tagName": "v1.0.0"}
+							]
+						}
+					}
+				}
+			}`),
+		}, nil)
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	run := func(t *testing.T, client *GitHubClient, now time.Time) string {
+		t.Helper()
+		state, err := readState(path, now, 24*time.Hour)
+		assert.NilError(t, err)
+		engine := newEngine(newRoot(), client, io.Discard, engineOpts{TrustHashes: true, State: state})
+		var out strings.Builder
+		assert.NilError(t, engine.ListSinceLastRun(testCtx(), &out, state, now))
+		assert.NilError(t, writeState(path, state))
+		return out.String()
+	}
+
+	// the first run reports every available upgrade
+	out := run(t, apiClient(t), start)
+	assert.Equal(t, out, "1 new upgrade(s) since last run:\n  ci.yaml owner/repo@"+commitA+": "+commitA+" @ v1.0.0 → "+commitB+" @ v1.1.0\n", "incorrect first run output")
+
+	// a run within the ttl reuses the recorded state without any API
+	// requests, and the same upgrade is not reported again
+	out = run(t, newTestClient(t, nil, nil), start.Add(time.Hour))
+	assert.Equal(t, out, "no new upgrades since last run\n", "incorrect second run output")
+
+	// once the state is stale, actions are resolved again, and the state's
+	// resolution time is refreshed
+	out = run(t, apiClient(t), start.Add(48*time.Hour))
+	assert.Equal(t, out, "no new upgrades since last run\n", "incorrect third run output")
+	state, err := readState(path, start, 0)
+	assert.NilError(t, err)
+	entry := state.Actions["owner/repo@"+commitA]
+	assert.Equal(t, entry.ResolvedAt.Equal(start.Add(48*time.Hour)), true, "state should be refreshed, got "+entry.ResolvedAt.String())
+	assert.Equal(t, entry.Latest, stateRelease{Version: "v1.1.0", Commit: commitB}, "incorrect recorded latest release")
+}
+
+func TestFindDrift(t *testing.T) {
+	t.Parallel()
+
+	step := func(ref string, latest Release) Step {
+		return Step{Action: Action{
+			Name:              "owner/repo",
+			Ref:               ref,
+			Release:           Release{Version: ref, CommitHash: "c-" + ref},
+			UpgradeCandidates: UpgradeCandidates{Latest: latest},
+		}}
+	}
+	v2 := Release{Version: "v2", CommitHash: "c-v2"}
+	v3 := Release{Version: "v3", CommitHash: "c-v3"}
+	root := Root{Workflows: map[string]Workflow{
+		"ci.yaml": {FilePath: "ci.yaml", Steps: []Step{
+			step("v1", v3),   // newer upgrade than last time
+			step("v1.1", v2), // same upgrade as last time
+			step("v1.2", v2), // not recorded last time
+			step("v2", v2),   // already latest
+		}},
+	}}
+	state := &runState{Actions: map[string]actionState{
+		"owner/repo@v1":   {Latest: newStateRelease(v2)},
+		"owner/repo@v1.1": {Latest: newStateRelease(v2)},
+	}}
+
+	drifts := state.findDrift(root)
+	assert.Equal(t, len(drifts), 2, "incorrect number of drifts")
+	assert.Equal(t, drifts[0].Step.Action.Ref, "v1", "incorrect drift")
+	assert.Equal(t, drifts[0].Previous, v2, "incorrect previous release")
+	assert.Equal(t, drifts[1].Step.Action.Ref, "v1.2", "incorrect drift")
+	assert.Equal(t, drifts[1].Previous.Exists(), false, "unrecorded action should have no previous release")
+}
@@ -0,0 +1,79 @@
+package ghavm
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mccutchen/ghavm/internal/slogctx"
+)
+
+// maxTypoDistance is the largest edit distance between a missing repo and an
+// existing repo for the latter to be suggested as a fix for a typo.
+const maxTypoDistance = 3
+
+// suggestRepo returns the existing repo most similar to the given missing
+// repo (e.g. actions/checkout for actons/checkout), found via GitHub's repo
+// search, or an empty string if none is similar enough or e.suggestTypos is
+// not set.
+func (e *Engine) suggestRepo(ctx context.Context, repo string) string {
+	if !e.suggestTypos {
+		return ""
+	}
+	owner, name, _ := strings.Cut(repo, "/")
+	// a typo in the owner is found among repos with the same name, and a
+	// typo in the name among the owner's repos
+	var candidates []string
+	for _, query := range []string{name + " in:name", "user:" + owner} {
+		found, err := e.gh.SearchRepos(ctx, query)
+		if err != nil {
+			slogctx.Debug(ctx, "engine: failed to search for similar repos", "repo", repo, "query", query, "error", err)
+			continue
+		}
+		candidates = append(candidates, found...)
+	}
+	return closestRepo(repo, candidates)
+}
+
+// closestRepo returns the candidate with the smallest edit distance from the
+// given repo, ignoring case, or an empty string if no candidate is within
+// [maxTypoDistance] (or a third of the repo's length, for short names). Ties
+// go to the earliest candidate.
+func closestRepo(repo string, candidates []string) string {
+	var (
+		target   = strings.ToLower(repo)
+		limit    = min(maxTypoDistance, len(target)/3)
+		best     string
+		bestDist = limit + 1
+	)
+	for _, c := range candidates {
+		d := editDistance(target, strings.ToLower(c))
+		if d > 0 && d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b, i.e. the
+// number of single character insertions, deletions, or substitutions needed
+// to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
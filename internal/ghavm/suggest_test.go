@@ -0,0 +1,109 @@
+package ghavm
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestEditDistance(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"checkout", "checkout", 0},
+		{"", "abc", 3},
+		{"actons", "actions", 1},
+		{"chekcout", "checkout", 2},
+		{"kitten", "sitting", 3},
+		{"naïve", "naive", 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.a+"/"+tc.b, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, editDistance(tc.a, tc.b), tc.want, "incorrect distance")
+			assert.Equal(t, editDistance(tc.b, tc.a), tc.want, "distance should be symmetric")
+		})
+	}
+}
+
+func TestClosestRepo(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		repo       string
+		candidates []string
+		want       string
+	}{
+		"typo in owner": {
+			repo:       "actons/checkout",
+			candidates: []string{"someone/checkout", "actions/checkout", "actions/checkout-v2"},
+			want:       "actions/checkout",
+		},
+		"typo in name, ignoring case": {
+			repo:       "actions/Chekout",
+			candidates: []string{"actions/cache", "actions/checkout"},
+			want:       "actions/checkout",
+		},
+		"ties go to the first candidate": {
+			repo:       "owner/repo-x",
+			candidates: []string{"owner/repo-a", "owner/repo-b"},
+			want:       "owner/repo-a",
+		},
+		"nothing close enough": {
+			repo:       "actions/chekcout-and-more",
+			candidates: []string{"actions/checkout"},
+			want:       "",
+		},
+		"short names allow fewer typos": {
+			repo:       "a/bc",
+			candidates: []string{"xy/bc"},
+			want:       "",
+		},
+		"no candidates": {
+			repo: "actons/checkout",
+			want: "",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, closestRepo(tc.repo, tc.candidates), tc.want, "incorrect suggestion")
+		})
+	}
+}
+
+func TestSuggestTypos(t *testing.T) {
+	t.Parallel()
+
+	notFound := errResponse(http.StatusNotFound, `{"message": "Not Found"}`)
+	client := newTestClient(t, nil, map[string]httpResponse{
+		"GET /repos/actons/checkout/git/ref/heads/v4": notFound,
+		"GET /repos/actons/checkout/git/ref/tags/v4":  notFound,
+		"GET /repos/actons/checkout":                  notFound,
+		"GET /search/repositories?per_page=50&q=checkout+in%3Aname": okResponse(`{
+			"items": [{"full_name": "someone/checkout"}, {"full_name": "actions/checkout"}]
+		}`),
+		// the misspelled owner doesn't exist, so its repos can't be searched
+		"GET /search/repositories?per_page=50&q=user%3Aactons": errResponse(http.StatusUnprocessableEntity, `{"message": "Validation Failed"}`),
+	})
+
+	const input = "steps:\n  - uses: actons/checkout@v4\n"
+	path := writeTestWorkflow(t, input)
+	root, err := ScanWorkflows([]string{path}, scanOpts{})
+	assert.NilError(t, err)
+
+	var logs strings.Builder
+	engine := newEngine(root, client, &logs, engineOpts{SuggestTypos: true})
+	assert.NilError(t, engine.Pin(testCtx(), &logs, ModeCurrent))
+	assert.Contains(t, logs.String(), "repo actons/checkout not found; did you mean actions/checkout?", "missing suggestion")
+
+	// suggestions alone don't annotate the workflow
+	got, err := os.ReadFile(path) // #nosec G304
+	assert.NilError(t, err)
+	assert.Equal(t, string(got), input, "workflow should not be changed")
+}
@@ -0,0 +1,108 @@
+package ghavm
+
+import (
+	"context"
+	"strings"
+)
+
+// defaultTransitiveDepth is the default number of levels of transitive
+// dependencies listed by list --transitive.
+const defaultTransitiveDepth = 3
+
+// Dependency is an action used by a composite action, as found in the
+// composite action's action.yml, along with the actions it uses in turn.
+type Dependency struct {
+	Action string `json:"action"`
+	Ref    string `json:"ref"`
+	// Cycle is true if the action is already among the actions that
+	// (transitively) use it, so its dependencies are not listed again.
+	Cycle bool `json:"cycle,omitempty"`
+	// Truncated is true if the depth limit was reached, so the action's own
+	// dependencies, if any, were not looked for.
+	Truncated bool `json:"truncated,omitempty"`
+	// Error describes why the action's dependencies could not be found, e.g.
+	// because its action.yml could not be fetched.
+	Error        string       `json:"error,omitempty"`
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+// dependencyKey identifies an action at a ref, for cycle detection.
+func dependencyKey(name, ref string) string {
+	return canonicalName(name) + "@" + ref
+}
+
+// resolveDependencies finds the transitive dependencies of the step's
+// action, if it is a composite action, fetching the action.yml of each
+// composite action found up to e.transitive levels deep.
+//
+// Dependencies are informational only, so failures are logged as warnings
+// rather than failing the step.
+func (e *Engine) resolveDependencies(ctx context.Context, workflow Workflow, step *Step) {
+	a := step.Action
+	if a.IsReusableWorkflow() || !a.Release.Exists() {
+		return
+	}
+	e.phaseLog.Info(workflow, step, "finding transitive dependencies for commit %s", a.Release.CommitHash)
+	path := map[string]bool{
+		dependencyKey(a.Name, a.Ref):                true,
+		dependencyKey(a.Name, a.Release.CommitHash): true,
+	}
+	deps, err := e.dependenciesOf(ctx, a, a.Release.CommitHash, e.transitive, path)
+	if err != nil {
+		e.phaseLog.Warn(workflow, step, "could not find transitive dependencies: %s", err)
+		return
+	}
+	step.Dependencies = deps
+}
+
+// dependenciesOf returns the actions used by the given action at the given
+// ref if it is a composite action, along with their own dependencies up to
+// depth levels deep in total. The path holds the keys of the actions that
+// (transitively) use the given action, which are reported as cycles instead
+// of being followed again.
+//
+// Action metadata files are cached per action and ref by the client, so
+// actions used in many places are only fetched once.
+func (e *Engine) dependenciesOf(ctx context.Context, a Action, ref string, depth int, path map[string]bool) ([]Dependency, error) {
+	content, err := e.gh.GetActionMetadataFile(ctx, a, ref)
+	if err != nil {
+		return nil, err
+	}
+	if parseActionRuntime(content) != "composite" {
+		return nil, nil
+	}
+	var deps []Dependency
+	for _, used := range parseCompositeUses(content) {
+		dep := Dependency{Action: used.Name, Ref: used.Ref}
+		key := dependencyKey(used.Name, used.Ref)
+		switch {
+		case path[key]:
+			dep.Cycle = true
+		case depth <= 1:
+			dep.Truncated = true
+		default:
+			path[key] = true
+			deps, err := e.dependenciesOf(ctx, Action{Name: used.Name, Ref: used.Ref}, used.Ref, depth-1, path)
+			delete(path, key)
+			if err != nil {
+				dep.Error = err.Error()
+			}
+			dep.Dependencies = deps
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// parseCompositeUses returns the remote actions used by the steps of a
+// composite action, given the contents of its action.yml. Local actions
+// (e.g. ./my-action) and docker:// images are not remote actions.
+func parseCompositeUses(content string) []usesMatch {
+	var uses []usesMatch
+	for _, line := range strings.Split(content, "\n") {
+		if m, ok := parseUsesLine(line); ok {
+			uses = append(uses, m)
+		}
+	}
+	return uses
+}
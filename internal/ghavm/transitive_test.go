@@ -0,0 +1,128 @@
+package ghavm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+// actionFileResponse returns a contents API response for an action.yml file
+// with the given content.
+func actionFileResponse(t *testing.T, content string) httpResponse {
+	t.Helper()
+	body, err := json.Marshal(map[string]string{
+		"encoding": "base64",
+		"content":  base64.StdEncoding.EncodeToString([]byte(content)),
+	})
+	assert.NilError(t, err)
+	return okResponse(string(body))
+}
+
+func TestResolveDependencies(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	notFound := errResponse(http.StatusNotFound, `{"message": "Not Found"}`)
+	restEndpoints := map[string]httpResponse{
+		"GET /repos/owner/top/contents/action.yml?ref=" + commit: actionFileResponse(t, `
+runs:
+  using: composite
+  steps:
+    - uses: actions/checkout@v4
+    - uses: ./local-action
+    - uses: owner/mid@v1
+    - uses: owner/gone@v1
+`),
+		"GET /repos/actions/checkout/contents/action.yml?ref=v4": actionFileResponse(t, "runs:\n  using: node20\n"),
+		"GET /repos/owner/mid/contents/action.yml?ref=v1": actionFileResponse(t, `
+runs:
+  using: "composite"
+  steps:
+    - uses: owner/top@`+commit+` # v1.0.0
+    - name: leaf
+      uses: owner/leaf/sub@v3
+`),
+		"GET /repos/owner/leaf/contents/sub/action.yml?ref=v3": actionFileResponse(t, `
+runs:
+  using: composite
+  steps:
+    - uses: owner/deep@v1
+`),
+		"GET /repos/owner/gone/contents/action.yml?ref=v1":  notFound,
+		"GET /repos/owner/gone/contents/action.yaml?ref=v1": notFound,
+	}
+	client := newTestClient(t, nil, restEndpoints)
+	engine := newEngine(Root{}, client, io.Discard, engineOpts{TransitiveDepth: 3})
+	engine.phaseLog.StartPhase("testing")
+
+	step := &Step{Action: Action{Name: "owner/top", Ref: "v1", Release: Release{CommitHash: commit, Version: "v1.0.0"}}}
+	engine.resolveDependencies(testCtx(), Workflow{FilePath: "ci.yaml"}, step)
+	assert.DeepEqual(t, step.Dependencies, []Dependency{
+		{Action: "actions/checkout", Ref: "v4"},
+		{Action: "owner/mid", Ref: "v1", Dependencies: []Dependency{
+			{Action: "owner/top", Ref: commit, Cycle: true},
+			{Action: "owner/leaf/sub", Ref: "v3", Dependencies: []Dependency{
+				{Action: "owner/deep", Ref: "v1", Truncated: true},
+			}},
+		}},
+		{Action: "owner/gone", Ref: "v1", Error: "no action.yml or action.yaml found for owner/gone at ref v1"},
+	}, "incorrect dependencies")
+	assert.Equal(t, len(engine.phaseLog.diagnostics["ci.yaml"]), 0, "expected no warnings")
+
+	var out strings.Builder
+	engine.renderDependencies(&out, step.Dependencies)
+	assert.Equal(t, out.String(), `    uses:    actions/checkout@v4
+             owner/mid@v1
+               owner/top@`+commit+` (cycle)
+               owner/leaf/sub@v3
+                 owner/deep@v1 (depth limit reached)
+             owner/gone@v1 (could not find dependencies: no action.yml or action.yaml found for owner/gone at ref v1)
+`, "incorrect rendered dependencies")
+}
+
+func TestResolveDependenciesNotComposite(t *testing.T) {
+	t.Parallel()
+
+	const commit = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testCases := map[string]struct {
+		restEndpoints map[string]httpResponse
+		wantWarning   string
+	}{
+		"javascript action": {
+			restEndpoints: map[string]httpResponse{
+				"GET /repos/owner/repo/contents/action.yml?ref=" + commit: actionFileResponse(t, "runs:\n  using: node20\n  main: index.js\n"),
+			},
+		},
+		"missing metadata file": {
+			restEndpoints: map[string]httpResponse{
+				"GET /repos/owner/repo/contents/action.yml?ref=" + commit:  errResponse(http.StatusNotFound, `{"message": "Not Found"}`),
+				"GET /repos/owner/repo/contents/action.yaml?ref=" + commit: errResponse(http.StatusNotFound, `{"message": "Not Found"}`),
+			},
+			wantWarning: "could not find transitive dependencies: no action.yml or action.yaml found for owner/repo at ref " + commit,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := newTestClient(t, nil, tc.restEndpoints)
+			engine := newEngine(Root{}, client, io.Discard, engineOpts{TransitiveDepth: defaultTransitiveDepth})
+			engine.phaseLog.StartPhase("testing")
+
+			step := &Step{Action: Action{Name: "owner/repo", Ref: "v1", Release: Release{CommitHash: commit, Version: "v1.0.0"}}}
+			engine.resolveDependencies(testCtx(), Workflow{FilePath: "ci.yaml"}, step)
+			assert.Equal(t, len(step.Dependencies), 0, "expected no dependencies")
+			diagnostics := engine.phaseLog.diagnostics["ci.yaml"]
+			if tc.wantWarning == "" {
+				assert.Equal(t, len(diagnostics), 0, "expected no warnings")
+				return
+			}
+			assert.Equal(t, len(diagnostics), 1, "expected a warning")
+			assert.Equal(t, diagnostics[0].Msg, tc.wantWarning, "incorrect warning")
+		})
+	}
+}
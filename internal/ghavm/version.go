@@ -0,0 +1,146 @@
+package ghavm
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Some repos have changed tag schemes over time (e.g. from 1.2.3 to v1.2.3),
+// so versions are normalized to a canonical semver form before they are
+// compared. The original tag names are kept everywhere else, since they are
+// what gets written to workflow files.
+
+// canonicalVersion returns the semver form of a version tag, adding the "v"
+// prefix that tags like 1.2.3 lack, or an empty string if the tag is not a
+// semver version at all.
+func canonicalVersion(version string) string {
+	if semver.IsValid(version) {
+		return version
+	}
+	if !strings.HasPrefix(version, "v") && semver.IsValid("v"+version) {
+		return "v" + version
+	}
+	return ""
+}
+
+// isValidVersion returns true if the version is a semver version, with or
+// without a "v" prefix.
+func isValidVersion(version string) bool {
+	return canonicalVersion(version) != ""
+}
+
+// sameVersion returns true if the two versions are the same, ignoring any
+// difference in "v" prefixes (e.g. 4.2.0 and v4.2.0).
+func sameVersion(a, b string) bool {
+	canonical := canonicalVersion(a)
+	return a == b || (canonical != "" && canonicalVersion(b) == canonical)
+}
+
+// compareVersions compares two versions by their canonical forms, as
+// [semver.Compare] does. Invalid versions compare less than valid ones and
+// equal to each other.
+func compareVersions(a, b string) int {
+	return semver.Compare(canonicalVersion(a), canonicalVersion(b))
+}
+
+// majorVersion returns the canonical major version prefix (e.g. "v1") of a
+// version, or an empty string if it is invalid.
+func majorVersion(version string) string {
+	return semver.Major(canonicalVersion(version))
+}
+
+// majorMinorVersion returns the canonical major.minor version prefix (e.g.
+// "v1.2") of a version, or an empty string if it is invalid.
+func majorMinorVersion(version string) string {
+	return semver.MajorMinor(canonicalVersion(version))
+}
+
+// isCompleteVersion returns true if the version specifies its major, minor,
+// and patch versions, unlike a floating tag like v4 or v4.1.
+func isCompleteVersion(version string) bool {
+	v := canonicalVersion(version)
+	return v != "" && semver.Canonical(v) == strings.TrimSuffix(v, semver.Build(v))
+}
+
+// isPrerelease returns true if the version has a prerelease suffix (e.g.
+// v2.0.0-rc.1).
+func isPrerelease(version string) bool {
+	return semver.Prerelease(canonicalVersion(version)) != ""
+}
+
+// isStableVersion returns true if the given version is a valid version that
+// is not a prerelease.
+func isStableVersion(version string) bool {
+	return isValidVersion(version) && !isPrerelease(version)
+}
+
+// sortVersions sorts versions in increasing order, as [semver.Sort] does.
+// Versions that compare equal (e.g. v1 and v1.0.0, or 1.2.0 and v1.2.0) are
+// ordered by their original strings.
+func sortVersions(versions []string) {
+	slices.SortFunc(versions, func(a, b string) int {
+		if c := compareVersions(a, b); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+}
+
+// sortVersionsNewestFirst sorts versions in decreasing order, so that the
+// newest version comes first. Unlike reversing [sortVersions], ties between
+// distinct tags for the same version are broken deterministically, so that
+// the version chosen from several tags on one commit is stable across runs
+// and machines:
+//
+//   - a release sorts before its prereleases (e.g. v4.1.2 before
+//     v4.1.2-beta), as semver precedence requires
+//   - more specific tags sort first (e.g. v1.0.0 before v1.0 before v1)
+//   - canonical tags with a "v" prefix sort before tags without one (e.g.
+//     v1.2.0 before 1.2.0)
+//   - tags without build metadata sort before tags with it (e.g. v1.2.0
+//     before v1.2.0+build.1)
+//   - any remaining ties sort lexically (e.g. v1.2.0+a before v1.2.0+b)
+func sortVersionsNewestFirst(versions []string) {
+	slices.SortFunc(versions, func(a, b string) int {
+		if c := compareVersions(b, a); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(versionSpecificity(b), versionSpecificity(a)); c != 0 {
+			return c
+		}
+		if c := compareTrueFirst(strings.HasPrefix(a, "v"), strings.HasPrefix(b, "v")); c != 0 {
+			return c
+		}
+		if c := compareTrueFirst(semver.Build(canonicalVersion(a)) == "", semver.Build(canonicalVersion(b)) == ""); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+}
+
+// versionSpecificity returns the number of components in the core of a
+// version (e.g. 1 for v1 and 3 for v1.2.3-rc.1), or 0 if it is invalid.
+func versionSpecificity(version string) int {
+	v := canonicalVersion(version)
+	if v == "" {
+		return 0
+	}
+	v = strings.TrimSuffix(v, semver.Build(v))
+	v = strings.TrimSuffix(v, semver.Prerelease(v))
+	return strings.Count(v, ".") + 1
+}
+
+// compareTrueFirst compares two bools such that true sorts before false.
+func compareTrueFirst(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return -1
+	default:
+		return 1
+	}
+}
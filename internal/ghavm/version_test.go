@@ -0,0 +1,120 @@
+package ghavm
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestCanonicalVersion(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"v1.2.3":      "v1.2.3",
+		"1.2.3":       "v1.2.3",
+		"1.2":         "v1.2",
+		"v2":          "v2",
+		"2.0.0-rc.1":  "v2.0.0-rc.1",
+		"main":        "",
+		"vv1.2.3":     "",
+		"release-1.0": "",
+		"":            "",
+	}
+	for version, want := range testCases {
+		t.Run(version, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, canonicalVersion(version), want, "incorrect canonical version")
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		a, b string
+		want int
+	}{
+		"same scheme":           {"v1.2.0", "v1.10.0", -1},
+		"mixed schemes":         {"1.10.0", "v1.2.0", 1},
+		"equal across schemes":  {"1.2.0", "v1.2.0", 0},
+		"invalid sorts first":   {"main", "1.0.0", -1},
+		"both invalid are same": {"main", "dev", 0},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, compareVersions(tc.a, tc.b), tc.want, "incorrect comparison")
+		})
+	}
+}
+
+func TestSortVersions(t *testing.T) {
+	t.Parallel()
+	versions := []string{"v1.10.0", "1.9.0", "v1", "v1.0.0", "v2.0.0-rc.1", "1.2", "v2.0.0"}
+	sortVersions(versions)
+	assert.DeepEqual(t, versions, []string{"v1", "v1.0.0", "1.2", "1.9.0", "v1.10.0", "v2.0.0-rc.1", "v2.0.0"}, "incorrect order")
+}
+
+func TestSortVersionsNewestFirst(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		versions []string
+		want     []string
+	}{
+		"newest first": {
+			versions: []string{"v1.10.0", "1.9.0", "v2.0.0-rc.1", "v2.0.0"},
+			want:     []string{"v2.0.0", "v2.0.0-rc.1", "v1.10.0", "1.9.0"},
+		},
+		"release before prerelease of same version": {
+			versions: []string{"v4.1.2-beta", "v4.1.2"},
+			want:     []string{"v4.1.2", "v4.1.2-beta"},
+		},
+		"more specific first": {
+			versions: []string{"v1", "v1.0", "v1.0.0"},
+			want:     []string{"v1.0.0", "v1.0", "v1"},
+		},
+		"v prefix first": {
+			versions: []string{"1.2.0", "v1.2.0"},
+			want:     []string{"v1.2.0", "1.2.0"},
+		},
+		"no build metadata first": {
+			versions: []string{"v1.2.0+build.1", "v1.2.0"},
+			want:     []string{"v1.2.0", "v1.2.0+build.1"},
+		},
+		"remaining ties are lexical": {
+			versions: []string{"v1.2.0+b", "v1.2.0+a", "v1.2.0+c"},
+			want:     []string{"v1.2.0+a", "v1.2.0+b", "v1.2.0+c"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			// every input order must produce the same result
+			for range len(tc.versions) {
+				versions := slices.Clone(tc.versions)
+				sortVersionsNewestFirst(versions)
+				assert.DeepEqual(t, versions, tc.want, "incorrect order")
+				tc.versions = append(tc.versions[1:], tc.versions[0])
+			}
+		})
+	}
+}
+
+func TestIsCompleteVersion(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]bool{
+		"v1.2.3":       true,
+		"1.2.3":        true,
+		"v2.0.0-rc.1":  true,
+		"v1.2.3+build": true,
+		"v1":           false,
+		"v1.2":         false,
+		"main":         false,
+	}
+	for version, want := range testCases {
+		t.Run(version, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, isCompleteVersion(version), want, "incorrect result")
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package ghavm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// versionMap maps commits in action repos to their versions, as given via
+// --version-map, so that version comments can be populated deterministically
+// without looking up each commit's version tags via the API.
+//
+// A version map file is a JSON object whose keys identify a commit as
+// owner/repo@commit and whose values are versions, e.g.:
+//
+//	{"actions/checkout@11bd71901bbe5b1630ceea73d27597364c9af683": "v4.2.2"}
+type versionMap map[string]string
+
+// versionMapKey returns the key identifying a commit in a repo in a
+// [versionMap], which matches repo names case-insensitively, as GitHub does.
+func versionMapKey(repo, commit string) string {
+	return canonicalName(repo) + "@" + strings.ToLower(commit)
+}
+
+// readVersionMap reads the version map file at path.
+func readVersionMap(path string) (versionMap, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version map: %w", err)
+	}
+	var entries map[string]string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse version map %s: %w", path, err)
+	}
+	m := make(versionMap, len(entries))
+	for key, version := range entries {
+		repo, commit, _ := strings.Cut(key, "@")
+		if !strings.Contains(repo, "/") || !isFullCommitHash(commit) {
+			return nil, fmt.Errorf("invalid version map %s: key %q must be in owner/repo@commit format, with a full commit hash", path, key)
+		}
+		if !isValidVersion(version) {
+			return nil, fmt.Errorf("invalid version map %s: %q for %s is not a valid version", path, version, key)
+		}
+		m[versionMapKey(repo, commit)] = version
+	}
+	return m, nil
+}
+
+// lookup returns the version of the given commit in the given repo, if known.
+func (m versionMap) lookup(repo, commit string) (string, bool) {
+	version, ok := m[versionMapKey(repo, commit)]
+	return version, ok
+}
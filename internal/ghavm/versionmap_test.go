@@ -0,0 +1,67 @@
+package ghavm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestReadVersionMap(t *testing.T) {
+	t.Parallel()
+
+	const commit = "ABCDEF1234abcdef1234abcdef1234abcdef1234"
+	testCases := map[string]struct {
+		content string
+		want    versionMap
+		wantErr string
+	}{
+		"valid": {
+			content: `{"Actions/Checkout@` + commit + `": "v4.2.2"}`,
+			want:    versionMap{"actions/checkout@abcdef1234abcdef1234abcdef1234abcdef1234": "v4.2.2"},
+		},
+		"empty": {
+			content: `{}`,
+			want:    versionMap{},
+		},
+		"invalid json": {
+			content: `["oops"]`,
+			wantErr: "failed to parse version map",
+		},
+		"missing owner": {
+			content: `{"checkout@` + commit + `": "v4.2.2"}`,
+			wantErr: `key "checkout@` + commit + `" must be in owner/repo@commit format`,
+		},
+		"short commit": {
+			content: `{"actions/checkout@abcdef1": "v4.2.2"}`,
+			wantErr: `key "actions/checkout@abcdef1" must be in owner/repo@commit format`,
+		},
+		"invalid version": {
+			content: `{"actions/checkout@` + commit + `": "latest"}`,
+			wantErr: `"latest" for actions/checkout@` + commit + ` is not a valid version`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "versions.json")
+			assert.NilError(t, os.WriteFile(path, []byte(tc.content), 0o600))
+			got, err := readVersionMap(path)
+			if tc.wantErr != "" {
+				assert.Contains(t, err.Error(), tc.wantErr, "incorrect error")
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, got, tc.want, "incorrect version map")
+		})
+	}
+
+	t.Run("lookup is case-insensitive", func(t *testing.T) {
+		t.Parallel()
+		m := versionMap{versionMapKey("actions/checkout", commit): "v4.2.2"}
+		version, ok := m.lookup("Actions/Checkout", commit)
+		assert.Equal(t, ok, true, "expected commit to be found")
+		assert.Equal(t, version, "v4.2.2", "incorrect version")
+	})
+}
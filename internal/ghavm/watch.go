@@ -0,0 +1,86 @@
+package ghavm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+)
+
+// minWatchInterval is the shortest allowed interval between runs when
+// watching, to avoid burning through API rate limits.
+const minWatchInterval = time.Minute
+
+// clearScreen moves the cursor to the top left and clears the screen.
+const clearScreen = "\033[H\033[2J"
+
+// watchOpts configures [watch].
+type watchOpts struct {
+	// Interval is the time to wait between runs.
+	Interval time.Duration
+	// Clear redraws each run's output in place, instead of appending it
+	// below the previous run's output.
+	Clear bool
+	// now returns the current time, if set, for testing.
+	now func() time.Time
+}
+
+// watch calls run to render output to dst, then calls it again after each
+// interval until ctx is canceled, refreshing the client's cached releases and
+// tags between runs so that each run sees new releases.
+//
+// A failing run is reported in dst rather than ending the watch, since it is
+// likely to be transient (e.g. a network error). Before each run, the client's
+// rate limits are checked, and if either is nearly exhausted the next run is
+// delayed until it resets.
+func watch(ctx context.Context, dst io.Writer, gh *GitHubClient, opts watchOpts, run func(context.Context, io.Writer) error) error {
+	now := opts.now
+	if now == nil {
+		now = time.Now
+	}
+	for {
+		// render each run in full before writing it, so that a redraw
+		// replaces the previous output all at once
+		var buf bytes.Buffer
+		if err := run(ctx, &buf); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fprintf(&buf, "error: %s\n", err)
+		}
+
+		wait := opts.Interval
+		if limits, err := gh.GetRateLimits(ctx); err == nil {
+			if d := rateLimitWait(limits, now()); d > wait {
+				fprintf(&buf, "\nrate limit nearly exhausted, waiting until it resets\n")
+				wait = d
+			}
+		}
+
+		if opts.Clear {
+			fprint(dst, clearScreen)
+		}
+		fprint(dst, buf.String())
+		fprintf(dst, "\nlast updated %s, next update in %s (press ctrl-c to stop)\n", now().Format(time.TimeOnly), wait.Round(time.Second))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		gh.forgetReleases()
+	}
+}
+
+// rateLimitWait returns how long to wait for any nearly exhausted rate limit
+// to reset, or zero if none are. A rate limit is nearly exhausted when less
+// than a tenth of it remains.
+func rateLimitWait(limits RateLimits, now time.Time) time.Duration {
+	var wait time.Duration
+	for _, limit := range []RateLimit{limits.REST, limits.GraphQL} {
+		if limit.Limit > 0 && limit.Remaining < limit.Limit/10 {
+			wait = max(wait, limit.Reset.Sub(now))
+		}
+	}
+	return wait
+}
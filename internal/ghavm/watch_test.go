@@ -0,0 +1,107 @@
+package ghavm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	client := newTestClient(t, nil, map[string]httpResponse{
+		"GET /rate_limit": okResponse(`{"resources": {
+			"core": {"limit": 5000, "remaining": 4990, "reset": 1700000000},
+			"graphql": {"limit": 5000, "remaining": 5000, "reset": 1700000000}
+		}}`),
+	})
+	// stand in for cached tags, which must be forgotten between runs
+	_, _ = client.tagCache.Do(testCtx(), "owner/repo", func() ([]versionTag, error) { return nil, nil })
+	// stand in for a release set still being fetched in the background,
+	// whose producer must be stopped when it is forgotten between runs
+	setCtx, setCancel := context.WithCancel(testCtx())
+	set, _ := client.releaseSets.Do(testCtx(), "owner/repo", func() (*releaseSet, error) {
+		return &releaseSet{ctx: setCtx, cancel: setCancel, pages: make(chan releasesPage)}, nil
+	})
+
+	ctx, cancel := context.WithCancel(testCtx())
+	defer cancel()
+	var runs int
+	run := func(_ context.Context, dst io.Writer) error {
+		runs++
+		if runs > 1 {
+			_, cached := client.tagCache.Peek("owner/repo")
+			assert.Equal(t, cached, false, "cached tags should be forgotten between runs")
+			assert.Error(t, set.ctx.Err(), context.Canceled)
+		}
+		switch runs {
+		case 1:
+			fprintln(dst, "first run")
+		case 2:
+			return errors.New("network blip")
+		default:
+			fprintln(dst, "third run")
+			cancel()
+		}
+		return nil
+	}
+
+	var out strings.Builder
+	now := func() time.Time { return time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC) }
+	err := watch(ctx, &out, client, watchOpts{Interval: time.Millisecond, Clear: true, now: now}, run)
+	assert.NilError(t, err)
+	assert.Equal(t, runs, 3, "incorrect number of runs")
+
+	footer := "\nlast updated 12:30:00, next update in 0s (press ctrl-c to stop)\n"
+	want := clearScreen + "first run\n" + footer +
+		clearScreen + "error: network blip\n" + footer +
+		clearScreen + "third run\n" + footer
+	assert.Equal(t, out.String(), want, "incorrect output")
+}
+
+func TestRateLimitWait(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		limits RateLimits
+		want   time.Duration
+	}{
+		"plenty remaining": {
+			limits: RateLimits{
+				REST:    RateLimit{Limit: 5000, Remaining: 4000, Reset: now.Add(time.Hour)},
+				GraphQL: RateLimit{Limit: 5000, Remaining: 500, Reset: now.Add(time.Hour)},
+			},
+			want: 0,
+		},
+		"one nearly exhausted": {
+			limits: RateLimits{
+				REST:    RateLimit{Limit: 5000, Remaining: 4000, Reset: now.Add(time.Hour)},
+				GraphQL: RateLimit{Limit: 5000, Remaining: 499, Reset: now.Add(20 * time.Minute)},
+			},
+			want: 20 * time.Minute,
+		},
+		"both nearly exhausted": {
+			limits: RateLimits{
+				REST:    RateLimit{Limit: 5000, Remaining: 0, Reset: now.Add(30 * time.Minute)},
+				GraphQL: RateLimit{Limit: 5000, Remaining: 10, Reset: now.Add(20 * time.Minute)},
+			},
+			want: 30 * time.Minute,
+		},
+		"unknown limits": {
+			limits: RateLimits{},
+			want:   0,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, rateLimitWait(tc.limits, now), tc.want, "incorrect wait")
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package ghavm
 
-import "strings"
+import (
+	"slices"
+	"strings"
+)
 
 // Root is the root of a tree of worfklows and their steps.
 type Root struct {
@@ -22,17 +25,57 @@ func (r Root) StepCount() int {
 	return n
 }
 
+// withoutTemplated returns a copy of the root without any templated
+// workflows, along with the sorted paths of the workflows removed.
+func (r Root) withoutTemplated() (Root, []string) {
+	var (
+		kept    = Root{Workflows: make(map[string]Workflow, len(r.Workflows))}
+		removed []string
+	)
+	for key, w := range r.Workflows {
+		if w.Templated {
+			removed = append(removed, w.FilePath)
+			continue
+		}
+		kept.Workflows[key] = w
+	}
+	slices.Sort(removed)
+	return kept, removed
+}
+
 // Workflow captures the info needed to upgrade a workflow's steps
 type Workflow struct {
 	FilePath string
 	Steps    []Step
+	// Templated marks a templated workflow source (e.g. ci.yaml.j2) that
+	// renders to a real workflow. Its steps are reported, but not rewritten
+	// unless explicitly allowed, since rewriting could corrupt the template.
+	Templated bool
+	// Warnings describe problems found while scanning that caused steps to
+	// be skipped (e.g. a `uses:` value spanning multiple lines).
+	Warnings []string
 }
 
 // Step captures all of the information necessary to manage/replace a
 // single "- uses:" entry in a workflow.
 type Step struct {
 	LineNumber int
-	Action     Action
+	// The text of the step's `uses:` line as scanned, without its line
+	// ending, or empty if the step was not scanned from a single line
+	Line   string
+	Action Action
+	// The trailing comment on the `uses:` line, if any (e.g. a version hint)
+	Comment string
+	// The ref the action tracked before it was pinned, if recorded in its
+	// version comment (e.g. main, from "v4 (was:main)"), which is kept out
+	// of Comment
+	OriginalRef string
+	// Matrix is true if the step belongs to a job with a matrix strategy,
+	// so that it may run many times
+	Matrix bool
+	// The actions used by the step's action, if it is a composite action,
+	// which are only found if requested
+	Dependencies []Dependency
 }
 
 // Action represents an action and its version as found in the `uses`
@@ -46,10 +89,28 @@ type Action struct {
 	Ref string
 	// The current release, if any, resolved from the ref on disk
 	Release Release
+	// All semver tags pointing to the current release's commit, with the
+	// newest and most specific first
+	VersionTags []string
 	// The "resolved" version candidates (if any)
 	UpgradeCandidates UpgradeCandidates
+	// Whether the action's owner is an organization with a verified domain,
+	// if checked
+	Creator CreatorStatus
 }
 
+// CreatorStatus records whether an action's owner is an organization that
+// has verified a domain with GitHub (see [GitHubClient.IsVerifiedCreator]).
+type CreatorStatus int
+
+const (
+	// CreatorUnknown means the owner's verification has not been (or could
+	// not be) checked.
+	CreatorUnknown CreatorStatus = iota
+	CreatorVerified
+	CreatorUnverified
+)
+
 // Repo returns the repository part (owner/repo) from the action name,
 // stripping any additional path components that may be present in workflow
 // file references.
@@ -61,18 +122,119 @@ func (a Action) Repo() string {
 	return a.Name
 }
 
+// CanonicalName returns the action name with its owner/repo portion, which
+// GitHub treats case-insensitively, lowercased. Any path within the repo is
+// left untouched.
+func (a Action) CanonicalName() string {
+	return canonicalName(a.Name)
+}
+
+// RefKind classifies the ref an action is used at in a workflow file.
+type RefKind string
+
+const (
+	// RefKindCommit is a full commit hash, i.e. a pinned action.
+	RefKindCommit RefKind = "commit"
+	// RefKindVersion is a version tag (e.g. v4 or v4.1.2).
+	RefKindVersion RefKind = "version"
+	// RefKindOther is any other ref, usually a branch (e.g. main), but
+	// possibly a non-version tag or a shortened commit hash.
+	RefKindOther RefKind = "other"
+)
+
+// RefKind classifies the action's ref on disk. Classification does not use
+// the GitHub API, so a branch and a non-version tag are indistinguishable.
+func (a Action) RefKind() RefKind {
+	switch {
+	case isFullCommitHash(a.Ref):
+		return RefKindCommit
+	case isValidVersion(a.Ref):
+		return RefKindVersion
+	default:
+		return RefKindOther
+	}
+}
+
+// canonicalName lowercases the owner/repo portion of an action name or
+// pattern (e.g. "Actions/Checkout" becomes "actions/checkout").
+func canonicalName(name string) string {
+	parts := strings.SplitN(name, "/", 3)
+	for i := range min(len(parts), 2) {
+		parts[i] = strings.ToLower(parts[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// Owner returns the owner part of the action name (e.g. "actions" for
+// actions/checkout).
+func (a Action) Owner() string {
+	owner, _, _ := strings.Cut(a.Name, "/")
+	return owner
+}
+
+// Path returns the path component of the action name within its repository
+// (e.g. "path/to/action" for owner/repo/path/to/action), or an empty string
+// for actions defined at the root of their repository.
+func (a Action) Path() string {
+	parts := strings.SplitN(a.Name, "/", 3)
+	if len(parts) == 3 {
+		return parts[2]
+	}
+	return ""
+}
+
+// ReleaseURL returns the URL of the GitHub release page for the current
+// release, or an empty string if the current release has no version or its
+// version was not published as a release.
+func (a Action) ReleaseURL() string {
+	if a.Release.Version == "" || a.UpgradeCandidates.CurrentUnreleased {
+		return ""
+	}
+	return "https://github.com/" + a.Repo() + "/releases/tag/" + a.Release.Version
+}
+
+// IsReusableWorkflow returns true if the action refers to a reusable workflow
+// file rather than an action.
+func (a Action) IsReusableWorkflow() bool {
+	return strings.HasSuffix(a.Name, ".yml") || strings.HasSuffix(a.Name, ".yaml")
+}
+
 // UpgradeCandidates capture possible upgrade versions.
 type UpgradeCandidates struct {
 	// Absolute latest release
 	Latest Release
 	// Latest release in the same major version, presumed to be compatible
 	LatestCompatible Release
+	// Number of releases newer than the current release
+	ReleasesBehind int
+	// Whether the current release was found among the repo's releases with
+	// a valid signature
+	CurrentVerified bool
+	// Whether the current version is a tag that was never published as a
+	// release, e.g. because the repo switched from releases to plain tags,
+	// or whose releases were not consulted. Newer versions may then exist
+	// only as tags, which are not considered upgrade candidates unless tags
+	// are a version source (see [candidateOpts.VersionSource]).
+	CurrentUnreleased bool
+	// Newest stable release older than the current release, which is only
+	// recorded when no stable release is at least as new as the current
+	// release, i.e. when the current version is ahead of every stable
+	// release (e.g. a release candidate, or a release that was yanked)
+	LatestStable Release
 }
 
 // Release contains the info necessary to compare one release to another.
 type Release struct {
 	Version    string
 	CommitHash string
+	// Verified is true if the release's tag or commit has a valid signature.
+	// It is only known for upgrade candidates and for current releases whose
+	// upgrade candidates have been fetched.
+	Verified bool
+	// TreeHash is the hash of the commit's git tree, which identifies the
+	// exact content of the action at that commit. It is only known when
+	// tree hashes are requested (see [engineOpts]).
+	TreeHash string
 }
 
 func (r Release) String() string {
@@ -0,0 +1,118 @@
+package ghavm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// yamlNode is a line of a YAML document parsed by [parseSimpleYAML], along
+// with the lines nested under it.
+type yamlNode struct {
+	// Line is the line number of the node, starting at 1.
+	Line int
+	// Text is the content of the line, without indentation, list markers,
+	// or trailing comments, e.g. for error messages.
+	Text string
+	// Key and Value are the unquoted key and value of a "key: value" line,
+	// where Value is empty if the key introduces nested lines. A line that
+	// is not a "key: value" line has an empty Key and its unquoted content as
+	// its Value.
+	Key   string
+	Value string
+	// List is true if the node is a list item ("- value"). An item holding
+	// a mapping (e.g. "- key: value") has that first entry as its first
+	// child, followed by the rest of the mapping's entries.
+	List bool
+	// Children are the nodes nested under this one.
+	Children []*yamlNode
+
+	indent int
+}
+
+// IsKey returns true if the node is a "key: value" line.
+func (n *yamlNode) IsKey() bool {
+	return n.Key != ""
+}
+
+// parseSimpleYAML parses the small subset of YAML used by ghavm's own config
+// files and the parts of other tools' config files it reads: "key: value"
+// lines and "- value" list items, nested by indentation, with comments.
+// Unlike full YAML, there are no multi-line strings, anchors, or flow
+// collections, so e.g. ["a", "b"] is returned as a plain value for the caller
+// to interpret.
+//
+// List items may be indented under their key or not, as in YAML. Lines
+// nested under a key with a value, or under a list item that is not a
+// mapping, are reported as unexpected indentation.
+func parseSimpleYAML(content string) ([]*yamlNode, error) {
+	var (
+		root  yamlNode
+		stack = []*yamlNode{&root}
+	)
+	root.indent = -1
+	for i, line := range strings.Split(content, "\n") {
+		lineNum := i + 1
+		line, _, _ = strings.Cut(line, " #")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		item, isItem := strings.CutPrefix(trimmed, "-")
+		isItem = isItem && (item == "" || item[0] == ' ' || item[0] == '\t')
+
+		// a line belongs to the closest less indented line before it, except
+		// that list items may sit at the same indentation as their key
+		for {
+			top := stack[len(stack)-1]
+			if top.indent < indent || (top.indent == indent && isItem && top.IsKey() && top.Value == "" && !top.List) {
+				break
+			}
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		if (parent == &root && indent > 0) || (parent.IsKey() && parent.Value != "") || (parent.List && len(parent.Children) == 0) {
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNum)
+		}
+
+		if !isItem {
+			node := newYAMLNode(lineNum, trimmed, indent)
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+			continue
+		}
+		text := strings.TrimSpace(item)
+		node := &yamlNode{Line: lineNum, Text: text, Value: unquoteYAML(text), List: true, indent: indent}
+		parent.Children = append(parent.Children, node)
+		stack = append(stack, node)
+		// an item holding a mapping nests its entries at the column where its
+		// content starts
+		if entry := newYAMLNode(lineNum, text, indent+len(trimmed)-len(text)); entry.IsKey() {
+			node.Children = append(node.Children, entry)
+			stack = append(stack, entry)
+		}
+	}
+	return root.Children, nil
+}
+
+// newYAMLNode returns a node for the given line content, splitting it into a
+// key and value if it is a "key: value" line.
+func newYAMLNode(lineNum int, text string, indent int) *yamlNode {
+	node := &yamlNode{Line: lineNum, Text: text, indent: indent}
+	key, value, ok := strings.Cut(text, ": ")
+	if !ok {
+		key, ok = strings.CutSuffix(text, ":")
+	}
+	if !ok {
+		node.Value = unquoteYAML(text)
+		return node
+	}
+	node.Key, node.Value = unquoteYAML(strings.TrimSpace(key)), unquoteYAML(strings.TrimSpace(value))
+	return node
+}
+
+// unquoteYAML removes any quotes around a YAML scalar value.
+func unquoteYAML(value string) string {
+	return strings.Trim(value, `"'`)
+}
@@ -0,0 +1,108 @@
+package ghavm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mccutchen/ghavm/internal/testing/assert"
+)
+
+func TestParseSimpleYAML(t *testing.T) {
+	t.Parallel()
+
+	// summarize renders the parsed nodes one per line, indented by depth, so
+	// that the structure is easy to compare
+	var summarize func(b *strings.Builder, nodes []*yamlNode, depth int)
+	summarize = func(b *strings.Builder, nodes []*yamlNode, depth int) {
+		for _, n := range nodes {
+			prefix := ""
+			if n.List {
+				prefix = "- "
+			}
+			fprintf(b, "%s%d %s%q=%q\n", strings.Repeat("  ", depth), n.Line, prefix, n.Key, n.Value)
+			summarize(b, n.Children, depth+1)
+		}
+	}
+
+	testCases := map[string]struct {
+		content string
+		want    string
+		wantErr error
+	}{
+		"keys, lists, and comments": {
+			content: `# comment
+scalar: "quoted"  # trailing comment
+list:
+  - a
+  - 'b'
+unindented:
+- c
+mapping:
+  key: value
+`,
+			want: `2 "scalar"="quoted"
+3 "list"=""
+  4 - ""="a"
+  5 - ""="b"
+6 "unindented"=""
+  7 - ""="c"
+8 "mapping"=""
+  9 "key"="value"
+`,
+		},
+		"list of mappings": {
+			content: `updates:
+  - ecosystem: actions
+    dirs: ["/"]
+    ignore:
+      - name: foo
+        versions: ">=2"
+  - ecosystem: npm
+`,
+			want: `1 "updates"=""
+  2 - ""="ecosystem: actions"
+    2 "ecosystem"="actions"
+    3 "dirs"="[\"/\"]"
+    4 "ignore"=""
+      5 - ""="name: foo"
+        5 "name"="foo"
+        6 "versions"=">=2"
+  7 - ""="ecosystem: npm"
+    7 "ecosystem"="npm"
+`,
+		},
+		"bare values": {
+			content: "list:\n  not-an-item\n",
+			want:    "1 \"list\"=\"\"\n  2 \"\"=\"not-an-item\"\n",
+		},
+		"indented first line": {
+			content: "  key: value\n",
+			wantErr: errors.New("line 1: unexpected indentation"),
+		},
+		"nested under a value": {
+			content: "key: value\n  - item\n",
+			wantErr: errors.New("line 2: unexpected indentation"),
+		},
+		"nested under a scalar item": {
+			content: "list:\n  - item\n    nested: value\n",
+			wantErr: errors.New("line 3: unexpected indentation"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			nodes, err := parseSimpleYAML(tc.content)
+			if tc.wantErr != nil {
+				assert.Error(t, err, tc.wantErr)
+				return
+			}
+			assert.NilError(t, err)
+			var b strings.Builder
+			summarize(&b, nodes, 0)
+			if b.String() != tc.want {
+				t.Fatalf("incorrect nodes:\n\n%s", diffStrings(t, tc.want, b.String()))
+			}
+		})
+	}
+}